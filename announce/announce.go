@@ -0,0 +1,195 @@
+package announce
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/scenes"
+	"github.com/hilli/kefw2ui/speaker"
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// Announcement defaults.
+const (
+	// DefaultVolume is used when a request does not set a volume.
+	DefaultVolume = 35
+
+	// DefaultMaxDuration bounds how long an announcement may play before the
+	// previous state is restored anyway.
+	DefaultMaxDuration = 60 * time.Second
+
+	// MaxDuration is the upper limit for a requested maximum duration.
+	MaxDuration = 10 * time.Minute
+)
+
+// Request describes an announcement.
+type Request struct {
+	URL         string        // Clip URL the speaker fetches
+	Title       string        // Title shown while the clip plays
+	MimeType    string        // Optional; guessed from the URL when empty
+	Volume      int           // Announcement volume (0 = DefaultVolume), within quiet hours
+	MaxDuration time.Duration // Cut-off before restoring (0 = DefaultMaxDuration)
+}
+
+// Result reports what an announcement did.
+type Result struct {
+	Title    string        `json:"title"`
+	Volume   int           `json:"volume"`
+	Played   bool          `json:"played"`   // the speaker started the clip
+	Duration int64         `json:"duration"` // milliseconds from start to restore
+	Steps    []scenes.Step `json:"steps"`    // restore report
+}
+
+// Announcer plays announcements one at a time so that a second announcement
+// never captures the first one as the state to restore.
+type Announcer struct {
+	manager *speaker.Manager // sets the volume within quiet hours
+	mu      sync.Mutex
+}
+
+// NewAnnouncer creates an announcer.
+func NewAnnouncer(manager *speaker.Manager) *Announcer {
+	return &Announcer{manager: manager}
+}
+
+// Play interrupts the speaker with the clip in req at the announcement volume,
+// waits for it to finish, and then restores the previous power state, source,
+// volume, mute, queue, position and play/pause state.
+//
+// Play blocks until the previous state is restored. Callers serving HTTP
+// requests should detach ctx from the request so a disconnecting client does
+// not leave the speaker playing the clip.
+func (a *Announcer) Play(ctx context.Context, spk *kefw2.KEFSpeaker, req Request) (*Result, error) {
+	if err := stations.ValidateURL(req.URL); err != nil {
+		return nil, err
+	}
+	if req.Volume == 0 {
+		req.Volume = DefaultVolume
+	}
+	if req.Volume < 0 || req.Volume > 100 {
+		return nil, fmt.Errorf("volume must be between 0 and 100")
+	}
+	if req.MaxDuration <= 0 {
+		req.MaxDuration = DefaultMaxDuration
+	}
+	req.MaxDuration = min(req.MaxDuration, MaxDuration)
+	if req.Title == "" {
+		req.Title = "Announcement"
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, err := scenes.Capture(ctx, spk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture speaker state: %w", err)
+	}
+
+	setVolume := a.manager.VolumeSetter(spk, speaker.OriginAnnouncement)
+	result := &Result{Title: req.Title}
+	start := time.Now()
+
+	var playErr error
+	result.Volume, playErr = play(ctx, spk, state, req, setVolume)
+	if playErr == nil {
+		result.Played = waitForClip(ctx, spk, req.URL, req.MaxDuration)
+	}
+
+	result.Steps = scenes.Recall(ctx, spk, state, setVolume)
+
+	// The clip replaced the queue; when there was nothing to put back, clear
+	// it so the clip does not linger there
+	if state.Source == string(kefw2.SourceWiFi) && len(state.Queue) == 0 {
+		_ = kefw2.NewAirableClient(spk).ClearPlaylist()
+	}
+
+	result.Duration = time.Since(start).Milliseconds()
+
+	if playErr != nil {
+		return result, playErr
+	}
+	return result, nil
+}
+
+// play switches the speaker to WiFi at the announcement volume and starts the
+// clip. It returns the volume set, which quiet hours may have lowered.
+func play(ctx context.Context, spk *kefw2.KEFSpeaker, state scenes.State, req Request, setVolume speaker.VolumeSetter) (int, error) {
+	if state.Source != string(kefw2.SourceWiFi) {
+		if err := spk.SetSource(ctx, kefw2.SourceWiFi); err != nil {
+			return req.Volume, fmt.Errorf("failed to switch to WiFi: %w", err)
+		}
+		if err := waitForSource(ctx, spk, kefw2.SourceWiFi); err != nil {
+			return req.Volume, err
+		}
+	}
+
+	volume, err := setVolume(ctx, req.Volume)
+	if err != nil {
+		return volume, fmt.Errorf("failed to set volume: %w", err)
+	}
+	if state.Muted {
+		if err := spk.Unmute(ctx); err != nil {
+			return volume, fmt.Errorf("failed to unmute: %w", err)
+		}
+	}
+
+	item := stations.StreamItem(req.URL, req.Title, "", "", req.MimeType)
+	if err := kefw2.NewAirableClient(spk).PlayUPnPTracks([]kefw2.ContentItem{item}); err != nil {
+		return volume, fmt.Errorf("failed to play clip: %w", err)
+	}
+	return volume, nil
+}
+
+// waitForSource polls the speaker until it reports source, giving a speaker
+// that was in standby time to come up.
+func waitForSource(ctx context.Context, spk *kefw2.KEFSpeaker, source kefw2.Source) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if s, err := spk.Source(ctx); err == nil && s == source {
+			// Give the player subsystem a moment to initialize
+			time.Sleep(1 * time.Second)
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return fmt.Errorf("speaker did not switch to %s within 10s", source)
+}
+
+// waitForClip waits for the speaker to start playing clipURL and then for it
+// to finish, up to maxDuration. It reports whether the clip started.
+func waitForClip(ctx context.Context, spk *kefw2.KEFSpeaker, clipURL string, maxDuration time.Duration) bool {
+	playingClip := func() (bool, bool) {
+		pd, err := spk.PlayerData(ctx)
+		if err != nil {
+			return false, false
+		}
+		res := pd.MediaRoles.MediaData.Resources
+		isClip := len(res) > 0 && res[0].URI == clipURL
+		return isClip, pd.State == kefw2.PlayerStatePlaying
+	}
+
+	deadline := time.Now().Add(maxDuration)
+	startBy := time.Now().Add(10 * time.Second)
+
+	started := false
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			return started
+		}
+		isClip, playing := playingClip()
+		switch {
+		case !started && isClip && playing:
+			started = true
+		case started && (!isClip || !playing):
+			return true
+		case !started && time.Now().After(startBy):
+			return false
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return started
+}
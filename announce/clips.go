@@ -0,0 +1,203 @@
+// Package announce plays short announcement clips (doorbells, timers,
+// pre-rendered TTS) on a speaker and restores whatever was playing before.
+//
+// Clips live in a local library under the config directory and are served by
+// kefw2ui over HTTP so the speaker can fetch them.
+package announce
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// MaxClipSize is the largest clip the library accepts (20 MB).
+const MaxClipSize = 20 << 20
+
+// clipExtensions lists the audio formats the speaker can play from a URL.
+var clipExtensions = map[string]bool{
+	".mp3":  true,
+	".wav":  true,
+	".flac": true,
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+	".m4a":  true,
+	".aac":  true,
+}
+
+// Clip is an audio file in the clip library.
+type Clip struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mimeType"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Library manages the announcement clip directory.
+type Library struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewLibrary creates a clip library, creating its directory if needed.
+func NewLibrary() (*Library, error) {
+	dir, err := config.ClipsDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clips directory: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create clips directory: %w", err)
+	}
+
+	return &Library{dir: dir}, nil
+}
+
+// List returns all clips sorted by name.
+func (l *Library) List() ([]Clip, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clips directory: %w", err)
+	}
+
+	clips := []Clip{}
+	for _, entry := range entries {
+		if entry.IsDir() || ValidateName(entry.Name()) != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		clips = append(clips, clipFromInfo(info))
+	}
+
+	sort.Slice(clips, func(i, j int) bool {
+		return strings.ToLower(clips[i].Name) < strings.ToLower(clips[j].Name)
+	})
+	return clips, nil
+}
+
+// Get returns a clip by file name.
+func (l *Library) Get(name string) (*Clip, error) {
+	path, err := l.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("clip not found: %s", name)
+		}
+		return nil, fmt.Errorf("failed to read clip: %w", err)
+	}
+
+	clip := clipFromInfo(info)
+	return &clip, nil
+}
+
+// Path returns the file path of a clip. It does not check that the clip exists.
+func (l *Library) Path(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, name), nil
+}
+
+// Save writes a clip from r, replacing an existing clip with the same name.
+// Clips larger than MaxClipSize are rejected.
+func (l *Library) Save(name string, r io.Reader) (*Clip, error) {
+	path, err := l.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Write to a temporary file first so a failed upload never leaves a
+	// truncated clip behind
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clip: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	n, err := io.Copy(tmp, io.LimitReader(r, MaxClipSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write clip: %w", err)
+	}
+	if n > MaxClipSize {
+		return nil, fmt.Errorf("clip exceeds the %d MB limit", MaxClipSize>>20)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("clip is empty")
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save clip: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clip: %w", err)
+	}
+	clip := clipFromInfo(info)
+	return &clip, nil
+}
+
+// Delete removes a clip.
+func (l *Library) Delete(name string) error {
+	path, err := l.Path(name)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("clip not found: %s", name)
+		}
+		return fmt.Errorf("failed to delete clip: %w", err)
+	}
+	return nil
+}
+
+// ValidateName checks that name is a plain file name with a supported audio
+// extension, so it cannot escape the clip directory.
+func ValidateName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid clip name %q", name)
+	}
+	if !clipExtensions[strings.ToLower(filepath.Ext(name))] {
+		return fmt.Errorf("unsupported clip format %q (use mp3, wav, flac, ogg, opus, m4a or aac)", filepath.Ext(name))
+	}
+	return nil
+}
+
+func clipFromInfo(info os.FileInfo) Clip {
+	return Clip{
+		Name:      info.Name(),
+		Size:      info.Size(),
+		MimeType:  stations.GuessMimeType(info.Name()),
+		UpdatedAt: info.ModTime(),
+	}
+}
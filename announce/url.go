@@ -0,0 +1,37 @@
+package announce
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BaseURL returns the base URL at which a speaker can reach kefw2ui. An
+// explicit publicURL wins; otherwise the local address used to route to the
+// speaker is combined with port.
+func BaseURL(publicURL, speakerIP string, port int) (string, error) {
+	if publicURL != "" {
+		return strings.TrimRight(publicURL, "/"), nil
+	}
+
+	// Dialing UDP sends nothing; it only selects the outgoing interface
+	conn, err := net.Dial("udp", net.JoinHostPort(speakerIP, "80"))
+	if err != nil {
+		return "", fmt.Errorf("failed to find a local address reachable by the speaker: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return "", fmt.Errorf("failed to find a local address reachable by the speaker")
+	}
+
+	return "http://" + net.JoinHostPort(addr.IP.String(), strconv.Itoa(port)), nil
+}
+
+// ClipURL returns the URL of a clip served by kefw2ui under baseURL.
+func ClipURL(baseURL, name string) string {
+	return baseURL + "/api/clips/" + url.PathEscape(name)
+}
@@ -0,0 +1,273 @@
+// Package audit records who changed what on the speaker: REST requests, MCP
+// tool calls, MPD and MQTT commands, rule runs, kefw2ui's own adjustments,
+// and changes made with the physical remote or the KEF app. Entries are
+// appended to a rotating JSON lines file in the config directory.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// Entry sources.
+const (
+	SourceAPI     = "api"
+	SourceMCP     = "mcp"
+	SourceMPD     = "mpd"
+	SourceMQTT    = "mqtt"
+	SourceRule    = "rule"
+	SourceSystem  = "system"  // kefw2ui itself, e.g. quiet hours
+	SourceSpeaker = "speaker" // physical remote or KEF app
+)
+
+// Results.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+const (
+	// maxFileSize is the size at which the log is rotated
+	maxFileSize = 1 << 20
+
+	// maxFiles is the number of files kept, including the current one
+	maxFiles = 5
+
+	// DefaultLimit and MaxLimit bound the entries returned by Query
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Caller identifies who made a change.
+type Caller struct {
+	IP     string `json:"ip,omitempty"`
+	Name   string `json:"name,omitempty"`   // user, token or tailnet login
+	Method string `json:"method,omitempty"` // token, session, tailscale, ...
+	Role   string `json:"role,omitempty"`
+	Node   string `json:"node,omitempty"`   // tailnet node
+	Client string `json:"client,omitempty"` // MCP client name or MQTT client ID
+}
+
+// Entry is one recorded action.
+type Entry struct {
+	Time      time.Time      `json:"time"`
+	Source    string         `json:"source"`
+	Action    string         `json:"action"`
+	Params    map[string]any `json:"params,omitempty"`
+	Caller    Caller         `json:"caller"`
+	Speaker   string         `json:"speaker,omitempty"`
+	SpeakerIP string         `json:"speakerIp,omitempty"`
+	Result    string         `json:"result"`
+	Status    int            `json:"status,omitempty"` // HTTP status of REST requests
+	Error     string         `json:"error,omitempty"`
+}
+
+// Filter selects entries. Text filters match case-insensitive substrings.
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Source  string
+	Action  string
+	Caller  string // name, IP, node or client
+	Speaker string // name or IP
+	Result  string
+	Limit   int // DefaultLimit when 0
+}
+
+// Match reports whether the entry passes the filter.
+func (f Filter) Match(e Entry) bool {
+	contains := func(s, sub string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+	}
+	switch {
+	case !f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && e.Time.After(f.Until),
+		f.Source != "" && e.Source != f.Source,
+		f.Result != "" && e.Result != f.Result,
+		f.Action != "" && !contains(e.Action, f.Action),
+		f.Speaker != "" && !contains(e.Speaker, f.Speaker) && !contains(e.SpeakerIP, f.Speaker):
+		return false
+	}
+	if f.Caller != "" {
+		c := e.Caller
+		return contains(c.Name, f.Caller) || contains(c.IP, f.Caller) ||
+			contains(c.Node, f.Caller) || contains(c.Client, f.Caller)
+	}
+	return true
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying the caller of a request, so handlers
+// further down (MCP tools) can record it.
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFromContext returns the caller stored by WithCaller.
+func CallerFromContext(ctx context.Context) Caller {
+	c, _ := ctx.Value(callerKey{}).(Caller)
+	return c
+}
+
+// Log is the audit log.
+type Log struct {
+	manager *speaker.Manager
+
+	mu    sync.Mutex
+	path  string
+	local []time.Time // recent changes made through kefw2ui
+
+	// Last reported speaker state, to record only changes
+	state speakerState
+}
+
+// New opens the audit log in the config directory.
+func New(manager *speaker.Manager) (*Log, error) {
+	path, err := config.AuditPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log path: %w", err)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return &Log{manager: manager, path: path, state: speakerState{volume: -1}}, nil
+}
+
+// Record appends an entry. The time, result and active speaker are filled
+// in when not set.
+func (l *Log) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Result == "" {
+		e.Result = ResultOK
+		if e.Error != "" {
+			e.Result = ResultError
+		}
+	}
+	if e.Speaker == "" && l.manager != nil {
+		if spk := l.manager.GetActiveSpeaker(); spk != nil {
+			e.Speaker, e.SpeakerIP = spk.Name, spk.IPAddress
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Audit: failed to marshal entry: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e.Source != SourceSpeaker {
+		l.noteLocal(e.Time)
+	}
+	if err := l.rotate(len(data)); err != nil {
+		log.Printf("Audit: failed to rotate log: %v", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Audit: failed to open log: %v", err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(data); err != nil {
+		log.Printf("Audit: failed to write entry: %v", err)
+	}
+}
+
+// Query returns the entries matching f, newest first.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	if f.Limit <= 0 {
+		f.Limit = DefaultLimit
+	}
+	f.Limit = min(f.Limit, MaxLimit)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []Entry{}
+	for _, path := range l.files() {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		var lines [][]byte
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxFileSize)
+		for scanner.Scan() {
+			lines = append(lines, slices.Clone(scanner.Bytes()))
+		}
+		for _, line := range slices.Backward(lines) {
+			var e Entry
+			if json.Unmarshal(line, &e) != nil || !f.Match(e) {
+				continue
+			}
+			entries = append(entries, e)
+			if len(entries) == f.Limit {
+				return entries, nil
+			}
+		}
+	}
+	return entries, nil
+}
+
+// files returns the log files, newest first. Caller must hold l.mu.
+func (l *Log) files() []string {
+	files := []string{l.path}
+	for i := 1; i < maxFiles; i++ {
+		files = append(files, fmt.Sprintf("%s.%d", l.path, i))
+	}
+	return files
+}
+
+// rotate shifts the files along when appending n bytes would make the
+// current one too big. Caller must hold l.mu.
+func (l *Log) rotate(n int) error {
+	info, err := os.Stat(l.path)
+	if err != nil || info.Size()+int64(n) <= maxFileSize {
+		return nil
+	}
+
+	files := l.files()
+	for i := len(files) - 1; i > 0; i-- {
+		if err := os.Rename(files[i-1], files[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// speakerState is the last reported speaker state.
+type speakerState struct {
+	volume int // -1 until known
+	muted  *bool
+	source kefw2.Source
+	power  kefw2.SpeakerStatus
+	state  string
+}
@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2026, time.March, 14, 20, 0, 0, 0, time.UTC)
+	entry := Entry{
+		Time:      now,
+		Source:    SourceAPI,
+		Action:    "POST /api/volume",
+		Caller:    Caller{IP: "192.168.1.20", Name: "alice", Node: "laptop", Client: "Claude Desktop"},
+		Speaker:   "Living Room",
+		SpeakerIP: "192.168.1.50",
+		Result:    ResultOK,
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"since before", Filter{Since: now.Add(-time.Minute)}, true},
+		{"since equal", Filter{Since: now}, true},
+		{"since after", Filter{Since: now.Add(time.Second)}, false},
+		{"until after", Filter{Until: now.Add(time.Minute)}, true},
+		{"until before", Filter{Until: now.Add(-time.Second)}, false},
+		{"source", Filter{Source: SourceAPI}, true},
+		{"other source", Filter{Source: SourceMCP}, false},
+		{"source is exact", Filter{Source: "ap"}, false},
+		{"action substring ignores case", Filter{Action: "volume"}, true},
+		{"other action", Filter{Action: "mute"}, false},
+		{"result", Filter{Result: ResultOK}, true},
+		{"other result", Filter{Result: ResultError}, false},
+		{"speaker name", Filter{Speaker: "living"}, true},
+		{"speaker IP", Filter{Speaker: "1.50"}, true},
+		{"other speaker", Filter{Speaker: "kitchen"}, false},
+		{"caller name", Filter{Caller: "ALICE"}, true},
+		{"caller IP", Filter{Caller: "192.168.1.20"}, true},
+		{"caller node", Filter{Caller: "lap"}, true},
+		{"caller client", Filter{Caller: "claude"}, true},
+		{"other caller", Filter{Caller: "bob"}, false},
+		{"all conditions", Filter{Source: SourceAPI, Action: "volume", Caller: "alice", Speaker: "living", Result: ResultOK}, true},
+		{"one condition fails", Filter{Source: SourceAPI, Action: "volume", Caller: "bob"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(entry); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestLog(t *testing.T) *Log {
+	t.Helper()
+	return &Log{path: filepath.Join(t.TempDir(), "audit.log"), state: speakerState{volume: -1}}
+}
+
+func TestRecordDefaults(t *testing.T) {
+	l := newTestLog(t)
+	l.Record(Entry{Source: SourceMQTT, Action: "volume"})
+	l.Record(Entry{Source: SourceMQTT, Action: "mute", Error: "no active speaker"})
+
+	entries, err := l.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	// Newest first
+	if entries[0].Action != "mute" || entries[0].Result != ResultError {
+		t.Errorf("newest entry = %+v", entries[0])
+	}
+	if entries[1].Action != "volume" || entries[1].Result != ResultOK || entries[1].Time.IsZero() {
+		t.Errorf("oldest entry = %+v", entries[1])
+	}
+}
+
+func TestRotation(t *testing.T) {
+	l := newTestLog(t)
+
+	// Entries of about 100 KB, so roughly ten fit in a file
+	padding := strings.Repeat("x", 100<<10)
+	const n = 80
+	for i := range n {
+		l.Record(Entry{Source: SourceAPI, Action: fmt.Sprintf("action %d", i), Params: map[string]any{"padding": padding}})
+	}
+
+	for i, path := range l.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("file %d: %v", i, err)
+		}
+		if info.Size() > maxFileSize {
+			t.Errorf("%s is %d bytes, over the %d limit", filepath.Base(path), info.Size(), maxFileSize)
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", l.path, maxFiles)); !os.IsNotExist(err) {
+		t.Errorf("more than %d files kept", maxFiles)
+	}
+
+	entries, err := l.Query(Filter{Limit: MaxLimit})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	kept := len(entries)
+	if kept == 0 || kept >= n {
+		t.Fatalf("kept %d of %d entries, want the oldest rotated out", kept, n)
+	}
+	for i, e := range entries {
+		if want := fmt.Sprintf("action %d", n-1-i); e.Action != want {
+			t.Fatalf("entry %d is %q, want %q", i, e.Action, want)
+		}
+	}
+
+	limited, err := l.Query(Filter{Limit: 3})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(limited) != 3 || limited[0].Action != fmt.Sprintf("action %d", n-1) {
+		t.Errorf("Query with limit 3 = %d entries", len(limited))
+	}
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"slices"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// localWindow is how long after a change made through kefw2ui the speaker's
+// events are taken to be its echo rather than a change on the speaker
+const localWindow = 5 * time.Second
+
+// speakerCaller stands in for the person using the physical remote or the
+// KEF app, which the speaker doesn't identify.
+var speakerCaller = Caller{Name: "physical remote or app"}
+
+// HandleEvent records speaker state changes that weren't made through
+// kefw2ui, given the event and when it was published. The first report of
+// each value after connecting or switching speakers is only remembered.
+func (l *Log) HandleEvent(event speaker.Event, at time.Time) {
+	var entry *Entry
+
+	l.mu.Lock()
+	local := l.localAt(at)
+	st := &l.state
+	switch e := event.(type) {
+	case speaker.ActiveSpeakerChanged:
+		l.state = speakerState{volume: -1}
+
+	case speaker.VolumeChanged:
+		if st.volume != e.Volume {
+			if st.volume >= 0 {
+				entry = &Entry{Action: "volume", Params: map[string]any{"from": st.volume, "to": e.Volume}}
+			}
+			st.volume = e.Volume
+		}
+
+	case speaker.MuteChanged:
+		if st.muted == nil || *st.muted != e.Muted {
+			if st.muted != nil {
+				action := "unmute"
+				if e.Muted {
+					action = "mute"
+				}
+				entry = &Entry{Action: action}
+			}
+			muted := e.Muted
+			st.muted = &muted
+		}
+
+	case speaker.SourceChanged:
+		if st.source != e.Source {
+			if st.source != "" {
+				entry = &Entry{Action: "source", Params: map[string]any{"from": st.source, "to": e.Source}}
+			}
+			st.source = e.Source
+		}
+
+	case speaker.PowerChanged:
+		if st.power != e.Status {
+			if st.power != "" {
+				entry = &Entry{Action: "power", Params: map[string]any{"status": e.Status}}
+			}
+			st.power = e.Status
+		}
+
+	case speaker.PlayerChanged:
+		// Pausing and resuming are deliberate; stopping happens on its own
+		// at the end of the queue
+		previous := st.state
+		if e.State != "" {
+			st.state = e.State
+		}
+		switch {
+		case e.State == kefw2.PlayerStatePaused && previous == kefw2.PlayerStatePlaying:
+			entry = &Entry{Action: "pause"}
+		case e.State == kefw2.PlayerStatePlaying && previous == kefw2.PlayerStatePaused:
+			entry = &Entry{Action: "play"}
+		}
+	}
+	l.mu.Unlock()
+
+	if entry == nil || local {
+		return
+	}
+	entry.Source = SourceSpeaker
+	entry.Caller = speakerCaller
+	l.Record(*entry)
+}
+
+// NoteLocalChange marks that kefw2ui is about to change the speaker, so the
+// events that follow aren't recorded as changes on the speaker. Record does
+// the same; this covers changes recorded after they complete.
+func (l *Log) NoteLocalChange() {
+	l.mu.Lock()
+	l.noteLocal(time.Now())
+	l.mu.Unlock()
+}
+
+// noteLocal remembers a change made through kefw2ui at t. Must be called
+// with l.mu held.
+func (l *Log) noteLocal(t time.Time) {
+	// Events are handled shortly after they are published, so changes are
+	// kept a while longer than the window they match events in
+	cutoff := time.Now().Add(-2 * localWindow)
+	l.local = slices.DeleteFunc(l.local, func(c time.Time) bool { return c.Before(cutoff) })
+	l.local = append(l.local, t)
+}
+
+// localAt reports whether an event published at t followed a change made
+// through kefw2ui within localWindow. Changes made after t are reactions to
+// the event, not its cause. Must be called with l.mu held.
+func (l *Log) localAt(t time.Time) bool {
+	for _, c := range l.local {
+		if !c.After(t) && t.Sub(c) < localWindow {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Package auth provides optional authentication for the kefw2ui HTTP API:
+// API tokens, local users with session cookies, and the roles that decide
+// what a caller may do.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Role is a caller's access level. Each role includes the ones below it.
+type Role string
+
+const (
+	// RoleViewer can read status and subscribe to events.
+	RoleViewer Role = "viewer"
+
+	// RoleController can also control playback, the queue, playlists,
+	// stations, favorites, scenes and announcements.
+	RoleController Role = "controller"
+
+	// RoleAdmin can also change settings, manage speakers, reindex, and
+	// manage webhooks, rules, tokens and users.
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists the roles from least to most privileged.
+var Roles = []Role{RoleViewer, RoleController, RoleAdmin}
+
+// ParseRole validates a role name.
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if !slices.Contains(Roles, role) {
+		return "", fmt.Errorf("unknown role %q (expected viewer, controller or admin)", s)
+	}
+	return role, nil
+}
+
+// Allows reports whether the role includes the required role.
+func (r Role) Allows(required Role) bool {
+	have := slices.Index(Roles, r)
+	return have >= 0 && have >= slices.Index(Roles, required)
+}
+
+// Authentication methods.
+const (
+	MethodToken     = "token"
+	MethodSession   = "session"
+	MethodPassword  = "password" // Subsonic u/p credentials
+	MethodAnonymous = "anonymous"
+	MethodTailscale = "tailscale" // tailnet user or node, see the Tailscale ACL
+)
+
+// Identity is an authenticated caller. Tailnet callers without a role in
+// the Tailscale ACL have an empty Role.
+type Identity struct {
+	Name   string `json:"name"`
+	Role   Role   `json:"role"`
+	Method string `json:"method"`
+	Node   string `json:"node,omitempty"` // tailnet node name
+}
+
+// String describes the caller for logs, e.g. "alice@github (tailscale)".
+func (id *Identity) String() string {
+	name := id.Name
+	if id.Node != "" && id.Node != id.Name {
+		name += " on " + id.Node
+	}
+	return name + " (" + id.Method + ")"
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a context carrying the caller's identity.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the caller's identity, or nil when the request was not
+// authenticated (or authentication is disabled).
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,410 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/hilli/kefw2ui/config"
+)
+
+const (
+	// TokenPrefix starts every API token, so leaked tokens are easy to
+	// recognise
+	TokenPrefix = "kefw2ui_"
+
+	// SessionTTL is how long a login session lasts
+	SessionTTL = 7 * 24 * time.Hour
+
+	// MinPasswordLength is the shortest accepted user password
+	MinPasswordLength = 8
+
+	// lastUsedInterval limits how often token use is written to disk
+	lastUsedInterval = time.Hour
+)
+
+// ErrInvalidCredentials is returned for a failed login.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Token is an API token. Only a hash of the token is stored; the token
+// itself is shown once, when it is created.
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	Prefix    string     `json:"prefix"` // first characters, to tell tokens apart
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+}
+
+// User is a local user who logs in with a password.
+type User struct {
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// storeFile is the on-disk format of auth.json.
+type storeFile struct {
+	Tokens []Token `json:"tokens"`
+	Users  []User  `json:"users"`
+}
+
+// session is a logged-in user.
+type session struct {
+	username string
+	expires  time.Time
+}
+
+// Store holds API tokens and users (persisted in auth.json) and login
+// sessions (in memory; they end when kefw2ui restarts).
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	data     storeFile
+	sessions map[string]session
+}
+
+// NewStore loads the tokens and users from the config directory.
+func NewStore() (*Store, error) {
+	path, err := config.AuthPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth path: %w", err)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	s := &Store{path: path, sessions: make(map[string]session)}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read auth file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.data); err != nil {
+			return nil, fmt.Errorf("failed to parse auth file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Tokens returns all tokens without their hashes.
+func (s *Store) Tokens() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]Token, len(s.data.Tokens))
+	for i, t := range s.data.Tokens {
+		t.Hash = ""
+		tokens[i] = t
+	}
+	return tokens
+}
+
+// CreateToken creates a token and returns it along with the secret token
+// value, which is not stored.
+func (s *Store) CreateToken(name string, role Role) (*Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, "", err
+	}
+	value := TokenPrefix + secret
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := Token{
+		ID:        id,
+		Name:      name,
+		Role:      role,
+		Prefix:    value[:len(TokenPrefix)+4],
+		Hash:      hashToken(value),
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Tokens = append(s.data.Tokens, token)
+	if err := s.save(); err != nil {
+		s.data.Tokens = s.data.Tokens[:len(s.data.Tokens)-1]
+		return nil, "", err
+	}
+
+	token.Hash = ""
+	return &token, value, nil
+}
+
+// DeleteToken revokes a token.
+func (s *Store) DeleteToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.data.Tokens, func(t Token) bool { return t.ID == id })
+	if i < 0 {
+		return fmt.Errorf("token not found: %s", id)
+	}
+	removed := s.data.Tokens[i]
+	s.data.Tokens = slices.Delete(s.data.Tokens, i, i+1)
+	if removed.Role == RoleAdmin && !s.hasAdmin() {
+		s.data.Tokens = slices.Insert(s.data.Tokens, i, removed)
+		return fmt.Errorf("cannot remove the last admin")
+	}
+	return s.save()
+}
+
+// AuthenticateToken returns the identity of a token value, or nil when the
+// token is unknown.
+func (s *Store) AuthenticateToken(value string) *Identity {
+	if !strings.HasPrefix(value, TokenPrefix) {
+		return nil
+	}
+	hash := []byte(hashToken(value))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Tokens {
+		t := &s.data.Tokens[i]
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) != 1 {
+			continue
+		}
+
+		now := time.Now()
+		if t.LastUsed == nil || now.Sub(*t.LastUsed) > lastUsedInterval {
+			t.LastUsed = &now
+			_ = s.save() // best effort
+		}
+		return &Identity{Name: t.Name, Role: t.Role, Method: MethodToken}
+	}
+	return nil
+}
+
+// Users returns all users without their password hashes.
+func (s *Store) Users() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]User, len(s.data.Users))
+	for i, u := range s.data.Users {
+		u.PasswordHash = ""
+		users[i] = u
+	}
+	return users
+}
+
+// SetUser creates a user or updates an existing one. An empty password or
+// role leaves the current value unchanged; both are required for new users.
+func (s *Store) SetUser(username, password string, role Role) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || strings.ContainsAny(username, "/ ") {
+		return nil, fmt.Errorf("username must be non-empty without spaces or slashes")
+	}
+	if role != "" {
+		if _, err := ParseRole(string(role)); err != nil {
+			return nil, err
+		}
+	}
+	var hash string
+	if password != "" {
+		if len(password) < MinPasswordLength {
+			return nil, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		hash = string(h)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.data.Users, func(u User) bool { return u.Username == username })
+	if i < 0 {
+		if hash == "" || role == "" {
+			return nil, fmt.Errorf("password and role are required for a new user")
+		}
+		s.data.Users = append(s.data.Users, User{
+			Username:  username,
+			Role:      role,
+			CreatedAt: time.Now(),
+		})
+		i = len(s.data.Users) - 1
+	}
+
+	previous := s.data.Users[i]
+	user := &s.data.Users[i]
+	if hash != "" {
+		user.PasswordHash = hash
+	}
+	if role != "" {
+		user.Role = role
+	}
+	if previous.Role == RoleAdmin && !s.hasAdmin() {
+		*user = previous
+		return nil, fmt.Errorf("cannot remove the last admin")
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	result := *user
+	result.PasswordHash = ""
+	return &result, nil
+}
+
+// DeleteUser removes a user and ends their sessions.
+func (s *Store) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.data.Users, func(u User) bool { return u.Username == username })
+	if i < 0 {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	removed := s.data.Users[i]
+	s.data.Users = slices.Delete(s.data.Users, i, i+1)
+	if removed.Role == RoleAdmin && !s.hasAdmin() {
+		s.data.Users = slices.Insert(s.data.Users, i, removed)
+		return fmt.Errorf("cannot remove the last admin")
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	for id, sess := range s.sessions {
+		if sess.username == username {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// CheckPassword returns the identity of a user whose password matches.
+func (s *Store) CheckPassword(username, password string) (*Identity, error) {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.data.Users, func(u User) bool { return u.Username == username })
+	var user User
+	if i >= 0 {
+		user = s.data.Users[i]
+	}
+	s.mu.Unlock()
+
+	// bcrypt is slow on purpose; don't hold the lock while comparing
+	if i < 0 || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Name: user.Username, Role: user.Role, Method: MethodPassword}, nil
+}
+
+// Login checks a user's password and starts a session. It returns the
+// session ID for the cookie and when the session expires.
+func (s *Store) Login(username, password string) (*Identity, string, time.Time, error) {
+	id, err := s.CheckPassword(username, password)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	sessionID, err := randomHex(32)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	expires := time.Now().Add(SessionTTL)
+
+	s.mu.Lock()
+	s.sessions[sessionID] = session{username: username, expires: expires}
+	s.mu.Unlock()
+
+	id.Method = MethodSession
+	return id, sessionID, expires, nil
+}
+
+// Session returns the identity of a session, or nil when it has expired or
+// the user no longer exists. The role is looked up on every call, so role
+// changes take effect immediately.
+func (s *Store) Session(sessionID string) *Identity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, sessionID)
+		return nil
+	}
+	i := slices.IndexFunc(s.data.Users, func(u User) bool { return u.Username == sess.username })
+	if i < 0 {
+		return nil
+	}
+	return &Identity{Name: sess.username, Role: s.data.Users[i].Role, Method: MethodSession}
+}
+
+// Logout ends a session.
+func (s *Store) Logout(sessionID string) {
+	s.mu.Lock()
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+}
+
+// hasAdmin reports whether any user or token has the admin role, so the
+// last admin can't be removed or demoted. Caller must hold s.mu.
+func (s *Store) hasAdmin() bool {
+	return slices.ContainsFunc(s.data.Users, func(u User) bool { return u.Role == RoleAdmin }) ||
+		slices.ContainsFunc(s.data.Tokens, func(t Token) bool { return t.Role == RoleAdmin })
+}
+
+// save writes the tokens and users to disk. Caller must hold s.mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal auth file: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write auth file: %w", err)
+	}
+
+	return nil
+}
+
+// hashToken returns the stored form of a token value.
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
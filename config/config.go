@@ -1,9 +1,15 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -35,6 +41,172 @@ type UPnPConfig struct {
 	// IndexContainer is the container path for search indexing scope
 	// Tip: Use "By Folder" structure for best results
 	IndexContainer string `yaml:"index_container,omitempty"`
+
+	// Bookmarks are named shortcuts to containers, possibly on different servers
+	Bookmarks []UPnPBookmark `yaml:"bookmarks,omitempty"`
+}
+
+// UPnPBookmark is a named shortcut to a container on a UPnP media server.
+type UPnPBookmark struct {
+	// ID is a URL-safe identifier derived from the name
+	ID   string `yaml:"id" json:"id"`
+	Name string `yaml:"name" json:"name"`
+
+	// ServerName is the display name of the media server
+	ServerName string `yaml:"server_name,omitempty" json:"serverName,omitempty"`
+
+	// ServerPath is the API path to the media server (defaults to the default server)
+	ServerPath string `yaml:"server_path,omitempty" json:"serverPath,omitempty"`
+
+	// Container is the human-readable container path, e.g. "Vinyl rips/Jazz"
+	Container string `yaml:"container,omitempty" json:"container,omitempty"`
+
+	// Path is an API container path. When set it is used directly instead of
+	// resolving Container on the server.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// WebhookConfig is an outbound webhook that receives speaker events.
+type WebhookConfig struct {
+	// ID is a URL-safe identifier derived from the name
+	ID   string `yaml:"id" json:"id"`
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+
+	// Secret is the HMAC-SHA256 key for the delivery signature; generated
+	// when empty
+	Secret string `yaml:"secret" json:"secret"`
+
+	// Events lists the event types to deliver; empty means all
+	Events []string `yaml:"events,omitempty" json:"events"`
+
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled"`
+}
+
+// SourcePreset is the state remembered for one source of a speaker.
+type SourcePreset struct {
+	// Restore applies the remembered volume when the source comes on, and
+	// RestoreMute the remembered mute state as well
+	Restore     bool `yaml:"restore,omitempty" json:"restore"`
+	RestoreMute bool `yaml:"restore_mute,omitempty" json:"restoreMute"`
+
+	// Volume and Muted are the last state seen on the source; Volume is nil
+	// until the source has been used
+	Volume *int `yaml:"volume,omitempty" json:"volume"`
+	Muted  bool `yaml:"muted,omitempty" json:"muted"`
+}
+
+// QuietHours caps the volume during a daily local time window.
+type QuietHours struct {
+	// Start and End are "HH:MM"; an End before Start wraps past midnight
+	Start     string `yaml:"start" json:"start"`
+	End       string `yaml:"end" json:"end"`
+	MaxVolume int    `yaml:"max_volume" json:"maxVolume"`
+	Disabled  bool   `yaml:"disabled,omitempty" json:"disabled"`
+}
+
+// Validate checks the window's times and cap.
+func (q QuietHours) Validate() error {
+	if _, err := ParseTimeWindow(q.Start, q.End); err != nil {
+		return err
+	}
+	if q.Start == q.End {
+		return fmt.Errorf("quiet hours start and end must differ")
+	}
+	if q.MaxVolume < 0 || q.MaxVolume > 100 {
+		return fmt.Errorf("quiet hours max volume must be between 0 and 100")
+	}
+	return nil
+}
+
+// Active reports whether t falls in the window.
+func (q QuietHours) Active(t time.Time) bool {
+	if q.Disabled {
+		return false
+	}
+	w, err := ParseTimeWindow(q.Start, q.End)
+	return err == nil && w.Contains(t)
+}
+
+// TimeWindow is a daily time window from Start up to End, in minutes since
+// local midnight. An End before Start wraps past midnight.
+type TimeWindow struct {
+	Start, End int
+}
+
+// ParseTimeWindow parses the "HH:MM" start and end of a time window.
+func ParseTimeWindow(start, end string) (TimeWindow, error) {
+	var w TimeWindow
+	var err error
+	if w.Start, err = clockMinutes(start); err != nil {
+		return TimeWindow{}, err
+	}
+	if w.End, err = clockMinutes(end); err != nil {
+		return TimeWindow{}, err
+	}
+	return w, nil
+}
+
+// Contains reports whether t's local time of day falls in the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	t = t.Local()
+	minute := t.Hour()*60 + t.Minute()
+	if w.Start <= w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// clockMinutes parses "HH:MM" into minutes since midnight.
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// SpeakerSettings holds kefw2ui's own per-speaker settings (the CLI's
+// SpeakerConfig is left as is).
+type SpeakerSettings struct {
+	// SourcePresets are keyed by source name (wifi, bluetooth, tv, ...)
+	SourcePresets map[string]SourcePreset `yaml:"source_presets,omitempty"`
+
+	// QuietHours are volume caps by time of day
+	QuietHours []QuietHours `yaml:"quiet_hours,omitempty"`
+}
+
+// TailscaleACL maps callers on the Tailscale listener to kefw2ui roles
+// (viewer, controller, admin). Rules are checked in order and the first
+// match wins; callers no rule matches get DefaultRole, or no access when it
+// is empty.
+type TailscaleACL struct {
+	DefaultRole string             `yaml:"default_role,omitempty" json:"defaultRole,omitempty"`
+	Rules       []TailscaleACLRule `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// TailscaleACLRule grants a role to callers matching any of its user login
+// names (alice@github), node names (kids-ipad) or node tags (tag:kiosk).
+type TailscaleACLRule struct {
+	Users []string `yaml:"users,omitempty" json:"users,omitempty"`
+	Nodes []string `yaml:"nodes,omitempty" json:"nodes,omitempty"`
+	Tags  []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Role  string   `yaml:"role" json:"role"`
+}
+
+// Role returns the role for a tailnet caller. Names are compared without
+// regard to case.
+func (a *TailscaleACL) Role(user, node string, tags []string) string {
+	matches := func(list []string, value string) bool {
+		return value != "" && slices.ContainsFunc(list, func(s string) bool { return strings.EqualFold(s, value) })
+	}
+	for _, rule := range a.Rules {
+		if matches(rule.Users, user) || matches(rule.Nodes, node) ||
+			slices.ContainsFunc(tags, func(tag string) bool { return matches(rule.Tags, tag) }) {
+			return rule.Role
+		}
+	}
+	return a.DefaultRole
 }
 
 // Config holds the application configuration (compatible with kefw2 CLI).
@@ -43,6 +215,13 @@ type Config struct {
 	DefaultSpeaker string          `yaml:"defaultspeaker,omitempty"`
 	Speakers       []SpeakerConfig `yaml:"speakers,omitempty"`
 	UPnP           UPnPConfig      `yaml:"upnp,omitempty"`
+	Webhooks       []WebhookConfig `yaml:"webhooks,omitempty"`
+
+	// SpeakerSettings are keyed by speaker IP address
+	SpeakerSettings map[string]SpeakerSettings `yaml:"speaker_settings,omitempty"`
+
+	// TailscaleACL assigns roles to tailnet callers (nil when not set)
+	TailscaleACL *TailscaleACL `yaml:"tailscale_acl,omitempty"`
 }
 
 // DefaultConfig returns a config with sensible defaults.
@@ -79,6 +258,70 @@ func PlaylistsDir() (string, error) {
 	return filepath.Join(dir, "playlists"), nil
 }
 
+// StationsPath returns the path to the custom radio stations file.
+func StationsPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "stations.json"), nil
+}
+
+// FavoritesPath returns the path to the local favorites file.
+func FavoritesPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "favorites.json"), nil
+}
+
+// ScenesPath returns the path to the saved scenes file.
+func ScenesPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scenes.json"), nil
+}
+
+// RulesPath returns the path to the automation rules file.
+func RulesPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rules.json"), nil
+}
+
+// AuthPath returns the path to the API tokens and users file.
+func AuthPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auth.json"), nil
+}
+
+// AuditPath returns the path to the audit log. Rotated files get a numeric
+// suffix (audit.log.1 is the newest).
+func AuditPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// ClipsDir returns the path to the announcement clip library.
+func ClipsDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clips"), nil
+}
+
 // Load reads the config file from disk.
 func Load() (*Config, error) {
 	path, err := Path()
@@ -250,3 +493,346 @@ func (c *Config) HasDefaultServer() bool {
 	defer c.mu.RUnlock()
 	return c.UPnP.DefaultServerPath != ""
 }
+
+// GetUPnPBookmarks returns all UPnP folder bookmarks.
+func (c *Config) GetUPnPBookmarks() []UPnPBookmark {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]UPnPBookmark, len(c.UPnP.Bookmarks))
+	copy(result, c.UPnP.Bookmarks)
+	return result
+}
+
+// FindUPnPBookmark finds a bookmark by ID.
+func (c *Config) FindUPnPBookmark(id string) *UPnPBookmark {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := range c.UPnP.Bookmarks {
+		if c.UPnP.Bookmarks[i].ID == id {
+			b := c.UPnP.Bookmarks[i]
+			return &b
+		}
+	}
+	return nil
+}
+
+// AddUPnPBookmark adds a bookmark, assigning it a unique ID, and saves config.
+func (c *Config) AddUPnPBookmark(b UPnPBookmark) (UPnPBookmark, error) {
+	if b.Name == "" {
+		return b, fmt.Errorf("bookmark name is required")
+	}
+	if b.Container == "" && b.Path == "" {
+		return b, fmt.Errorf("bookmark container or path is required")
+	}
+
+	c.mu.Lock()
+	base := bookmarkID(b.Name)
+	b.ID = base
+	for n := 2; c.hasBookmarkID(b.ID); n++ {
+		b.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+	c.UPnP.Bookmarks = append(c.UPnP.Bookmarks, b)
+	c.mu.Unlock()
+
+	return b, c.Save()
+}
+
+// UpdateUPnPBookmark replaces the bookmark with the same ID and saves config.
+func (c *Config) UpdateUPnPBookmark(b UPnPBookmark) error {
+	c.mu.Lock()
+	found := false
+	for i := range c.UPnP.Bookmarks {
+		if c.UPnP.Bookmarks[i].ID == b.ID {
+			c.UPnP.Bookmarks[i] = b
+			found = true
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("bookmark not found: %s", b.ID)
+	}
+	return c.Save()
+}
+
+// RemoveUPnPBookmark removes a bookmark by ID and saves config.
+func (c *Config) RemoveUPnPBookmark(id string) error {
+	c.mu.Lock()
+	found := false
+	for i := range c.UPnP.Bookmarks {
+		if c.UPnP.Bookmarks[i].ID == id {
+			c.UPnP.Bookmarks = append(c.UPnP.Bookmarks[:i], c.UPnP.Bookmarks[i+1:]...)
+			found = true
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("bookmark not found: %s", id)
+	}
+	return c.Save()
+}
+
+// hasBookmarkID reports whether a bookmark with id exists. Caller must hold c.mu.
+func (c *Config) hasBookmarkID(id string) bool {
+	for _, b := range c.UPnP.Bookmarks {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// bookmarkID creates a URL-safe ID from a bookmark name.
+func bookmarkID(name string) string {
+	return slugID(name, "bookmark")
+}
+
+// slugID derives a URL-safe ID from a name, using fallback when the name has
+// no usable characters.
+func slugID(name, fallback string) string {
+	var result strings.Builder
+	lastHyphen := true
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			result.WriteRune(r)
+			lastHyphen = false
+		case !lastHyphen:
+			result.WriteRune('-')
+			lastHyphen = true
+		}
+	}
+
+	id := strings.Trim(result.String(), "-")
+	if id == "" {
+		id = fallback
+	}
+	return id
+}
+
+// GetWebhooks returns all configured webhooks.
+func (c *Config) GetWebhooks() []WebhookConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]WebhookConfig, len(c.Webhooks))
+	copy(result, c.Webhooks)
+	return result
+}
+
+// FindWebhook finds a webhook by ID.
+func (c *Config) FindWebhook(id string) *WebhookConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := range c.Webhooks {
+		if c.Webhooks[i].ID == id {
+			wh := c.Webhooks[i]
+			return &wh
+		}
+	}
+	return nil
+}
+
+// AddWebhook adds a webhook, assigning it a unique ID and (when empty) a
+// random secret, and saves config.
+func (c *Config) AddWebhook(wh WebhookConfig) (WebhookConfig, error) {
+	if wh.Name == "" {
+		return wh, fmt.Errorf("webhook name is required")
+	}
+	if wh.URL == "" {
+		return wh, fmt.Errorf("webhook URL is required")
+	}
+	if wh.Secret == "" {
+		secret, err := NewWebhookSecret()
+		if err != nil {
+			return wh, err
+		}
+		wh.Secret = secret
+	}
+
+	c.mu.Lock()
+	base := slugID(wh.Name, "webhook")
+	wh.ID = base
+	for n := 2; c.hasWebhookID(wh.ID); n++ {
+		wh.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+	c.Webhooks = append(c.Webhooks, wh)
+	c.mu.Unlock()
+
+	return wh, c.Save()
+}
+
+// UpdateWebhook replaces the webhook with the same ID and saves config.
+func (c *Config) UpdateWebhook(wh WebhookConfig) error {
+	c.mu.Lock()
+	found := false
+	for i := range c.Webhooks {
+		if c.Webhooks[i].ID == wh.ID {
+			c.Webhooks[i] = wh
+			found = true
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("webhook not found: %s", wh.ID)
+	}
+	return c.Save()
+}
+
+// RemoveWebhook removes a webhook by ID and saves config.
+func (c *Config) RemoveWebhook(id string) error {
+	c.mu.Lock()
+	found := false
+	for i := range c.Webhooks {
+		if c.Webhooks[i].ID == id {
+			c.Webhooks = append(c.Webhooks[:i], c.Webhooks[i+1:]...)
+			found = true
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("webhook not found: %s", id)
+	}
+	return c.Save()
+}
+
+// hasWebhookID reports whether a webhook with id exists. Caller must hold c.mu.
+func (c *Config) hasWebhookID(id string) bool {
+	for _, wh := range c.Webhooks {
+		if wh.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookSecret returns a random hex-encoded webhook signing secret.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetSourcePresets returns the source presets of a speaker.
+func (c *Config) GetSourcePresets(ip string) map[string]SourcePreset {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make(map[string]SourcePreset)
+	for source, p := range c.SpeakerSettings[ip].SourcePresets {
+		if p.Volume != nil {
+			v := *p.Volume
+			p.Volume = &v
+		}
+		result[source] = p
+	}
+	return result
+}
+
+// SetSourcePreset replaces a speaker's preset for a source and saves config.
+func (c *Config) SetSourcePreset(ip, source string, p SourcePreset) error {
+	c.mu.Lock()
+	c.setSourcePreset(ip, source, p)
+	c.mu.Unlock()
+	return c.Save()
+}
+
+// RememberSourceState records the last volume and mute state seen on a
+// speaker's source without saving; call Save to persist it. Nil values are
+// left unchanged. It reports whether anything changed.
+func (c *Config) RememberSourceState(ip, source string, volume *int, muted *bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.SpeakerSettings[ip].SourcePresets[source]
+	changed := false
+	if volume != nil && (p.Volume == nil || *p.Volume != *volume) {
+		v := *volume
+		p.Volume = &v
+		changed = true
+	}
+	if muted != nil && p.Muted != *muted {
+		p.Muted = *muted
+		changed = true
+	}
+	if changed {
+		c.setSourcePreset(ip, source, p)
+	}
+	return changed
+}
+
+// setSourcePreset stores a preset. Caller must hold c.mu.
+func (c *Config) setSourcePreset(ip, source string, p SourcePreset) {
+	if c.SpeakerSettings == nil {
+		c.SpeakerSettings = make(map[string]SpeakerSettings)
+	}
+	settings := c.SpeakerSettings[ip]
+	if settings.SourcePresets == nil {
+		settings.SourcePresets = make(map[string]SourcePreset)
+	}
+	settings.SourcePresets[source] = p
+	c.SpeakerSettings[ip] = settings
+}
+
+// GetQuietHours returns the quiet hours of a speaker.
+func (c *Config) GetQuietHours(ip string) []QuietHours {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	windows := c.SpeakerSettings[ip].QuietHours
+	result := make([]QuietHours, len(windows))
+	copy(result, windows)
+	return result
+}
+
+// SetQuietHours validates and replaces the quiet hours of a speaker, and
+// saves config.
+func (c *Config) SetQuietHours(ip string, windows []QuietHours) error {
+	for i, q := range windows {
+		if err := q.Validate(); err != nil {
+			return fmt.Errorf("quiet hours %d: %w", i+1, err)
+		}
+	}
+
+	c.mu.Lock()
+	if c.SpeakerSettings == nil {
+		c.SpeakerSettings = make(map[string]SpeakerSettings)
+	}
+	settings := c.SpeakerSettings[ip]
+	settings.QuietHours = windows
+	c.SpeakerSettings[ip] = settings
+	c.mu.Unlock()
+	return c.Save()
+}
+
+// VolumeCap returns the lowest quiet-hours cap of a speaker active at t. ok
+// is false when no window is active.
+func (c *Config) VolumeCap(ip string, t time.Time) (limit int, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, q := range c.SpeakerSettings[ip].QuietHours {
+		if q.Active(t) && (!ok || q.MaxVolume < limit) {
+			limit, ok = q.MaxVolume, true
+		}
+	}
+	return limit, ok
+}
+
+// GetTailscaleACL returns a copy of the Tailscale ACL, or nil when none is
+// configured.
+func (c *Config) GetTailscaleACL() *TailscaleACL {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.TailscaleACL == nil {
+		return nil
+	}
+	acl := *c.TailscaleACL
+	acl.Rules = slices.Clone(acl.Rules)
+	return &acl
+}
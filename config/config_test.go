@@ -0,0 +1,110 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a local time on an arbitrary day.
+func at(hour, minute int) time.Time {
+	return time.Date(2026, time.March, 14, hour, minute, 30, 0, time.Local)
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		hour, min  int
+		want       bool
+	}{
+		{"same day inside", "09:00", "17:00", 12, 0, true},
+		{"same day at start", "09:00", "17:00", 9, 0, true},
+		{"same day at end", "09:00", "17:00", 17, 0, false},
+		{"same day before", "09:00", "17:00", 8, 59, false},
+		{"overnight before midnight", "22:00", "07:00", 23, 30, true},
+		{"overnight at midnight", "22:00", "07:00", 0, 0, true},
+		{"overnight after midnight", "22:00", "07:00", 6, 59, true},
+		{"overnight at end", "22:00", "07:00", 7, 0, false},
+		{"overnight at start", "22:00", "07:00", 22, 0, true},
+		{"overnight midday", "22:00", "07:00", 12, 0, false},
+		{"until midnight", "20:00", "00:00", 23, 59, true},
+		{"until midnight next day", "20:00", "00:00", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseTimeWindow(tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("ParseTimeWindow: %v", err)
+			}
+			if got := w.Contains(at(tt.hour, tt.min)); got != tt.want {
+				t.Errorf("%s-%s contains %02d:%02d = %v, want %v", tt.start, tt.end, tt.hour, tt.min, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeWindowInvalid(t *testing.T) {
+	for _, tt := range [][2]string{{"", "07:00"}, {"22:00", "7am"}, {"24:00", "07:00"}, {"22:60", "07:00"}} {
+		if _, err := ParseTimeWindow(tt[0], tt[1]); err == nil {
+			t.Errorf("ParseTimeWindow(%q, %q) succeeded", tt[0], tt[1])
+		}
+	}
+}
+
+func TestQuietHoursValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       QuietHours
+		wantErr bool
+	}{
+		{"overnight", QuietHours{Start: "22:00", End: "07:00", MaxVolume: 20}, false},
+		{"zero cap", QuietHours{Start: "13:00", End: "15:00", MaxVolume: 0}, false},
+		{"empty window", QuietHours{Start: "22:00", End: "22:00", MaxVolume: 20}, true},
+		{"bad time", QuietHours{Start: "10pm", End: "07:00", MaxVolume: 20}, true},
+		{"cap too high", QuietHours{Start: "22:00", End: "07:00", MaxVolume: 101}, true},
+		{"negative cap", QuietHours{Start: "22:00", End: "07:00", MaxVolume: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.q.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVolumeCap(t *testing.T) {
+	cfg := &Config{SpeakerSettings: map[string]SpeakerSettings{
+		"10.0.0.2": {QuietHours: []QuietHours{
+			{Start: "22:00", End: "07:00", MaxVolume: 30},
+			{Start: "00:00", End: "06:00", MaxVolume: 15},
+			{Start: "12:00", End: "14:00", MaxVolume: 5, Disabled: true},
+		}},
+	}}
+
+	tests := []struct {
+		name      string
+		ip        string
+		hour, min int
+		wantLimit int
+		wantOK    bool
+	}{
+		{"evening", "10.0.0.2", 23, 0, 30, true},
+		{"lowest overlapping cap", "10.0.0.2", 3, 0, 15, true},
+		{"morning after overlap", "10.0.0.2", 6, 30, 30, true},
+		{"daytime", "10.0.0.2", 10, 0, 0, false},
+		{"disabled window", "10.0.0.2", 13, 0, 0, false},
+		{"other speaker", "10.0.0.3", 23, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, ok := cfg.VolumeCap(tt.ip, at(tt.hour, tt.min))
+			if limit != tt.wantLimit || ok != tt.wantOK {
+				t.Errorf("VolumeCap = %d, %v, want %d, %v", limit, ok, tt.wantLimit, tt.wantOK)
+			}
+		})
+	}
+}
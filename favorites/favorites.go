@@ -0,0 +1,355 @@
+// Package favorites manages kefw2ui-side favorites for kefw2ui.
+//
+// Unlike Airable favorites, which only cover radio stations and podcasts and
+// live on the speaker's account, local favorites can hold any browse item
+// (UPnP tracks and folders, radio stations, podcasts, custom streams) and
+// keep a user-defined order and tags.
+package favorites
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/ids"
+)
+
+// Favorite is a saved reference to a browse item.
+type Favorite struct {
+	ID            string           `json:"id"`
+	Source        string           `json:"source"` // "upnp", "radio", "podcasts", "stations", "music"
+	Title         string           `json:"title"`
+	Type          string           `json:"type"` // "audio", "container"
+	Path          string           `json:"path"`
+	Icon          string           `json:"icon,omitempty"`
+	Artist        string           `json:"artist,omitempty"`
+	Album         string           `json:"album,omitempty"`
+	AudioType     string           `json:"audioType,omitempty"`
+	ContainerPath string           `json:"containerPath,omitempty"` // Parent container for podcast episodes
+	MediaData     *kefw2.MediaData `json:"mediaData,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	AddedAt       time.Time        `json:"addedAt"`
+}
+
+// HasTag reports whether the favorite carries tag (case-insensitive).
+func (f *Favorite) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the favorite's title, artist, album or tags contain
+// query (case-insensitive).
+func (f *Favorite) Matches(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return true
+	}
+	for _, field := range append([]string{f.Title, f.Artist, f.Album}, f.Tags...) {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentItem converts the favorite to a kefw2 ContentItem for playback.
+func (f *Favorite) ContentItem() *kefw2.ContentItem {
+	item := &kefw2.ContentItem{
+		Title:     f.Title,
+		Type:      f.Type,
+		Path:      f.Path,
+		Icon:      f.Icon,
+		AudioType: f.AudioType,
+		MediaData: f.MediaData,
+	}
+	if f.ContainerPath != "" {
+		item.Context = &kefw2.Context{
+			Path: f.ContainerPath,
+		}
+	}
+	return item
+}
+
+// Manager handles favorites storage and retrieval.
+type Manager struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewManager creates a new favorites manager.
+func NewManager() (*Manager, error) {
+	path, err := config.FavoritesPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorites path: %w", err)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return &Manager{path: path}, nil
+}
+
+// List returns all favorites in user-defined order. If tag is non-empty only
+// favorites carrying that tag are returned.
+func (m *Manager) List(tag string) ([]Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		return favs, nil
+	}
+
+	filtered := make([]Favorite, 0, len(favs))
+	for _, f := range favs {
+		if f.HasTag(tag) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered, nil
+}
+
+// Get retrieves a favorite by ID.
+func (m *Manager) Get(id string) (*Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range favs {
+		if favs[i].ID == id {
+			return &favs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("favorite not found: %s", id)
+}
+
+// FindByPath returns the favorite for the given source and path, or nil.
+// An empty source matches any source.
+func (m *Manager) FindByPath(source, path string) (*Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range favs {
+		if favs[i].Path == path && (source == "" || favs[i].Source == source) {
+			return &favs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Add appends a favorite. If an item with the same source and path is already
+// a favorite, the existing entry is returned and created is false.
+func (m *Manager) Add(fav Favorite) (result *Favorite, created bool, err error) {
+	if fav.Source == "" || fav.Path == "" {
+		return nil, false, fmt.Errorf("favorite source and path are required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i := range favs {
+		if favs[i].Source == fav.Source && favs[i].Path == fav.Path {
+			return &favs[i], false, nil
+		}
+	}
+
+	fav.ID = ids.Random(6)
+	fav.AddedAt = time.Now()
+	if fav.Title == "" {
+		fav.Title = fav.Path
+	}
+
+	favs = append(favs, fav)
+	if err := m.save(favs); err != nil {
+		return nil, false, err
+	}
+
+	return &fav, true, nil
+}
+
+// Update changes a favorite's title and tags. An empty title keeps the
+// current title; a nil tags slice keeps the existing tags.
+func (m *Manager) Update(id, title string, tags []string) (*Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range favs {
+		if favs[i].ID != id {
+			continue
+		}
+		if title != "" {
+			favs[i].Title = title
+		}
+		if tags != nil {
+			favs[i].Tags = tags
+		}
+		if err := m.save(favs); err != nil {
+			return nil, err
+		}
+		return &favs[i], nil
+	}
+
+	return nil, fmt.Errorf("favorite not found: %s", id)
+}
+
+// Remove deletes a favorite.
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return err
+	}
+
+	for i := range favs {
+		if favs[i].ID == id {
+			favs = append(favs[:i], favs[i+1:]...)
+			return m.save(favs)
+		}
+	}
+
+	return fmt.Errorf("favorite not found: %s", id)
+}
+
+// Move moves a favorite to a new position (0-based). Positions past the end
+// move the favorite to the end of the list.
+func (m *Manager) Move(id string, position int) ([]Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	from := -1
+	for i := range favs {
+		if favs[i].ID == id {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return nil, fmt.Errorf("favorite not found: %s", id)
+	}
+
+	fav := favs[from]
+	favs = append(favs[:from], favs[from+1:]...)
+	if position < 0 {
+		position = 0
+	}
+	if position > len(favs) {
+		position = len(favs)
+	}
+	favs = append(favs[:position], append([]Favorite{fav}, favs[position:]...)...)
+
+	if err := m.save(favs); err != nil {
+		return nil, err
+	}
+	return favs, nil
+}
+
+// Reorder sets the order of favorites to match ids. Favorites not listed
+// keep their relative order after the listed ones.
+func (m *Manager) Reorder(ids []string) ([]Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favs, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Favorite, len(favs))
+	for _, f := range favs {
+		byID[f.ID] = f
+	}
+
+	ordered := make([]Favorite, 0, len(favs))
+	for _, id := range ids {
+		f, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("favorite not found: %s", id)
+		}
+		ordered = append(ordered, f)
+		delete(byID, id)
+	}
+	for _, f := range favs {
+		if _, ok := byID[f.ID]; ok {
+			ordered = append(ordered, f)
+		}
+	}
+
+	if err := m.save(ordered); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// load reads all favorites from disk. Caller must hold m.mu.
+func (m *Manager) load() ([]Favorite, error) {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Favorite{}, nil
+		}
+		return nil, fmt.Errorf("failed to read favorites: %w", err)
+	}
+
+	var favs []Favorite
+	if err := json.Unmarshal(data, &favs); err != nil {
+		return nil, fmt.Errorf("failed to parse favorites: %w", err)
+	}
+
+	return favs, nil
+}
+
+// save writes all favorites to disk. Caller must hold m.mu.
+func (m *Manager) save(favs []Favorite) error {
+	data, err := json.MarshalIndent(favs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal favorites: %w", err)
+	}
+
+	if err := os.WriteFile(m.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write favorites: %w", err)
+	}
+
+	return nil
+}
@@ -20,6 +20,9 @@ let reconnectAttempts = 0;
 const MAX_RECONNECT_DELAY = 30000;
 let isReconnect = false;
 
+// ID of the last event received, so a reconnect replays what was missed
+let lastEventId = '';
+
 // Heartbeat watchdog: server sends ping every 30s, we allow 45s before declaring stale
 let lastHeartbeat = 0;
 let heartbeatWatchdog: ReturnType<typeof setInterval> | null = null;
@@ -66,7 +69,10 @@ function connect() {
 
 	connectionStatus.set('connecting');
 
-	eventSource = new EventSource('/events');
+	const url = lastEventId
+		? `/events?lastEventId=${encodeURIComponent(lastEventId)}`
+		: '/events';
+	eventSource = new EventSource(url);
 
 	eventSource.onopen = () => {
 		connectionStatus.set('connected');
@@ -75,8 +81,9 @@ function connect() {
 		reconnectAttempts = 0;
 		isReconnect = false;
 
-		// After a reconnect, refresh full state to catch changes that happened while disconnected
-		if (wasReconnect) {
+		// After a reconnect, refresh full state to catch changes that happened while
+		// disconnected, unless the server replays them
+		if (wasReconnect && !lastEventId) {
 			refreshFullState();
 		}
 	};
@@ -94,6 +101,13 @@ function connect() {
 		lastHeartbeat = Date.now();
 	});
 
+	eventSource.addEventListener('resync', (event) => {
+		// Too many events were missed to replay; the server sends its current
+		// state, but the queue and speaker list need fetching
+		lastEventId = event.lastEventId;
+		refreshFullState();
+	});
+
 	eventSource.addEventListener('ping', () => {
 		// Heartbeat received, connection is alive
 		lastHeartbeat = Date.now();
@@ -103,6 +117,9 @@ function connect() {
 	eventSource.onmessage = (event) => {
 		try {
 			const message = JSON.parse(event.data);
+			if (event.lastEventId) {
+				lastEventId = event.lastEventId;
+			}
 			lastHeartbeat = Date.now(); // Any message counts as proof of connection
 			handleEvent(message);
 		} catch (e) {
@@ -0,0 +1,47 @@
+// Package ids generates the IDs of stored items: readable ones derived from
+// a name, for items addressed in URLs, and random ones.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// FromName creates a URL-safe ID from a name: lowercase letters and digits,
+// with hyphens between words. fallback is used when nothing of the name is
+// left.
+func FromName(name, fallback string) string {
+	// Convert to lowercase and replace spaces with hyphens
+	id := strings.ToLower(name)
+	id = strings.ReplaceAll(id, " ", "-")
+
+	// Remove non-alphanumeric characters (except hyphens)
+	var result strings.Builder
+	for _, r := range id {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			result.WriteRune(r)
+		}
+	}
+
+	id = result.String()
+
+	// Remove consecutive hyphens and trim
+	for strings.Contains(id, "--") {
+		id = strings.ReplaceAll(id, "--", "-")
+	}
+	id = strings.Trim(id, "-")
+
+	if id == "" {
+		id = fallback
+	}
+
+	return id
+}
+
+// Random returns a random hex ID of n bytes.
+func Random(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b) // never fails
+	return hex.EncodeToString(b)
+}
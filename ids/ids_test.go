@@ -0,0 +1,37 @@
+package ids
+
+import "testing"
+
+func TestFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Morning Jazz", "morning-jazz"},
+		{"  Radio  Paradise  ", "radio-paradise"},
+		{"Rock & Roll", "rock-roll"},
+		{"BBC Radio 6", "bbc-radio-6"},
+		{"already-an-id", "already-an-id"},
+		{"--edge--", "edge"},
+		{"Café Del Mar", "caf-del-mar"},
+		{"über_cool", "bercool"},
+		{"", "item"},
+		{"!!!", "item"},
+	}
+
+	for _, tt := range tests {
+		if got := FromName(tt.name, "item"); got != tt.want {
+			t.Errorf("FromName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	a, b := Random(6), Random(6)
+	if len(a) != 12 {
+		t.Errorf("Random(6) = %q, want 12 hex digits", a)
+	}
+	if a == b {
+		t.Errorf("Random(6) returned %q twice", a)
+	}
+}
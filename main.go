@@ -15,9 +15,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/auth"
 	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/favorites"
+	"github.com/hilli/kefw2ui/mcp"
+	"github.com/hilli/kefw2ui/mqtt"
+	"github.com/hilli/kefw2ui/playlist"
+	"github.com/hilli/kefw2ui/scenes"
 	"github.com/hilli/kefw2ui/server"
 	"github.com/hilli/kefw2ui/speaker"
+	"github.com/hilli/kefw2ui/stations"
 	"tailscale.com/tsnet"
 )
 
@@ -90,11 +98,51 @@ func main() {
 		tsStateDir      string
 		imageCacheTTL   string
 		imageCacheMemMB int
+		publicURL       string
+		musicDir        string
+		upnpRenderer    bool
+		upnpName        string
+		mpdAddr         string
+		mqttOpts        mqtt.Options
+		authEnabled     bool
+		authAdminUser   string
+		authAdminPass   string
+		authAnonymous   string
+		mcpStdio        bool
 	)
 
 	flag.StringVar(&bind, "bind", envOrDefault("KEFW2UI_BIND", "0.0.0.0"), "Address to bind to")
 	flag.IntVar(&port, "port", envInt("KEFW2UI_PORT", 8080), "Port to listen on")
 	flag.BoolVar(&showVersion, "version", false, "Print version and exit")
+	flag.BoolVar(&mcpStdio, "mcp-stdio", false, "Serve MCP over stdin/stdout for desktop AI clients instead of starting the web server")
+	flag.StringVar(&publicURL, "public-url", envOrDefault("KEFW2UI_PUBLIC_URL", ""), "Base URL speakers use to fetch audio from kefw2ui (default: detected)")
+
+	// Local music flags (env vars provide defaults)
+	flag.StringVar(&musicDir, "music-dir", envOrDefault("KEFW2UI_MUSIC_DIR", ""), "Local music directory to serve to the speaker")
+
+	// UPnP renderer flags (env vars provide defaults)
+	flag.BoolVar(&upnpRenderer, "upnp-renderer", envBool("KEFW2UI_UPNP_RENDERER"), "Expose kefw2ui as a UPnP/DLNA MediaRenderer for casting apps")
+	flag.StringVar(&upnpName, "upnp-renderer-name", envOrDefault("KEFW2UI_UPNP_RENDERER_NAME", ""), "Name shown in casting apps (default: speaker name)")
+
+	// MPD server flags (env vars provide defaults)
+	flag.StringVar(&mpdAddr, "mpd-addr", envOrDefault("KEFW2UI_MPD_ADDR", ""), "Address for the MPD protocol server, e.g. :6600 (disabled when empty)")
+
+	// MQTT flags (env vars provide defaults)
+	flag.StringVar(&mqttOpts.BrokerURL, "mqtt-broker", envOrDefault("KEFW2UI_MQTT_BROKER", ""), "MQTT broker URL, e.g. tcp://localhost:1883 (disabled when empty)")
+	flag.StringVar(&mqttOpts.Username, "mqtt-username", envOrDefault("KEFW2UI_MQTT_USERNAME", ""), "MQTT username")
+	flag.StringVar(&mqttOpts.Password, "mqtt-password", envOrDefault("KEFW2UI_MQTT_PASSWORD", ""), "MQTT password")
+	flag.StringVar(&mqttOpts.TopicPrefix, "mqtt-topic-prefix", envOrDefault("KEFW2UI_MQTT_TOPIC_PREFIX", mqtt.DefaultTopicPrefix), "Root topic for speaker state and commands")
+	flag.StringVar(&mqttOpts.DiscoveryPrefix, "mqtt-discovery-prefix", envOrDefault("KEFW2UI_MQTT_DISCOVERY_PREFIX", mqtt.DefaultDiscoveryPrefix), "Home Assistant discovery prefix (- to disable discovery)")
+	flag.StringVar(&mqttOpts.CAFile, "mqtt-ca-file", envOrDefault("KEFW2UI_MQTT_CA_FILE", ""), "CA certificate to verify a TLS broker")
+	flag.StringVar(&mqttOpts.CertFile, "mqtt-cert-file", envOrDefault("KEFW2UI_MQTT_CERT_FILE", ""), "Client certificate for TLS brokers")
+	flag.StringVar(&mqttOpts.KeyFile, "mqtt-key-file", envOrDefault("KEFW2UI_MQTT_KEY_FILE", ""), "Client key for TLS brokers")
+	flag.BoolVar(&mqttOpts.InsecureSkipVerify, "mqtt-insecure", envBool("KEFW2UI_MQTT_INSECURE"), "Skip TLS verification of the broker certificate")
+
+	// Auth flags (env vars provide defaults)
+	flag.BoolVar(&authEnabled, "auth", envBool("KEFW2UI_AUTH"), "Require API tokens or a login for the HTTP API")
+	flag.StringVar(&authAdminUser, "auth-admin-user", envOrDefault("KEFW2UI_AUTH_ADMIN_USER", "admin"), "Admin user created or reset at startup when --auth-admin-password is set")
+	flag.StringVar(&authAdminPass, "auth-admin-password", envOrDefault("KEFW2UI_AUTH_ADMIN_PASSWORD", ""), "Password for the admin user")
+	flag.StringVar(&authAnonymous, "auth-anonymous-role", envOrDefault("KEFW2UI_AUTH_ANONYMOUS_ROLE", ""), "Role for requests without credentials: viewer, controller or admin (default: none)")
 
 	// Speaker flags (env vars provide defaults)
 	flag.StringVar(&speakerIPs, "speaker-ips", envOrDefault("KEFW2UI_SPEAKER_IPS", ""), "Comma-separated list of speaker IP addresses")
@@ -122,6 +170,18 @@ func main() {
 		log.Printf("Warning: could not load config: %v", err)
 	}
 
+	if mcpStdio {
+		runMCPStdio(cfg, speakerIPs, noDiscovery)
+		return
+	}
+
+	var anonymousRole auth.Role
+	if authAnonymous != "" {
+		if anonymousRole, err = auth.ParseRole(authAnonymous); err != nil {
+			log.Fatalf("Invalid --auth-anonymous-role: %v", err)
+		}
+	}
+
 	// Parse image cache TTL
 	imgTTL, err := parseDurationWithDays(imageCacheTTL)
 	if err != nil {
@@ -130,6 +190,7 @@ func main() {
 
 	// Create speaker manager
 	speakerMgr := speaker.NewManager()
+	limitVolume(cfg, speakerMgr)
 
 	// Create server
 	srv := server.New(server.Options{
@@ -140,6 +201,19 @@ func main() {
 		SpeakerManager:  speakerMgr,
 		ImageCacheTTL:   imgTTL,
 		ImageCacheMemMB: imageCacheMemMB,
+		PublicURL:       publicURL,
+		MusicDir:        musicDir,
+
+		UPnPRenderer:     upnpRenderer,
+		UPnPRendererName: upnpName,
+
+		MPDAddr: mpdAddr,
+		MQTT:    mqttOpts,
+
+		Auth:              authEnabled,
+		AuthAdminUser:     authAdminUser,
+		AuthAdminPassword: authAdminPass,
+		AuthAnonymousRole: anonymousRole,
 	})
 
 	// Wire up speaker events to SSE broadcast
@@ -148,63 +222,11 @@ func main() {
 	// Wire up speaker health changes to SSE broadcast
 	speakerMgr.SetHealthCallback(srv.HandleSpeakerHealth)
 
-	// Initial speaker discovery and connection
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		// First, load any speakers from config
-		if cfg != nil {
-			for _, spkCfg := range cfg.GetSpeakers() {
-				log.Printf("Loading configured speaker: %s (%s)", spkCfg.Name, spkCfg.IPAddress)
-				speakerMgr.AddConfiguredSpeaker(spkCfg.IPAddress, spkCfg.Name, spkCfg.Model)
-			}
-		}
+	// Wire up quiet-hours clamping to SSE broadcast
+	speakerMgr.SetVolumeClampedCallback(srv.BroadcastVolumeClamped)
 
-		// Add speakers from --speaker-ips flag
-		if speakerIPs != "" {
-			for _, raw := range strings.Split(speakerIPs, ",") {
-				ip := strings.TrimSpace(raw)
-				if ip == "" {
-					continue
-				}
-				log.Printf("Adding speaker from --speaker-ips: %s", ip)
-				if _, err := speakerMgr.AddSpeaker(ctx, ip); err != nil {
-					log.Printf("Warning: could not add speaker %s: %v", ip, err)
-				}
-			}
-		}
-
-		// Then discover speakers on the network (unless --no-discovery is set)
-		if !noDiscovery {
-			speakers, err := speakerMgr.Discover(ctx)
-			if err != nil {
-				log.Printf("Speaker discovery error: %v", err)
-			} else {
-				log.Printf("Discovered %d speaker(s)", len(speakers))
-			}
-		} else {
-			log.Printf("Speaker discovery disabled (--no-discovery)")
-		}
-
-		// Connect to default speaker if configured
-		if cfg != nil && cfg.GetDefaultSpeaker() != "" {
-			defaultIP := cfg.GetDefaultSpeaker()
-			if err := speakerMgr.SetActiveSpeaker(context.Background(), defaultIP); err != nil {
-				log.Printf("Could not connect to default speaker %s: %v", defaultIP, err)
-			} else {
-				log.Printf("Connected to default speaker: %s", defaultIP)
-			}
-		} else if len(speakerMgr.GetSpeakers()) > 0 {
-			// Auto-connect to first available speaker
-			speakers := speakerMgr.GetSpeakers()
-			if err := speakerMgr.SetActiveSpeaker(context.Background(), speakers[0].IPAddress); err != nil {
-				log.Printf("Could not connect to speaker %s: %v", speakers[0].IPAddress, err)
-			} else {
-				log.Printf("Connected to speaker: %s (%s)", speakers[0].Name, speakers[0].IPAddress)
-			}
-		}
-	}()
+	// Initial speaker discovery and connection
+	go connectSpeakers(cfg, speakerMgr, speakerIPs, noDiscovery)
 
 	// Tailscale listener (optional)
 	var tsServer *tsnet.Server
@@ -228,9 +250,16 @@ func main() {
 			log.Fatalf("Tailscale ListenTLS error: %v", err)
 		}
 
+		// Callers are identified with WhoIs and mapped to roles by the
+		// tailscale_acl config
+		lc, err := tsServer.LocalClient()
+		if err != nil {
+			log.Fatalf("Tailscale local client error: %v", err)
+		}
+
 		go func() {
 			log.Printf("Tailscale HTTPS listener active on %s:443", tsHostname)
-			if err := http.Serve(ln, srv.Handler()); err != nil { //nolint:gosec // local Tailscale listener, timeouts not needed
+			if err := http.Serve(ln, srv.TailscaleHandler(lc.WhoIs)); err != nil { //nolint:gosec // local Tailscale listener, timeouts not needed
 				log.Fatalf("Tailscale serve error: %v", err)
 			}
 		}()
@@ -277,3 +306,110 @@ func main() {
 	speakerMgr.Close()
 	log.Println("Shutdown complete")
 }
+
+// limitVolume caps every volume change the manager makes at the configured
+// quiet hours.
+func limitVolume(cfg *config.Config, speakerMgr *speaker.Manager) {
+	if cfg != nil {
+		speakerMgr.SetVolumeLimit(cfg.VolumeCap)
+	}
+}
+
+// connectSpeakers adds the configured speakers and those from --speaker-ips,
+// discovers speakers on the network unless disabled, and connects to the
+// default speaker or the first one found.
+func connectSpeakers(cfg *config.Config, speakerMgr *speaker.Manager, speakerIPs string, noDiscovery bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// First, load any speakers from config
+	if cfg != nil {
+		for _, spkCfg := range cfg.GetSpeakers() {
+			log.Printf("Loading configured speaker: %s (%s)", spkCfg.Name, spkCfg.IPAddress)
+			speakerMgr.AddConfiguredSpeaker(spkCfg.IPAddress, spkCfg.Name, spkCfg.Model)
+		}
+	}
+
+	// Add speakers from --speaker-ips flag
+	if speakerIPs != "" {
+		for _, raw := range strings.Split(speakerIPs, ",") {
+			ip := strings.TrimSpace(raw)
+			if ip == "" {
+				continue
+			}
+			log.Printf("Adding speaker from --speaker-ips: %s", ip)
+			if _, err := speakerMgr.AddSpeaker(ctx, ip); err != nil {
+				log.Printf("Warning: could not add speaker %s: %v", ip, err)
+			}
+		}
+	}
+
+	// Then discover speakers on the network (unless --no-discovery is set)
+	if !noDiscovery {
+		speakers, err := speakerMgr.Discover(ctx)
+		if err != nil {
+			log.Printf("Speaker discovery error: %v", err)
+		} else {
+			log.Printf("Discovered %d speaker(s)", len(speakers))
+		}
+	} else {
+		log.Printf("Speaker discovery disabled (--no-discovery)")
+	}
+
+	// Connect to default speaker if configured
+	if cfg != nil && cfg.GetDefaultSpeaker() != "" {
+		defaultIP := cfg.GetDefaultSpeaker()
+		if err := speakerMgr.SetActiveSpeaker(context.Background(), defaultIP); err != nil {
+			log.Printf("Could not connect to default speaker %s: %v", defaultIP, err)
+		} else {
+			log.Printf("Connected to default speaker: %s", defaultIP)
+		}
+	} else if len(speakerMgr.GetSpeakers()) > 0 {
+		// Auto-connect to first available speaker
+		speakers := speakerMgr.GetSpeakers()
+		if err := speakerMgr.SetActiveSpeaker(context.Background(), speakers[0].IPAddress); err != nil {
+			log.Printf("Could not connect to speaker %s: %v", speakers[0].IPAddress, err)
+		} else {
+			log.Printf("Connected to speaker: %s (%s)", speakers[0].Name, speakers[0].IPAddress)
+		}
+	}
+}
+
+// runMCPStdio serves MCP over stdin/stdout (--mcp-stdio) instead of starting
+// the web server. It talks to the speakers directly and shares playlists,
+// stations, favorites, scenes and bookmarks with kefw2ui through the config
+// directory. Rules, the audit log and announcements need the web server and
+// are not available. Logs go to stderr, which MCP clients show or discard.
+func runMCPStdio(cfg *config.Config, speakerIPs string, noDiscovery bool) {
+	speakerMgr := speaker.NewManager()
+	defer speakerMgr.Close()
+	limitVolume(cfg, speakerMgr)
+	connectSpeakers(cfg, speakerMgr, speakerIPs, noDiscovery)
+
+	opts := mcp.Options{
+		Config:         cfg,
+		SpeakerManager: speakerMgr,
+		AirableCache:   kefw2.NewRowsCache(kefw2.DefaultDiskCacheConfig()),
+	}
+	var err error
+	if opts.Playlists, err = playlist.NewManager(); err != nil {
+		log.Printf("Warning: failed to initialize playlist manager: %v", err)
+	}
+	if opts.Stations, err = stations.NewManager(); err != nil {
+		log.Printf("Warning: failed to initialize station manager: %v", err)
+	}
+	if opts.Favorites, err = favorites.NewManager(); err != nil {
+		log.Printf("Warning: failed to initialize favorites manager: %v", err)
+	}
+	if opts.Scenes, err = scenes.NewManager(); err != nil {
+		log.Printf("Warning: failed to initialize scene manager: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Serving MCP on stdio (kefw2ui %s)", version)
+	if err := mcp.ServeStdio(ctx, opts, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("MCP stdio error: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/auth"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// auditTools records calls of tools that change state (everything but the
+// read-only tools) with the caller and MCP client name.
+func (h *Handler) auditTools(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+		if h.audit == nil || toolRole(req.Params.Name) == auth.RoleViewer {
+			return next(ctx, req)
+		}
+
+		h.audit.NoteLocalChange()
+		result, err := next(ctx, req)
+
+		entry := audit.Entry{
+			Source: audit.SourceMCP,
+			Action: req.Params.Name,
+			Params: req.GetArguments(),
+			Caller: audit.CallerFromContext(ctx),
+		}
+		if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+			entry.Caller.Client = session.GetClientInfo().Name
+		}
+		switch {
+		case err != nil:
+			entry.Error = err.Error()
+		case result != nil && result.IsError:
+			entry.Error = "failed"
+			for _, content := range result.Content {
+				if text, ok := content.(mcppkg.TextContent); ok {
+					entry.Error = text.Text
+					break
+				}
+			}
+		}
+		h.audit.Record(entry)
+		return result, err
+	}
+}
+
+// handleResourceAudit returns the latest audit log entries.
+func (h *Handler) handleResourceAudit(ctx context.Context, req mcppkg.ReadResourceRequest) ([]mcppkg.ResourceContents, error) {
+	if h.audit == nil {
+		return nil, errors.New("audit log not available")
+	}
+	// Like /api/audit, the log is for admins
+	if id := auth.FromContext(ctx); id != nil && !id.Role.Allows(auth.RoleAdmin) {
+		return nil, errors.New("forbidden: the audit log requires the admin role")
+	}
+
+	entries, err := h.audit.Query(audit.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return []mcppkg.ResourceContents{
+		mcppkg.TextResourceContents{
+			URI:      req.Params.URI,
+			MIMEType: "application/json",
+			Text:     jsonString(map[string]any{"entries": entries, "count": len(entries)}),
+		},
+	}, nil
+}
@@ -0,0 +1,50 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hilli/kefw2ui/auth"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// adminTools change settings, speakers or automation and need the admin
+// role, like their REST counterparts.
+var adminTools = map[string]bool{
+	"set_active_speaker": true,
+	"discover_speakers":  true,
+	"add_bookmark":       true,
+	"remove_bookmark":    true,
+	"set_source_preset":  true,
+	"set_quiet_hours":    true,
+	"create_rule":        true,
+	"update_rule":        true,
+	"delete_rule":        true,
+	"test_rule":          true,
+}
+
+// toolRole returns the role needed to call a tool: viewer for read-only
+// tools, admin for adminTools and controller for everything else.
+func toolRole(name string) auth.Role {
+	switch {
+	case adminTools[name]:
+		return auth.RoleAdmin
+	case strings.HasPrefix(name, "get_"), strings.HasPrefix(name, "list_"),
+		strings.HasPrefix(name, "search_"), strings.HasPrefix(name, "browse_"):
+		return auth.RoleViewer
+	}
+	return auth.RoleController
+}
+
+// authorizeTools rejects tool calls the caller's role doesn't allow. Calls
+// without an identity (authentication disabled) are allowed.
+func authorizeTools(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+		id := auth.FromContext(ctx)
+		if required := toolRole(req.Params.Name); id != nil && !id.Role.Allows(required) {
+			return mcppkg.NewToolResultError("Forbidden: " + req.Params.Name + " requires the " + string(required) + " role"), nil
+		}
+		return next(ctx, req)
+	}
+}
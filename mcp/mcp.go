@@ -5,44 +5,156 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 
 	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/announce"
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/favorites"
 	"github.com/hilli/kefw2ui/playlist"
+	"github.com/hilli/kefw2ui/rules"
+	"github.com/hilli/kefw2ui/scenes"
 	"github.com/hilli/kefw2ui/speaker"
+	"github.com/hilli/kefw2ui/stations"
 	mcppkg "github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
+// Options configures the MCP handler.
+type Options struct {
+	Config         *config.Config
+	SpeakerManager *speaker.Manager
+	Playlists      *playlist.Manager
+	Stations       *stations.Manager
+	Favorites      *favorites.Manager
+	Scenes         *scenes.Manager
+	Rules          *rules.Engine
+	Audit          *audit.Log
+	Clips          *announce.Library
+	Announcer      *announce.Announcer
+	AirableCache   *kefw2.RowsCache
+
+	// SpeakerState serves player status from memory; the speaker is queried
+	// directly when nil.
+	SpeakerState *speaker.StateStore
+
+	// Events are the speaker and kefw2ui events. Resource subscribers are
+	// notified of changes when set.
+	Events *speaker.Bus
+
+	// MediaBaseURL returns the base URL at which a speaker can fetch audio
+	// served by kefw2ui.
+	MediaBaseURL func(spk *kefw2.KEFSpeaker) (string, error)
+
+	// OnPlaylistChange is invoked after any playlist mutation so the caller
+	// can broadcast updates to connected clients.
+	OnPlaylistChange func()
+
+	// OnSceneChange is invoked after a scene is saved or deleted, and
+	// OnSceneRecall after a scene is recalled with its step report.
+	OnSceneChange func()
+	OnSceneRecall func(scene *scenes.Scene, steps []scenes.Step)
+
+	// OnRuleChange is invoked after a rule is created, updated or deleted.
+	OnRuleChange func()
+
+	// OnAnnouncement is invoked after an announcement with its outcome.
+	OnAnnouncement func(result *announce.Result)
+}
+
 // Handler holds the shared dependencies needed by all MCP tool/resource handlers.
 type Handler struct {
+	config           *config.Config
 	manager          *speaker.Manager
 	playlists        *playlist.Manager
+	stations         *stations.Manager
+	favorites        *favorites.Manager
+	scenes           *scenes.Manager
+	rules            *rules.Engine
+	audit            *audit.Log
+	clips            *announce.Library
+	announcer        *announce.Announcer
 	airableCache     *kefw2.RowsCache
+	speakerState     *speaker.StateStore
+	mediaBaseURL     func(spk *kefw2.KEFSpeaker) (string, error)
 	onPlaylistChange func() // called after playlist CRUD to notify SSE clients
+	onSceneChange    func()
+	onSceneRecall    func(scene *scenes.Scene, steps []scenes.Step)
+	onRuleChange     func()
+	onAnnouncement   func(result *announce.Result)
 }
 
 // NewMCPHandler creates a fully-configured MCP server with all tools, resources,
 // and prompts registered, and returns it as an http.Handler suitable for mounting
-// on an existing ServeMux. The onPlaylistChange callback is invoked after any
-// playlist mutation so the caller can broadcast updates to connected clients.
-func NewMCPHandler(mgr *speaker.Manager, pl *playlist.Manager, cache *kefw2.RowsCache, onPlaylistChange func()) http.Handler {
-	h := &Handler{
-		manager:          mgr,
-		playlists:        pl,
-		airableCache:     cache,
-		onPlaylistChange: onPlaylistChange,
+// on an existing ServeMux.
+func NewMCPHandler(opts Options) http.Handler {
+	subs, hooks := newSubscriptions()
+	// The resource list is fixed (speakers and playlists are templates), so
+	// only changes to the resources themselves are notified
+	s := newHandler(opts).newServer(
+		server.WithResourceCapabilities(true, false),
+		server.WithHooks(hooks),
+	)
+
+	subs.server = s
+	if opts.Events != nil {
+		go subs.run(opts.Events.Subscribe("MCP", 256))
 	}
 
-	s := server.NewMCPServer("kef-speakers", "1.0.0",
+	return subs.middleware(server.NewStreamableHTTPServer(s))
+}
+
+// ServeStdio serves the same tools, resources and prompts as NewMCPHandler
+// over stdin/stdout, for clients that start the MCP server as a subprocess.
+// Resource subscriptions are not supported. It returns when in is closed or
+// ctx is done.
+func ServeStdio(ctx context.Context, opts Options, in io.Reader, out io.Writer) error {
+	s := newHandler(opts).newServer(server.WithResourceCapabilities(false, false))
+	return server.NewStdioServer(s).Listen(ctx, in, out)
+}
+
+// newHandler creates a Handler from the options.
+func newHandler(opts Options) *Handler {
+	return &Handler{
+		config:           opts.Config,
+		manager:          opts.SpeakerManager,
+		playlists:        opts.Playlists,
+		stations:         opts.Stations,
+		favorites:        opts.Favorites,
+		scenes:           opts.Scenes,
+		rules:            opts.Rules,
+		audit:            opts.Audit,
+		clips:            opts.Clips,
+		announcer:        opts.Announcer,
+		airableCache:     opts.AirableCache,
+		speakerState:     opts.SpeakerState,
+		mediaBaseURL:     opts.MediaBaseURL,
+		onPlaylistChange: opts.OnPlaylistChange,
+		onSceneChange:    opts.OnSceneChange,
+		onSceneRecall:    opts.OnSceneRecall,
+		onRuleChange:     opts.OnRuleChange,
+		onAnnouncement:   opts.OnAnnouncement,
+	}
+}
+
+// newServer creates the MCP server with all tools, resources and prompts
+// registered. The transport adds its resource capabilities.
+func (h *Handler) newServer(opts ...server.ServerOption) *server.MCPServer {
+	opts = append([]server.ServerOption{
 		server.WithToolCapabilities(false),
-		server.WithResourceCapabilities(false, false),
 		server.WithPromptCapabilities(false),
-		server.WithInstructions("MCP server for controlling KEF W2 wireless speakers (LSX II, LS50 Wireless II, LS60). "+
-			"Provides tools for playback control, volume, source selection, queue management, playlist management, "+
-			"media browsing (UPnP, internet radio, podcasts), and multi-speaker management."),
-	)
+		server.WithToolHandlerMiddleware(authorizeTools),
+		server.WithToolHandlerMiddleware(h.auditTools),
+		server.WithInstructions("MCP server for controlling KEF W2 wireless speakers (LSX II, LS50 Wireless II, LS60). " +
+			"Provides tools for playback control, volume, source selection, queue management, playlist management, " +
+			"media browsing (UPnP, internet radio, podcasts), custom radio stations, local favorites, direct stream URL playback, " +
+			"scenes (saved speaker states), automation rules, announcements, and multi-speaker management."),
+	}, opts...)
+	s := server.NewMCPServer("kef-speakers", "1.0.0", opts...)
 
 	// Register tools
 	h.registerPlayerTools(s)
@@ -50,6 +162,12 @@ func NewMCPHandler(mgr *speaker.Manager, pl *playlist.Manager, cache *kefw2.Rows
 	h.registerQueueTools(s)
 	h.registerBrowseTools(s)
 	h.registerSpeakerTools(s)
+	h.registerStationTools(s)
+	h.registerFavoriteTools(s)
+	h.registerBookmarkTools(s)
+	h.registerSceneTools(s)
+	h.registerRuleTools(s)
+	h.registerAnnounceTools(s)
 
 	// Register resources
 	h.registerResources(s)
@@ -57,7 +175,7 @@ func NewMCPHandler(mgr *speaker.Manager, pl *playlist.Manager, cache *kefw2.Rows
 	// Register prompts
 	h.registerPrompts(s)
 
-	return server.NewStreamableHTTPServer(s)
+	return s
 }
 
 // getCachedAirableClient returns an AirableClient with the shared disk cache.
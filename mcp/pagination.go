@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"fmt"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/pagination"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+)
+
+// Browse tools always return a single page so AI clients never receive a
+// truncated or oversized listing. Cursors are the same opaque offsets the
+// REST browse API uses.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// limitOption is the limit parameter shared by the browse tools.
+func limitOption() mcppkg.ToolOption {
+	return mcppkg.WithNumber("limit",
+		mcppkg.Description(fmt.Sprintf("Maximum number of items to return (default %d, max %d)", defaultPageLimit, maxPageLimit)),
+	)
+}
+
+// cursorOption is the cursor parameter shared by the browse tools.
+func cursorOption() mcppkg.ToolOption {
+	return mcppkg.WithString("cursor",
+		mcppkg.Description("nextCursor from a previous result, to fetch the following page"),
+	)
+}
+
+// pageRequest is the window of a listing requested by a tool call.
+type pageRequest struct {
+	offset int
+	limit  int
+}
+
+// pageFromRequest reads the limit and cursor arguments of a tool call.
+func pageFromRequest(req mcppkg.CallToolRequest) (pageRequest, error) {
+	page := pageRequest{limit: defaultPageLimit}
+
+	if cursor := req.GetString("cursor", ""); cursor != "" {
+		offset, err := pagination.DecodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.offset = offset
+	}
+
+	if limit := req.GetInt("limit", 0); limit > 0 {
+		page.limit = min(limit, maxPageLimit)
+	}
+
+	return page, nil
+}
+
+// pageItems returns the requested window of a fully loaded listing.
+func pageItems[T any](page pageRequest, items []T) []T {
+	return pagination.Window(items, page.offset, page.limit)
+}
+
+// nextCursor returns the cursor of the page following one that consumed n
+// items of a listing with total items, or "" when the listing is exhausted.
+func (p pageRequest) nextCursor(n, total int) string {
+	return pagination.NextCursor(p.offset, p.limit, n, total)
+}
+
+// addTo sets the paging fields of a tool result.
+func (p pageRequest) addTo(result map[string]any, n, total int) map[string]any {
+	if next := p.nextCursor(n, total); next != "" {
+		result["nextCursor"] = next
+	}
+	return result
+}
+
+// Radio and podcast categories, fetched a page at a time.
+var (
+	radioCategories   = []string{"favorites", "local", "popular", "trending", "hq", "new"}
+	podcastCategories = []string{"favorites", "popular", "trending", "history"}
+)
+
+// fetchCategory fetches a page of a radio or podcast category. Favorites
+// change often, so they bypass the rows cache.
+func fetchCategory(spk *kefw2.KEFSpeaker, airable *kefw2.AirableClient, service kefw2.AirableServiceType, category string, page pageRequest) (*kefw2.RowsResponse, error) {
+	path, err := pagination.CategoryPath(airable, service, category)
+	if err != nil {
+		return nil, err
+	}
+	if category == "favorites" {
+		airable = kefw2.NewAirableClient(spk)
+	}
+	return pagination.FetchRows(airable, path, page.offset, page.limit)
+}
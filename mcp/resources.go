@@ -12,33 +12,40 @@ import (
 func (h *Handler) registerResources(s *server.MCPServer) {
 	// Static resources
 	s.AddResource(mcppkg.NewResource(
-		"kefw2://speaker/status",
+		uriSpeakerStatus,
 		"Speaker Status",
 		mcppkg.WithResourceDescription("Current playback state including track, volume, source, and position"),
 		mcppkg.WithMIMEType("application/json"),
 	), h.handleResourceSpeakerStatus)
 
 	s.AddResource(mcppkg.NewResource(
-		"kefw2://speaker/info",
+		uriSpeakerInfo,
 		"Speaker Info",
 		mcppkg.WithResourceDescription("Active speaker details including model, firmware, and MAC address"),
 		mcppkg.WithMIMEType("application/json"),
 	), h.handleResourceSpeakerInfo)
 
 	s.AddResource(mcppkg.NewResource(
-		"kefw2://queue",
+		uriQueue,
 		"Play Queue",
 		mcppkg.WithResourceDescription("Current play queue with all tracks"),
 		mcppkg.WithMIMEType("application/json"),
 	), h.handleResourceQueue)
 
 	s.AddResource(mcppkg.NewResource(
-		"kefw2://playlists",
+		uriPlaylists,
 		"Playlists",
 		mcppkg.WithResourceDescription("All saved playlists with metadata"),
 		mcppkg.WithMIMEType("application/json"),
 	), h.handleResourcePlaylists)
 
+	s.AddResource(mcppkg.NewResource(
+		"kefw2://audit",
+		"Audit Log",
+		mcppkg.WithResourceDescription("Latest control actions: who changed what (REST, MCP, rules, or the physical remote/app), with parameters and result"),
+		mcppkg.WithMIMEType("application/json"),
+	), h.handleResourceAudit)
+
 	// Resource templates
 	s.AddResourceTemplate(mcppkg.NewResourceTemplate(
 		"kefw2://playlists/{id}",
@@ -0,0 +1,203 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hilli/kefw2ui/speaker"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Resource subscription methods, which mcp-go doesn't define.
+const (
+	methodResourcesSubscribe   = "resources/subscribe"
+	methodResourcesUnsubscribe = "resources/unsubscribe"
+)
+
+// Resources clients can subscribe to with resources/subscribe.
+const (
+	uriSpeakerStatus = "kefw2://speaker/status"
+	uriSpeakerInfo   = "kefw2://speaker/info"
+	uriQueue         = "kefw2://queue"
+	uriPlaylists     = "kefw2://playlists"
+	uriPlaylist      = "kefw2://playlists/" // + id
+)
+
+// resourceEvents maps event types to the resources they change. A URI ending
+// in "/" stands for every resource under it. Position updates are left out:
+// they come every second while the speaker plays.
+var resourceEvents = map[string][]string{
+	"volume":        {uriSpeakerStatus},
+	"mute":          {uriSpeakerStatus},
+	"source":        {uriSpeakerStatus},
+	"power":         {uriSpeakerStatus},
+	"player":        {uriSpeakerStatus},
+	"playMode":      {uriSpeakerStatus},
+	"speakerHealth": {uriSpeakerStatus},
+	"speaker":       {uriSpeakerStatus, uriSpeakerInfo, uriQueue},
+	"queue":         {uriQueue},
+	"playlists":     {uriPlaylists, uriPlaylist},
+}
+
+// subscribable reports whether clients can subscribe to a resource.
+func subscribable(uri string) bool {
+	switch uri {
+	case uriSpeakerStatus, uriSpeakerInfo, uriQueue, uriPlaylists:
+		return true
+	}
+	return strings.HasPrefix(uri, uriPlaylist) && len(uri) > len(uriPlaylist)
+}
+
+// subscriptions tracks the resources each MCP session subscribed to, and
+// sends them notifications/resources/updated when they change.
+//
+// mcp-go advertises the subscribe capability but doesn't handle
+// resources/subscribe, so the requests are answered here, in front of the
+// streamable HTTP transport.
+type subscriptions struct {
+	server *server.MCPServer
+
+	mu       sync.Mutex
+	sessions map[string]map[string]bool // session ID → subscribed URIs; nil until one is made
+}
+
+// newSubscriptions creates the subscription registry. Its hooks must be
+// passed to the MCP server so it sees sessions come and go.
+func newSubscriptions() (*subscriptions, *server.Hooks) {
+	sub := &subscriptions{sessions: make(map[string]map[string]bool)}
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(func(_ context.Context, session server.ClientSession) {
+		sub.mu.Lock()
+		defer sub.mu.Unlock()
+		if _, ok := sub.sessions[session.SessionID()]; !ok {
+			sub.sessions[session.SessionID()] = nil
+		}
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		sub.removeSession(session.SessionID())
+	})
+	return sub, hooks
+}
+
+// removeSession drops a session and its subscriptions.
+func (sub *subscriptions) removeSession(sessionID string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	delete(sub.sessions, sessionID)
+}
+
+// subscribe adds or removes a subscription of a session.
+func (sub *subscriptions) subscribe(sessionID, uri string, on bool) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	uris, ok := sub.sessions[sessionID]
+	if !ok {
+		return errors.New("unknown session; initialize first")
+	}
+	if !on {
+		delete(uris, uri)
+		return nil
+	}
+	if uris == nil {
+		uris = make(map[string]bool)
+		sub.sessions[sessionID] = uris
+	}
+	uris[uri] = true
+	return nil
+}
+
+// run sends notifications for the events of bus until the subscription is
+// closed.
+func (sub *subscriptions) run(events *speaker.Subscription) {
+	for d := range events.Events() {
+		if changed := resourceEvents[d.Event.EventType()]; len(changed) > 0 {
+			sub.notify(changed)
+		}
+	}
+}
+
+// notify sends notifications/resources/updated to the sessions subscribed to
+// the changed resources. Sessions that aren't listening miss it: the
+// notification channel of mcp-go doesn't block.
+func (sub *subscriptions) notify(changed []string) {
+	type notification struct{ sessionID, uri string }
+	var pending []notification
+
+	sub.mu.Lock()
+	for sessionID, uris := range sub.sessions {
+		for uri := range uris {
+			for _, c := range changed {
+				if uri == c || (strings.HasSuffix(c, "/") && strings.HasPrefix(uri, c)) {
+					pending = append(pending, notification{sessionID, uri})
+					break
+				}
+			}
+		}
+	}
+	sub.mu.Unlock()
+
+	for _, n := range pending {
+		err := sub.server.SendNotificationToSpecificClient(n.sessionID, mcppkg.MethodNotificationResourceUpdated, map[string]any{
+			"uri": n.uri,
+		})
+		if errors.Is(err, server.ErrSessionNotFound) {
+			sub.removeSession(n.sessionID)
+		}
+	}
+}
+
+// middleware answers resources/subscribe and resources/unsubscribe requests,
+// and forgets the subscriptions of terminated sessions. Everything else is
+// passed on to the MCP transport.
+func (sub *subscriptions) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.Header.Get(server.HeaderKeySessionID)
+		if r.Method == http.MethodDelete && sessionID != "" {
+			sub.removeSession(sessionID)
+		}
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				URI string `json:"uri"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(body, &req) != nil || len(req.ID) == 0 ||
+			(req.Method != methodResourcesSubscribe && req.Method != methodResourcesUnsubscribe) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		resp := map[string]any{"jsonrpc": mcppkg.JSONRPC_VERSION, "id": req.ID}
+		on := req.Method == methodResourcesSubscribe
+		if on && !subscribable(req.Params.URI) {
+			resp["error"] = map[string]any{"code": mcppkg.INVALID_PARAMS, "message": "Resource does not support subscriptions: " + req.Params.URI}
+		} else if err := sub.subscribe(sessionID, req.Params.URI, on); err != nil {
+			resp["error"] = map[string]any{"code": mcppkg.INVALID_REQUEST, "message": err.Error()}
+		} else {
+			resp["result"] = map[string]any{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,103 @@
+package mcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/hilli/kefw2ui/announce"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func (h *Handler) registerAnnounceTools(s *server.MCPServer) {
+	s.AddTool(mcppkg.NewTool("list_clips",
+		mcppkg.WithDescription("List announcement clips in the local clip library (doorbell, laundry done, pre-rendered TTS, ...)"),
+	), h.handleListClips)
+
+	s.AddTool(mcppkg.NewTool("announce",
+		mcppkg.WithDescription("Interrupt the active speaker with a short announcement clip at an announcement volume, then restore the previous source, volume, queue position and play/pause state. Returns after the state has been restored."),
+		mcppkg.WithString("clip",
+			mcppkg.Description("File name of a clip in the clip library (see list_clips)"),
+		),
+		mcppkg.WithString("url",
+			mcppkg.Description("HTTP(S) URL of an audio file to announce instead of a library clip"),
+		),
+		mcppkg.WithNumber("volume",
+			mcppkg.Description("Announcement volume 0-100 (default 35)"),
+			mcppkg.Min(0),
+			mcppkg.Max(100),
+		),
+		mcppkg.WithNumber("max_duration",
+			mcppkg.Description("Seconds after which the previous state is restored even if the clip is still playing (default 60)"),
+		),
+	), h.handleAnnounce)
+}
+
+func (h *Handler) handleListClips(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.clips == nil {
+		return mcppkg.NewToolResultError("Clip library not available"), nil
+	}
+
+	list, err := h.clips.List()
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to list clips: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"clips":      list,
+		"totalCount": len(list),
+	})), nil
+}
+
+func (h *Handler) handleAnnounce(ctx context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.announcer == nil {
+		return mcppkg.NewToolResultError("Announcements not available"), nil
+	}
+
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+
+	clipName := req.GetString("clip", "")
+	playReq := announce.Request{
+		URL:         req.GetString("url", ""),
+		Volume:      req.GetInt("volume", 0),
+		MaxDuration: time.Duration(req.GetInt("max_duration", 0)) * time.Second,
+	}
+
+	switch {
+	case clipName != "" && playReq.URL != "":
+		return mcppkg.NewToolResultError("Set either clip or url, not both"), nil
+	case clipName != "":
+		if h.clips == nil || h.mediaBaseURL == nil {
+			return mcppkg.NewToolResultError("Clip library not available"), nil
+		}
+		clip, err := h.clips.Get(clipName)
+		if err != nil {
+			return mcppkg.NewToolResultError(err.Error()), nil
+		}
+		baseURL, err := h.mediaBaseURL(spk)
+		if err != nil {
+			return mcppkg.NewToolResultError(err.Error()), nil
+		}
+		playReq.URL = announce.ClipURL(baseURL, clip.Name)
+		playReq.MimeType = clip.MimeType
+		playReq.Title = clip.Name
+	case playReq.URL == "":
+		return mcppkg.NewToolResultError("clip or url is required"), nil
+	}
+
+	result, err := h.announcer.Play(context.WithoutCancel(ctx), spk, playReq)
+	if result != nil && h.onAnnouncement != nil {
+		h.onAnnouncement(result)
+	}
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to announce: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status":       "ok",
+		"announcement": result,
+	})), nil
+}
@@ -0,0 +1,182 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/config"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// bookmarkPathPrefix prefixes the browse path of a UPnP folder bookmark.
+const bookmarkPathPrefix = "bookmark:"
+
+func (h *Handler) registerBookmarkTools(s *server.MCPServer) {
+	s.AddTool(mcppkg.NewTool("list_bookmarks",
+		mcppkg.WithDescription("List bookmarked UPnP folders. Browse or play a bookmark using its path (bookmark:{id}) with browse_media or play_media_item."),
+	), h.handleListBookmarks)
+
+	s.AddTool(mcppkg.NewTool("add_bookmark",
+		mcppkg.WithDescription("Bookmark a UPnP folder by its human-readable path (e.g. 'Vinyl rips/Jazz') or by a container path from browse results"),
+		mcppkg.WithString("name",
+			mcppkg.Required(),
+			mcppkg.Description("Bookmark name"),
+		),
+		mcppkg.WithString("container",
+			mcppkg.Description("Human-readable folder path on the server, e.g. 'Music/Vinyl rips/Jazz'"),
+		),
+		mcppkg.WithString("path",
+			mcppkg.Description("Container path from browse_media results (alternative to container)"),
+		),
+		mcppkg.WithString("server_name",
+			mcppkg.Description("Media server display name (defaults to the configured default server)"),
+		),
+	), h.handleAddBookmark)
+
+	s.AddTool(mcppkg.NewTool("remove_bookmark",
+		mcppkg.WithDescription("Remove a UPnP folder bookmark"),
+		mcppkg.WithString("bookmark_id",
+			mcppkg.Required(),
+			mcppkg.Description("The bookmark ID"),
+		),
+	), h.handleRemoveBookmark)
+}
+
+// isBookmarkPath reports whether path addresses a UPnP folder bookmark.
+func isBookmarkPath(path string) bool {
+	return strings.HasPrefix(path, bookmarkPathPrefix)
+}
+
+// resolveBookmark resolves a "bookmark:{id}" path to the API path of the
+// bookmarked container.
+func (h *Handler) resolveBookmark(airable *kefw2.AirableClient, path string) (string, error) {
+	if h.config == nil {
+		return "", fmt.Errorf("config not available")
+	}
+
+	id := strings.TrimPrefix(path, bookmarkPathPrefix)
+	b := h.config.FindUPnPBookmark(id)
+	if b == nil {
+		return "", fmt.Errorf("bookmark not found: %s", id)
+	}
+	if b.Path != "" {
+		return b.Path, nil
+	}
+
+	serverPath := b.ServerPath
+	if serverPath == "" && b.ServerName != "" {
+		srv, err := airable.GetMediaServerByName(b.ServerName)
+		if err != nil {
+			return "", fmt.Errorf("media server %q not found: %w", b.ServerName, err)
+		}
+		serverPath = srv.Path
+	}
+	if serverPath == "" {
+		serverPath = h.config.GetUPnPConfig().DefaultServerPath
+	}
+	if serverPath == "" {
+		return "", fmt.Errorf("bookmark %q has no media server and no default server is set", b.Name)
+	}
+
+	resolved, _, err := kefw2.FindContainerByPath(airable, serverPath, b.Container)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve bookmark %q: %w", b.Name, err)
+	}
+	return resolved, nil
+}
+
+// bookmarkItems returns the configured bookmarks as browse items.
+func (h *Handler) bookmarkItems() []map[string]any {
+	if h.config == nil {
+		return nil
+	}
+
+	bookmarks := h.config.GetUPnPBookmarks()
+	items := make([]map[string]any, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		item := map[string]any{
+			"title":    b.Name,
+			"type":     "container",
+			"path":     bookmarkPathPrefix + b.ID,
+			"id":       b.ID,
+			"playable": true,
+		}
+		if b.Container != "" {
+			item["container"] = b.Container
+		}
+		if b.ServerName != "" {
+			item["serverName"] = b.ServerName
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (h *Handler) handleListBookmarks(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	items := h.bookmarkItems()
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"bookmarks":  items,
+		"totalCount": len(items),
+	})), nil
+}
+
+func (h *Handler) handleAddBookmark(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcppkg.NewToolResultError("name is required"), nil
+	}
+
+	b := config.UPnPBookmark{
+		Name:       name,
+		ServerName: req.GetString("server_name", ""),
+		Container:  req.GetString("container", ""),
+		Path:       req.GetString("path", ""),
+	}
+
+	// Resolve the server path up front so browsing skips the lookup later
+	if b.ServerName != "" {
+		if spk := h.manager.GetActiveSpeaker(); spk != nil {
+			if srv, getErr := h.getCachedAirableClient(spk).GetMediaServerByName(b.ServerName); getErr == nil {
+				b.ServerPath = srv.Path
+			}
+		}
+	}
+
+	b, err = h.config.AddUPnPBookmark(b)
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to add bookmark: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"bookmark": b,
+		"path":     bookmarkPathPrefix + b.ID,
+	})), nil
+}
+
+func (h *Handler) handleRemoveBookmark(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	id, err := req.RequireString("bookmark_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("bookmark_id is required"), nil
+	}
+
+	if err := h.config.RemoveUPnPBookmark(id); err != nil {
+		return mcppkg.NewToolResultError("Failed to remove bookmark: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
+}
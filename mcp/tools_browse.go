@@ -2,18 +2,24 @@ package mcp
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
 	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/pagination"
+	"github.com/hilli/kefw2ui/stations"
 	mcppkg "github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
 func (h *Handler) registerBrowseTools(s *server.MCPServer) {
 	s.AddTool(mcppkg.NewTool("browse_media",
-		mcppkg.WithDescription("Browse UPnP media servers and their content. Call without path to list servers, or with a path to browse a container."),
+		mcppkg.WithDescription("Browse UPnP media servers and their content. Call without path to list folder bookmarks and servers, or with a path to browse a container."),
 		mcppkg.WithString("path",
 			mcppkg.Description("Path to browse. Omit to list media servers."),
 		),
+		limitOption(),
+		cursorOption(),
 	), h.handleBrowseMedia)
 
 	s.AddTool(mcppkg.NewTool("search_media",
@@ -22,13 +28,15 @@ func (h *Handler) registerBrowseTools(s *server.MCPServer) {
 			mcppkg.Required(),
 			mcppkg.Description("Search query. Use 'artist:Name' or 'album:Name' for filtered searches."),
 		),
+		limitOption(),
+		cursorOption(),
 	), h.handleSearchMedia)
 
 	s.AddTool(mcppkg.NewTool("browse_radio",
 		mcppkg.WithDescription("Browse internet radio stations by category or search"),
 		mcppkg.WithString("category",
 			mcppkg.Description("Radio category to browse"),
-			mcppkg.Enum("menu", "favorites", "local", "popular", "trending", "hq", "new"),
+			mcppkg.Enum("menu", "favorites", "local", "popular", "trending", "hq", "new", "stations"),
 		),
 		mcppkg.WithString("query",
 			mcppkg.Description("Search query for radio stations"),
@@ -36,6 +44,8 @@ func (h *Handler) registerBrowseTools(s *server.MCPServer) {
 		mcppkg.WithString("path",
 			mcppkg.Description("Direct path to browse (overrides category)"),
 		),
+		limitOption(),
+		cursorOption(),
 	), h.handleBrowseRadio)
 
 	s.AddTool(mcppkg.NewTool("browse_podcasts",
@@ -50,6 +60,8 @@ func (h *Handler) registerBrowseTools(s *server.MCPServer) {
 		mcppkg.WithString("path",
 			mcppkg.Description("Direct path to browse (overrides category)"),
 		),
+		limitOption(),
+		cursorOption(),
 	), h.handleBrowsePodcasts)
 
 	s.AddTool(mcppkg.NewTool("play_media_item",
@@ -61,7 +73,7 @@ func (h *Handler) registerBrowseTools(s *server.MCPServer) {
 		mcppkg.WithString("source",
 			mcppkg.Required(),
 			mcppkg.Description("The source type"),
-			mcppkg.Enum("upnp", "radio", "podcasts"),
+			mcppkg.Enum("upnp", "radio", "podcasts", "stations"),
 		),
 		mcppkg.WithString("type",
 			mcppkg.Description("Item type (audio or container)"),
@@ -84,7 +96,7 @@ func (h *Handler) registerBrowseTools(s *server.MCPServer) {
 		mcppkg.WithString("source",
 			mcppkg.Required(),
 			mcppkg.Description("The source type"),
-			mcppkg.Enum("upnp", "radio", "podcasts"),
+			mcppkg.Enum("upnp", "radio", "podcasts", "stations"),
 		),
 		mcppkg.WithString("type",
 			mcppkg.Description("Item type (audio or container)"),
@@ -102,16 +114,27 @@ func (h *Handler) handleBrowseMedia(_ context.Context, req mcppkg.CallToolReques
 		return noSpeakerError(), nil
 	}
 
+	page, err := pageFromRequest(req)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
 	airable := h.getCachedAirableClient(spk)
 	path := req.GetString("path", "")
 
 	var resp *kefw2.RowsResponse
-	var err error
+
+	if isBookmarkPath(path) {
+		path, err = h.resolveBookmark(airable, path)
+		if err != nil {
+			return mcppkg.NewToolResultError("Failed to open bookmark: " + err.Error()), nil
+		}
+	}
 
 	if path == "" {
 		resp, err = airable.GetMediaServers()
 	} else {
-		resp, err = airable.BrowseContainer(path)
+		resp, err = pagination.FetchRows(airable, path, page.offset, page.limit)
 	}
 
 	if err != nil {
@@ -119,6 +142,13 @@ func (h *Handler) handleBrowseMedia(_ context.Context, req mcppkg.CallToolReques
 	}
 
 	items := make([]map[string]any, 0, len(resp.Rows))
+	totalCount := resp.RowsCount
+	if path == "" {
+		// Bookmarked folders are listed ahead of the servers
+		bookmarks := h.bookmarkItems()
+		items = append(items, bookmarks...)
+		totalCount += len(bookmarks)
+	}
 	for _, row := range resp.Rows {
 		if row.Type == "query" {
 			continue
@@ -155,11 +185,19 @@ func (h *Handler) handleBrowseMedia(_ context.Context, req mcppkg.CallToolReques
 		items = append(items, item)
 	}
 
-	return mcppkg.NewToolResultText(jsonString(map[string]any{
+	// The server listing is loaded whole, containers a page at a time
+	consumed := len(resp.Rows)
+	if path == "" {
+		totalCount = len(items)
+		items = pageItems(page, items)
+		consumed = len(items)
+	}
+
+	return mcppkg.NewToolResultText(jsonString(page.addTo(map[string]any{
 		"items":      items,
-		"totalCount": resp.RowsCount,
+		"totalCount": totalCount,
 		"source":     "upnp",
-	})), nil
+	}, consumed, totalCount))), nil
 }
 
 func (h *Handler) handleSearchMedia(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
@@ -168,12 +206,17 @@ func (h *Handler) handleSearchMedia(_ context.Context, req mcppkg.CallToolReques
 		return mcppkg.NewToolResultError("query is required"), nil
 	}
 
+	page, err := pageFromRequest(req)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
 	index, loadErr := kefw2.LoadTrackIndexCached()
 	if loadErr != nil || index == nil {
 		return mcppkg.NewToolResultError("No media index found. Use 'kefw2 upnp index' to build the search index."), nil
 	}
 
-	results := kefw2.SearchTracks(index, query, 100)
+	results := kefw2.SearchTracks(index, query, 1000)
 	if len(results) == 0 {
 		return mcppkg.NewToolResultText(jsonString(map[string]any{
 			"items":      []any{},
@@ -182,6 +225,9 @@ func (h *Handler) handleSearchMedia(_ context.Context, req mcppkg.CallToolReques
 		})), nil
 	}
 
+	totalCount := len(results)
+	results = pageItems(page, results)
+
 	items := make([]map[string]any, 0, len(results))
 	for _, track := range results {
 		item := map[string]any{
@@ -205,52 +251,47 @@ func (h *Handler) handleSearchMedia(_ context.Context, req mcppkg.CallToolReques
 		items = append(items, item)
 	}
 
-	return mcppkg.NewToolResultText(jsonString(map[string]any{
+	return mcppkg.NewToolResultText(jsonString(page.addTo(map[string]any{
 		"items":      items,
-		"totalCount": len(items),
+		"totalCount": totalCount,
 		"source":     "upnp",
 		"search":     true,
-	})), nil
+	}, len(items), totalCount))), nil
 }
 
-func (h *Handler) handleBrowseRadio(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+func (h *Handler) handleBrowseRadio(ctx context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	query := req.GetString("query", "")
+	path := req.GetString("path", "")
+	category := req.GetString("category", "menu")
+
+	// Custom stations live locally rather than in the Airable catalog
+	if category == "stations" || path == stations.ContainerPath {
+		return h.handleListStations(ctx, req)
+	}
+
 	spk := h.manager.GetActiveSpeaker()
 	if spk == nil {
 		return noSpeakerError(), nil
 	}
 
+	page, err := pageFromRequest(req)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
 	airable := h.getCachedAirableClient(spk)
-	query := req.GetString("query", "")
-	path := req.GetString("path", "")
-	category := req.GetString("category", "menu")
 
 	var resp *kefw2.RowsResponse
-	var err error
 
 	switch {
 	case query != "":
 		resp, err = airable.SearchRadio(query)
 	case path != "":
-		resp, err = airable.BrowseRadioByItemPath(path)
+		resp, err = pagination.FetchRows(airable, path, page.offset, page.limit)
+	case slices.Contains(radioCategories, category):
+		resp, err = fetchCategory(spk, airable, kefw2.ServiceRadio, category, page)
 	default:
-		switch category {
-		case "favorites":
-			// Don't cache favorites
-			uncached := kefw2.NewAirableClient(spk)
-			resp, err = uncached.GetRadioFavorites()
-		case "local":
-			resp, err = airable.GetRadioLocal()
-		case "popular":
-			resp, err = airable.GetRadioPopular()
-		case "trending":
-			resp, err = airable.GetRadioTrending()
-		case "hq":
-			resp, err = airable.GetRadioHQ()
-		case "new":
-			resp, err = airable.GetRadioNew()
-		default:
-			resp, err = airable.GetRadioMenu()
-		}
+		resp, err = airable.GetRadioMenu()
 	}
 
 	if err != nil {
@@ -291,11 +332,32 @@ func (h *Handler) handleBrowseRadio(_ context.Context, req mcppkg.CallToolReques
 		items = append(items, item)
 	}
 
-	return mcppkg.NewToolResultText(jsonString(map[string]any{
+	// Offer the custom stations folder alongside the Airable radio menu
+	totalCount := resp.RowsCount
+	if query == "" && path == "" && category == "menu" && h.stations != nil {
+		items = append(items, map[string]any{
+			"title":    "My Stations",
+			"type":     "container",
+			"path":     stations.ContainerPath,
+			"playable": false,
+		})
+		totalCount++
+	}
+
+	// Containers opened by path and categories are fetched a page at a
+	// time; search results and the menu are loaded whole
+	consumed := len(items)
+	if query != "" || path == "" && !slices.Contains(radioCategories, category) {
+		totalCount = len(items)
+		items = pageItems(page, items)
+		consumed = len(items)
+	}
+
+	return mcppkg.NewToolResultText(jsonString(page.addTo(map[string]any{
 		"items":      items,
-		"totalCount": resp.RowsCount,
+		"totalCount": totalCount,
 		"source":     "radio",
-	})), nil
+	}, consumed, totalCount))), nil
 }
 
 func (h *Handler) handleBrowsePodcasts(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
@@ -304,34 +366,27 @@ func (h *Handler) handleBrowsePodcasts(_ context.Context, req mcppkg.CallToolReq
 		return noSpeakerError(), nil
 	}
 
+	page, err := pageFromRequest(req)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
 	airable := h.getCachedAirableClient(spk)
 	query := req.GetString("query", "")
 	path := req.GetString("path", "")
 	category := req.GetString("category", "menu")
 
 	var resp *kefw2.RowsResponse
-	var err error
 
 	switch {
 	case query != "":
 		resp, err = airable.SearchPodcasts(query)
 	case path != "":
-		// Don't cache favorites/history
-		resp, err = airable.GetRows(path, 0, 100)
+		resp, err = pagination.FetchRows(airable, path, page.offset, page.limit)
+	case slices.Contains(podcastCategories, category):
+		resp, err = fetchCategory(spk, airable, kefw2.ServicePodcast, category, page)
 	default:
-		switch category {
-		case "favorites":
-			uncached := kefw2.NewAirableClient(spk)
-			resp, err = uncached.GetPodcastFavorites()
-		case "popular":
-			resp, err = airable.GetPodcastPopular()
-		case "trending":
-			resp, err = airable.GetPodcastTrending()
-		case "history":
-			resp, err = airable.GetPodcastHistory()
-		default:
-			resp, err = airable.GetPodcastMenu()
-		}
+		resp, err = airable.GetPodcastMenu()
 	}
 
 	if err != nil {
@@ -373,11 +428,21 @@ func (h *Handler) handleBrowsePodcasts(_ context.Context, req mcppkg.CallToolReq
 		items = append(items, item)
 	}
 
-	return mcppkg.NewToolResultText(jsonString(map[string]any{
+	// Containers opened by path and categories are fetched a page at a
+	// time; search results and the menu are loaded whole
+	totalCount := resp.RowsCount
+	consumed := len(items)
+	if query != "" || path == "" && !slices.Contains(podcastCategories, category) {
+		totalCount = len(items)
+		items = pageItems(page, items)
+		consumed = len(items)
+	}
+
+	return mcppkg.NewToolResultText(jsonString(page.addTo(map[string]any{
 		"items":      items,
-		"totalCount": resp.RowsCount,
+		"totalCount": totalCount,
 		"source":     "podcasts",
-	})), nil
+	}, consumed, totalCount))), nil
 }
 
 func (h *Handler) handlePlayMediaItem(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
@@ -397,44 +462,61 @@ func (h *Handler) handlePlayMediaItem(_ context.Context, req mcppkg.CallToolRequ
 	}
 
 	itemType := req.GetString("type", "audio")
-	airable := kefw2.NewAirableClient(spk)
+	item := &kefw2.ContentItem{
+		Path:  path,
+		Title: req.GetString("title", ""),
+		Type:  itemType,
+	}
+	if containerPath := req.GetString("container_path", ""); containerPath != "" {
+		item.Context = &kefw2.Context{
+			Path: containerPath,
+		}
+	}
+
+	if err := h.playItem(kefw2.NewAirableClient(spk), source, item); err != nil {
+		return mcppkg.NewToolResultError("Failed to play: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
+}
+
+// playItem plays a browse item through the given source. Podcast episodes use
+// item.Context for their parent container path.
+func (h *Handler) playItem(airable *kefw2.AirableClient, source string, item *kefw2.ContentItem) error {
+	if stations.IsStationPath(item.Path) {
+		source = "stations"
+	}
 
 	switch source {
 	case "upnp":
-		if itemType == "container" {
-			err = airable.PlayUPnPContainer(path)
-		} else {
-			err = airable.PlayUPnPByPath(path)
+		if isBookmarkPath(item.Path) {
+			path, err := h.resolveBookmark(airable, item.Path)
+			if err != nil {
+				return err
+			}
+			return airable.PlayUPnPContainer(path)
 		}
-	case "radio":
-		station, getErr := airable.GetRadioStationDetails(path)
-		if getErr != nil {
-			return mcppkg.NewToolResultError("Failed to get station details: " + getErr.Error()), nil
+		if item.Type == "container" {
+			return airable.PlayUPnPContainer(item.Path)
 		}
-		err = airable.ResolveAndPlayRadioStation(station)
-	case "podcasts":
-		title := req.GetString("title", "")
-		containerPath := req.GetString("container_path", "")
-		episode := &kefw2.ContentItem{
-			Path:  path,
-			Title: title,
-			Type:  itemType,
+		return airable.PlayUPnPByPath(item.Path)
+	case "stations":
+		st, err := h.getStation(item.Path)
+		if err != nil {
+			return err
 		}
-		if containerPath != "" {
-			episode.Context = &kefw2.Context{
-				Path: containerPath,
-			}
+		return airable.PlayUPnPTracks([]kefw2.ContentItem{st.ContentItem()})
+	case "radio":
+		station, err := airable.GetRadioStationDetails(item.Path)
+		if err != nil {
+			return fmt.Errorf("failed to get station details: %w", err)
 		}
-		err = airable.PlayPodcastEpisode(episode)
+		return airable.ResolveAndPlayRadioStation(station)
+	case "podcasts":
+		return airable.PlayPodcastEpisode(item)
 	default:
-		return mcppkg.NewToolResultError("Unknown source: " + source), nil
-	}
-
-	if err != nil {
-		return mcppkg.NewToolResultError("Failed to play: " + err.Error()), nil
+		return fmt.Errorf("unknown source: %s", source)
 	}
-
-	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
 }
 
 func (h *Handler) handleAddToQueue(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
@@ -458,6 +540,15 @@ func (h *Handler) handleAddToQueue(_ context.Context, req mcppkg.CallToolRequest
 	airable := kefw2.NewAirableClient(spk)
 	tracksAdded := 0
 
+	// Bookmarked folders queue like any other UPnP container
+	if isBookmarkPath(path) {
+		path, err = h.resolveBookmark(airable, path)
+		if err != nil {
+			return mcppkg.NewToolResultError("Failed to open bookmark: " + err.Error()), nil
+		}
+		itemType = "container"
+	}
+
 	switch source {
 	case "upnp":
 		if itemType == "container" {
@@ -487,7 +578,16 @@ func (h *Handler) handleAddToQueue(_ context.Context, req mcppkg.CallToolRequest
 			err = airable.AddToQueue([]kefw2.ContentItem{*track}, false)
 			tracksAdded = 1
 		}
-	case "radio":
+	case "radio", "stations":
+		if stations.IsStationPath(path) {
+			st, getErr := h.getStation(path)
+			if getErr != nil {
+				return mcppkg.NewToolResultError(getErr.Error()), nil
+			}
+			err = airable.AddToQueue([]kefw2.ContentItem{st.ContentItem()}, false)
+			tracksAdded = 1
+			break
+		}
 		station, getErr := airable.GetRadioStationDetails(path)
 		if getErr != nil {
 			station = &kefw2.ContentItem{
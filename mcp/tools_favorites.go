@@ -0,0 +1,233 @@
+package mcp
+
+import (
+	"context"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/favorites"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func (h *Handler) registerFavoriteTools(s *server.MCPServer) {
+	s.AddTool(mcppkg.NewTool("list_favorites",
+		mcppkg.WithDescription("List local favorites (UPnP tracks and folders, radio stations, podcasts, custom streams) in their saved order"),
+		mcppkg.WithString("tag",
+			mcppkg.Description("Only return favorites with this tag"),
+		),
+		mcppkg.WithString("query",
+			mcppkg.Description("Filter on title, artist, album or tag"),
+		),
+		limitOption(),
+		cursorOption(),
+	), h.handleListFavorites)
+
+	s.AddTool(mcppkg.NewTool("add_favorite",
+		mcppkg.WithDescription("Add a browse item to the local favorites"),
+		mcppkg.WithString("path",
+			mcppkg.Required(),
+			mcppkg.Description("The path of the item (from browse results)"),
+		),
+		mcppkg.WithString("source",
+			mcppkg.Required(),
+			mcppkg.Description("The source the item was browsed from"),
+			mcppkg.Enum("upnp", "radio", "podcasts", "stations"),
+		),
+		mcppkg.WithString("title",
+			mcppkg.Description("Item title"),
+		),
+		mcppkg.WithString("type",
+			mcppkg.Description("Item type (audio or container)"),
+			mcppkg.Enum("audio", "container"),
+		),
+		mcppkg.WithString("icon",
+			mcppkg.Description("Artwork URL"),
+		),
+		mcppkg.WithString("artist",
+			mcppkg.Description("Artist name"),
+		),
+		mcppkg.WithString("album",
+			mcppkg.Description("Album name"),
+		),
+		mcppkg.WithString("container_path",
+			mcppkg.Description("Parent container path (needed for podcast episodes)"),
+		),
+		mcppkg.WithArray("tags",
+			mcppkg.Description("Optional tags"),
+			mcppkg.WithStringItems(),
+		),
+	), h.handleAddFavorite)
+
+	s.AddTool(mcppkg.NewTool("remove_favorite",
+		mcppkg.WithDescription("Remove an item from the local favorites"),
+		mcppkg.WithString("favorite_id",
+			mcppkg.Required(),
+			mcppkg.Description("The favorite ID"),
+		),
+	), h.handleRemoveFavorite)
+
+	s.AddTool(mcppkg.NewTool("update_favorite",
+		mcppkg.WithDescription("Rename, retag or reorder a local favorite"),
+		mcppkg.WithString("favorite_id",
+			mcppkg.Required(),
+			mcppkg.Description("The favorite ID"),
+		),
+		mcppkg.WithString("title",
+			mcppkg.Description("New title"),
+		),
+		mcppkg.WithArray("tags",
+			mcppkg.Description("Replacement tags"),
+			mcppkg.WithStringItems(),
+		),
+		mcppkg.WithNumber("position",
+			mcppkg.Description("New position in the list (0-based)"),
+		),
+	), h.handleUpdateFavorite)
+
+	s.AddTool(mcppkg.NewTool("play_favorite",
+		mcppkg.WithDescription("Play a local favorite"),
+		mcppkg.WithString("favorite_id",
+			mcppkg.Required(),
+			mcppkg.Description("The favorite ID to play"),
+		),
+	), h.handlePlayFavorite)
+}
+
+func (h *Handler) handleListFavorites(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.favorites == nil {
+		return mcppkg.NewToolResultError("Favorites not available"), nil
+	}
+
+	page, err := pageFromRequest(req)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
+	favs, err := h.favorites.List(req.GetString("tag", ""))
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to list favorites: " + err.Error()), nil
+	}
+
+	query := req.GetString("query", "")
+	result := make([]favorites.Favorite, 0, len(favs))
+	for _, f := range favs {
+		if f.Matches(query) {
+			result = append(result, f)
+		}
+	}
+
+	totalCount := len(result)
+	result = pageItems(page, result)
+
+	return mcppkg.NewToolResultText(jsonString(page.addTo(map[string]any{
+		"favorites":  result,
+		"totalCount": totalCount,
+	}, len(result), totalCount))), nil
+}
+
+func (h *Handler) handleAddFavorite(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.favorites == nil {
+		return mcppkg.NewToolResultError("Favorites not available"), nil
+	}
+
+	path, err := req.RequireString("path")
+	if err != nil {
+		return mcppkg.NewToolResultError("path is required"), nil
+	}
+
+	source, err := req.RequireString("source")
+	if err != nil {
+		return mcppkg.NewToolResultError("source is required"), nil
+	}
+
+	fav, created, err := h.favorites.Add(favorites.Favorite{
+		Source:        source,
+		Path:          path,
+		Title:         req.GetString("title", ""),
+		Type:          req.GetString("type", "audio"),
+		Icon:          req.GetString("icon", ""),
+		Artist:        req.GetString("artist", ""),
+		Album:         req.GetString("album", ""),
+		ContainerPath: req.GetString("container_path", ""),
+		Tags:          req.GetStringSlice("tags", nil),
+	})
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to add favorite: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"favorite": fav,
+		"created":  created,
+	})), nil
+}
+
+func (h *Handler) handleRemoveFavorite(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.favorites == nil {
+		return mcppkg.NewToolResultError("Favorites not available"), nil
+	}
+
+	id, err := req.RequireString("favorite_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("favorite_id is required"), nil
+	}
+
+	if err := h.favorites.Remove(id); err != nil {
+		return mcppkg.NewToolResultError("Failed to remove favorite: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
+}
+
+func (h *Handler) handleUpdateFavorite(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.favorites == nil {
+		return mcppkg.NewToolResultError("Favorites not available"), nil
+	}
+
+	id, err := req.RequireString("favorite_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("favorite_id is required"), nil
+	}
+
+	fav, err := h.favorites.Update(id, req.GetString("title", ""), req.GetStringSlice("tags", nil))
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to update favorite: " + err.Error()), nil
+	}
+
+	if _, ok := req.GetArguments()["position"]; ok {
+		if _, err := h.favorites.Move(id, req.GetInt("position", 0)); err != nil {
+			return mcppkg.NewToolResultError("Failed to move favorite: " + err.Error()), nil
+		}
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{"favorite": fav})), nil
+}
+
+func (h *Handler) handlePlayFavorite(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.favorites == nil {
+		return mcppkg.NewToolResultError("Favorites not available"), nil
+	}
+
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+
+	id, err := req.RequireString("favorite_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("favorite_id is required"), nil
+	}
+
+	fav, err := h.favorites.Get(id)
+	if err != nil {
+		return mcppkg.NewToolResultError("Favorite not found: " + err.Error()), nil
+	}
+
+	if err := h.playItem(kefw2.NewAirableClient(spk), fav.Source, fav.ContentItem()); err != nil {
+		return mcppkg.NewToolResultError("Failed to play: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status": "ok",
+		"title":  fav.Title,
+	})), nil
+}
@@ -2,8 +2,10 @@ package mcp
 
 import (
 	"context"
+	"time"
 
 	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/speaker"
 	mcppkg "github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
@@ -42,7 +44,7 @@ func (h *Handler) registerPlayerTools(s *server.MCPServer) {
 	), h.handleSeek)
 
 	s.AddTool(mcppkg.NewTool("set_volume",
-		mcppkg.WithDescription("Set the speaker volume"),
+		mcppkg.WithDescription("Set the speaker volume. During quiet hours the volume is limited to the configured cap."),
 		mcppkg.WithNumber("volume",
 			mcppkg.Required(),
 			mcppkg.Description("Volume level (0-100)"),
@@ -108,6 +110,23 @@ func (h *Handler) handleGetPlayerStatus(ctx context.Context, _ mcppkg.CallToolRe
 		})), nil
 	}
 
+	// The position counts on from the last one the speaker reported
+	if h.speakerState != nil {
+		state, _ := h.speakerState.Get(ctx, spk)
+		return mcppkg.NewToolResultText(jsonString(map[string]any{
+			"state":     state.Player.State,
+			"volume":    state.Volume,
+			"muted":     state.Muted,
+			"source":    string(state.Source),
+			"title":     state.Player.Title,
+			"artist":    state.Player.Artist,
+			"album":     state.Player.Album,
+			"duration":  state.Player.Duration,
+			"position":  state.Player.CurrentPosition(time.Now()),
+			"audioType": state.Player.AudioType,
+		})), nil
+	}
+
 	playerData, err := spk.PlayerData(ctx)
 	if err != nil {
 		volume, _ := spk.GetVolume(ctx)
@@ -236,6 +255,11 @@ func (h *Handler) handleSeek(ctx context.Context, req mcppkg.CallToolRequest) (*
 	if err := spk.SeekTo(ctx, positionMS); err != nil {
 		return mcppkg.NewToolResultError("Seek failed: " + err.Error()), nil
 	}
+	if h.speakerState != nil {
+		h.speakerState.Update(spk.IPAddress, func(state *speaker.State) {
+			state.Player.Position, state.Player.PositionAt = positionMS, time.Now()
+		})
+	}
 
 	return mcppkg.NewToolResultText(jsonString(map[string]any{
 		"status":           "ok",
@@ -258,11 +282,20 @@ func (h *Handler) handleSetVolume(ctx context.Context, req mcppkg.CallToolReques
 		return mcppkg.NewToolResultError("Volume must be between 0 and 100"), nil
 	}
 
-	if err := spk.SetVolume(ctx, vol); err != nil {
+	// Lowered to the quiet-hours cap
+	requested := vol
+	vol, err = h.manager.SetVolume(ctx, spk, requested, speaker.OriginMCP)
+	if err != nil {
 		return mcppkg.NewToolResultError("Failed to set volume: " + err.Error()), nil
 	}
 
-	return mcppkg.NewToolResultText(jsonString(map[string]any{"volume": vol})), nil
+	result := map[string]any{"volume": vol}
+	if vol < requested {
+		result["clamped"] = true
+		result["requested"] = requested
+		result["note"] = "Volume limited by quiet hours"
+	}
+	return mcppkg.NewToolResultText(jsonString(result)), nil
 }
 
 func (h *Handler) handleGetVolume(ctx context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
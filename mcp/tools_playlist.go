@@ -3,7 +3,6 @@ package mcp
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/hilli/go-kef-w2/kefw2"
@@ -330,67 +329,7 @@ func (h *Handler) handleLoadPlaylist(ctx context.Context, req mcppkg.CallToolReq
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	contentItems := make([]kefw2.ContentItem, 0, len(pl.Tracks))
-	skipped := 0
-	for _, track := range pl.Tracks {
-		if track.Type == "container" || (track.URI == "" && track.Path == "") {
-			skipped++
-			continue
-		}
-
-		// If the track has a browsable path but no stream URI, resolve it
-		// from the speaker API to get the full ContentItem with stream URL.
-		if track.URI == "" && track.Path != "" {
-			resp, resolveErr := airable.GetRows(track.Path, 0, 1)
-			if resolveErr == nil {
-				var resolved *kefw2.ContentItem
-				switch {
-				case resp.Roles != nil:
-					resolved = resp.Roles
-				case len(resp.Rows) > 0:
-					resolved = &resp.Rows[0]
-				}
-				if resolved != nil {
-					contentItems = append(contentItems, *resolved)
-					continue
-				}
-			}
-			skipped++
-			continue
-		}
-
-		serviceID := track.ServiceID
-		if serviceID == "" {
-			serviceID = "UPnP"
-		}
-
-		path := track.Path
-		if strings.HasPrefix(path, "playlists:item/") || path == "" {
-			path = track.URI
-		}
-
-		contentItems = append(contentItems, kefw2.ContentItem{
-			Title: track.Title,
-			ID:    track.ID,
-			Path:  path,
-			Icon:  track.Icon,
-			Type:  track.Type,
-			MediaData: &kefw2.MediaData{
-				MetaData: kefw2.MediaMetaData{
-					Artist:    track.Artist,
-					Album:     track.Album,
-					ServiceID: serviceID,
-				},
-				Resources: []kefw2.MediaResource{
-					{
-						URI:      track.URI,
-						MimeType: track.MimeType,
-						Duration: track.Duration,
-					},
-				},
-			},
-		})
-	}
+	contentItems, skipped := playlist.ContentItems(airable, pl.Tracks)
 
 	if len(contentItems) == 0 {
 		return mcppkg.NewToolResultError("No playable tracks in playlist"), nil
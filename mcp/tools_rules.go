@@ -0,0 +1,294 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hilli/kefw2ui/rules"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ruleWhenSchema and ruleThenSchema describe a rule's trigger and actions.
+var (
+	ruleWhenSchema = map[string]any{
+		"event":       map[string]any{"type": "string", "enum": rules.EventTypes, "description": "Event that triggers the rule"},
+		"source":      map[string]any{"type": "string", "description": "source event: the new source (wifi, bluetooth, tv, optical, coaxial, analog, usb, standby)"},
+		"power":       map[string]any{"type": "string", "enum": []string{"on", "standby"}, "description": "power event: the new power state"},
+		"title":       map[string]any{"type": "string", "description": "track event: track title"},
+		"artist":      map[string]any{"type": "string", "description": "track event: artist"},
+		"album":       map[string]any{"type": "string", "description": "track event: album"},
+		"state":       map[string]any{"type": "string", "enum": []string{"playing", "paused", "stopped"}, "description": "playback event: the new player state"},
+		"volumeAbove": map[string]any{"type": "integer", "description": "volume event: volume is above this"},
+		"volumeBelow": map[string]any{"type": "integer", "description": "volume event: volume is below this"},
+		"muted":       map[string]any{"type": "boolean", "description": "mute event: the new mute state"},
+		"between":     map[string]any{"type": "string", "description": "Local time window HH:MM-HH:MM, may wrap midnight (22:00-07:00)"},
+	}
+	ruleThenSchema = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":  map[string]any{"type": "string", "enum": rules.ActionTypes},
+			"value": map[string]any{"type": "string", "description": "volume: 0-100, source: source name, scene: scene ID, wait: seconds"},
+		},
+		"required": []string{"type"},
+	}
+)
+
+func (h *Handler) registerRuleTools(s *server.MCPServer) {
+	s.AddTool(mcppkg.NewTool("list_rules",
+		mcppkg.WithDescription("List automation rules ('when <event and conditions> then <actions>')"),
+	), h.handleListRules)
+
+	s.AddTool(mcppkg.NewTool("create_rule",
+		mcppkg.WithDescription("Create an automation rule that runs actions on the active speaker when an event matches, "+
+			"e.g. when source becomes tv then set volume 35, or when track changes and artist is X then skip (next)"),
+		mcppkg.WithString("name",
+			mcppkg.Required(),
+			mcppkg.Description("Rule name"),
+		),
+		mcppkg.WithObject("when",
+			mcppkg.Required(),
+			mcppkg.Description("Trigger event and conditions; all conditions must hold, text matches ignore case"),
+			mcppkg.Properties(ruleWhenSchema),
+		),
+		mcppkg.WithArray("then",
+			mcppkg.Required(),
+			mcppkg.Description("Actions to run in order"),
+			mcppkg.Items(ruleThenSchema),
+		),
+		mcppkg.WithBoolean("enabled",
+			mcppkg.Description("Whether the rule is active (default true)"),
+		),
+	), h.handleCreateRule)
+
+	s.AddTool(mcppkg.NewTool("update_rule",
+		mcppkg.WithDescription("Change an automation rule. Omitted fields are left unchanged."),
+		mcppkg.WithString("rule_id",
+			mcppkg.Required(),
+			mcppkg.Description("The rule ID"),
+		),
+		mcppkg.WithString("name",
+			mcppkg.Description("New name"),
+		),
+		mcppkg.WithObject("when",
+			mcppkg.Description("Replacement trigger"),
+			mcppkg.Properties(ruleWhenSchema),
+		),
+		mcppkg.WithArray("then",
+			mcppkg.Description("Replacement actions"),
+			mcppkg.Items(ruleThenSchema),
+		),
+		mcppkg.WithBoolean("enabled",
+			mcppkg.Description("Enable or disable the rule"),
+		),
+	), h.handleUpdateRule)
+
+	s.AddTool(mcppkg.NewTool("delete_rule",
+		mcppkg.WithDescription("Delete an automation rule"),
+		mcppkg.WithString("rule_id",
+			mcppkg.Required(),
+			mcppkg.Description("The rule ID"),
+		),
+	), h.handleDeleteRule)
+
+	s.AddTool(mcppkg.NewTool("test_rule",
+		mcppkg.WithDescription("Check whether an event would trigger a rule. By default this is a dry run that only lists the actions; set execute to run them."),
+		mcppkg.WithString("rule_id",
+			mcppkg.Required(),
+			mcppkg.Description("The rule ID"),
+		),
+		mcppkg.WithObject("event",
+			mcppkg.Description("Sample event: type (defaults to the rule's trigger), source, power, title, artist, album, state, volume, muted, time (RFC 3339, defaults to now)"),
+		),
+		mcppkg.WithBoolean("execute",
+			mcppkg.Description("Run the actions on the speaker instead of a dry run"),
+		),
+	), h.handleTestRule)
+
+	s.AddTool(mcppkg.NewTool("get_rule_runs",
+		mcppkg.WithDescription("Show a rule's recent executions with the result of each action"),
+		mcppkg.WithString("rule_id",
+			mcppkg.Required(),
+			mcppkg.Description("The rule ID"),
+		),
+	), h.handleGetRuleRuns)
+}
+
+// decodeArgument decodes an object or array argument into target. It reports
+// false when the argument is absent.
+func decodeArgument(req mcppkg.CallToolRequest, key string, target any) (bool, error) {
+	v, ok := req.GetArguments()[key]
+	if !ok || v == nil {
+		return false, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, target)
+}
+
+// notifyRuleChange calls the onRuleChange callback (if set).
+func (h *Handler) notifyRuleChange() {
+	if h.onRuleChange != nil {
+		h.onRuleChange()
+	}
+}
+
+func (h *Handler) handleListRules(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.rules == nil {
+		return mcppkg.NewToolResultError("Rules not available"), nil
+	}
+
+	list, err := h.rules.List()
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to list rules: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"rules":      list,
+		"totalCount": len(list),
+	})), nil
+}
+
+func (h *Handler) handleCreateRule(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.rules == nil {
+		return mcppkg.NewToolResultError("Rules not available"), nil
+	}
+
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcppkg.NewToolResultError("name is required"), nil
+	}
+	rule := rules.Rule{Name: name, Enabled: req.GetBool("enabled", true)}
+	if _, err := decodeArgument(req, "when", &rule.When); err != nil {
+		return mcppkg.NewToolResultError("Invalid when: " + err.Error()), nil
+	}
+	if _, err := decodeArgument(req, "then", &rule.Then); err != nil {
+		return mcppkg.NewToolResultError("Invalid then: " + err.Error()), nil
+	}
+
+	created, err := h.rules.Create(rule)
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to save rule: " + err.Error()), nil
+	}
+	h.notifyRuleChange()
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status": "ok",
+		"rule":   created,
+	})), nil
+}
+
+func (h *Handler) handleUpdateRule(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.rules == nil {
+		return mcppkg.NewToolResultError("Rules not available"), nil
+	}
+
+	id, err := req.RequireString("rule_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("rule_id is required"), nil
+	}
+	rule, err := h.rules.Get(id)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
+	if name := req.GetString("name", ""); name != "" {
+		rule.Name = name
+	}
+	if _, ok := req.GetArguments()["enabled"]; ok {
+		rule.Enabled = req.GetBool("enabled", rule.Enabled)
+	}
+	var when rules.When
+	if ok, err := decodeArgument(req, "when", &when); err != nil {
+		return mcppkg.NewToolResultError("Invalid when: " + err.Error()), nil
+	} else if ok {
+		rule.When = when
+	}
+	var then []rules.Action
+	if ok, err := decodeArgument(req, "then", &then); err != nil {
+		return mcppkg.NewToolResultError("Invalid then: " + err.Error()), nil
+	} else if ok {
+		rule.Then = then
+	}
+
+	updated, err := h.rules.Update(*rule)
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to save rule: " + err.Error()), nil
+	}
+	h.notifyRuleChange()
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status": "ok",
+		"rule":   updated,
+	})), nil
+}
+
+func (h *Handler) handleDeleteRule(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.rules == nil {
+		return mcppkg.NewToolResultError("Rules not available"), nil
+	}
+
+	id, err := req.RequireString("rule_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("rule_id is required"), nil
+	}
+
+	if err := h.rules.Delete(id); err != nil {
+		return mcppkg.NewToolResultError("Failed to delete rule: " + err.Error()), nil
+	}
+	h.rules.Forget(id)
+	h.notifyRuleChange()
+
+	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
+}
+
+func (h *Handler) handleTestRule(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.rules == nil {
+		return mcppkg.NewToolResultError("Rules not available"), nil
+	}
+
+	id, err := req.RequireString("rule_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("rule_id is required"), nil
+	}
+	var event rules.Event
+	if _, err := decodeArgument(req, "event", &event); err != nil {
+		return mcppkg.NewToolResultError("Invalid event: " + err.Error()), nil
+	}
+
+	matched, reason, run, err := h.rules.Test(id, event, req.GetBool("execute", false))
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
+	result := map[string]any{
+		"matched": matched,
+	}
+	if reason != "" {
+		result["reason"] = reason
+	}
+	if run != nil {
+		result["run"] = run
+	}
+	return mcppkg.NewToolResultText(jsonString(result)), nil
+}
+
+func (h *Handler) handleGetRuleRuns(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.rules == nil {
+		return mcppkg.NewToolResultError("Rules not available"), nil
+	}
+
+	id, err := req.RequireString("rule_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("rule_id is required"), nil
+	}
+	if _, err := h.rules.Get(id); err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"runs": h.rules.Runs(id),
+	})), nil
+}
@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"context"
+
+	"github.com/hilli/kefw2ui/scenes"
+	"github.com/hilli/kefw2ui/speaker"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func (h *Handler) registerSceneTools(s *server.MCPServer) {
+	s.AddTool(mcppkg.NewTool("list_scenes",
+		mcppkg.WithDescription("List saved scenes (named speaker states such as 'Movie night' or 'Dinner')"),
+	), h.handleListScenes)
+
+	s.AddTool(mcppkg.NewTool("save_scene",
+		mcppkg.WithDescription("Capture the active speaker's current state (power, source, volume, mute, EQ, play mode, queue, current item and position) as a named scene. Saving under an existing name replaces that scene."),
+		mcppkg.WithString("name",
+			mcppkg.Required(),
+			mcppkg.Description("Scene name, e.g. 'Movie night'"),
+		),
+		mcppkg.WithString("description",
+			mcppkg.Description("Optional description"),
+		),
+	), h.handleSaveScene)
+
+	s.AddTool(mcppkg.NewTool("recall_scene",
+		mcppkg.WithDescription("Restore a saved scene on the active speaker. Returns a report for each step (power, source, mute, volume, eq, queue, playMode, current, position)."),
+		mcppkg.WithString("scene_id",
+			mcppkg.Required(),
+			mcppkg.Description("The scene ID"),
+		),
+	), h.handleRecallScene)
+
+	s.AddTool(mcppkg.NewTool("delete_scene",
+		mcppkg.WithDescription("Delete a saved scene"),
+		mcppkg.WithString("scene_id",
+			mcppkg.Required(),
+			mcppkg.Description("The scene ID"),
+		),
+	), h.handleDeleteScene)
+}
+
+// sceneSummary returns a compact description of a scene for tool results,
+// leaving out the stored queue items.
+func sceneSummary(sc *scenes.Scene) map[string]any {
+	summary := map[string]any{
+		"id":         sc.ID,
+		"name":       sc.Name,
+		"poweredOn":  sc.State.PoweredOn,
+		"source":     sc.State.Source,
+		"volume":     sc.State.Volume,
+		"muted":      sc.State.Muted,
+		"queueSize":  len(sc.State.Queue),
+		"playing":    sc.State.Playing,
+		"updatedAt":  sc.UpdatedAt,
+		"playMode":   sc.State.PlayMode,
+		"positionMs": sc.State.Position,
+	}
+	if sc.Description != "" {
+		summary["description"] = sc.Description
+	}
+	if sc.State.EQ != nil {
+		summary["eqProfile"] = sc.State.EQ.ProfileName
+	}
+	if sc.State.Current != nil {
+		summary["current"] = sc.State.Current.Title
+	}
+	return summary
+}
+
+// notifySceneChange calls the onSceneChange callback (if set).
+func (h *Handler) notifySceneChange() {
+	if h.onSceneChange != nil {
+		h.onSceneChange()
+	}
+}
+
+func (h *Handler) handleListScenes(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.scenes == nil {
+		return mcppkg.NewToolResultError("Scenes not available"), nil
+	}
+
+	list, err := h.scenes.List()
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to list scenes: " + err.Error()), nil
+	}
+
+	result := make([]map[string]any, 0, len(list))
+	for i := range list {
+		result = append(result, sceneSummary(&list[i]))
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"scenes":     result,
+		"totalCount": len(result),
+	})), nil
+}
+
+func (h *Handler) handleSaveScene(ctx context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.scenes == nil {
+		return mcppkg.NewToolResultError("Scenes not available"), nil
+	}
+
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcppkg.NewToolResultError("name is required"), nil
+	}
+
+	state, err := scenes.Capture(ctx, spk)
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to capture scene: " + err.Error()), nil
+	}
+
+	scene, err := h.scenes.Save(name, req.GetString("description", ""), state)
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to save scene: " + err.Error()), nil
+	}
+	h.notifySceneChange()
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"scene": sceneSummary(scene),
+	})), nil
+}
+
+func (h *Handler) handleRecallScene(ctx context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.scenes == nil {
+		return mcppkg.NewToolResultError("Scenes not available"), nil
+	}
+
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+
+	id, err := req.RequireString("scene_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("scene_id is required"), nil
+	}
+
+	scene, err := h.scenes.Get(id)
+	if err != nil {
+		return mcppkg.NewToolResultError("Scene not found: " + err.Error()), nil
+	}
+
+	steps := scenes.Recall(ctx, spk, scene.State, h.manager.VolumeSetter(spk, speaker.OriginScene))
+
+	if scene.State.PoweredOn {
+		h.manager.NotifyWake()
+	} else {
+		h.manager.NotifyStandby()
+	}
+	if h.onSceneRecall != nil {
+		h.onSceneRecall(scene, steps)
+	}
+
+	status := "ok"
+	if scenes.Failed(steps) > 0 {
+		status = "partial"
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status": status,
+		"scene":  scene.Name,
+		"steps":  steps,
+	})), nil
+}
+
+func (h *Handler) handleDeleteScene(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.scenes == nil {
+		return mcppkg.NewToolResultError("Scenes not available"), nil
+	}
+
+	id, err := req.RequireString("scene_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("scene_id is required"), nil
+	}
+
+	if err := h.scenes.Delete(id); err != nil {
+		return mcppkg.NewToolResultError("Failed to delete scene: " + err.Error()), nil
+	}
+	h.notifySceneChange()
+
+	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
+}
@@ -3,7 +3,9 @@ package mcp
 import (
 	"context"
 	"strings"
+	"time"
 
+	"github.com/hilli/kefw2ui/config"
 	mcppkg "github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
@@ -34,6 +36,51 @@ func (h *Handler) registerSpeakerTools(s *server.MCPServer) {
 	s.AddTool(mcppkg.NewTool("get_speaker_info",
 		mcppkg.WithDescription("Get detailed information about the active speaker including model, firmware, and capabilities"),
 	), h.handleGetSpeakerInfo)
+
+	s.AddTool(mcppkg.NewTool("get_source_presets",
+		mcppkg.WithDescription("Get the active speaker's per-source volume presets: the last volume and mute state used on each source, and whether they are restored when the source comes on"),
+	), h.handleGetSourcePresets)
+
+	s.AddTool(mcppkg.NewTool("set_source_preset",
+		mcppkg.WithDescription("Configure a source's volume preset on the active speaker, e.g. restore volume 25 whenever the TV source comes on"),
+		mcppkg.WithString("source",
+			mcppkg.Required(),
+			mcppkg.Description("Source: wifi, bluetooth, aux, optical, coaxial, tv, usb"),
+		),
+		mcppkg.WithBoolean("restore",
+			mcppkg.Description("Restore the volume when the source comes on"),
+		),
+		mcppkg.WithBoolean("restore_mute",
+			mcppkg.Description("Restore the mute state as well"),
+		),
+		mcppkg.WithNumber("volume",
+			mcppkg.Description("Volume to restore (0-100); defaults to the last volume used on the source"),
+			mcppkg.Min(0),
+			mcppkg.Max(100),
+		),
+	), h.handleSetSourcePreset)
+
+	s.AddTool(mcppkg.NewTool("get_quiet_hours",
+		mcppkg.WithDescription("Get the active speaker's quiet hours (time windows with a volume cap) and the cap in effect now"),
+	), h.handleGetQuietHours)
+
+	s.AddTool(mcppkg.NewTool("set_quiet_hours",
+		mcppkg.WithDescription("Replace the active speaker's quiet hours. While a window is active, volume changes above its cap are limited, including ones from the remote. Pass an empty list to remove all windows."),
+		mcppkg.WithArray("windows",
+			mcppkg.Required(),
+			mcppkg.Description("Quiet hours windows"),
+			mcppkg.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"start":     map[string]any{"type": "string", "description": "Start time HH:MM (local)"},
+					"end":       map[string]any{"type": "string", "description": "End time HH:MM; before start wraps past midnight"},
+					"maxVolume": map[string]any{"type": "integer", "description": "Volume cap (0-100)"},
+					"disabled":  map[string]any{"type": "boolean"},
+				},
+				"required": []string{"start", "end", "maxVolume"},
+			}),
+		),
+	), h.handleSetQuietHours)
 }
 
 func (h *Handler) handleListSpeakers(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
@@ -170,3 +217,104 @@ func (h *Handler) handleGetSpeakerInfo(ctx context.Context, _ mcppkg.CallToolReq
 
 	return mcppkg.NewToolResultText(jsonString(info)), nil
 }
+
+func (h *Handler) handleGetSourcePresets(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"speaker":       spk.Name,
+		"sourcePresets": h.config.GetSourcePresets(spk.IPAddress),
+	})), nil
+}
+
+func (h *Handler) handleSetSourcePreset(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	sourceName, err := req.RequireString("source")
+	if err != nil {
+		return mcppkg.NewToolResultError("source is required"), nil
+	}
+	source, ok := sourceMap[sourceName]
+	if !ok {
+		return mcppkg.NewToolResultError("Unknown source: " + sourceName + ". Valid sources: wifi, bluetooth, aux, optical, coaxial, tv, usb"), nil
+	}
+
+	preset := h.config.GetSourcePresets(spk.IPAddress)[string(source)]
+	args := req.GetArguments()
+	if _, ok := args["restore"]; ok {
+		preset.Restore = req.GetBool("restore", preset.Restore)
+	}
+	if _, ok := args["restore_mute"]; ok {
+		preset.RestoreMute = req.GetBool("restore_mute", preset.RestoreMute)
+	}
+	if _, ok := args["volume"]; ok {
+		volume := req.GetInt("volume", -1)
+		if volume < 0 || volume > 100 {
+			return mcppkg.NewToolResultError("volume must be between 0 and 100"), nil
+		}
+		preset.Volume = &volume
+	}
+
+	if err := h.config.SetSourcePreset(spk.IPAddress, string(source), preset); err != nil {
+		return mcppkg.NewToolResultError("Failed to save source preset: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"source": string(source),
+		"preset": preset,
+	})), nil
+}
+
+func (h *Handler) handleGetQuietHours(_ context.Context, _ mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	result := map[string]any{
+		"speaker":    spk.Name,
+		"quietHours": h.config.GetQuietHours(spk.IPAddress),
+	}
+	if limit, ok := h.config.VolumeCap(spk.IPAddress, time.Now()); ok {
+		result["volumeCap"] = limit
+	}
+	return mcppkg.NewToolResultText(jsonString(result)), nil
+}
+
+func (h *Handler) handleSetQuietHours(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+	if h.config == nil {
+		return mcppkg.NewToolResultError("Config not available"), nil
+	}
+
+	windows := []config.QuietHours{}
+	if _, err := decodeArgument(req, "windows", &windows); err != nil {
+		return mcppkg.NewToolResultError("Invalid windows: " + err.Error()), nil
+	}
+	if err := h.config.SetQuietHours(spk.IPAddress, windows); err != nil {
+		return mcppkg.NewToolResultError("Failed to save quiet hours: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status":     "ok",
+		"quietHours": windows,
+	})), nil
+}
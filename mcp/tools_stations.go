@@ -0,0 +1,306 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+	"github.com/hilli/kefw2ui/stations"
+	mcppkg "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func (h *Handler) registerStationTools(s *server.MCPServer) {
+	s.AddTool(mcppkg.NewTool("list_stations",
+		mcppkg.WithDescription("List user-defined internet radio stations (the 'My Stations' folder)"),
+		mcppkg.WithString("query",
+			mcppkg.Description("Optional filter on station name or tag"),
+		),
+		limitOption(),
+		cursorOption(),
+	), h.handleListStations)
+
+	s.AddTool(mcppkg.NewTool("add_station",
+		mcppkg.WithDescription("Add a custom internet radio station by stream URL"),
+		mcppkg.WithString("name",
+			mcppkg.Required(),
+			mcppkg.Description("Station name"),
+		),
+		mcppkg.WithString("url",
+			mcppkg.Required(),
+			mcppkg.Description("HTTP(S) stream URL"),
+		),
+		mcppkg.WithString("logo",
+			mcppkg.Description("Optional logo image URL"),
+		),
+		mcppkg.WithArray("tags",
+			mcppkg.Description("Optional tags (e.g. genre, country)"),
+			mcppkg.WithStringItems(),
+		),
+		mcppkg.WithString("mime_type",
+			mcppkg.Description("Optional stream MIME type (guessed from the URL when omitted)"),
+		),
+	), h.handleAddStation)
+
+	s.AddTool(mcppkg.NewTool("update_station",
+		mcppkg.WithDescription("Update a custom internet radio station"),
+		mcppkg.WithString("station_id",
+			mcppkg.Required(),
+			mcppkg.Description("The station ID"),
+		),
+		mcppkg.WithString("name",
+			mcppkg.Description("New station name"),
+		),
+		mcppkg.WithString("url",
+			mcppkg.Description("New HTTP(S) stream URL"),
+		),
+		mcppkg.WithString("logo",
+			mcppkg.Description("New logo image URL"),
+		),
+		mcppkg.WithArray("tags",
+			mcppkg.Description("Replacement tags"),
+			mcppkg.WithStringItems(),
+		),
+		mcppkg.WithString("mime_type",
+			mcppkg.Description("New stream MIME type"),
+		),
+	), h.handleUpdateStation)
+
+	s.AddTool(mcppkg.NewTool("delete_station",
+		mcppkg.WithDescription("Delete a custom internet radio station"),
+		mcppkg.WithString("station_id",
+			mcppkg.Required(),
+			mcppkg.Description("The station ID to delete"),
+		),
+	), h.handleDeleteStation)
+
+	s.AddTool(mcppkg.NewTool("play_station",
+		mcppkg.WithDescription("Play a custom internet radio station"),
+		mcppkg.WithString("station_id",
+			mcppkg.Required(),
+			mcppkg.Description("The station ID to play"),
+		),
+	), h.handlePlayStation)
+
+	s.AddTool(mcppkg.NewTool("play_url",
+		mcppkg.WithDescription("Play an arbitrary HTTP(S) audio URL (stream or file) on the active speaker"),
+		mcppkg.WithString("url",
+			mcppkg.Required(),
+			mcppkg.Description("HTTP(S) audio URL"),
+		),
+		mcppkg.WithString("title",
+			mcppkg.Description("Title to display (defaults to the URL)"),
+		),
+		mcppkg.WithString("artist",
+			mcppkg.Description("Artist to display"),
+		),
+		mcppkg.WithString("artwork",
+			mcppkg.Description("Artwork image URL"),
+		),
+		mcppkg.WithString("mime_type",
+			mcppkg.Description("Audio MIME type (guessed from the URL when omitted)"),
+		),
+		mcppkg.WithBoolean("queue",
+			mcppkg.Description("If true, append to the queue instead of replacing it"),
+		),
+	), h.handlePlayURL)
+}
+
+// stationToMap converts a station to the MCP browse item representation.
+func stationToMap(st *stations.Station) map[string]any {
+	item := map[string]any{
+		"id":        st.ID,
+		"title":     st.Name,
+		"type":      "audio",
+		"path":      st.Path(),
+		"url":       st.URL,
+		"playable":  true,
+		"audioType": "audioBroadcast",
+	}
+	if st.Logo != "" {
+		item["icon"] = st.Logo
+	}
+	if len(st.Tags) > 0 {
+		item["tags"] = st.Tags
+	}
+	return item
+}
+
+// getStation looks up a custom station by its browse path.
+func (h *Handler) getStation(path string) (*stations.Station, error) {
+	if h.stations == nil {
+		return nil, fmt.Errorf("station manager not available")
+	}
+	return h.stations.Get(stations.IDFromPath(path))
+}
+
+func (h *Handler) handleListStations(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.stations == nil {
+		return mcppkg.NewToolResultError("Station manager not available"), nil
+	}
+
+	page, err := pageFromRequest(req)
+	if err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
+	list, err := h.stations.List()
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to list stations: " + err.Error()), nil
+	}
+
+	query := req.GetString("query", "")
+	items := make([]map[string]any, 0, len(list))
+	for i := range list {
+		if list[i].Matches(query) {
+			items = append(items, stationToMap(&list[i]))
+		}
+	}
+
+	totalCount := len(items)
+	items = pageItems(page, items)
+
+	return mcppkg.NewToolResultText(jsonString(page.addTo(map[string]any{
+		"items":      items,
+		"totalCount": totalCount,
+		"source":     "radio",
+	}, len(items), totalCount))), nil
+}
+
+func (h *Handler) handleAddStation(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.stations == nil {
+		return mcppkg.NewToolResultError("Station manager not available"), nil
+	}
+
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcppkg.NewToolResultError("name is required"), nil
+	}
+	streamURL, err := req.RequireString("url")
+	if err != nil {
+		return mcppkg.NewToolResultError("url is required"), nil
+	}
+
+	st, err := h.stations.Create(name, streamURL,
+		req.GetString("logo", ""),
+		req.GetStringSlice("tags", nil),
+		req.GetString("mime_type", ""))
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to add station: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{"station": st})), nil
+}
+
+func (h *Handler) handleUpdateStation(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.stations == nil {
+		return mcppkg.NewToolResultError("Station manager not available"), nil
+	}
+
+	id, err := req.RequireString("station_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("station_id is required"), nil
+	}
+
+	// Get existing station to preserve values not being updated
+	existing, err := h.stations.Get(id)
+	if err != nil {
+		return mcppkg.NewToolResultError("Station not found: " + err.Error()), nil
+	}
+
+	st, err := h.stations.Update(id,
+		req.GetString("name", existing.Name),
+		req.GetString("url", existing.URL),
+		req.GetString("logo", existing.Logo),
+		req.GetStringSlice("tags", existing.Tags),
+		req.GetString("mime_type", existing.MimeType))
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to update station: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{"station": st})), nil
+}
+
+func (h *Handler) handleDeleteStation(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.stations == nil {
+		return mcppkg.NewToolResultError("Station manager not available"), nil
+	}
+
+	id, err := req.RequireString("station_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("station_id is required"), nil
+	}
+
+	if err := h.stations.Delete(id); err != nil {
+		return mcppkg.NewToolResultError("Failed to delete station: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(`{"status":"ok"}`), nil
+}
+
+func (h *Handler) handlePlayStation(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	if h.stations == nil {
+		return mcppkg.NewToolResultError("Station manager not available"), nil
+	}
+
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+
+	id, err := req.RequireString("station_id")
+	if err != nil {
+		return mcppkg.NewToolResultError("station_id is required"), nil
+	}
+
+	st, err := h.stations.Get(id)
+	if err != nil {
+		return mcppkg.NewToolResultError("Station not found: " + err.Error()), nil
+	}
+
+	airable := kefw2.NewAirableClient(spk)
+	if err := airable.PlayUPnPTracks([]kefw2.ContentItem{st.ContentItem()}); err != nil {
+		return mcppkg.NewToolResultError("Failed to play: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status":  "ok",
+		"station": st.Name,
+	})), nil
+}
+
+func (h *Handler) handlePlayURL(_ context.Context, req mcppkg.CallToolRequest) (*mcppkg.CallToolResult, error) {
+	spk := h.manager.GetActiveSpeaker()
+	if spk == nil {
+		return noSpeakerError(), nil
+	}
+
+	streamURL, err := req.RequireString("url")
+	if err != nil {
+		return mcppkg.NewToolResultError("url is required"), nil
+	}
+	if err := stations.ValidateURL(streamURL); err != nil {
+		return mcppkg.NewToolResultError(err.Error()), nil
+	}
+
+	item := stations.StreamItem(streamURL,
+		req.GetString("title", ""),
+		req.GetString("artist", ""),
+		req.GetString("artwork", ""),
+		req.GetString("mime_type", ""))
+
+	airable := kefw2.NewAirableClient(spk)
+	if req.GetBool("queue", false) {
+		err = airable.AddToQueue([]kefw2.ContentItem{item}, true)
+	} else {
+		err = airable.PlayUPnPTracks([]kefw2.ContentItem{item})
+	}
+	if err != nil {
+		return mcppkg.NewToolResultError("Failed to play URL: " + err.Error()), nil
+	}
+
+	return mcppkg.NewToolResultText(jsonString(map[string]any{
+		"status": "ok",
+		"title":  item.Title,
+	})), nil
+}
@@ -0,0 +1,37 @@
+package mpd
+
+import (
+	"net"
+
+	"github.com/hilli/kefw2ui/audit"
+)
+
+// clientCaller returns the audit caller of a connection: the client's
+// address and, after the password command, its identity.
+func clientCaller(c *client) audit.Caller {
+	addr := c.conn.RemoteAddr().String()
+	caller := audit.Caller{IP: addr}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		caller.IP = host
+	}
+	if id := c.identity; id != nil {
+		caller.Name, caller.Method, caller.Role = id.Name, id.Method, string(id.Role)
+	}
+	return caller
+}
+
+// record adds a finished command to the audit log.
+func (s *Server) record(c *client, args []string, ack *ackError) {
+	entry := audit.Entry{
+		Source: audit.SourceMPD,
+		Action: args[0],
+		Caller: clientCaller(c),
+	}
+	if len(args) > 1 {
+		entry.Params = map[string]any{"args": args[1:]}
+	}
+	if ack != nil {
+		entry.Error = ack.message
+	}
+	s.opts.Audit.Record(entry)
+}
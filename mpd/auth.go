@@ -0,0 +1,69 @@
+package mpd
+
+import (
+	"fmt"
+
+	"github.com/hilli/kefw2ui/auth"
+)
+
+// publicCommands need no role: connection setup and the password command.
+var publicCommands = map[string]bool{
+	"ping": true, "password": true, "binarylimit": true, "tagtypes": true,
+	"commands": true, "notcommands": true,
+}
+
+// controlCommands change the speaker, the queue or stored playlists. They
+// need the controller role and are recorded in the audit log; everything
+// else only reads and needs the viewer role.
+var controlCommands = map[string]bool{
+	"play": true, "playid": true, "pause": true, "stop": true,
+	"next": true, "previous": true,
+	"seekcur": true, "seek": true, "seekid": true,
+	"setvol": true, "volume": true,
+	"random": true, "repeat": true, "single": true,
+	"add": true, "addid": true, "delete": true, "deleteid": true,
+	"move": true, "moveid": true, "clear": true,
+	"load": true, "searchadd": true, "findadd": true,
+}
+
+// commandRole returns the role a command needs, or "" for none.
+func commandRole(command string) auth.Role {
+	switch {
+	case publicCommands[command]:
+		return ""
+	case controlCommands[command]:
+		return auth.RoleController
+	}
+	return auth.RoleViewer
+}
+
+// authorize checks that the connection may run a command. Everything is
+// allowed when authentication is disabled.
+func (s *Server) authorize(c *client, command string) *ackError {
+	required := commandRole(command)
+	if s.opts.Authenticate == nil || required == "" {
+		return nil
+	}
+	if id := c.identity; id != nil && id.Role.Allows(required) {
+		return nil
+	}
+	return &ackError{code: ackErrorPermission, message: fmt.Sprintf("you don't have permission for %q", command)}
+}
+
+// password identifies the connection with an API token or a local user's
+// "username:password". The connection keeps its role when the password is
+// wrong, as MPD does.
+func (s *Server) password(c *client, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"password\"")
+	}
+	if s.opts.Authenticate == nil {
+		return nil
+	}
+	id := s.opts.Authenticate(args[0])
+	if id == nil {
+		return &ackError{code: ackErrorPassword, message: "incorrect password"}
+	}
+	c.identity = id
+	return nil
+}
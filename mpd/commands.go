@@ -0,0 +1,1004 @@
+package mpd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// commandTimeout bounds the speaker calls made for one command.
+const commandTimeout = 15 * time.Second
+
+// commandFunc implements an MPD command. args excludes the command name.
+type commandFunc func(ctx context.Context, w *bufio.Writer, args []string) *ackError
+
+// commandTable returns the supported commands.
+func (s *Server) commandTable() map[string]commandFunc {
+	return map[string]commandFunc{
+		// Connection
+		"ping":        noop,
+		"binarylimit": noop,
+		"tagtypes":    s.cmdTagTypes,
+		"commands":    s.cmdCommands,
+		"notcommands": noop,
+		"urlhandlers": s.cmdURLHandlers,
+		"decoders":    noop,
+		"outputs":     s.cmdOutputs,
+		"replay_gain_status": func(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+			writePair(w, "replay_gain_mode", "off")
+			return nil
+		},
+
+		// Status
+		"status":      s.cmdStatus,
+		"currentsong": s.cmdCurrentSong,
+		"stats":       s.cmdStats,
+
+		// Playback
+		"play":     s.cmdPlay,
+		"playid":   s.cmdPlayID,
+		"pause":    s.cmdPause,
+		"stop":     s.cmdStop,
+		"next":     s.cmdNext,
+		"previous": s.cmdPrevious,
+		"seekcur":  s.cmdSeekCur,
+		"seek":     s.cmdSeek,
+		"seekid":   s.cmdSeekID,
+		"setvol":   s.cmdSetVol,
+		"volume":   s.cmdVolume,
+		"getvol":   s.cmdGetVol,
+		"random":   s.cmdRandom,
+		"repeat":   s.cmdRepeat,
+		"single":   s.cmdSingle,
+		"consume":  noop,
+
+		// Queue
+		"playlistinfo":   s.cmdPlaylistInfo,
+		"playlistid":     s.cmdPlaylistID,
+		"plchanges":      s.cmdPlChanges,
+		"plchangesposid": s.cmdPlChangesPosID,
+		"add":            s.cmdAdd,
+		"addid":          s.cmdAddID,
+		"delete":         s.cmdDelete,
+		"deleteid":       s.cmdDeleteID,
+		"move":           s.cmdMove,
+		"moveid":         s.cmdMoveID,
+		"clear":          s.cmdClear,
+
+		// Stored playlists
+		"listplaylists":    s.cmdListPlaylists,
+		"listplaylist":     s.cmdListPlaylist,
+		"listplaylistinfo": s.cmdListPlaylistInfo,
+		"load":             s.cmdLoad,
+
+		// Database
+		"search":      s.cmdSearch,
+		"find":        s.cmdFind,
+		"searchadd":   s.cmdSearchAdd,
+		"findadd":     s.cmdFindAdd,
+		"list":        s.cmdList,
+		"count":       s.cmdCount,
+		"lsinfo":      s.cmdLsInfo,
+		"listall":     s.cmdListAll,
+		"listallinfo": s.cmdListAllInfo,
+	}
+}
+
+// run executes one command.
+func (s *Server) run(c *client, args []string) *ackError {
+	if args[0] == "password" {
+		return s.password(c, args[1:])
+	}
+	fn, ok := s.commands[args[0]]
+	if !ok {
+		return &ackError{code: ackErrorUnknown, message: fmt.Sprintf("unknown command %q", args[0])}
+	}
+	if ack := s.authorize(c, args[0]); ack != nil {
+		return ack
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	if s.opts.Audit == nil || !controlCommands[args[0]] {
+		return fn(ctx, c.w, args[1:])
+	}
+	s.opts.Audit.NoteLocalChange()
+	ack := fn(ctx, c.w, args[1:])
+	s.record(c, args, ack)
+	return ack
+}
+
+func noop(context.Context, *bufio.Writer, []string) *ackError {
+	return nil
+}
+
+// activeSpeaker returns the active speaker or an ACK error.
+func (s *Server) activeSpeaker() (*kefw2.KEFSpeaker, *ackError) {
+	spk := s.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		return nil, systemError("No active speaker")
+	}
+	return spk, nil
+}
+
+// tagTypes are the song tags this server reports.
+var tagTypes = []string{"Artist", "AlbumArtist", "Album", "Title"}
+
+func (s *Server) cmdTagTypes(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	// "tagtypes clear/all/enable/disable" only change what is reported;
+	// the tag set here is small enough to always send everything
+	if len(args) > 0 {
+		return nil
+	}
+	for _, t := range tagTypes {
+		writePair(w, "tagtype", t)
+	}
+	return nil
+}
+
+func (s *Server) cmdCommands(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	names := make([]string, 0, len(s.commands)+4)
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	names = append(names, "close", "idle", "noidle", "password", "command_list_begin")
+	sort.Strings(names)
+	for _, name := range names {
+		writePair(w, "command", name)
+	}
+	return nil
+}
+
+func (s *Server) cmdURLHandlers(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	writePair(w, "handler", "http://")
+	writePair(w, "handler", "https://")
+	return nil
+}
+
+func (s *Server) cmdOutputs(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	name := "KEF"
+	if spk := s.opts.Manager.GetActiveSpeaker(); spk != nil && spk.Name != "" {
+		name = spk.Name
+	}
+	writePair(w, "outputid", "0")
+	writePair(w, "outputname", name)
+	writePair(w, "plugin", "kefw2")
+	writePair(w, "outputenabled", "1")
+	return nil
+}
+
+// Status
+
+// playerState maps the speaker's player state to MPD's.
+func playerState(state string) string {
+	switch state {
+	case kefw2.PlayerStatePlaying:
+		return "play"
+	case kefw2.PlayerStatePaused:
+		return "pause"
+	default:
+		return "stop"
+	}
+}
+
+// playModes returns MPD's repeat and single flags for the speaker's repeat
+// mode. Repeat-one is reported as repeat with single.
+func playModes(airable *kefw2.AirableClient) (repeat, single, random bool) {
+	mode, _ := airable.GetRepeatMode()
+	random, _ = airable.IsShuffleEnabled()
+	return mode == "all" || mode == "one", mode == "one", random
+}
+
+func (s *Server) cmdStatus(ctx context.Context, w *bufio.Writer, _ []string) *ackError {
+	writePair(w, "playlist", strconv.FormatUint(uint64(s.queueVersion()), 10))
+
+	spk := s.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		writePair(w, "playlistlength", "0")
+		writePair(w, "state", "stop")
+		return nil
+	}
+
+	airable := kefw2.NewAirableClient(spk)
+	if volume, err := spk.GetVolume(ctx); err == nil {
+		writePair(w, "volume", strconv.Itoa(volume))
+	}
+	repeat, single, random := playModes(airable)
+	writePair(w, "repeat", boolString(repeat))
+	writePair(w, "random", boolString(random))
+	writePair(w, "single", boolString(single))
+	writePair(w, "consume", "0")
+
+	var rows []kefw2.ContentItem
+	if queue, err := airable.GetPlayQueue(); err == nil {
+		rows = queue.Rows
+	}
+	writePair(w, "playlistlength", strconv.Itoa(len(rows)))
+
+	pd, err := spk.PlayerData(ctx)
+	if err != nil {
+		writePair(w, "state", "stop")
+		return nil
+	}
+	state := playerState(pd.State)
+	writePair(w, "state", state)
+
+	if pos := queuePosition(rows, pd); pos >= 0 {
+		writePair(w, "song", strconv.Itoa(pos))
+		writePair(w, "songid", strconv.Itoa(songID(rows[pos], pos)))
+		if pos+1 < len(rows) {
+			writePair(w, "nextsong", strconv.Itoa(pos+1))
+			writePair(w, "nextsongid", strconv.Itoa(songID(rows[pos+1], pos+1)))
+		}
+	}
+
+	if state != "stop" {
+		elapsed, _ := spk.SongProgressMS(ctx)
+		duration := pd.Status.Duration
+		writePair(w, "time", fmt.Sprintf("%d:%d", elapsed/1000, duration/1000))
+		writePair(w, "elapsed", formatSeconds(elapsed))
+		if duration > 0 {
+			writePair(w, "duration", formatSeconds(duration))
+		}
+	}
+	return nil
+}
+
+func (s *Server) cmdCurrentSong(ctx context.Context, w *bufio.Writer, _ []string) *ackError {
+	spk := s.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		return nil
+	}
+	pd, err := spk.PlayerData(ctx)
+	if err != nil || pd.TrackRoles.Title == "" {
+		return nil
+	}
+
+	if queue, err := kefw2.NewAirableClient(spk).GetPlayQueue(); err == nil {
+		if pos := queuePosition(queue.Rows, pd); pos >= 0 {
+			writeQueueSong(w, queue.Rows[pos], pos)
+			return nil
+		}
+	}
+
+	// Not playing from the queue (radio, AirPlay, ...)
+	file := pd.TrackRoles.Path
+	if res := pd.MediaRoles.MediaData.Resources; len(res) > 0 && res[0].URI != "" {
+		file = res[0].URI
+	}
+	writeSong(w, song{
+		file:     file,
+		title:    pd.TrackRoles.Title,
+		artist:   pd.TrackRoles.MediaData.MetaData.Artist,
+		album:    pd.TrackRoles.MediaData.MetaData.Album,
+		duration: pd.Status.Duration,
+		pos:      -1,
+	})
+	return nil
+}
+
+func (s *Server) cmdStats(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	artists, albums, songs := 0, 0, 0
+	dbUpdate := int64(0)
+	if index := loadIndex(); index != nil {
+		artistSet, albumSet := map[string]bool{}, map[string]bool{}
+		for i := range index.Tracks {
+			artistSet[index.Tracks[i].Artist] = true
+			albumSet[index.Tracks[i].Album] = true
+		}
+		artists, albums, songs = len(artistSet), len(albumSet), len(index.Tracks)
+		dbUpdate = index.IndexedAt.Unix()
+	}
+
+	writePair(w, "artists", strconv.Itoa(artists))
+	writePair(w, "albums", strconv.Itoa(albums))
+	writePair(w, "songs", strconv.Itoa(songs))
+	writePair(w, "uptime", strconv.Itoa(int(time.Since(s.started).Seconds())))
+	writePair(w, "playtime", "0")
+	writePair(w, "db_playtime", "0")
+	writePair(w, "db_update", strconv.FormatInt(dbUpdate, 10))
+	return nil
+}
+
+// Playback
+
+func (s *Server) cmdPlay(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	airable := kefw2.NewAirableClient(spk)
+
+	if len(args) == 0 || args[0] == "-1" {
+		if _, err := airable.PlayOrResumeFromQueue(ctx); err != nil {
+			return systemError("Failed to play: %v", err)
+		}
+		return nil
+	}
+
+	pos, ack := intArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	return playPosition(airable, pos)
+}
+
+func (s *Server) cmdPlayID(ctx context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return s.cmdPlay(ctx, w, nil)
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	airable := kefw2.NewAirableClient(spk)
+
+	pos, ack := positionForID(airable, args[0])
+	if ack != nil {
+		return ack
+	}
+	return playPosition(airable, pos)
+}
+
+// playPosition starts playback at a queue position.
+func playPosition(airable *kefw2.AirableClient, pos int) *ackError {
+	queue, err := airable.GetPlayQueue()
+	if err != nil {
+		return systemError("Failed to get queue: %v", err)
+	}
+	if pos < 0 || pos >= len(queue.Rows) {
+		return argError("Bad song index")
+	}
+	if err := airable.PlayQueueIndex(pos, &queue.Rows[pos]); err != nil {
+		return systemError("Failed to play: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdPause(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+
+	pd, err := spk.PlayerData(ctx)
+	if err != nil {
+		return systemError("Failed to get player state: %v", err)
+	}
+
+	toggle := true
+	if len(args) > 0 {
+		pause, ack := boolArg(args[0])
+		if ack != nil {
+			return ack
+		}
+		// Only toggle when the speaker is not already in the requested state
+		toggle = (pause && pd.State == kefw2.PlayerStatePlaying) || (!pause && pd.State == kefw2.PlayerStatePaused)
+	} else if pd.State == kefw2.PlayerStateStopped {
+		toggle = false
+	}
+
+	if toggle {
+		if err := spk.PlayPause(ctx); err != nil {
+			return systemError("Failed to pause: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) cmdStop(ctx context.Context, _ *bufio.Writer, _ []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	if err := spk.Stop(ctx); err != nil {
+		return systemError("Failed to stop: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdNext(ctx context.Context, _ *bufio.Writer, _ []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	if err := spk.NextTrack(ctx); err != nil {
+		return systemError("Failed to skip: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdPrevious(ctx context.Context, _ *bufio.Writer, _ []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	if err := spk.PreviousTrack(ctx); err != nil {
+		return systemError("Failed to go back: %v", err)
+	}
+	return nil
+}
+
+// parseSeekTime parses a time in fractional seconds into milliseconds.
+func parseSeekTime(s string) (int64, *ackError) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, argError("Number expected: %s", s)
+	}
+	return int64(secs * 1000), nil
+}
+
+func (s *Server) cmdSeekCur(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"seekcur\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+
+	target, ack := parseSeekTime(args[0])
+	if ack != nil {
+		return ack
+	}
+	// "+N" and "-N" seek relative to the current position
+	if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+		elapsed, err := spk.SongProgressMS(ctx)
+		if err != nil {
+			return systemError("Failed to get position: %v", err)
+		}
+		target = max(int64(elapsed)+target, 0)
+	}
+
+	if err := spk.SeekTo(ctx, target); err != nil {
+		return systemError("Failed to seek: %v", err)
+	}
+	return nil
+}
+
+// seekPosition plays the queue position pos if it is not current and seeks
+// to time.
+func (s *Server) seekPosition(ctx context.Context, spk *kefw2.KEFSpeaker, pos int, time string) *ackError {
+	target, ack := parseSeekTime(time)
+	if ack != nil {
+		return ack
+	}
+
+	airable := kefw2.NewAirableClient(spk)
+	current, _ := airable.GetCurrentQueueIndex()
+	if current != pos {
+		if ack := playPosition(airable, pos); ack != nil {
+			return ack
+		}
+	}
+
+	if err := spk.SeekTo(ctx, target); err != nil {
+		return systemError("Failed to seek: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdSeek(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 2 {
+		return argError("wrong number of arguments for \"seek\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	pos, ack := intArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	return s.seekPosition(ctx, spk, pos, args[1])
+}
+
+func (s *Server) cmdSeekID(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 2 {
+		return argError("wrong number of arguments for \"seekid\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	pos, ack := positionForID(kefw2.NewAirableClient(spk), args[0])
+	if ack != nil {
+		return ack
+	}
+	return s.seekPosition(ctx, spk, pos, args[1])
+}
+
+func (s *Server) cmdSetVol(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"setvol\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	volume, ack := intArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	if volume < 0 || volume > 100 {
+		return argError("Invalid volume value")
+	}
+	if _, err := s.opts.Manager.SetVolume(ctx, spk, volume, speaker.OriginMPD); err != nil {
+		return systemError("Failed to set volume: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdVolume(ctx context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"volume\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	delta, ack := intArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	current, err := spk.GetVolume(ctx)
+	if err != nil {
+		return systemError("Failed to get volume: %v", err)
+	}
+	if _, err := s.opts.Manager.SetVolume(ctx, spk, min(max(current+delta, 0), 100), speaker.OriginMPD); err != nil {
+		return systemError("Failed to set volume: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdGetVol(ctx context.Context, w *bufio.Writer, _ []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	volume, err := spk.GetVolume(ctx)
+	if err != nil {
+		return systemError("Failed to get volume: %v", err)
+	}
+	writePair(w, "volume", strconv.Itoa(volume))
+	return nil
+}
+
+func (s *Server) cmdRandom(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"random\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	random, ack := boolArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	if err := kefw2.NewAirableClient(spk).SetShuffle(random); err != nil {
+		return systemError("Failed to set random: %v", err)
+	}
+	return nil
+}
+
+// setRepeat applies MPD's repeat and single flags as the speaker's repeat
+// mode; single maps to repeat-one.
+func (s *Server) setRepeat(update func(repeat, single bool) (bool, bool)) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	airable := kefw2.NewAirableClient(spk)
+	repeat, single, _ := playModes(airable)
+	repeat, single = update(repeat, single)
+
+	mode := "off"
+	switch {
+	case single:
+		mode = "one"
+	case repeat:
+		mode = "all"
+	}
+	if err := airable.SetRepeat(mode); err != nil {
+		return systemError("Failed to set repeat: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) cmdRepeat(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"repeat\"")
+	}
+	on, ack := boolArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	return s.setRepeat(func(_, single bool) (bool, bool) { return on, single && on })
+}
+
+func (s *Server) cmdSingle(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"single\"")
+	}
+	// "oneshot" is not supported by the speaker; treat it as single
+	on := args[0] == "oneshot"
+	if !on {
+		var ack *ackError
+		if on, ack = boolArg(args[0]); ack != nil {
+			return ack
+		}
+	}
+	return s.setRepeat(func(repeat, _ bool) (bool, bool) { return repeat || on, on })
+}
+
+// boolString formats an MPD boolean.
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// Queue
+
+// queueRows fetches the speaker's play queue.
+func (s *Server) queueRows() (*kefw2.AirableClient, []kefw2.ContentItem, *ackError) {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return nil, nil, ack
+	}
+	airable := kefw2.NewAirableClient(spk)
+	queue, err := airable.GetPlayQueue()
+	if err != nil {
+		return nil, nil, systemError("Failed to get queue: %v", err)
+	}
+	return airable, queue.Rows, nil
+}
+
+// songID returns a stable MPD song ID for a queue row. The speaker's queue
+// paths ("playlists:item/{id}") carry an internal item ID; the position is
+// the fallback.
+func songID(item kefw2.ContentItem, pos int) int {
+	if id, ok := strings.CutPrefix(item.Path, "playlists:item/"); ok {
+		if n, err := strconv.Atoi(id); err == nil {
+			return n
+		}
+	}
+	if n, err := strconv.Atoi(item.ID); err == nil {
+		return n
+	}
+	return pos + 1
+}
+
+// queuePosition returns the queue position of what the speaker is playing,
+// or -1.
+func queuePosition(rows []kefw2.ContentItem, pd kefw2.PlayerData) int {
+	if !strings.HasPrefix(pd.TrackRoles.Path, "playlists:item/") {
+		return -1
+	}
+	for i, item := range rows {
+		if item.Path == pd.TrackRoles.Path {
+			return i
+		}
+	}
+	for i, item := range rows {
+		if item.Title == pd.TrackRoles.Title {
+			return i
+		}
+	}
+	return -1
+}
+
+// positionForID resolves an MPD song ID to its queue position.
+func positionForID(airable *kefw2.AirableClient, idArg string) (int, *ackError) {
+	id, ack := intArg(idArg)
+	if ack != nil {
+		return 0, ack
+	}
+	queue, err := airable.GetPlayQueue()
+	if err != nil {
+		return 0, systemError("Failed to get queue: %v", err)
+	}
+	for i, item := range queue.Rows {
+		if songID(item, i) == id {
+			return i, nil
+		}
+	}
+	return 0, noExistError("No such song")
+}
+
+func (s *Server) cmdPlaylistInfo(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	_, rows, ack := s.queueRows()
+	if ack != nil {
+		return ack
+	}
+
+	start, end := 0, len(rows)
+	if len(args) > 0 {
+		var err error
+		if start, end, err = parseRange(args[0]); err != nil {
+			return argError("%s", err.Error())
+		}
+		if end < 0 || end > len(rows) {
+			end = len(rows)
+		}
+		if start >= len(rows) && len(args[0]) > 0 && !strings.Contains(args[0], ":") {
+			return argError("Bad song index")
+		}
+	}
+
+	for i := start; i < end; i++ {
+		writeQueueSong(w, rows[i], i)
+	}
+	return nil
+}
+
+func (s *Server) cmdPlaylistID(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	_, rows, ack := s.queueRows()
+	if ack != nil {
+		return ack
+	}
+	if len(args) == 0 {
+		for i, item := range rows {
+			writeQueueSong(w, item, i)
+		}
+		return nil
+	}
+
+	id, ack := intArg(args[0])
+	if ack != nil {
+		return ack
+	}
+	for i, item := range rows {
+		if songID(item, i) == id {
+			writeQueueSong(w, item, i)
+			return nil
+		}
+	}
+	return noExistError("No such song")
+}
+
+// The speaker does not report which queue entries changed, so plchanges
+// returns the whole queue whenever the client's version is out of date.
+
+func (s *Server) cmdPlChanges(ctx context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) > 0 && args[0] == strconv.FormatUint(uint64(s.queueVersion()), 10) {
+		return nil
+	}
+	return s.cmdPlaylistInfo(ctx, w, nil)
+}
+
+func (s *Server) cmdPlChangesPosID(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) > 0 && args[0] == strconv.FormatUint(uint64(s.queueVersion()), 10) {
+		return nil
+	}
+	_, rows, ack := s.queueRows()
+	if ack != nil {
+		return ack
+	}
+	for i, item := range rows {
+		writePair(w, "cpos", strconv.Itoa(i))
+		writePair(w, "Id", strconv.Itoa(songID(item, i)))
+	}
+	return nil
+}
+
+// resolveURI turns a song URI into a queue item: a track from the index
+// when it is known there, otherwise an HTTP(S) stream.
+func resolveURI(uri string) (kefw2.ContentItem, *ackError) {
+	if index := loadIndex(); index != nil {
+		for i := range index.Tracks {
+			t := &index.Tracks[i]
+			if t.URI == uri || t.Path == uri {
+				return kefw2.IndexedTrackToContentItem(t), nil
+			}
+		}
+	}
+	if err := stations.ValidateURL(uri); err != nil {
+		return kefw2.ContentItem{}, noExistError("No such song")
+	}
+	return stations.StreamItem(uri, "", "", "", ""), nil
+}
+
+// addItems appends items to the queue and bumps the queue version.
+func (s *Server) addItems(airable *kefw2.AirableClient, items []kefw2.ContentItem) *ackError {
+	if err := airable.AddToQueue(items, false); err != nil {
+		return systemError("Failed to add to queue: %v", err)
+	}
+	s.Notify(SubsystemPlaylist)
+	return nil
+}
+
+func (s *Server) cmdAdd(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"add\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	item, ack := resolveURI(args[0])
+	if ack != nil {
+		return ack
+	}
+	return s.addItems(kefw2.NewAirableClient(spk), []kefw2.ContentItem{item})
+}
+
+func (s *Server) cmdAddID(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"addid\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	item, ack := resolveURI(args[0])
+	if ack != nil {
+		return ack
+	}
+	airable := kefw2.NewAirableClient(spk)
+	if ack := s.addItems(airable, []kefw2.ContentItem{item}); ack != nil {
+		return ack
+	}
+
+	queue, err := airable.GetPlayQueue()
+	if err != nil || len(queue.Rows) == 0 {
+		return systemError("Failed to get queue: %v", err)
+	}
+	last := len(queue.Rows) - 1
+	id := songID(queue.Rows[last], last)
+
+	if len(args) > 1 {
+		pos, ack := intArg(args[1])
+		if ack != nil {
+			return ack
+		}
+		if pos != last {
+			if err := airable.MoveQueueItem(last, pos); err != nil {
+				return systemError("Failed to move song: %v", err)
+			}
+		}
+	}
+
+	writePair(w, "Id", strconv.Itoa(id))
+	return nil
+}
+
+func (s *Server) cmdDelete(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"delete\"")
+	}
+	airable, rows, ack := s.queueRows()
+	if ack != nil {
+		return ack
+	}
+	start, end, err := parseRange(args[0])
+	if err != nil {
+		return argError("%s", err.Error())
+	}
+	if end < 0 || end > len(rows) {
+		end = len(rows)
+	}
+	if start >= end {
+		return argError("Bad song index")
+	}
+
+	indices := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		indices = append(indices, i)
+	}
+	if err := airable.RemoveFromQueue(indices); err != nil {
+		return systemError("Failed to delete: %v", err)
+	}
+	s.Notify(SubsystemPlaylist)
+	return nil
+}
+
+func (s *Server) cmdDeleteID(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"deleteid\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	airable := kefw2.NewAirableClient(spk)
+	pos, ack := positionForID(airable, args[0])
+	if ack != nil {
+		return ack
+	}
+	if err := airable.RemoveFromQueue([]int{pos}); err != nil {
+		return systemError("Failed to delete: %v", err)
+	}
+	s.Notify(SubsystemPlaylist)
+	return nil
+}
+
+// moveRange moves the queue entries [start, end) so the first lands at to.
+func (s *Server) moveRange(airable *kefw2.AirableClient, start, end, to int) *ackError {
+	n := end - start
+	for i := range n {
+		var err error
+		if to > start {
+			// Moving down: the entry at start shifts each time
+			err = airable.MoveQueueItem(start, to+n-1)
+		} else {
+			err = airable.MoveQueueItem(start+i, to+i)
+		}
+		if err != nil {
+			return systemError("Failed to move song: %v", err)
+		}
+	}
+	s.Notify(SubsystemPlaylist)
+	return nil
+}
+
+func (s *Server) cmdMove(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 2 {
+		return argError("wrong number of arguments for \"move\"")
+	}
+	airable, rows, ack := s.queueRows()
+	if ack != nil {
+		return ack
+	}
+	start, end, err := parseRange(args[0])
+	if err != nil {
+		return argError("%s", err.Error())
+	}
+	if end < 0 || end > len(rows) {
+		end = len(rows)
+	}
+	to, ack := intArg(args[1])
+	if ack != nil {
+		return ack
+	}
+	if start >= end || to < 0 || to+(end-start) > len(rows) {
+		return argError("Bad song index")
+	}
+	return s.moveRange(airable, start, end, to)
+}
+
+func (s *Server) cmdMoveID(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) != 2 {
+		return argError("wrong number of arguments for \"moveid\"")
+	}
+	airable, rows, ack := s.queueRows()
+	if ack != nil {
+		return ack
+	}
+	pos, ack := positionForID(airable, args[0])
+	if ack != nil {
+		return ack
+	}
+	to, ack := intArg(args[1])
+	if ack != nil {
+		return ack
+	}
+	if to < 0 || to >= len(rows) {
+		return argError("Bad song index")
+	}
+	return s.moveRange(airable, pos, pos+1, to)
+}
+
+func (s *Server) cmdClear(_ context.Context, _ *bufio.Writer, _ []string) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	if err := kefw2.NewAirableClient(spk).ClearPlaylist(); err != nil {
+		return systemError("Failed to clear queue: %v", err)
+	}
+	s.Notify(SubsystemPlaylist)
+	return nil
+}
@@ -0,0 +1,485 @@
+package mpd
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/playlist"
+)
+
+// song is the metadata written for one song entry.
+type song struct {
+	file     string
+	title    string
+	artist   string
+	album    string
+	duration int // milliseconds
+	pos, id  int // queue position and ID; -1 outside the queue
+	modified time.Time
+}
+
+// writeSong writes a song entry. MPD clients start a new song at "file:".
+func writeSong(w *bufio.Writer, s song) {
+	file := s.file
+	if file == "" {
+		file = s.title
+	}
+	writePair(w, "file", file)
+	if !s.modified.IsZero() {
+		writePair(w, "Last-Modified", s.modified.UTC().Format(time.RFC3339))
+	}
+	writePair(w, "Title", s.title)
+	writePair(w, "Artist", s.artist)
+	writePair(w, "AlbumArtist", s.artist)
+	writePair(w, "Album", s.album)
+	if s.duration > 0 {
+		writePair(w, "Time", strconv.Itoa(s.duration/1000))
+		writePair(w, "duration", formatSeconds(s.duration))
+	}
+	if s.pos >= 0 {
+		writePair(w, "Pos", strconv.Itoa(s.pos))
+		writePair(w, "Id", strconv.Itoa(s.id))
+	}
+}
+
+// writeQueueSong writes a queue row at position pos.
+func writeQueueSong(w *bufio.Writer, item kefw2.ContentItem, pos int) {
+	s := song{file: item.Path, title: item.Title, pos: pos, id: songID(item, pos)}
+	if md := item.MediaData; md != nil {
+		s.artist = md.MetaData.Artist
+		s.album = md.MetaData.Album
+		if len(md.Resources) > 0 {
+			if md.Resources[0].URI != "" {
+				s.file = md.Resources[0].URI
+			}
+			s.duration = md.Resources[0].Duration
+		}
+	}
+	writeSong(w, s)
+}
+
+// indexedSong converts a track index entry.
+func indexedSong(t *kefw2.IndexedTrack) song {
+	file := t.URI
+	if file == "" {
+		file = t.Path
+	}
+	return song{file: file, title: t.Title, artist: t.Artist, album: t.Album, duration: t.Duration, pos: -1}
+}
+
+// playlistSong converts a stored playlist track.
+func playlistSong(t playlist.Track) song {
+	file := t.URI
+	if file == "" {
+		file = t.Path
+	}
+	return song{file: file, title: t.Title, artist: t.Artist, album: t.Album, duration: t.Duration, pos: -1}
+}
+
+// loadIndex returns the UPnP track index, or nil when none has been built.
+func loadIndex() *kefw2.TrackIndex {
+	index, err := kefw2.LoadTrackIndexCached()
+	if err != nil {
+		return nil
+	}
+	return index
+}
+
+// Stored playlists
+
+// findPlaylist looks up a stored playlist by name, then by ID.
+func (s *Server) findPlaylist(name string) (*playlist.Playlist, *ackError) {
+	if s.opts.Playlists == nil {
+		return nil, noExistError("No such playlist")
+	}
+	list, err := s.opts.Playlists.List()
+	if err != nil {
+		return nil, systemError("Failed to list playlists: %v", err)
+	}
+	id := ""
+	for _, pl := range list {
+		if pl.Name == name {
+			id = pl.ID
+			break
+		}
+		if pl.ID == name {
+			id = pl.ID
+		}
+	}
+	if id == "" {
+		return nil, noExistError("No such playlist")
+	}
+
+	pl, err := s.opts.Playlists.Get(id)
+	if err != nil {
+		return nil, noExistError("No such playlist")
+	}
+	return pl, nil
+}
+
+// writePlaylists writes "playlist:" entries for every stored playlist.
+func (s *Server) writePlaylists(w *bufio.Writer) *ackError {
+	if s.opts.Playlists == nil {
+		return nil
+	}
+	list, err := s.opts.Playlists.List()
+	if err != nil {
+		return systemError("Failed to list playlists: %v", err)
+	}
+	for _, pl := range list {
+		writePair(w, "playlist", pl.Name)
+		writePair(w, "Last-Modified", pl.UpdatedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *Server) cmdListPlaylists(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	return s.writePlaylists(w)
+}
+
+func (s *Server) cmdListPlaylist(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"listplaylist\"")
+	}
+	pl, ack := s.findPlaylist(args[0])
+	if ack != nil {
+		return ack
+	}
+	for _, t := range pl.Tracks {
+		writePair(w, "file", playlistSong(t).file)
+	}
+	return nil
+}
+
+func (s *Server) cmdListPlaylistInfo(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"listplaylistinfo\"")
+	}
+	pl, ack := s.findPlaylist(args[0])
+	if ack != nil {
+		return ack
+	}
+	for _, t := range pl.Tracks {
+		writeSong(w, playlistSong(t))
+	}
+	return nil
+}
+
+func (s *Server) cmdLoad(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"load\"")
+	}
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	pl, ack := s.findPlaylist(args[0])
+	if ack != nil {
+		return ack
+	}
+
+	tracks := pl.Tracks
+	if len(args) > 1 {
+		start, end, err := parseRange(args[1])
+		if err != nil {
+			return argError("%s", err.Error())
+		}
+		if end < 0 || end > len(tracks) {
+			end = len(tracks)
+		}
+		if start >= end {
+			return argError("Bad song index")
+		}
+		tracks = tracks[start:end]
+	}
+
+	airable := kefw2.NewAirableClient(spk)
+	items, _ := playlist.ContentItems(airable, tracks)
+	if len(items) == 0 {
+		return &ackError{code: ackErrorPlaylist, message: "No playable tracks in playlist"}
+	}
+	return s.addItems(airable, items)
+}
+
+// Database
+
+// filterExpr matches one "(TAG OP 'VALUE')" clause of an MPD filter
+// expression. Clauses are combined with AND.
+var filterExpr = regexp.MustCompile(`\(\s*(\w+)\s+(==|!=|contains|starts_with)\s+("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')\s*\)`)
+
+// filter is one tag condition.
+type filter struct {
+	tag, op, value string
+}
+
+// parseFilters parses find/search arguments: either a filter expression or
+// TAG VALUE pairs. Trailing "sort" and "window" arguments are ignored,
+// except that a window is returned.
+func parseFilters(args []string) ([]filter, int, int, *ackError) {
+	start, end := 0, -1
+	for i := 0; i+1 < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "window":
+			var err error
+			if start, end, err = parseRange(args[i+1]); err != nil {
+				return nil, 0, 0, argError("%s", err.Error())
+			}
+			fallthrough
+		case "sort", "group":
+			args = append(args[:i:i], args[i+2:]...)
+			i--
+		}
+	}
+
+	var filters []filter
+	if len(args) == 1 && strings.HasPrefix(args[0], "(") {
+		matches := filterExpr.FindAllStringSubmatch(args[0], -1)
+		if len(matches) == 0 {
+			return nil, 0, 0, argError("Unsupported filter expression")
+		}
+		for _, m := range matches {
+			value := m[3][1 : len(m[3])-1]
+			value = strings.NewReplacer(`\"`, `"`, `\'`, `'`, `\\`, `\`).Replace(value)
+			filters = append(filters, filter{tag: strings.ToLower(m[1]), op: m[2], value: value})
+		}
+		return filters, start, end, nil
+	}
+
+	if len(args)%2 != 0 {
+		return nil, 0, 0, argError("Incorrect number of filter arguments")
+	}
+	for i := 0; i < len(args); i += 2 {
+		filters = append(filters, filter{tag: strings.ToLower(args[i]), op: "==", value: args[i+1]})
+	}
+	return filters, start, end, nil
+}
+
+// tagValues returns the values of tag for a track; "any" covers all tags.
+func tagValues(t *kefw2.IndexedTrack, tag string) []string {
+	switch tag {
+	case "artist", "albumartist", "artistsort", "albumartistsort":
+		return []string{t.Artist}
+	case "album", "albumsort":
+		return []string{t.Album}
+	case "title":
+		return []string{t.Title}
+	case "file", "base":
+		return []string{t.URI, t.Path}
+	case "any":
+		return []string{t.Title, t.Artist, t.Album}
+	}
+	return nil
+}
+
+// matches reports whether a track passes all filters. search (fold) is
+// case-insensitive and treats "==" as a substring match, like MPD.
+func matches(t *kefw2.IndexedTrack, filters []filter, fold bool) bool {
+	for _, f := range filters {
+		want := f.value
+		if fold {
+			want = strings.ToLower(want)
+		}
+		found := false
+		for _, v := range tagValues(t, f.tag) {
+			if fold {
+				v = strings.ToLower(v)
+			}
+			switch f.op {
+			case "contains":
+				found = strings.Contains(v, want)
+			case "starts_with":
+				found = strings.HasPrefix(v, want)
+			case "==", "!=":
+				if fold {
+					found = strings.Contains(v, want)
+				} else {
+					found = v == want
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if found == (f.op == "!=") {
+			return false
+		}
+	}
+	return true
+}
+
+// findTracks returns the index tracks matching args.
+func findTracks(args []string, fold bool) ([]*kefw2.IndexedTrack, *ackError) {
+	filters, start, end, ack := parseFilters(args)
+	if ack != nil {
+		return nil, ack
+	}
+	index := loadIndex()
+	if index == nil {
+		return nil, nil
+	}
+
+	var found []*kefw2.IndexedTrack
+	for i := range index.Tracks {
+		if matches(&index.Tracks[i], filters, fold) {
+			found = append(found, &index.Tracks[i])
+		}
+	}
+
+	if end < 0 || end > len(found) {
+		end = len(found)
+	}
+	if start >= end {
+		return nil, nil
+	}
+	return found[start:end], nil
+}
+
+func (s *Server) writeTracks(w *bufio.Writer, args []string, fold bool) *ackError {
+	tracks, ack := findTracks(args, fold)
+	if ack != nil {
+		return ack
+	}
+	for _, t := range tracks {
+		writeSong(w, indexedSong(t))
+	}
+	return nil
+}
+
+func (s *Server) cmdSearch(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	return s.writeTracks(w, args, true)
+}
+
+func (s *Server) cmdFind(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	return s.writeTracks(w, args, false)
+}
+
+func (s *Server) addTracks(args []string, fold bool) *ackError {
+	spk, ack := s.activeSpeaker()
+	if ack != nil {
+		return ack
+	}
+	tracks, ack := findTracks(args, fold)
+	if ack != nil {
+		return ack
+	}
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	items := make([]kefw2.ContentItem, 0, len(tracks))
+	for _, t := range tracks {
+		items = append(items, kefw2.IndexedTrackToContentItem(t))
+	}
+	return s.addItems(kefw2.NewAirableClient(spk), items)
+}
+
+func (s *Server) cmdSearchAdd(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	return s.addTracks(args, true)
+}
+
+func (s *Server) cmdFindAdd(_ context.Context, _ *bufio.Writer, args []string) *ackError {
+	return s.addTracks(args, false)
+}
+
+// listTags maps the tags "list" supports to their response keys.
+var listTags = map[string]string{
+	"artist":      "Artist",
+	"albumartist": "AlbumArtist",
+	"album":       "Album",
+	"title":       "Title",
+	"file":        "file",
+}
+
+func (s *Server) cmdList(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"list\"")
+	}
+	tag := strings.ToLower(args[0])
+	key, ok := listTags[tag]
+	if !ok {
+		// Tags the index does not have (genre, date, ...) have no values
+		return nil
+	}
+
+	// "list album ARTIST" is the pre-0.21 shorthand for "list album artist ARTIST"
+	filterArgs := args[1:]
+	if tag == "album" && len(filterArgs) == 1 && !strings.HasPrefix(filterArgs[0], "(") {
+		filterArgs = []string{"artist", filterArgs[0]}
+	}
+	tracks, ack := findTracks(filterArgs, false)
+	if ack != nil {
+		return ack
+	}
+
+	seen := map[string]bool{}
+	var values []string
+	for _, t := range tracks {
+		for _, v := range tagValues(t, tag)[:1] {
+			if v != "" && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		writePair(w, key, v)
+	}
+	return nil
+}
+
+func (s *Server) cmdCount(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	tracks, ack := findTracks(args, false)
+	if ack != nil {
+		return ack
+	}
+	playtime := 0
+	for _, t := range tracks {
+		playtime += t.Duration
+	}
+	writePair(w, "songs", strconv.Itoa(len(tracks)))
+	writePair(w, "playtime", strconv.Itoa(playtime/1000))
+	return nil
+}
+
+func (s *Server) cmdLsInfo(_ context.Context, w *bufio.Writer, args []string) *ackError {
+	// The index is flat, so the root holds only the stored playlists; a
+	// song URI lists that song
+	if len(args) == 0 || args[0] == "" || args[0] == "/" {
+		return s.writePlaylists(w)
+	}
+	if index := loadIndex(); index != nil {
+		for i := range index.Tracks {
+			if t := &index.Tracks[i]; t.URI == args[0] || t.Path == args[0] {
+				writeSong(w, indexedSong(t))
+				return nil
+			}
+		}
+	}
+	return noExistError("Not found")
+}
+
+func (s *Server) cmdListAll(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	if index := loadIndex(); index != nil {
+		for i := range index.Tracks {
+			writePair(w, "file", indexedSong(&index.Tracks[i]).file)
+		}
+	}
+	return nil
+}
+
+func (s *Server) cmdListAllInfo(_ context.Context, w *bufio.Writer, _ []string) *ackError {
+	if index := loadIndex(); index != nil {
+		for i := range index.Tracks {
+			writeSong(w, indexedSong(&index.Tracks[i]))
+		}
+	}
+	return nil
+}
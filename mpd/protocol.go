@@ -0,0 +1,152 @@
+package mpd
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MPD ACK error codes.
+const (
+	ackErrorArg        = 2
+	ackErrorPassword   = 3
+	ackErrorPermission = 4
+	ackErrorUnknown    = 5
+	ackErrorNoExist    = 50
+	ackErrorSystem     = 52
+	ackErrorPlaylist   = 53
+)
+
+// ackError is a failed command, reported to the client as
+// "ACK [code@index] {command} message".
+type ackError struct {
+	code    int
+	index   int
+	command string
+	message string
+}
+
+func (e *ackError) Error() string {
+	return e.message
+}
+
+// argError, noExistError and systemError create ACK errors of the common
+// kinds.
+func argError(format string, args ...any) *ackError {
+	return &ackError{code: ackErrorArg, message: fmt.Sprintf(format, args...)}
+}
+
+func noExistError(format string, args ...any) *ackError {
+	return &ackError{code: ackErrorNoExist, message: fmt.Sprintf(format, args...)}
+}
+
+func systemError(format string, args ...any) *ackError {
+	return &ackError{code: ackErrorSystem, message: fmt.Sprintf(format, args...)}
+}
+
+func writeAck(w *bufio.Writer, e *ackError) {
+	fmt.Fprintf(w, "ACK [%d@%d] {%s} %s\n", e.code, e.index, e.command, e.message)
+}
+
+// splitArgs tokenizes a command line. Arguments are separated by spaces and
+// may be double-quoted with backslash escapes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		if line[i] != '"' {
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			args = append(args, line[start:i])
+			continue
+		}
+
+		var b strings.Builder
+		i++
+		for {
+			if i >= len(line) {
+				return nil, fmt.Errorf("missing closing '\"'")
+			}
+			ch := line[i]
+			if ch == '"' {
+				i++
+				break
+			}
+			if ch == '\\' && i+1 < len(line) {
+				i++
+				ch = line[i]
+			}
+			b.WriteByte(ch)
+			i++
+		}
+		args = append(args, b.String())
+	}
+}
+
+// parseRange parses "N" or "START:END" (END optional) into a half-open
+// range. A single position N yields N:N+1.
+func parseRange(s string) (start, end int, err error) {
+	from, to, isRange := strings.Cut(s, ":")
+	start, err = strconv.Atoi(from)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("Integer expected: %s", s) //nolint:staticcheck // MPD's wording
+	}
+	if !isRange {
+		return start, start + 1, nil
+	}
+	if to == "" {
+		return start, -1, nil
+	}
+	end, err = strconv.Atoi(to)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("Bad range: %s", s) //nolint:staticcheck // MPD's wording
+	}
+	return start, end, nil
+}
+
+// boolArg parses MPD's "0"/"1" booleans.
+func boolArg(s string) (bool, *ackError) {
+	switch s {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	}
+	return false, argError("Boolean (0/1) expected: %s", s)
+}
+
+// intArg parses an integer argument.
+func intArg(s string) (int, *ackError) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, argError("Integer expected: %s", s)
+	}
+	return n, nil
+}
+
+// writePair writes a "key: value" line, skipping empty values.
+func writePair(w *bufio.Writer, key, value string) {
+	if value == "" {
+		return
+	}
+	w.WriteString(key)
+	w.WriteString(": ")
+	// Newlines would break the line-based protocol
+	w.WriteString(strings.ReplaceAll(value, "\n", " "))
+	w.WriteByte('\n')
+}
+
+// formatSeconds formats milliseconds as MPD's fractional seconds.
+func formatSeconds(ms int) string {
+	return strconv.FormatFloat(float64(ms)/1000, 'f', 3, 64)
+}
@@ -0,0 +1,91 @@
+package mpd
+
+import (
+	"bufio"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"status", []string{"status"}, false},
+		{"setvol 40", []string{"setvol", "40"}, false},
+		{"  seek\t3   12.5 ", []string{"seek", "3", "12.5"}, false},
+		{`add "http://example.com/a b.mp3"`, []string{"add", "http://example.com/a b.mp3"}, false},
+		{`find artist "Miles Davis" album "Kind of Blue"`, []string{"find", "artist", "Miles Davis", "album", "Kind of Blue"}, false},
+		{`search any "say \"hi\""`, []string{"search", "any", `say "hi"`}, false},
+		{`load "back\\slash"`, []string{"load", `back\slash`}, false},
+		{`find title ""`, []string{"find", "title", ""}, false},
+		{`find"artist"`, []string{`find"artist"`}, false},
+		{`"play"`, []string{"play"}, false},
+		{`add "unterminated`, nil, true},
+		{`add "trailing escape\`, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := splitArgs(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitArgs(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		s          string
+		start, end int
+		wantErr    bool
+	}{
+		{"3", 3, 4, false},
+		{"0", 0, 1, false},
+		{"2:5", 2, 5, false},
+		{"2:2", 2, 2, false},
+		{"4:", 4, -1, false},
+		{"5:2", 0, 0, true},
+		{"-1", 0, 0, true},
+		{"a:2", 0, 0, true},
+		{"1:b", 0, 0, true},
+		{"", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		start, end, err := parseRange(tt.s)
+		if (err != nil) != tt.wantErr || start != tt.start || end != tt.end {
+			t.Errorf("parseRange(%q) = %d, %d, %v, want %d, %d, error %v", tt.s, start, end, err, tt.start, tt.end, tt.wantErr)
+		}
+	}
+}
+
+func TestBoolArg(t *testing.T) {
+	for s, want := range map[string]bool{"0": false, "1": true} {
+		if got, ack := boolArg(s); ack != nil || got != want {
+			t.Errorf("boolArg(%q) = %v, %v", s, got, ack)
+		}
+	}
+	for _, s := range []string{"", "true", "2", "on"} {
+		if _, ack := boolArg(s); ack == nil || ack.code != ackErrorArg {
+			t.Errorf("boolArg(%q) = %v, want an argument error", s, ack)
+		}
+	}
+}
+
+func TestWriteAck(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeAck(w, &ackError{code: ackErrorNoExist, index: 2, command: "playid", message: "No such song"})
+	_ = w.Flush()
+	if got, want := buf.String(), "ACK [50@2] {playid} No such song\n"; got != want {
+		t.Errorf("writeAck wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,391 @@
+// Package mpd implements a subset of the Music Player Daemon protocol on top
+// of the active speaker, so MPD clients (mpc, ncmpcpp, MPD phone apps) can
+// control KEF speakers. The queue maps to the speaker's play queue, stored
+// playlists to kefw2ui playlists and the database to the UPnP track index.
+package mpd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/auth"
+	"github.com/hilli/kefw2ui/playlist"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// protocolVersion is the MPD protocol version announced to clients.
+const protocolVersion = "0.23.0"
+
+// maxLineLength bounds a single command line.
+const maxLineLength = 1 << 20
+
+// Idle subsystems reported by this server.
+const (
+	SubsystemDatabase       = "database"
+	SubsystemStoredPlaylist = "stored_playlist"
+	SubsystemPlaylist       = "playlist"
+	SubsystemPlayer         = "player"
+	SubsystemMixer          = "mixer"
+	SubsystemOptions        = "options"
+)
+
+// subsystems lists every subsystem a client can wait for.
+var subsystems = []string{
+	SubsystemDatabase, SubsystemStoredPlaylist, SubsystemPlaylist,
+	SubsystemPlayer, SubsystemMixer, SubsystemOptions,
+}
+
+// Options configures a Server.
+type Options struct {
+	Manager   *speaker.Manager
+	Playlists *playlist.Manager
+
+	// Audit records commands that change state. Optional.
+	Audit *audit.Log
+
+	// Authenticate checks the password a client sends with the password
+	// command. When set, reading needs the viewer role and changing
+	// anything the controller role; nil disables authentication.
+	// Anonymous is the identity of connections before a password, nil for
+	// none.
+	Authenticate func(password string) *auth.Identity
+	Anonymous    *auth.Identity
+
+	// Addr is the TCP address to listen on, e.g. ":6600".
+	Addr string
+}
+
+// Server is an MPD protocol listener backed by the active speaker.
+type Server struct {
+	opts     Options
+	started  time.Time
+	commands map[string]commandFunc
+
+	mu       sync.Mutex
+	listener net.Listener
+	clients  map[*client]struct{}
+	version  uint32 // queue version, bumped on every playlist change
+}
+
+// New creates an MPD server. Call Start to begin listening.
+func New(opts Options) *Server {
+	s := &Server{
+		opts:    opts,
+		started: time.Now(),
+		clients: make(map[*client]struct{}),
+		version: 1,
+	}
+	s.commands = s.commandTable()
+	return s
+}
+
+// Start opens the listener and serves clients in the background.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.opts.Addr, err)
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
+	go s.serve(ln)
+	return nil
+}
+
+// Close stops the listener and disconnects all clients.
+func (s *Server) Close() {
+	s.mu.Lock()
+	ln := s.listener
+	s.listener = nil
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	if ln != nil {
+		_ = ln.Close()
+	}
+	for _, c := range clients {
+		_ = c.conn.Close()
+	}
+}
+
+func (s *Server) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("MPD accept error: %v", err)
+			}
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Notify records a change in the given subsystems and wakes idling clients.
+func (s *Server) Notify(changed ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range changed {
+		if sub == SubsystemPlaylist {
+			s.version++
+		}
+	}
+	for c := range s.clients {
+		c.notify(changed)
+	}
+}
+
+// HandleEvent maps a speaker event to the idle subsystems it changes.
+func (s *Server) HandleEvent(event speaker.Event) {
+	switch event.(type) {
+	case speaker.VolumeChanged, speaker.MuteChanged:
+		s.Notify(SubsystemMixer)
+	case speaker.PlayerChanged, speaker.SourceChanged, speaker.PowerChanged:
+		s.Notify(SubsystemPlayer)
+	case speaker.QueueChanged:
+		s.Notify(SubsystemPlaylist)
+	case speaker.PlayModeChanged:
+		s.Notify(SubsystemOptions)
+	}
+}
+
+// queueVersion returns the current queue version.
+func (s *Server) queueVersion() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// client is one connected MPD client.
+type client struct {
+	conn     net.Conn
+	w        *bufio.Writer
+	identity *auth.Identity // nil until authenticated, unless anonymous
+
+	mu      sync.Mutex
+	pending map[string]bool // subsystems changed since the last idle
+	wake    chan struct{}
+}
+
+// notify marks subsystems as changed. Must be called with Server.mu held.
+func (c *client) notify(changed []string) {
+	c.mu.Lock()
+	for _, sub := range changed {
+		c.pending[sub] = true
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeChanges returns and clears the pending subsystems in filter (all when
+// filter is empty).
+func (c *client) takeChanges(filter []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(filter) == 0 {
+		filter = subsystems
+	}
+	var changed []string
+	for _, sub := range filter {
+		if c.pending[sub] {
+			changed = append(changed, sub)
+			delete(c.pending, sub)
+		}
+	}
+	return changed
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	c := &client{
+		conn:     conn,
+		w:        bufio.NewWriter(conn),
+		identity: s.opts.Anonymous,
+		pending:  make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	// Read lines in the background so idle can wait for events and
+	// "noidle" at the same time
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 4096), maxLineLength)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintf(c.w, "OK MPD %s\n", protocolVersion)
+	if c.w.Flush() != nil {
+		return
+	}
+
+	var list []string // commands of an open command list
+	inList, listOK := false, false
+
+	for line := range lines {
+		line = strings.TrimRight(line, "\r")
+
+		switch {
+		case line == "command_list_begin" || line == "command_list_ok_begin":
+			inList, listOK, list = true, line == "command_list_ok_begin", nil
+			continue
+		case inList && line != "command_list_end":
+			list = append(list, line)
+			continue
+		case inList:
+			inList = false
+			s.runList(c, list, listOK)
+		case strings.TrimSpace(line) == "noidle":
+			// A late noidle after idle already returned is ignored
+			continue
+		default:
+			if cmd := strings.TrimSpace(line); strings.HasPrefix(cmd, "idle") && (len(cmd) == 4 || cmd[4] == ' ') {
+				if !s.idle(c, cmd, lines) {
+					return
+				}
+				continue
+			}
+			if s.runList(c, []string{line}, false) {
+				_ = c.w.Flush()
+				return
+			}
+		}
+
+		if c.w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// runList executes commands and writes the final OK or the first ACK. It
+// reports whether the client asked to close the connection.
+func (s *Server) runList(c *client, lines []string, listOK bool) bool {
+	for i, line := range lines {
+		args, err := splitArgs(line)
+		if err != nil {
+			writeAck(c.w, &ackError{code: ackErrorArg, index: i, message: err.Error()})
+			return false
+		}
+		if len(args) == 0 {
+			writeAck(c.w, &ackError{code: ackErrorUnknown, index: i, message: "No command given"})
+			return false
+		}
+		if args[0] == "close" {
+			return true
+		}
+
+		if ack := s.run(c, args); ack != nil {
+			ack.index = i
+			ack.command = args[0]
+			writeAck(c.w, ack)
+			return false
+		}
+		if listOK {
+			c.w.WriteString("list_OK\n")
+		}
+	}
+	c.w.WriteString("OK\n")
+	return false
+}
+
+// idle waits until one of the requested subsystems changes or the client
+// sends "noidle". It reports whether the connection is still open.
+func (s *Server) idle(c *client, cmd string, lines <-chan string) bool {
+	args, err := splitArgs(cmd)
+	if err != nil {
+		writeAck(c.w, &ackError{code: ackErrorArg, command: "idle", message: err.Error()})
+		return c.w.Flush() == nil
+	}
+	if ack := s.authorize(c, "idle"); ack != nil {
+		ack.command = "idle"
+		writeAck(c.w, ack)
+		return c.w.Flush() == nil
+	}
+	filter := args[1:]
+	for _, sub := range filter {
+		if !isSubsystem(sub) {
+			writeAck(c.w, &ackError{code: ackErrorArg, command: "idle", message: "Unrecognized idle event: " + sub})
+			return c.w.Flush() == nil
+		}
+	}
+
+	for {
+		if changed := c.takeChanges(filter); len(changed) > 0 {
+			for _, sub := range changed {
+				fmt.Fprintf(c.w, "changed: %s\n", sub)
+			}
+			c.w.WriteString("OK\n")
+			return c.w.Flush() == nil
+		}
+
+		select {
+		case <-c.wake:
+		case line, ok := <-lines:
+			if !ok {
+				return false
+			}
+			// Only "noidle" is allowed while idling; anything else ends
+			// the connection, as MPD does
+			if strings.TrimSpace(line) != "noidle" {
+				return false
+			}
+			for _, sub := range c.takeChanges(filter) {
+				fmt.Fprintf(c.w, "changed: %s\n", sub)
+			}
+			c.w.WriteString("OK\n")
+			return c.w.Flush() == nil
+		}
+	}
+}
+
+// isSubsystem reports whether name is a known idle subsystem. Subsystems
+// this server never reports are accepted too, so clients can wait on them.
+func isSubsystem(name string) bool {
+	switch name {
+	case "update", "output", "sticker", "subscription", "message", "neighbor", "mount", "partition":
+		return true
+	}
+	for _, sub := range subsystems {
+		if sub == name {
+			return true
+		}
+	}
+	return false
+}
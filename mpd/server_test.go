@@ -0,0 +1,183 @@
+package mpd
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/hilli/kefw2ui/auth"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// session is a client connection to a server, over an in-memory pipe.
+type session struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newSession(t *testing.T, s *Server) *session {
+	t.Helper()
+	client, server := net.Pipe()
+	go s.handleConn(server)
+	t.Cleanup(func() { _ = client.Close() })
+
+	c := &session{t: t, conn: client, r: bufio.NewReader(client)}
+	if greeting := c.line(); greeting != "OK MPD "+protocolVersion {
+		t.Fatalf("greeting = %q", greeting)
+	}
+	return c
+}
+
+func (c *session) line() string {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// send sends command lines and returns the response up to the final OK or
+// ACK line.
+func (c *session) send(lines ...string) []string {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+	var response []string
+	for {
+		line := c.line()
+		response = append(response, line)
+		if line == "OK" || strings.HasPrefix(line, "ACK ") {
+			return response
+		}
+	}
+}
+
+// last returns the final line of a response.
+func last(response []string) string {
+	return response[len(response)-1]
+}
+
+func TestCommandLists(t *testing.T) {
+	c := newSession(t, New(Options{Manager: speaker.NewManager()}))
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{"ping", []string{"ping"}, []string{"OK"}},
+		{"unknown", []string{"frobnicate"}, []string{`ACK [5@0] {frobnicate} unknown command "frobnicate"`}},
+		{"empty", []string{""}, []string{"ACK [5@0] {} No command given"}},
+		{"unterminated quote", []string{`add "x`}, []string{`ACK [2@0] {} missing closing '"'`}},
+		{"list", []string{"command_list_begin", "ping", "urlhandlers", "command_list_end"},
+			[]string{"handler: http://", "handler: https://", "OK"}},
+		{"ok list", []string{"command_list_ok_begin", "ping", "ping", "command_list_end"},
+			[]string{"list_OK", "list_OK", "OK"}},
+		{"list stops at the first error", []string{"command_list_ok_begin", "ping", "nope", "ping", "command_list_end"},
+			[]string{"list_OK", `ACK [5@1] {nope} unknown command "nope"`}},
+		{"no speaker", []string{"setvol 20"}, []string{"ACK [52@0] {setvol} No active speaker"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.send(tt.lines...); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandRole(t *testing.T) {
+	tests := map[string]auth.Role{
+		"ping":         "",
+		"password":     "",
+		"commands":     "",
+		"status":       auth.RoleViewer,
+		"currentsong":  auth.RoleViewer,
+		"playlistinfo": auth.RoleViewer,
+		"idle":         auth.RoleViewer,
+		"play":         auth.RoleController,
+		"setvol":       auth.RoleController,
+		"clear":        auth.RoleController,
+		"findadd":      auth.RoleController,
+	}
+	for command, want := range tests {
+		if got := commandRole(command); got != want {
+			t.Errorf("commandRole(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	identities := map[string]*auth.Identity{
+		"viewer:secret":     {Name: "viewer", Role: auth.RoleViewer},
+		"controller:secret": {Name: "controller", Role: auth.RoleController},
+	}
+	s := New(Options{
+		Manager:      speaker.NewManager(),
+		Authenticate: func(password string) *auth.Identity { return identities[password] },
+	})
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // final line of each response
+	}{
+		{"public commands without a password", []string{"ping", "tagtypes"}, []string{"OK", "OK"}},
+		{"reading needs a password", []string{"status"}, []string{`ACK [4@0] {status} you don't have permission for "status"`}},
+		{"idle needs a password", []string{"idle"}, []string{`ACK [4@0] {idle} you don't have permission for "idle"`}},
+		{"wrong password", []string{"password nope", "status"}, []string{
+			"ACK [3@0] {password} incorrect password",
+			`ACK [4@0] {status} you don't have permission for "status"`,
+		}},
+		{"missing password", []string{"password"}, []string{`ACK [2@0] {password} wrong number of arguments for "password"`}},
+		{"viewer reads but can't control", []string{"password viewer:secret", "outputs", "setvol 20"}, []string{
+			"OK",
+			"OK",
+			`ACK [4@0] {setvol} you don't have permission for "setvol"`,
+		}},
+		{"controller controls", []string{"password controller:secret", "setvol 20"}, []string{
+			"OK",
+			"ACK [52@0] {setvol} No active speaker",
+		}},
+		{"wrong password keeps the role", []string{"password controller:secret", "password nope", "outputs"}, []string{
+			"OK",
+			"ACK [3@0] {password} incorrect password",
+			"OK",
+		}},
+		{"checked per command in a list", []string{"password viewer:secret", "command_list_begin\nping\nclear\ncommand_list_end"}, []string{
+			"OK",
+			`ACK [4@1] {clear} you don't have permission for "clear"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSession(t, s)
+			for i, line := range tt.lines {
+				if got := last(c.send(line)); got != tt.want[i] {
+					t.Errorf("%q: got %q, want %q", line, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAnonymousRole(t *testing.T) {
+	s := New(Options{
+		Manager:      speaker.NewManager(),
+		Authenticate: func(string) *auth.Identity { return nil },
+		Anonymous:    &auth.Identity{Name: "anonymous", Role: auth.RoleViewer},
+	})
+	c := newSession(t, s)
+	if got := last(c.send("outputs")); got != "OK" {
+		t.Errorf("outputs: %q", got)
+	}
+	if got := last(c.send("stop")); got != `ACK [4@0] {stop} you don't have permission for "stop"` {
+		t.Errorf("stop: %q", got)
+	}
+}
@@ -0,0 +1,434 @@
+// Package mqtt publishes the active speaker's state to an MQTT broker,
+// accepts player commands on command topics, and announces the speaker to
+// Home Assistant through MQTT discovery.
+//
+// State topics (retained unless noted), under the topic prefix:
+//
+//	{prefix}/status    online | offline (last will)
+//	{prefix}/power     ON | OFF
+//	{prefix}/source    wifi, bluetooth, tv, optical, coaxial, analog, usb, standby
+//	{prefix}/volume    0-100
+//	{prefix}/mute      ON | OFF
+//	{prefix}/state     playing | paused | idle | off
+//	{prefix}/media     {"title","artist","album","duration","icon"} (duration in seconds)
+//	{prefix}/position  elapsed seconds (not retained)
+//
+// Commands are accepted on {prefix}/set/{command}; see handleCommand.
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// DefaultTopicPrefix and DefaultDiscoveryPrefix are used when the options
+// leave them empty.
+const (
+	DefaultTopicPrefix     = "kefw2ui"
+	DefaultDiscoveryPrefix = "homeassistant"
+)
+
+// publishTimeout bounds waiting for the broker to accept a publish.
+const publishTimeout = 5 * time.Second
+
+// outboxSize is how many publishes may wait for a slow broker before new
+// ones are dropped.
+const outboxSize = 256
+
+// Options configures the MQTT bridge.
+type Options struct {
+	Manager *speaker.Manager
+
+	// State is the speaker state store the state snapshots are read from.
+	State *speaker.StateStore
+
+	// Audit records commands received on the set topics. Optional.
+	Audit *audit.Log
+
+	// BrokerURL is the broker address, e.g. tcp://localhost:1883,
+	// ssl://broker:8883 or ws://broker:9001.
+	BrokerURL string
+	Username  string
+	Password  string
+	ClientID  string // default: the topic prefix
+
+	// TopicPrefix is the root of the state and command topics.
+	TopicPrefix string
+
+	// DiscoveryPrefix is Home Assistant's discovery prefix. Discovery is
+	// disabled when it is "-".
+	DiscoveryPrefix string
+
+	// TLS settings for ssl://, tls://, mqtts:// and wss:// brokers. CAFile
+	// adds a CA to verify the broker with; CertFile and KeyFile enable
+	// client certificate authentication.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// client is the part of the MQTT client the bridge uses, so tests can
+// replace it.
+type client interface {
+	Connect() paho.Token
+	Disconnect(quiesce uint)
+	IsConnected() bool
+	IsConnectionOpen() bool
+	Publish(topic string, qos byte, retained bool, payload any) paho.Token
+}
+
+// Bridge connects the active speaker to an MQTT broker.
+type Bridge struct {
+	opts   Options
+	client client
+
+	// Publishes waiting to be sent, in order, by sendLoop
+	outbox chan message
+	done   chan struct{}
+	loop   sync.WaitGroup
+
+	mu       sync.Mutex
+	position int64 // last published position, in seconds
+}
+
+// message is a publish waiting in the outbox.
+type message struct {
+	topic    string
+	data     []byte
+	retained bool
+}
+
+// New creates a bridge. Call Start to connect.
+func New(opts Options) (*Bridge, error) {
+	if opts.BrokerURL == "" {
+		return nil, fmt.Errorf("broker URL is required")
+	}
+	opts.TopicPrefix = strings.Trim(opts.TopicPrefix, "/")
+	if opts.TopicPrefix == "" {
+		opts.TopicPrefix = DefaultTopicPrefix
+	}
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = strings.ReplaceAll(opts.TopicPrefix, "/", "-")
+	}
+
+	b := &Bridge{
+		opts:     opts,
+		outbox:   make(chan message, outboxSize),
+		done:     make(chan struct{}),
+		position: -1,
+	}
+
+	clientOpts := paho.NewClientOptions().
+		AddBroker(opts.BrokerURL).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetKeepAlive(30*time.Second).
+		// Command handlers wait for the speaker, which would hold up
+		// acknowledgements with in-order delivery
+		SetOrderMatters(false).
+		SetWill(b.topic("status"), "offline", 1, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("MQTT connection lost: %v", err)
+		})
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+
+	b.client = paho.NewClient(clientOpts)
+	return b, nil
+}
+
+// tlsConfig builds the TLS configuration, or nil when no TLS option is set
+// (TLS brokers then use the system roots).
+func (o Options) tlsConfig() (*tls.Config, error) {
+	if o.CAFile == "" && o.CertFile == "" && !o.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify, //nolint:gosec // opt-in for self-signed brokers
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Start connects to the broker in the background; the client keeps
+// retrying until the broker is reachable.
+func (b *Bridge) Start() {
+	b.loop.Add(1)
+	go b.sendLoop()
+	b.client.Connect()
+}
+
+// Close stops the send loop, publishes the offline status and disconnects.
+// Publishes still in the outbox are dropped.
+func (b *Bridge) Close() {
+	close(b.done)
+	b.loop.Wait()
+	if b.client.IsConnected() {
+		b.send(message{topic: b.topic("status"), data: []byte("offline"), retained: true})
+	}
+	b.client.Disconnect(250)
+}
+
+// topic returns a topic under the prefix.
+func (b *Bridge) topic(name string) string {
+	return b.opts.TopicPrefix + "/" + name
+}
+
+// onConnect runs on every (re)connection: subscribe to commands, announce
+// entities and publish a full state snapshot.
+func (b *Bridge) onConnect(client paho.Client) {
+	log.Printf("MQTT connected to %s", b.opts.BrokerURL)
+
+	client.Subscribe(b.topic("set/+"), 1, b.onCommand)
+	if b.discoveryEnabled() {
+		// Home Assistant publishes "online" when it starts; re-announce so
+		// entities survive HA restarts without retained discovery
+		client.Subscribe(b.opts.DiscoveryPrefix+"/status", 1, func(_ paho.Client, msg paho.Message) {
+			if string(msg.Payload()) == "online" {
+				b.publishDiscovery()
+			}
+		})
+	}
+
+	go func() {
+		b.publish("status", "online", true)
+		b.publishDiscovery()
+		b.publishState()
+	}()
+}
+
+// publish queues a payload for a topic under the prefix. It doesn't wait
+// for the broker, so speaker events aren't held up by a slow one. Failures
+// are logged; state is republished on the next change or reconnect.
+func (b *Bridge) publish(name string, payload any, retained bool) {
+	b.publishTopic(b.topic(name), payload, retained)
+}
+
+func (b *Bridge) publishTopic(topic string, payload any, retained bool) {
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+	if !b.client.IsConnectionOpen() {
+		return
+	}
+
+	var data []byte
+	switch p := payload.(type) {
+	case string:
+		data = []byte(p)
+	case []byte:
+		data = p
+	default:
+		var err error
+		if data, err = json.Marshal(p); err != nil {
+			log.Printf("MQTT: failed to encode %s: %v", topic, err)
+			return
+		}
+	}
+
+	select {
+	case b.outbox <- message{topic: topic, data: data, retained: retained}:
+	default:
+		log.Printf("MQTT: outbox full, dropping publish to %s", topic)
+	}
+}
+
+// sendLoop sends queued publishes one at a time, so retained state arrives
+// in order, until the bridge is closed.
+func (b *Bridge) sendLoop() {
+	defer b.loop.Done()
+	for {
+		select {
+		case <-b.done:
+			return
+		case m := <-b.outbox:
+			b.send(m)
+		}
+	}
+}
+
+// send publishes a message and waits for the broker to accept it.
+func (b *Bridge) send(m message) {
+	token := b.client.Publish(m.topic, 1, m.retained, m.data)
+	if !token.WaitTimeout(publishTimeout) {
+		log.Printf("MQTT: publish to %s timed out", m.topic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		log.Printf("MQTT: failed to publish to %s: %v", m.topic, err)
+	}
+}
+
+// onOff formats a boolean the way Home Assistant switches expect.
+func onOff(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// playerState maps the speaker's player state to the published state.
+func playerState(state string) string {
+	switch state {
+	case kefw2.PlayerStatePlaying:
+		return "playing"
+	case kefw2.PlayerStatePaused:
+		return "paused"
+	default:
+		return "idle"
+	}
+}
+
+// HandleEvent publishes the state a speaker event changes. A change of the
+// active speaker re-announces the device; its state follows in the next
+// events. Speaker reachability is published as the bridge's availability.
+func (b *Bridge) HandleEvent(event speaker.Event) {
+	switch e := event.(type) {
+	case speaker.VolumeChanged:
+		b.publish("volume", strconv.Itoa(e.Volume), true)
+	case speaker.MuteChanged:
+		b.publish("mute", onOff(e.Muted), true)
+	case speaker.SourceChanged:
+		b.publish("source", string(e.Source), true)
+		b.publish("power", onOff(e.Source != kefw2.SourceStandby), true)
+		if e.Source == kefw2.SourceStandby {
+			b.publish("state", "off", true)
+		}
+	case speaker.PowerChanged:
+		on := e.Status != kefw2.SpeakerStatusStandby
+		b.publish("power", onOff(on), true)
+		if !on {
+			b.publish("state", "off", true)
+		}
+	case speaker.PlayerChanged:
+		b.publish("state", playerState(e.State), true)
+		b.publish("media", mediaPayload(e.Title, e.Artist, e.Album, e.Duration, e.Icon), true)
+	case speaker.PositionChanged:
+		b.publishPosition(e.Position)
+	case speaker.HealthChanged:
+		if !e.Connected {
+			b.publish("status", "offline", true)
+			return
+		}
+		b.publish("status", "online", true)
+		go b.publishState()
+	case speaker.ActiveSpeakerChanged:
+		b.publishDiscovery()
+	}
+}
+
+// mediaPayload builds the now-playing JSON.
+func mediaPayload(title, artist, album string, durationMS int, icon string) map[string]any {
+	return map[string]any{
+		"title":    title,
+		"artist":   artist,
+		"album":    album,
+		"duration": durationMS / 1000,
+		"icon":     icon,
+	}
+}
+
+// publishPosition publishes the position when the whole second changes.
+func (b *Bridge) publishPosition(ms int64) {
+	secs := int64(0)
+	if ms > 0 {
+		secs = ms / 1000
+	}
+
+	b.mu.Lock()
+	changed := secs != b.position
+	b.position = secs
+	b.mu.Unlock()
+
+	if changed {
+		b.publish("position", strconv.FormatInt(secs, 10), false)
+	}
+}
+
+// publishState publishes a full snapshot of the active speaker's state.
+func (b *Bridge) publishState() {
+	spk := b.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		b.publish("status", "offline", true)
+		return
+	}
+
+	// Querying a speaker in standby wakes it up, so report standby as is
+	if b.opts.Manager.IsInStandby() {
+		b.publish("power", "OFF", true)
+		b.publish("source", string(kefw2.SourceStandby), true)
+		b.publish("state", "off", true)
+		return
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	state, err := b.opts.State.Get(ctx, spk)
+	if err != nil {
+		log.Printf("MQTT: failed to read speaker state: %v", err)
+		return
+	}
+
+	b.publish("source", string(state.Source), true)
+	b.publish("power", onOff(state.Source != kefw2.SourceStandby), true)
+	b.publish("volume", strconv.Itoa(state.Volume), true)
+	b.publish("mute", onOff(state.Muted), true)
+	b.publish("state", playerState(state.Player.State), true)
+	b.publish("media", mediaPayload(
+		state.Player.Title,
+		state.Player.Artist,
+		state.Player.Album,
+		state.Player.Duration,
+		state.Player.Icon,
+	), true)
+}
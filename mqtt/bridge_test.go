@@ -0,0 +1,468 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// fakeClient records publishes instead of sending them to a broker.
+type fakeClient struct {
+	mu        sync.Mutex
+	connected bool
+	published []message
+}
+
+func (c *fakeClient) Connect() paho.Token { return doneToken{} }
+
+func (c *fakeClient) Disconnect(uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = false
+}
+
+func (c *fakeClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *fakeClient) IsConnectionOpen() bool { return c.IsConnected() }
+
+func (c *fakeClient) Publish(topic string, _ byte, retained bool, payload any) paho.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, message{topic: topic, data: payload.([]byte), retained: retained})
+	return doneToken{}
+}
+
+func (c *fakeClient) messages() []message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.published)
+}
+
+// doneToken is a completed publish.
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (doneToken) Error() error { return nil }
+
+// fakeMessage is a message received on a command topic.
+type fakeMessage struct {
+	paho.Message
+	topic   string
+	payload string
+}
+
+func (m fakeMessage) Topic() string   { return m.topic }
+func (m fakeMessage) Payload() []byte { return []byte(m.payload) }
+
+// newTestBridge creates a bridge with a connected fake client. The send loop
+// isn't started; queued publishes are read from the outbox with drain.
+func newTestBridge(t *testing.T, opts Options) (*Bridge, *fakeClient) {
+	t.Helper()
+	opts.BrokerURL = "tcp://127.0.0.1:1883"
+	if opts.Manager == nil {
+		opts.Manager = speaker.NewManager()
+	}
+	if opts.State == nil {
+		opts.State = speaker.NewStateStore()
+	}
+	b, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	fake := &fakeClient{connected: true}
+	b.client = fake
+	return b, fake
+}
+
+// drain returns the publishes waiting in the outbox.
+func drain(b *Bridge) []message {
+	var messages []message
+	for {
+		select {
+		case m := <-b.outbox:
+			messages = append(messages, m)
+		default:
+			return messages
+		}
+	}
+}
+
+// payloads maps the topics of messages to their payloads.
+func payloads(messages []message) map[string]string {
+	byTopic := make(map[string]string, len(messages))
+	for _, m := range messages {
+		byTopic[m.topic] = string(m.data)
+	}
+	return byTopic
+}
+
+func TestPublishDiscovery(t *testing.T) {
+	tests := []struct {
+		name            string
+		topicPrefix     string
+		discoveryPrefix string
+		wantNode        string
+	}{
+		{"defaults", "", "", "kefw2ui"},
+		{"nested prefix", "home/living room/", "ha", "home_living_room"},
+		{"disabled", "", "-", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBridge(t, Options{TopicPrefix: tt.topicPrefix, DiscoveryPrefix: tt.discoveryPrefix})
+			b.publishDiscovery()
+			messages := drain(b)
+
+			if tt.wantNode == "" {
+				if len(messages) != 0 {
+					t.Fatalf("published %d discovery entries, want none", len(messages))
+				}
+				return
+			}
+			entities := b.entities()
+			if len(messages) != len(entities) {
+				t.Fatalf("published %d discovery entries, want %d", len(messages), len(entities))
+			}
+			for i, e := range entities {
+				m := messages[i]
+				wantTopic := b.opts.DiscoveryPrefix + "/" + e.component + "/" + tt.wantNode + "/" + e.object + "/config"
+				if m.topic != wantTopic {
+					t.Errorf("topic = %q, want %q", m.topic, wantTopic)
+				}
+				if !m.retained {
+					t.Errorf("%s: not retained", m.topic)
+				}
+
+				var config struct {
+					UniqueID     string `json:"unique_id"`
+					ObjectID     string `json:"object_id"`
+					Availability string `json:"availability_topic"`
+					CommandTopic string `json:"command_topic"`
+					Device       struct {
+						Identifiers []string `json:"identifiers"`
+						Name        string   `json:"name"`
+					} `json:"device"`
+				}
+				if err := json.Unmarshal(m.data, &config); err != nil {
+					t.Fatalf("%s: %v", m.topic, err)
+				}
+				if want := tt.wantNode + "_" + e.object; config.UniqueID != want || config.ObjectID != want {
+					t.Errorf("%s: unique_id %q, object_id %q, want %q", m.topic, config.UniqueID, config.ObjectID, want)
+				}
+				if want := b.topic("status"); config.Availability != want {
+					t.Errorf("%s: availability_topic = %q, want %q", m.topic, config.Availability, want)
+				}
+				if config.CommandTopic != "" && !strings.HasPrefix(config.CommandTopic, b.topic("set/")) {
+					t.Errorf("%s: command_topic = %q, want it under %q", m.topic, config.CommandTopic, b.topic("set/"))
+				}
+				if !slices.Equal(config.Device.Identifiers, []string{tt.wantNode}) || config.Device.Name != "kefw2ui" {
+					t.Errorf("%s: device = %+v", m.topic, config.Device)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event speaker.Event
+		want  map[string]string
+	}{
+		{"volume", speaker.VolumeChanged{Volume: 42}, map[string]string{"kefw2ui/volume": "42"}},
+		{"mute", speaker.MuteChanged{Muted: true}, map[string]string{"kefw2ui/mute": "ON"}},
+		{"source", speaker.SourceChanged{Source: kefw2.SourceOptical}, map[string]string{
+			"kefw2ui/source": "optical",
+			"kefw2ui/power":  "ON",
+		}},
+		{"standby", speaker.SourceChanged{Source: kefw2.SourceStandby}, map[string]string{
+			"kefw2ui/source": "standby",
+			"kefw2ui/power":  "OFF",
+			"kefw2ui/state":  "off",
+		}},
+		{"player", speaker.PlayerChanged{State: kefw2.PlayerStatePaused, Title: "Song", Duration: 61500}, map[string]string{
+			"kefw2ui/state": "paused",
+			"kefw2ui/media": `{"album":"","artist":"","duration":61,"icon":"","title":"Song"}`,
+		}},
+		{"position", speaker.PositionChanged{Position: 12999}, map[string]string{"kefw2ui/position": "12"}},
+		{"disconnected", speaker.HealthChanged{Connected: false}, map[string]string{"kefw2ui/status": "offline"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBridge(t, Options{})
+			b.HandleEvent(tt.event)
+			if got := payloads(drain(b)); !maps.Equal(got, tt.want) {
+				t.Errorf("published %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishPositionOncePerSecond(t *testing.T) {
+	b, _ := newTestBridge(t, Options{})
+	for _, ms := range []int64{1000, 1500, 1999, 2000, -5} {
+		b.publishPosition(ms)
+	}
+
+	var got []string
+	for _, m := range drain(b) {
+		got = append(got, string(m.data))
+		if m.retained {
+			t.Errorf("position published retained")
+		}
+	}
+	if want := []string{"1", "2", "0"}; !slices.Equal(got, want) {
+		t.Errorf("published positions %v, want %v", got, want)
+	}
+}
+
+func TestPublishStateWithoutSpeaker(t *testing.T) {
+	b, _ := newTestBridge(t, Options{})
+	b.publishState()
+	want := map[string]string{"kefw2ui/status": "offline"}
+	if got := payloads(drain(b)); !maps.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestPublishStateFromStore(t *testing.T) {
+	spk := newFakeSpeaker(t)
+	b, _ := newTestBridge(t, Options{Manager: spk.manager})
+
+	b.publishState()
+	want := map[string]string{
+		"kefw2ui/source": "wifi",
+		"kefw2ui/power":  "ON",
+		"kefw2ui/volume": "30",
+		"kefw2ui/mute":   "OFF",
+		"kefw2ui/state":  "idle",
+		"kefw2ui/media":  `{"album":"","artist":"","duration":0,"icon":"","title":""}`,
+	}
+	if got := payloads(drain(b)); !maps.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	// The second snapshot comes from the store, with the change an event made
+	reads := spk.reads()
+	b.opts.State.HandleEvent(spk.ip, &kefw2.VolumeEvent{Volume: 55})
+	b.publishState()
+	if got := payloads(drain(b))["kefw2ui/volume"]; got != "55" {
+		t.Errorf("volume = %q, want 55", got)
+	}
+	if spk.reads() != reads {
+		t.Errorf("snapshot queried the speaker again")
+	}
+}
+
+func TestHandleCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		payload string
+		wantErr string
+		wantSet []string // path=value of the speaker settings changed
+	}{
+		{"volume", "40", "", []string{"player:volume=40"}},
+		{"volume", "12.6", "", []string{"player:volume=13"}},
+		{"volume", "101", "invalid volume", nil},
+		{"volume", "loud", "invalid volume", nil},
+		{"mute", "ON", "", []string{"settings:/mediaPlayer/mute=true"}},
+		{"mute", "off", "", []string{"settings:/mediaPlayer/mute=false"}},
+		{"source", "Optical", "", []string{"settings:/kef/play/physicalSource=optical"}},
+		{"power", "OFF", "", []string{"settings:/kef/play/physicalSource=standby"}},
+		{"seek", "-1", "invalid position", nil},
+		{"rewind", "", "unknown command", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command+" "+tt.payload, func(t *testing.T) {
+			spk := newFakeSpeaker(t)
+			b, _ := newTestBridge(t, Options{Manager: spk.manager})
+
+			err := b.handleCommand(tt.command, tt.payload)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("handleCommand: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("handleCommand error = %v, want %q", err, tt.wantErr)
+			}
+			if got := spk.sets(); !slices.Equal(got, tt.wantSet) {
+				t.Errorf("speaker settings changed %v, want %v", got, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestHandleCommandWithoutSpeaker(t *testing.T) {
+	b, _ := newTestBridge(t, Options{})
+	if err := b.handleCommand("play", ""); err == nil || err.Error() != "no active speaker" {
+		t.Errorf("handleCommand error = %v, want no active speaker", err)
+	}
+}
+
+func TestOnCommandRecordsAudit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	manager := speaker.NewManager()
+	log, err := audit.New(manager)
+	if err != nil {
+		t.Fatalf("audit.New: %v", err)
+	}
+	b, _ := newTestBridge(t, Options{Manager: manager, Audit: log, ClientID: "ha-bridge"})
+
+	b.onCommand(nil, fakeMessage{topic: "kefw2ui/set/volume", payload: " 40 \n"})
+
+	var entries []audit.Entry
+	for deadline := time.Now().Add(5 * time.Second); len(entries) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		if entries, err = log.Query(audit.Filter{Source: audit.SourceMQTT}); err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+	}
+	if len(entries) != 1 {
+		t.Fatalf("recorded %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Action != "volume" || e.Caller.Client != "ha-bridge" || e.Params["payload"] != "40" || e.Error != "no active speaker" {
+		t.Errorf("recorded %+v", e)
+	}
+}
+
+func TestCloseStopsSendLoop(t *testing.T) {
+	b, fake := newTestBridge(t, Options{})
+	b.Start()
+	b.publish("volume", "10", true)
+	for deadline := time.Now().Add(5 * time.Second); len(fake.messages()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("queued publish wasn't sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	b.Close()
+	b.publish("volume", "20", true)
+
+	want := []message{
+		{topic: "kefw2ui/volume", data: []byte("10"), retained: true},
+		{topic: "kefw2ui/status", data: []byte("offline"), retained: true},
+	}
+	got := fake.messages()
+	if !slices.EqualFunc(got, want, func(a, b message) bool {
+		return a.topic == b.topic && string(a.data) == string(b.data) && a.retained == b.retained
+	}) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	if len(drain(b)) != 0 {
+		t.Errorf("publish queued after Close")
+	}
+	if fake.IsConnected() {
+		t.Errorf("still connected after Close")
+	}
+}
+
+// fakeSpeaker is a speaker API on a local HTTP server, made the active
+// speaker of its manager. It reports wifi at volume 30, unmuted, with
+// nothing playing, and records the settings changed.
+type fakeSpeaker struct {
+	ip      string
+	manager *speaker.Manager
+
+	mu      sync.Mutex
+	changed []string
+	getData int
+}
+
+func newFakeSpeaker(t *testing.T) *fakeSpeaker {
+	t.Helper()
+	f := &fakeSpeaker{manager: speaker.NewManager()}
+
+	values := map[string]string{
+		"settings:/kef/play/physicalSource": `[{"type":"kefPhysicalSource","kefPhysicalSource":"wifi"}]`,
+		"player:volume":                     `[{"type":"i32_","i32_":30}]`,
+		"settings:/mediaPlayer/mute":        `[{"type":"bool_","bool_":false}]`,
+		"settings:/kef/host/speakerStatus":  `[{"type":"kefSpeakerStatus","kefSpeakerStatus":"powerOn"}]`,
+		"settings:/kef/host/maximumVolume":  `[{"type":"i32_","i32_":100}]`,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/event/modifyQueue", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `"{queue}"`)
+	})
+	mux.HandleFunc("/api/event/pollQueue", func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/api/getData", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.getData++
+		f.mu.Unlock()
+		value, ok := values[r.URL.Query().Get("path")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, value)
+	})
+	mux.HandleFunc("/api/setData", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Path  string                     `json:"path"`
+			Value map[string]json.RawMessage `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var typ string
+		_ = json.Unmarshal(req.Value["type"], &typ)
+		f.mu.Lock()
+		f.changed = append(f.changed, req.Path+"="+strings.Trim(string(req.Value[typ]), `"`))
+		f.mu.Unlock()
+		_, _ = io.WriteString(w, "{}")
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Cleanup(f.manager.Close)
+
+	f.ip = strings.TrimPrefix(srv.URL, "http://")
+	f.manager.AddConfiguredSpeaker(f.ip, "Living room", "LSX2")
+	if err := f.manager.SetActiveSpeaker(t.Context(), f.ip); err != nil {
+		t.Fatalf("SetActiveSpeaker: %v", err)
+	}
+	return f
+}
+
+// sets returns the settings changed, as path=value.
+func (f *fakeSpeaker) sets() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.changed)
+}
+
+// reads returns how many values were read.
+func (f *fakeSpeaker) reads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.getData
+}
@@ -0,0 +1,178 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// commandTimeout bounds the speaker calls made for one command.
+const commandTimeout = 15 * time.Second
+
+func commandContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), commandTimeout)
+}
+
+// onCommand handles a message on {prefix}/set/{command}. Commands run off
+// the client's message goroutine so slow speaker calls don't stall it.
+func (b *Bridge) onCommand(_ paho.Client, msg paho.Message) {
+	command := path.Base(msg.Topic())
+	payload := strings.TrimSpace(string(msg.Payload()))
+
+	go func() {
+		if b.opts.Audit != nil {
+			b.opts.Audit.NoteLocalChange()
+		}
+		err := b.handleCommand(command, payload)
+		b.record(command, payload, err)
+		if err != nil {
+			log.Printf("MQTT command %s %q failed: %v", command, payload, err)
+		}
+	}()
+}
+
+// record adds a command to the audit log. MQTT doesn't tell subscribers who
+// published a message, so the caller is the bridge's own client ID: the
+// connection the command came in on.
+func (b *Bridge) record(command, payload string, err error) {
+	if b.opts.Audit == nil {
+		return
+	}
+	entry := audit.Entry{
+		Source: audit.SourceMQTT,
+		Action: command,
+		Caller: audit.Caller{Client: b.opts.ClientID},
+	}
+	if payload != "" {
+		entry.Params = map[string]any{"payload": payload}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	b.opts.Audit.Record(entry)
+}
+
+// handleCommand runs a player command on the active speaker:
+//
+//	power      ON | OFF | TOGGLE
+//	source     a source name (wifi, bluetooth, tv, optical, coaxial, analog, usb, standby)
+//	volume     0-100
+//	mute       ON | OFF | TOGGLE
+//	play, pause, playpause, stop, next, previous (payload ignored)
+//	seek       position in seconds
+func (b *Bridge) handleCommand(command, payload string) error {
+	spk := b.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		return fmt.Errorf("no active speaker")
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	switch command {
+	case "power":
+		on := strings.EqualFold(payload, "ON")
+		if strings.EqualFold(payload, "TOGGLE") {
+			on = b.opts.Manager.IsInStandby()
+			if !on {
+				poweredOn, err := spk.IsPoweredOn(ctx)
+				if err != nil {
+					return err
+				}
+				on = !poweredOn
+			}
+		}
+		if on {
+			if err := spk.SetSource(ctx, kefw2.SourceWiFi); err != nil {
+				return err
+			}
+			b.opts.Manager.NotifyWake()
+			return nil
+		}
+		if err := spk.PowerOff(ctx); err != nil {
+			return err
+		}
+		b.opts.Manager.NotifyStandby()
+		return nil
+
+	case "source":
+		source := kefw2.Source(strings.ToLower(payload))
+		if err := spk.SetSource(ctx, source); err != nil {
+			return err
+		}
+		// Keep the manager's standby tracking in step, as the REST handler does
+		if source == kefw2.SourceStandby {
+			b.opts.Manager.NotifyStandby()
+		} else {
+			b.opts.Manager.NotifyWake()
+		}
+		return nil
+
+	case "volume":
+		volume, err := strconv.ParseFloat(payload, 64)
+		if err != nil || volume < 0 || volume > 100 {
+			return fmt.Errorf("invalid volume")
+		}
+		_, err = b.opts.Manager.SetVolume(ctx, spk, int(volume+0.5), speaker.OriginMQTT)
+		return err
+
+	case "mute":
+		mute := strings.EqualFold(payload, "ON")
+		if strings.EqualFold(payload, "TOGGLE") {
+			muted, err := spk.IsMuted(ctx)
+			if err != nil {
+				return err
+			}
+			mute = !muted
+		}
+		if mute {
+			return spk.Mute(ctx)
+		}
+		return spk.Unmute(ctx)
+
+	case "play":
+		_, err := kefw2.NewAirableClient(spk).PlayOrResumeFromQueue(ctx)
+		return err
+
+	case "pause":
+		pd, err := spk.PlayerData(ctx)
+		if err != nil {
+			return err
+		}
+		if pd.State != kefw2.PlayerStatePlaying {
+			return nil
+		}
+		return spk.PlayPause(ctx)
+
+	case "playpause":
+		return spk.PlayPause(ctx)
+
+	case "stop":
+		return spk.Stop(ctx)
+
+	case "next":
+		return spk.NextTrack(ctx)
+
+	case "previous":
+		return spk.PreviousTrack(ctx)
+
+	case "seek":
+		secs, err := strconv.ParseFloat(payload, 64)
+		if err != nil || secs < 0 {
+			return fmt.Errorf("invalid position")
+		}
+		return spk.SeekTo(ctx, int64(secs*1000))
+	}
+
+	return fmt.Errorf("unknown command")
+}
@@ -0,0 +1,139 @@
+package mqtt
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+)
+
+// Home Assistant's MQTT integration has no media_player platform, so the
+// speaker is announced as one device with an entity per control: source
+// select, volume number, power and mute switches, transport buttons and
+// playback sensors.
+
+// sources are the options of the source select.
+var sources = []kefw2.Source{
+	kefw2.SourceWiFi, kefw2.SourceBluetooth, kefw2.SourceTV, kefw2.SourceOptical,
+	kefw2.SourceCoaxial, kefw2.SourceAux, kefw2.SourceUSB, kefw2.SourceStandby,
+}
+
+// entity is one Home Assistant discovery entry.
+type entity struct {
+	component string // sensor, switch, select, number, button
+	object    string
+	config    map[string]any
+}
+
+var nodeIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// nodeID returns the discovery node ID derived from the topic prefix.
+func (b *Bridge) nodeID() string {
+	return strings.Trim(nodeIDChars.ReplaceAllString(b.opts.TopicPrefix, "_"), "_")
+}
+
+func (b *Bridge) discoveryEnabled() bool {
+	return b.opts.DiscoveryPrefix != "-"
+}
+
+// entities returns the discovery entries for the active speaker.
+func (b *Bridge) entities() []entity {
+	button := func(object, name, command, icon string) entity {
+		return entity{"button", object, map[string]any{
+			"name":          name,
+			"command_topic": b.topic("set/" + command),
+			"payload_press": "PRESS",
+			"icon":          icon,
+		}}
+	}
+	sourceOptions := make([]string, len(sources))
+	for i, src := range sources {
+		sourceOptions[i] = string(src)
+	}
+
+	return []entity{
+		{"switch", "power", map[string]any{
+			"name":          "Power",
+			"state_topic":   b.topic("power"),
+			"command_topic": b.topic("set/power"),
+			"icon":          "mdi:power",
+		}},
+		{"select", "source", map[string]any{
+			"name":          "Source",
+			"state_topic":   b.topic("source"),
+			"command_topic": b.topic("set/source"),
+			"options":       sourceOptions,
+			"icon":          "mdi:import",
+		}},
+		{"number", "volume", map[string]any{
+			"name":          "Volume",
+			"state_topic":   b.topic("volume"),
+			"command_topic": b.topic("set/volume"),
+			"min":           0,
+			"max":           100,
+			"step":          1,
+			"mode":          "slider",
+			"icon":          "mdi:volume-high",
+		}},
+		{"switch", "mute", map[string]any{
+			"name":          "Mute",
+			"state_topic":   b.topic("mute"),
+			"command_topic": b.topic("set/mute"),
+			"icon":          "mdi:volume-off",
+		}},
+		{"sensor", "state", map[string]any{
+			"name":        "Playback",
+			"state_topic": b.topic("state"),
+			"icon":        "mdi:play-pause",
+		}},
+		{"sensor", "media", map[string]any{
+			"name":                  "Now playing",
+			"state_topic":           b.topic("media"),
+			"value_template":        "{{ value_json.title }}",
+			"json_attributes_topic": b.topic("media"),
+			"icon":                  "mdi:music",
+		}},
+		{"sensor", "position", map[string]any{
+			"name":                "Position",
+			"state_topic":         b.topic("position"),
+			"device_class":        "duration",
+			"unit_of_measurement": "s",
+		}},
+		button("play", "Play", "play", "mdi:play"),
+		button("pause", "Pause", "pause", "mdi:pause"),
+		button("stop", "Stop", "stop", "mdi:stop"),
+		button("next", "Next", "next", "mdi:skip-next"),
+		button("previous", "Previous", "previous", "mdi:skip-previous"),
+	}
+}
+
+// publishDiscovery announces all entities to Home Assistant. The entries are
+// retained, so they are also picked up when Home Assistant starts later.
+func (b *Bridge) publishDiscovery() {
+	if !b.discoveryEnabled() {
+		return
+	}
+
+	node := b.nodeID()
+	device := map[string]any{
+		"identifiers":  []string{node},
+		"name":         "kefw2ui",
+		"manufacturer": "KEF",
+	}
+	if spk := b.opts.Manager.GetActiveSpeaker(); spk != nil {
+		if spk.Name != "" {
+			device["name"] = spk.Name
+		}
+		if spk.Model != "" {
+			device["model"] = spk.Model
+		}
+	}
+
+	for _, e := range b.entities() {
+		e.config["unique_id"] = node + "_" + e.object
+		e.config["object_id"] = node + "_" + e.object
+		e.config["availability_topic"] = b.topic("status")
+		e.config["device"] = device
+		b.publishTopic(b.opts.DiscoveryPrefix+"/"+e.component+"/"+node+"/"+e.object+"/config", e.config, true)
+	}
+}
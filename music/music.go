@@ -0,0 +1,478 @@
+// Package music indexes a local directory of audio files so kefw2ui can serve
+// them to the speaker over HTTP.
+//
+// Tags are read from FLAC, MP3, M4A and Ogg files. Files are addressed by
+// their slash-separated path relative to the music directory, which doubles
+// as the track ID; only indexed files are ever served.
+package music
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// Browse path prefixes for the local music source.
+const (
+	// FolderPathPrefix prefixes the browse path of a folder. The bare prefix
+	// is the music directory itself.
+	FolderPathPrefix = "music:folder/"
+
+	// TrackPathPrefix prefixes the browse path of a single track.
+	TrackPathPrefix = "music:track/"
+)
+
+// audioFormats maps supported file extensions to their MIME types.
+var audioFormats = map[string]string{
+	".flac": "audio/flac",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+}
+
+// coverNames are the file names checked for folder artwork, in order.
+var coverNames = []string{"cover.jpg", "cover.png", "folder.jpg", "folder.png", "front.jpg", "front.png"}
+
+// Track is an indexed audio file.
+type Track struct {
+	ID          string    `json:"id"` // Path relative to the music directory
+	Title       string    `json:"title"`
+	Artist      string    `json:"artist,omitempty"`
+	Album       string    `json:"album,omitempty"`
+	AlbumArtist string    `json:"albumArtist,omitempty"`
+	Genre       string    `json:"genre,omitempty"`
+	Year        int       `json:"year,omitempty"`
+	TrackNumber int       `json:"trackNumber,omitempty"`
+	DiscNumber  int       `json:"discNumber,omitempty"`
+	MimeType    string    `json:"mimeType"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	HasArtwork  bool      `json:"hasArtwork,omitempty"`
+}
+
+// Path returns the browse path of the track.
+func (t *Track) Path() string {
+	return TrackPathPrefix + t.ID
+}
+
+// Folder returns the ID of the folder containing the track.
+func (t *Track) Folder() string {
+	if dir := path.Dir(t.ID); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// Matches reports whether the track's title, artist, album or file name
+// contain query (case-insensitive).
+func (t *Track) Matches(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return true
+	}
+	for _, field := range []string{t.Title, t.Artist, t.Album, t.AlbumArtist, path.Base(t.ID)} {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// Folder is a directory in the music library that contains audio files,
+// directly or in a subfolder.
+type Folder struct {
+	ID   string `json:"id"` // Path relative to the music directory ("" for the root)
+	Name string `json:"name"`
+}
+
+// Path returns the browse path of the folder.
+func (f *Folder) Path() string {
+	return FolderPathPrefix + f.ID
+}
+
+// Stats describes the state of the index.
+type Stats struct {
+	Dir       string    `json:"dir"`
+	Tracks    int       `json:"tracks"`
+	Folders   int       `json:"folders"`
+	Scanning  bool      `json:"scanning"`
+	ScannedAt time.Time `json:"scannedAt,omitzero"`
+}
+
+// Library is an in-memory index of a music directory.
+type Library struct {
+	root string
+
+	mu        sync.RWMutex
+	tracks    map[string]*Track
+	folders   map[string][]string // folder ID -> subfolder IDs
+	contents  map[string][]string // folder ID -> track IDs
+	scanning  bool
+	scannedAt time.Time
+}
+
+// NewLibrary creates a library for dir. Call Scan to build the index.
+func NewLibrary(dir string) (*Library, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve music directory: %w", err)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open music directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("music directory %s is not a directory", root)
+	}
+
+	return &Library{
+		root:     root,
+		tracks:   map[string]*Track{},
+		folders:  map[string][]string{},
+		contents: map[string][]string{},
+	}, nil
+}
+
+// Dir returns the music directory.
+func (l *Library) Dir() string {
+	return l.root
+}
+
+// Scan walks the music directory and rebuilds the index. The previous index
+// stays available until the scan completes. Unreadable files are skipped.
+func (l *Library) Scan() error {
+	l.mu.Lock()
+	if l.scanning {
+		l.mu.Unlock()
+		return fmt.Errorf("scan already in progress")
+	}
+	l.scanning = true
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.scanning = false
+		l.mu.Unlock()
+	}()
+
+	tracks := map[string]*Track{}
+	folders := map[string][]string{}
+	contents := map[string][]string{}
+	linked := map[string]bool{}
+
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr // skip unreadable entries and keep scanning
+		}
+		if d.IsDir() {
+			if p != l.root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		mimeType, ok := audioFormats[strings.ToLower(filepath.Ext(p))]
+		if !ok || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return nil //nolint:nilerr // not below the root; skip
+		}
+		track := readTrack(p, filepath.ToSlash(rel), mimeType)
+		if track == nil {
+			return nil
+		}
+
+		tracks[track.ID] = track
+		folder := track.Folder()
+		contents[folder] = append(contents[folder], track.ID)
+		addFolder(folders, linked, folder)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan music directory: %w", err)
+	}
+
+	for id := range contents {
+		sortTracks(contents[id], tracks)
+	}
+	for id := range folders {
+		sort.Slice(folders[id], func(i, j int) bool {
+			return strings.ToLower(folders[id][i]) < strings.ToLower(folders[id][j])
+		})
+	}
+
+	l.mu.Lock()
+	l.tracks = tracks
+	l.folders = folders
+	l.contents = contents
+	l.scannedAt = time.Now()
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Stats returns the current index statistics.
+func (l *Library) Stats() Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	folders := 0
+	for id := range l.folders {
+		if id != "" {
+			folders++
+		}
+	}
+
+	return Stats{
+		Dir:       l.root,
+		Tracks:    len(l.tracks),
+		Folders:   folders,
+		Scanning:  l.scanning,
+		ScannedAt: l.scannedAt,
+	}
+}
+
+// Browse returns the subfolders and tracks directly inside folder.
+func (l *Library) Browse(folder string) ([]Folder, []Track, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	subfolders, ok := l.folders[folder]
+	if !ok && folder != "" {
+		return nil, nil, fmt.Errorf("folder not found: %s", folder)
+	}
+	trackIDs := l.contents[folder]
+
+	folders := make([]Folder, 0, len(subfolders))
+	for _, id := range subfolders {
+		folders = append(folders, Folder{ID: id, Name: path.Base(id)})
+	}
+
+	tracks := make([]Track, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		tracks = append(tracks, *l.tracks[id])
+	}
+
+	return folders, tracks, nil
+}
+
+// FolderTracks returns all tracks in folder and its subfolders, in browse
+// order.
+func (l *Library) FolderTracks(folder string) ([]Track, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if _, ok := l.folders[folder]; !ok && folder != "" {
+		return nil, fmt.Errorf("folder not found: %s", folder)
+	}
+
+	var tracks []Track
+	var walk func(id string)
+	walk = func(id string) {
+		for _, trackID := range l.contents[id] {
+			tracks = append(tracks, *l.tracks[trackID])
+		}
+		for _, sub := range l.folders[id] {
+			walk(sub)
+		}
+	}
+	walk(folder)
+
+	return tracks, nil
+}
+
+// Search returns tracks matching query, ordered by folder and track number.
+func (l *Library) Search(query string) []Track {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ids := make([]string, 0)
+	for id, t := range l.tracks {
+		if t.Matches(query) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := l.tracks[ids[i]], l.tracks[ids[j]]
+		if a.Folder() != b.Folder() {
+			return a.Folder() < b.Folder()
+		}
+		return trackLess(a, b)
+	})
+
+	tracks := make([]Track, 0, len(ids))
+	for _, id := range ids {
+		tracks = append(tracks, *l.tracks[id])
+	}
+	return tracks
+}
+
+// Get returns an indexed track by ID.
+func (l *Library) Get(id string) (*Track, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	t, ok := l.tracks[id]
+	if !ok {
+		return nil, fmt.Errorf("track not found: %s", id)
+	}
+	track := *t
+	return &track, nil
+}
+
+// FilePath returns the file system path of an indexed track. Only indexed
+// tracks resolve, so IDs cannot reach files outside the music directory.
+func (l *Library) FilePath(id string) (string, error) {
+	if _, err := l.Get(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(id)), nil
+}
+
+// Artwork returns the cover art of a track: the embedded picture, or a cover
+// image in the track's folder.
+func (l *Library) Artwork(id string) ([]byte, string, error) {
+	p, err := l.FilePath(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if pic := readPicture(p); pic != nil {
+		return pic.Data, pic.MIMEType, nil
+	}
+
+	if cover := findCover(filepath.Dir(p)); cover != "" {
+		data, err := os.ReadFile(cover) //nolint:gosec // cover lives next to an indexed track
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read artwork: %w", err)
+		}
+		mimeType := "image/jpeg"
+		if strings.HasSuffix(cover, ".png") {
+			mimeType = "image/png"
+		}
+		return data, mimeType, nil
+	}
+
+	return nil, "", fmt.Errorf("no artwork for %s", id)
+}
+
+// IsMusicPath reports whether a browse path belongs to the local music source.
+func IsMusicPath(p string) bool {
+	return strings.HasPrefix(p, FolderPathPrefix) || strings.HasPrefix(p, TrackPathPrefix)
+}
+
+// readTrack reads the tags of the file at p. Files without readable tags are
+// indexed under their file name.
+func readTrack(p, id, mimeType string) *Track {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil
+	}
+
+	track := &Track{
+		ID:       id,
+		Title:    strings.TrimSuffix(path.Base(id), path.Ext(id)),
+		MimeType: mimeType,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+
+	f, err := os.Open(p) //nolint:gosec // p comes from walking the music directory
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	if m, err := tag.ReadFrom(f); err == nil {
+		if title := strings.TrimSpace(m.Title()); title != "" {
+			track.Title = title
+		}
+		track.Artist = strings.TrimSpace(m.Artist())
+		track.Album = strings.TrimSpace(m.Album())
+		track.AlbumArtist = strings.TrimSpace(m.AlbumArtist())
+		track.Genre = strings.TrimSpace(m.Genre())
+		track.Year = m.Year()
+		track.TrackNumber, _ = m.Track()
+		track.DiscNumber, _ = m.Disc()
+		track.HasArtwork = m.Picture() != nil && len(m.Picture().Data) > 0
+	}
+	if !track.HasArtwork {
+		track.HasArtwork = findCover(filepath.Dir(p)) != ""
+	}
+
+	return track
+}
+
+// readPicture returns the embedded picture of the file at p, if any.
+func readPicture(p string) *tag.Picture {
+	data, err := os.ReadFile(p) //nolint:gosec // p is an indexed track
+	if err != nil {
+		return nil
+	}
+	m, err := tag.ReadFrom(bytes.NewReader(data))
+	if err != nil || m.Picture() == nil || len(m.Picture().Data) == 0 {
+		return nil
+	}
+	return m.Picture()
+}
+
+// findCover returns the path of a cover image in dir, or "".
+func findCover(dir string) string {
+	for _, name := range coverNames {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// addFolder registers folder and its ancestors in folders. linked records
+// the folders already listed under their parent.
+func addFolder(folders map[string][]string, linked map[string]bool, folder string) {
+	if _, ok := folders[""]; !ok {
+		folders[""] = []string{}
+	}
+	for folder != "" && !linked[folder] {
+		parent := path.Dir(folder)
+		if parent == "." {
+			parent = ""
+		}
+		if _, ok := folders[folder]; !ok {
+			folders[folder] = []string{}
+		}
+		folders[parent] = append(folders[parent], folder)
+		linked[folder] = true
+		folder = parent
+	}
+}
+
+// sortTracks orders track IDs by disc, track number and title.
+func sortTracks(ids []string, tracks map[string]*Track) {
+	sort.Slice(ids, func(i, j int) bool {
+		return trackLess(tracks[ids[i]], tracks[ids[j]])
+	})
+}
+
+func trackLess(a, b *Track) bool {
+	if a.DiscNumber != b.DiscNumber {
+		return a.DiscNumber < b.DiscNumber
+	}
+	if a.TrackNumber != b.TrackNumber {
+		return a.TrackNumber < b.TrackNumber
+	}
+	return strings.ToLower(a.ID) < strings.ToLower(b.ID)
+}
@@ -0,0 +1,117 @@
+// Package pagination holds the limit/cursor paging shared by the REST browse
+// API and the MCP browse tools. Cursors are opaque to clients; they encode
+// the offset of the next item in a listing.
+package pagination
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+)
+
+// Window returns limit items of a fully loaded listing starting at offset.
+func Window[T any](items []T, offset, limit int) []T {
+	start := min(offset, len(items))
+	end := min(start+limit, len(items))
+	return items[start:end]
+}
+
+// NextCursor returns the cursor of the page following one that started at
+// offset and consumed n of limit items of a listing with total items, or ""
+// when the listing is exhausted.
+func NextCursor(offset, limit, n, total int) string {
+	if n < limit || offset+n >= total {
+		return ""
+	}
+	return EncodeCursor(offset + n)
+}
+
+// EncodeCursor returns the opaque cursor for a listing offset.
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+// DecodeCursor returns the listing offset stored in a cursor.
+func DecodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(data) < 3 || string(data[:2]) != "o:" {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(data[2:]))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return offset, nil
+}
+
+// FetchRows fetches limit rows of an Airable container starting at offset.
+// The API caps each response at roughly 30 rows, so the window is requested
+// in batches; each batch goes through the client's RowsCache. RowsCount of
+// the result holds the size of the whole container.
+func FetchRows(airable *kefw2.AirableClient, path string, offset, limit int) (*kefw2.RowsResponse, error) {
+	// Always ask for at least one row so the container size is known even
+	// when the window is already filled by local items
+	end := offset + max(limit, 1)
+	page := &kefw2.RowsResponse{}
+
+	for from := offset; from < end; {
+		resp, err := airable.GetRows(path, from, end)
+		if err != nil {
+			return nil, err
+		}
+
+		// Cached responses are shared, so copy rather than modify them
+		page.RowsCount = resp.RowsCount
+		page.RowsVersion = resp.RowsVersion
+		page.Roles = resp.Roles
+		page.Rows = append(page.Rows, resp.Rows...)
+
+		from += len(resp.Rows)
+		if len(resp.Rows) == 0 || from >= resp.RowsCount {
+			break
+		}
+	}
+
+	if len(page.Rows) > limit {
+		page.Rows = page.Rows[:max(limit, 0)]
+	}
+	return page, nil
+}
+
+// CategoryPath returns the container path of a radio or podcast category
+// such as "popular", so the category can be fetched a page at a time with
+// FetchRows instead of loading it whole. The service's base URL is
+// discovered through its menu the first time.
+func CategoryPath(airable *kefw2.AirableClient, service kefw2.AirableServiceType, category string) (string, error) {
+	baseURL := func() string {
+		if service == kefw2.ServicePodcast {
+			return airable.PodcastBaseURL
+		}
+		return airable.RadioBaseURL
+	}
+
+	if !strings.HasPrefix(baseURL(), "airable:https://") {
+		menu := airable.GetRadioMenu
+		if service == kefw2.ServicePodcast {
+			menu = airable.GetPodcastMenu
+		}
+		if _, err := menu(); err != nil {
+			return "", err
+		}
+	}
+
+	// The base URL may point into the service, e.g.
+	// "airable:https://8448239770.airable.io/airable/radios"
+	servicePath := "/airable/" + string(service)
+	base := baseURL()
+	if base == "" {
+		return "", fmt.Errorf("could not discover the %s base URL", service)
+	}
+	if i := strings.Index(base, servicePath); i >= 0 {
+		base = base[:i]
+	}
+	return base + servicePath + "/" + category, nil
+}
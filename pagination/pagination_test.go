@@ -0,0 +1,131 @@
+package pagination
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 30, 12345} {
+		cursor := EncodeCursor(offset)
+		got, err := DecodeCursor(cursor)
+		if err != nil {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)): %v", offset, err)
+			continue
+		}
+		if got != offset {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)) = %d", offset, got)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "%%%"},
+		{"raw offset", "MTA"},      // "10"
+		{"wrong prefix", "eDox"},   // "x:1"
+		{"no offset", "bzo"},       // "o:"
+		{"negative", "bzotMQ"},     // "o:-1"
+		{"not a number", "bzphYg"}, // "o:ab"
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if offset, err := DecodeCursor(tt.cursor); err == nil {
+				t.Errorf("DecodeCursor(%q) = %d, want an error", tt.cursor, offset)
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	items := []int{0, 1, 2, 3, 4, 5, 6}
+	tests := []struct {
+		offset, limit int
+		want          []int
+	}{
+		{0, 3, []int{0, 1, 2}},
+		{3, 3, []int{3, 4, 5}},
+		{6, 3, []int{6}},
+		{7, 3, []int{}},
+		{20, 3, []int{}},
+		{0, 0, []int{}},
+		{2, 100, []int{2, 3, 4, 5, 6}},
+	}
+
+	for _, tt := range tests {
+		if got := Window(items, tt.offset, tt.limit); !slices.Equal(got, tt.want) {
+			t.Errorf("Window(%d, %d) = %v, want %v", tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	tests := []struct {
+		name                    string
+		offset, limit, n, total int
+		wantOffset              int // -1 for no next page
+	}{
+		{"first page", 0, 10, 10, 25, 10},
+		{"middle page", 10, 10, 10, 25, 20},
+		{"last partial page", 20, 10, 5, 25, -1},
+		{"last full page", 15, 10, 10, 25, -1},
+		{"short page before total", 0, 10, 8, 25, -1},
+		{"empty listing", 0, 10, 0, 0, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := NextCursor(tt.offset, tt.limit, tt.n, tt.total)
+			if tt.wantOffset < 0 {
+				if cursor != "" {
+					t.Errorf("cursor = %q, want none", cursor)
+				}
+				return
+			}
+			got, err := DecodeCursor(cursor)
+			if err != nil || got != tt.wantOffset {
+				t.Errorf("cursor = %q (offset %d, %v), want offset %d", cursor, got, err, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestCategoryPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  kefw2.AirableServiceType
+		baseURL  string
+		category string
+		want     string
+	}{
+		{"radio", kefw2.ServiceRadio, "airable:https://8448239770.airable.io/airable/radios", "popular",
+			"airable:https://8448239770.airable.io/airable/radios/popular"},
+		{"radio host only", kefw2.ServiceRadio, "airable:https://8448239770.airable.io", "trending",
+			"airable:https://8448239770.airable.io/airable/radios/trending"},
+		{"podcast", kefw2.ServicePodcast, "airable:https://8448239770.airable.io/airable/feeds", "popular",
+			"airable:https://8448239770.airable.io/airable/feeds/popular"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			airable := kefw2.NewAirableClient(&kefw2.KEFSpeaker{})
+			airable.RadioBaseURL = tt.baseURL
+			airable.PodcastBaseURL = tt.baseURL
+
+			got, err := CategoryPath(airable, tt.service, tt.category)
+			if err != nil {
+				t.Fatalf("CategoryPath: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CategoryPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,7 +10,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hilli/go-kef-w2/kefw2"
+
 	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/ids"
 )
 
 // Track represents a single track in a playlist.
@@ -121,7 +124,7 @@ func (m *Manager) Get(id string) (*Playlist, error) {
 
 // Create creates a new playlist.
 func (m *Manager) Create(name string, description string, tracks []Track) (*Playlist, error) {
-	id := generateID(name)
+	id := ids.FromName(name, "playlist")
 
 	// Check if ID already exists, append timestamp if so
 	if _, err := m.Get(id); err == nil {
@@ -246,35 +249,6 @@ func (m *Manager) save(playlist *Playlist) error {
 	return nil
 }
 
-// generateID creates a URL-safe ID from a playlist name.
-func generateID(name string) string {
-	// Convert to lowercase and replace spaces with hyphens
-	id := strings.ToLower(name)
-	id = strings.ReplaceAll(id, " ", "-")
-
-	// Remove non-alphanumeric characters (except hyphens)
-	var result strings.Builder
-	for _, r := range id {
-		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
-			result.WriteRune(r)
-		}
-	}
-
-	id = result.String()
-
-	// Remove consecutive hyphens and trim
-	for strings.Contains(id, "--") {
-		id = strings.ReplaceAll(id, "--", "-")
-	}
-	id = strings.Trim(id, "-")
-
-	if id == "" {
-		id = "playlist"
-	}
-
-	return id
-}
-
 // TrackCount returns the number of tracks in a playlist without loading them all.
 func (m *Manager) TrackCount(id string) (int, error) {
 	playlist, err := m.Get(id)
@@ -283,3 +257,72 @@ func (m *Manager) TrackCount(id string) (int, error) {
 	}
 	return len(playlist.Tracks), nil
 }
+
+// ContentItems converts playlist tracks to the ContentItems the speaker's
+// queue accepts, skipping containers and tracks without a URI or path. UPnP
+// tracks saved by path only are resolved through airable to get their
+// stream URL. It returns the items and the number of tracks skipped.
+func ContentItems(airable *kefw2.AirableClient, tracks []Track) ([]kefw2.ContentItem, int) {
+	items := make([]kefw2.ContentItem, 0, len(tracks))
+	skipped := 0
+	for _, track := range tracks {
+		// Containers (albums, folders) can't be played as individual tracks
+		if track.Type == "container" || (track.URI == "" && track.Path == "") {
+			skipped++
+			continue
+		}
+
+		// Resolve tracks that have a browsable path but no stream URI
+		if track.URI == "" {
+			resp, err := airable.GetRows(track.Path, 0, 1)
+			if err == nil {
+				switch {
+				case resp.Roles != nil:
+					items = append(items, *resp.Roles)
+					continue
+				case len(resp.Rows) > 0:
+					items = append(items, resp.Rows[0])
+					continue
+				}
+			}
+			skipped++
+			continue
+		}
+
+		// Default to UPnP for local media
+		serviceID := track.ServiceID
+		if serviceID == "" {
+			serviceID = "UPnP"
+		}
+
+		// Queue-internal paths like "playlists:item/N" are ephemeral and
+		// can't be resolved by the speaker; it plays from the URI instead
+		path := track.Path
+		if strings.HasPrefix(path, "playlists:item/") || path == "" {
+			path = track.URI
+		}
+
+		items = append(items, kefw2.ContentItem{
+			Title: track.Title,
+			ID:    track.ID,
+			Path:  path,
+			Icon:  track.Icon,
+			Type:  track.Type,
+			MediaData: &kefw2.MediaData{
+				MetaData: kefw2.MediaMetaData{
+					Artist:    track.Artist,
+					Album:     track.Album,
+					ServiceID: serviceID,
+				},
+				Resources: []kefw2.MediaResource{
+					{
+						URI:      track.URI,
+						MimeType: track.MimeType,
+						Duration: track.Duration,
+					},
+				},
+			},
+		})
+	}
+	return items, skipped
+}
@@ -0,0 +1,692 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// actionFunc implements a UPnP action. It receives the request arguments
+// and returns the output arguments in SCPD order.
+type actionFunc func(ctx context.Context, args map[string]string) ([]arg, *upnpError)
+
+// actions returns the action implementations of svc.
+func (r *Renderer) actions(svc *service) map[string]actionFunc {
+	switch svc {
+	case &avTransportService:
+		return map[string]actionFunc{
+			"SetAVTransportURI":          r.setAVTransportURI,
+			"SetNextAVTransportURI":      r.setNextAVTransportURI,
+			"GetMediaInfo":               r.getMediaInfo,
+			"GetTransportInfo":           r.getTransportInfo,
+			"GetPositionInfo":            r.getPositionInfo,
+			"GetDeviceCapabilities":      r.getDeviceCapabilities,
+			"GetTransportSettings":       r.getTransportSettings,
+			"Stop":                       r.stop,
+			"Play":                       r.play,
+			"Pause":                      r.pause,
+			"Seek":                       r.seek,
+			"Next":                       r.next,
+			"Previous":                   r.previous,
+			"GetCurrentTransportActions": r.getCurrentTransportActions,
+		}
+	case &renderingControlService:
+		return map[string]actionFunc{
+			"ListPresets":  r.listPresets,
+			"SelectPreset": r.selectPreset,
+			"GetMute":      r.getMute,
+			"SetMute":      r.setMute,
+			"GetVolume":    r.getVolume,
+			"SetVolume":    r.setVolume,
+		}
+	case &connectionManagerService:
+		return map[string]actionFunc{
+			"GetProtocolInfo":          r.getProtocolInfo,
+			"GetCurrentConnectionIDs":  r.getCurrentConnectionIDs,
+			"GetCurrentConnectionInfo": r.getCurrentConnectionInfo,
+		}
+	}
+	return nil
+}
+
+// handleControl dispatches a SOAP action request.
+func (r *Renderer) handleControl(w http.ResponseWriter, req *http.Request, svc *service) {
+	name, args, err := parseSOAPAction(req, svc.typ)
+	if err != nil {
+		writeSOAPFault(w, newError(errInvalidAction, "%s", err.Error()))
+		return
+	}
+
+	fn, ok := r.actions(svc)[name]
+	if !ok {
+		writeSOAPFault(w, newError(errInvalidAction, "Invalid Action"))
+		return
+	}
+	if id, ok := args["InstanceID"]; ok && strings.TrimSpace(id) != "0" {
+		writeSOAPFault(w, newError(errInvalidInstanceID, "Invalid InstanceID"))
+		return
+	}
+
+	out, upnpErr := fn(req.Context(), args)
+	if upnpErr != nil {
+		log.Printf("UPnP renderer: %s failed: %s", name, upnpErr.Description)
+		writeSOAPFault(w, upnpErr)
+		return
+	}
+
+	writeSOAPResponse(w, svc.typ, name, out)
+}
+
+// playTitle is the title the speaker shows (and reports back) for uri.
+func playTitle(uri string, meta Metadata) string {
+	if meta.Title != "" {
+		return meta.Title
+	}
+	return uri
+}
+
+// contentItem builds the item the speaker plays for uri.
+func contentItem(uri string, meta Metadata) kefw2.ContentItem {
+	item := stations.StreamItem(uri, meta.Title, meta.Artist, meta.Icon, meta.MimeType)
+	item.MediaData.MetaData.Album = meta.Album
+	item.MediaData.MetaData.Live = meta.Live
+	item.MediaData.Resources[0].Duration = int(meta.Duration / time.Millisecond)
+	return item
+}
+
+// checkMimeType rejects formats the speaker cannot play, such as video.
+func checkMimeType(meta Metadata) *upnpError {
+	if meta.MimeType == "" {
+		return nil
+	}
+	for _, p := range sinkProtocols {
+		if strings.Split(p, ":")[2] == meta.MimeType {
+			return nil
+		}
+	}
+	if strings.HasPrefix(meta.MimeType, "audio/") {
+		return nil
+	}
+	return newError(errIllegalMIMEType, "Illegal MIME-type %s", meta.MimeType)
+}
+
+// didlItem is the DIDL-Lite item built for tracks without control point
+// metadata.
+type didlItem struct {
+	XMLName xml.Name `xml:"item"`
+	ID      string   `xml:"id,attr"`
+	Parent  string   `xml:"parentID,attr"`
+	Rest    string   `xml:"restricted,attr"`
+	Title   string   `xml:"dc:title"`
+	Creator string   `xml:"dc:creator,omitempty"`
+	Artist  string   `xml:"upnp:artist,omitempty"`
+	Album   string   `xml:"upnp:album,omitempty"`
+	Art     string   `xml:"upnp:albumArtURI,omitempty"`
+	Class   string   `xml:"upnp:class"`
+	Res     *didlRes `xml:"res,omitempty"`
+}
+
+type didlRes struct {
+	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Duration     string `xml:"duration,attr,omitempty"`
+	URL          string `xml:",chardata"`
+}
+
+// buildDIDL builds a DIDL-Lite document for a track.
+func buildDIDL(uri string, meta Metadata) string {
+	item := didlItem{
+		ID:      "0",
+		Parent:  "-1",
+		Rest:    "1",
+		Title:   playTitle(uri, meta),
+		Creator: meta.Artist,
+		Artist:  meta.Artist,
+		Album:   meta.Album,
+		Art:     meta.Icon,
+		Class:   "object.item.audioItem.musicTrack",
+	}
+	if meta.Live {
+		item.Class = "object.item.audioItem.audioBroadcast"
+	}
+	if uri != "" {
+		mimeType := meta.MimeType
+		if mimeType == "" {
+			mimeType = stations.GuessMimeType(uri)
+		}
+		item.Res = &didlRes{ProtocolInfo: "http-get:*:" + mimeType + ":*", URL: uri}
+		if meta.Duration > 0 {
+			item.Res.Duration = formatDuration(meta.Duration)
+		}
+	}
+
+	data, err := xml.Marshal(item)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	buf.Write(data)
+	buf.WriteString(`</DIDL-Lite>`)
+	return buf.String()
+}
+
+// startPlayback switches the speaker to WiFi if needed and plays uri.
+func (r *Renderer) startPlayback(ctx context.Context, spk *kefw2.KEFSpeaker, uri string, meta Metadata) *upnpError {
+	source, err := spk.Source(ctx)
+	if err != nil {
+		return newError(errActionFailed, "Failed to get source: %v", err)
+	}
+	if source != kefw2.SourceWiFi {
+		if source == kefw2.SourceStandby {
+			r.opts.Manager.NotifyWake()
+		}
+		if err := spk.SetSource(ctx, kefw2.SourceWiFi); err != nil {
+			return newError(errActionFailed, "Failed to switch to WiFi: %v", err)
+		}
+		if err := waitForWiFi(ctx, spk); err != nil {
+			return newError(errActionFailed, "%s", err.Error())
+		}
+	}
+
+	if err := kefw2.NewAirableClient(spk).PlayUPnPTracks([]kefw2.ContentItem{contentItem(uri, meta)}); err != nil {
+		return newError(errActionFailed, "Failed to play: %v", err)
+	}
+
+	r.mu.Lock()
+	r.state.loaded = true
+	r.state.nextQueued = false
+	r.state.transport = "TRANSITIONING"
+	r.state.positionMS = 0
+	r.mu.Unlock()
+	r.subs.notify(r, &avTransportService)
+	return nil
+}
+
+// waitForWiFi polls the speaker until it reports the WiFi source, giving a
+// speaker that was in standby time to come up.
+func waitForWiFi(ctx context.Context, spk *kefw2.KEFSpeaker) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if s, err := spk.Source(ctx); err == nil && s == kefw2.SourceWiFi {
+			// Give the player subsystem a moment to initialize
+			time.Sleep(1 * time.Second)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("speaker did not switch to WiFi within 10s")
+}
+
+// AVTransport actions
+
+func (r *Renderer) setAVTransportURI(ctx context.Context, args map[string]string) ([]arg, *upnpError) {
+	uri := strings.TrimSpace(args["CurrentURI"])
+	metadata := args["CurrentURIMetaData"]
+	meta := parseDIDL(metadata, uri)
+
+	if uri != "" {
+		if err := stations.ValidateURL(uri); err != nil {
+			return nil, newError(errResourceNotFound, "%s", err.Error())
+		}
+		if upnpErr := checkMimeType(meta); upnpErr != nil {
+			return nil, upnpErr
+		}
+	}
+
+	r.mu.Lock()
+	wasPlaying := r.state.loaded && r.state.transport == "PLAYING"
+	r.state.uri, r.state.uriMetadata, r.state.meta = uri, metadata, meta
+	r.state.nextURI, r.state.nextURIMetadata, r.state.nextMeta = "", "", Metadata{}
+	r.state.loaded = false
+	r.state.nextQueued = false
+	r.mu.Unlock()
+
+	// Switching tracks while playing starts the new one right away, as
+	// control points expect from a renderer that is already playing
+	if wasPlaying && uri != "" {
+		spk, upnpErr := r.speakerOrFault()
+		if upnpErr != nil {
+			return nil, upnpErr
+		}
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+		if upnpErr := r.startPlayback(ctx, spk, uri, meta); upnpErr != nil {
+			return nil, upnpErr
+		}
+		return nil, nil
+	}
+
+	r.subs.notify(r, &avTransportService)
+	return nil, nil
+}
+
+func (r *Renderer) setNextAVTransportURI(_ context.Context, args map[string]string) ([]arg, *upnpError) {
+	uri := strings.TrimSpace(args["NextURI"])
+	metadata := args["NextURIMetaData"]
+	meta := parseDIDL(metadata, uri)
+
+	if uri != "" {
+		if err := stations.ValidateURL(uri); err != nil {
+			return nil, newError(errResourceNotFound, "%s", err.Error())
+		}
+		if upnpErr := checkMimeType(meta); upnpErr != nil {
+			return nil, upnpErr
+		}
+	}
+
+	r.mu.Lock()
+	r.state.nextURI, r.state.nextURIMetadata, r.state.nextMeta = uri, metadata, meta
+	r.state.nextQueued = false
+	loaded := r.state.loaded
+	r.mu.Unlock()
+
+	// Queue behind the current track so the speaker continues gaplessly
+	if loaded && uri != "" {
+		spk, upnpErr := r.speakerOrFault()
+		if upnpErr != nil {
+			return nil, upnpErr
+		}
+		if err := kefw2.NewAirableClient(spk).AddToQueue([]kefw2.ContentItem{contentItem(uri, meta)}, false); err != nil {
+			return nil, newError(errActionFailed, "Failed to queue next track: %v", err)
+		}
+		r.mu.Lock()
+		r.state.nextQueued = r.state.nextURI == uri
+		r.mu.Unlock()
+	}
+
+	r.subs.notify(r, &avTransportService)
+	return nil, nil
+}
+
+func (r *Renderer) getMediaInfo(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &r.state
+	tracks, medium := "0", "NONE"
+	if s.uri != "" {
+		tracks, medium = "1", "NETWORK"
+	}
+	_, _, duration := r.currentTrack()
+
+	return []arg{
+		{"NrTracks", tracks},
+		{"MediaDuration", formatDuration(duration)},
+		{"CurrentURI", s.uri},
+		{"CurrentURIMetaData", s.uriMetadata},
+		{"NextURI", s.nextURI},
+		{"NextURIMetaData", s.nextURIMetadata},
+		{"PlayMedium", medium},
+		{"RecordMedium", "NOT_IMPLEMENTED"},
+		{"WriteStatus", "NOT_IMPLEMENTED"},
+	}, nil
+}
+
+func (r *Renderer) getTransportInfo(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return []arg{
+		{"CurrentTransportState", r.transportState()},
+		{"CurrentTransportStatus", "OK"},
+		{"CurrentSpeed", "1"},
+	}, nil
+}
+
+func (r *Renderer) getPositionInfo(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	uri, metadata, duration := r.currentTrack()
+	track := "0"
+	if uri != "" || metadata != "" {
+		track = "1"
+	}
+	position := formatDuration(time.Duration(r.state.positionMS) * time.Millisecond)
+
+	return []arg{
+		{"Track", track},
+		{"TrackDuration", formatDuration(duration)},
+		{"TrackMetaData", metadata},
+		{"TrackURI", uri},
+		{"RelTime", position},
+		{"AbsTime", position},
+		{"RelCount", "2147483647"},
+		{"AbsCount", "2147483647"},
+	}, nil
+}
+
+func (r *Renderer) getDeviceCapabilities(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	return []arg{
+		{"PlayMedia", "NETWORK"},
+		{"RecMedia", "NOT_IMPLEMENTED"},
+		{"RecQualityModes", "NOT_IMPLEMENTED"},
+	}, nil
+}
+
+func (r *Renderer) getTransportSettings(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	return []arg{
+		{"PlayMode", "NORMAL"},
+		{"RecQualityMode", "NOT_IMPLEMENTED"},
+	}, nil
+}
+
+func (r *Renderer) getCurrentTransportActions(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return []arg{{"Actions", r.transportActions()}}, nil
+}
+
+func (r *Renderer) stop(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	r.mu.Lock()
+	loaded := r.state.loaded
+	r.mu.Unlock()
+
+	// Only stop the speaker when it is playing our URI; stopping is a no-op
+	// for a renderer that has nothing loaded
+	if loaded {
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+		if err := spk.Stop(ctx); err != nil {
+			return nil, newError(errActionFailed, "Failed to stop: %v", err)
+		}
+	}
+
+	r.mu.Lock()
+	r.state.loaded = false
+	r.state.nextQueued = false
+	r.state.transport = "STOPPED"
+	r.state.positionMS = 0
+	r.mu.Unlock()
+	r.subs.notify(r, &avTransportService)
+	return nil, nil
+}
+
+func (r *Renderer) play(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	r.mu.Lock()
+	uri, meta := r.state.uri, r.state.meta
+	loaded, transport := r.state.loaded, r.state.transport
+	r.mu.Unlock()
+
+	if uri == "" {
+		return nil, newError(errTransitionNotAvail, "No media present")
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	switch {
+	case !loaded:
+		if upnpErr := r.startPlayback(ctx, spk, uri, meta); upnpErr != nil {
+			return nil, upnpErr
+		}
+	case transport == "PAUSED_PLAYBACK":
+		if err := spk.PlayPause(ctx); err != nil {
+			return nil, newError(errActionFailed, "Failed to resume: %v", err)
+		}
+	}
+	return nil, nil
+}
+
+func (r *Renderer) pause(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	r.mu.Lock()
+	transport := r.state.transport
+	r.mu.Unlock()
+
+	switch transport {
+	case "PAUSED_PLAYBACK":
+		return nil, nil
+	case "PLAYING", "TRANSITIONING":
+	default:
+		return nil, newError(errTransitionNotAvail, "Transition not available")
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	if err := spk.PlayPause(ctx); err != nil {
+		return nil, newError(errActionFailed, "Failed to pause: %v", err)
+	}
+	return nil, nil
+}
+
+func (r *Renderer) seek(ctx context.Context, args map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	switch args["Unit"] {
+	case "REL_TIME", "ABS_TIME":
+	default:
+		return nil, newError(errSeekModeUnsupported, "Seek mode %q not supported", args["Unit"])
+	}
+	target, err := parseDuration(args["Target"])
+	if err != nil {
+		return nil, newError(errInvalidArgs, "%s", err.Error())
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	if err := spk.SeekTo(ctx, target.Milliseconds()); err != nil {
+		return nil, newError(errActionFailed, "Failed to seek: %v", err)
+	}
+
+	r.mu.Lock()
+	r.state.positionMS = target.Milliseconds()
+	r.mu.Unlock()
+	return nil, nil
+}
+
+func (r *Renderer) next(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// A next URI that is not on the speaker's queue yet is played directly
+	r.mu.Lock()
+	s := &r.state
+	promote := s.nextURI != "" && !s.nextQueued
+	uri, meta := s.nextURI, s.nextMeta
+	if promote {
+		s.uri, s.uriMetadata, s.meta = s.nextURI, s.nextURIMetadata, s.nextMeta
+		s.nextURI, s.nextURIMetadata, s.nextMeta = "", "", Metadata{}
+	}
+	r.mu.Unlock()
+
+	if promote {
+		return nil, r.startPlayback(ctx, spk, uri, meta)
+	}
+	if err := spk.NextTrack(ctx); err != nil {
+		return nil, newError(errActionFailed, "Failed to skip: %v", err)
+	}
+	return nil, nil
+}
+
+func (r *Renderer) previous(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	if err := spk.PreviousTrack(ctx); err != nil {
+		return nil, newError(errActionFailed, "Failed to go back: %v", err)
+	}
+	return nil, nil
+}
+
+// RenderingControl actions
+
+func (r *Renderer) listPresets(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	return []arg{{"CurrentPresetNameList", "FactoryDefaults"}}, nil
+}
+
+func (r *Renderer) selectPreset(_ context.Context, args map[string]string) ([]arg, *upnpError) {
+	if args["PresetName"] != "FactoryDefaults" {
+		return nil, newError(errInvalidArgs, "Invalid preset %q", args["PresetName"])
+	}
+	return nil, nil
+}
+
+func (r *Renderer) getVolume(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	r.mu.Lock()
+	volume, ok := r.state.volume, r.state.haveVolume
+	r.mu.Unlock()
+
+	if !ok {
+		spk, upnpErr := r.speakerOrFault()
+		if upnpErr != nil {
+			return nil, upnpErr
+		}
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+		v, err := spk.GetVolume(ctx)
+		if err != nil {
+			return nil, newError(errActionFailed, "Failed to get volume: %v", err)
+		}
+		volume = v
+	}
+
+	return []arg{{"CurrentVolume", strconv.Itoa(volume)}}, nil
+}
+
+func (r *Renderer) setVolume(ctx context.Context, args map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	volume, err := strconv.Atoi(strings.TrimSpace(args["DesiredVolume"]))
+	if err != nil || volume < 0 || volume > 100 {
+		return nil, newError(errInvalidArgs, "Volume must be 0-100")
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	if _, err := r.opts.Manager.SetVolume(ctx, spk, volume, speaker.OriginUPnP); err != nil {
+		return nil, newError(errActionFailed, "Failed to set volume: %v", err)
+	}
+	return nil, nil
+}
+
+func (r *Renderer) getMute(ctx context.Context, _ map[string]string) ([]arg, *upnpError) {
+	r.mu.Lock()
+	muted, ok := r.state.muted, r.state.haveMute
+	r.mu.Unlock()
+
+	if !ok {
+		spk, upnpErr := r.speakerOrFault()
+		if upnpErr != nil {
+			return nil, upnpErr
+		}
+		ctx, cancel := withTimeout(ctx)
+		defer cancel()
+		m, err := spk.IsMuted(ctx)
+		if err != nil {
+			return nil, newError(errActionFailed, "Failed to get mute state: %v", err)
+		}
+		muted = m
+	}
+
+	return []arg{{"CurrentMute", boolString(muted)}}, nil
+}
+
+func (r *Renderer) setMute(ctx context.Context, args map[string]string) ([]arg, *upnpError) {
+	spk, upnpErr := r.speakerOrFault()
+	if upnpErr != nil {
+		return nil, upnpErr
+	}
+
+	var mute bool
+	switch strings.ToLower(strings.TrimSpace(args["DesiredMute"])) {
+	case "1", "true", "yes":
+		mute = true
+	case "0", "false", "no":
+	default:
+		return nil, newError(errInvalidArgs, "Invalid DesiredMute")
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var err error
+	if mute {
+		err = spk.Mute(ctx)
+	} else {
+		err = spk.Unmute(ctx)
+	}
+	if err != nil {
+		return nil, newError(errActionFailed, "Failed to set mute: %v", err)
+	}
+	return nil, nil
+}
+
+// boolString formats a UPnP boolean.
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// ConnectionManager actions
+
+func (r *Renderer) getProtocolInfo(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	return []arg{
+		{"Source", ""},
+		{"Sink", sinkProtocolInfo},
+	}, nil
+}
+
+func (r *Renderer) getCurrentConnectionIDs(_ context.Context, _ map[string]string) ([]arg, *upnpError) {
+	return []arg{{"ConnectionIDs", "0"}}, nil
+}
+
+func (r *Renderer) getCurrentConnectionInfo(_ context.Context, args map[string]string) ([]arg, *upnpError) {
+	if strings.TrimSpace(args["ConnectionID"]) != "0" {
+		return nil, newError(errInvalidArgs, "Invalid ConnectionID")
+	}
+	return []arg{
+		{"RcsID", "0"},
+		{"AVTransportID", "0"},
+		{"ProtocolInfo", ""},
+		{"PeerConnectionManager", ""},
+		{"PeerConnectionID", "-1"},
+		{"Direction", "Input"},
+		{"Status", "OK"},
+	}, nil
+}
@@ -0,0 +1,313 @@
+package renderer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subscription timeouts in seconds.
+const (
+	defaultSubscriptionTimeout = 1800
+	maxSubscriptionTimeout     = 3600
+)
+
+// subscriber is a control point subscribed to a service's events.
+type subscriber struct {
+	sid       string
+	svc       *service
+	callbacks []string
+	expires   time.Time // guarded by subscriptions.mu
+
+	mu   sync.Mutex // serializes NOTIFYs so SEQ arrives in order
+	seq  uint32
+	last string // last propertyset sent, to skip duplicates
+}
+
+// subscriptions tracks GENA event subscriptions.
+type subscriptions struct {
+	mu     sync.Mutex
+	subs   map[string]*subscriber
+	client *http.Client
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		subs:   make(map[string]*subscriber),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// handleEventSub handles SUBSCRIBE (new and renewal) and UNSUBSCRIBE.
+func (r *Renderer) handleEventSub(w http.ResponseWriter, req *http.Request, svc *service) {
+	sid := req.Header.Get("SID")
+	callback := req.Header.Get("CALLBACK")
+	nt := req.Header.Get("NT")
+
+	switch req.Method {
+	case "SUBSCRIBE":
+		if sid != "" && (callback != "" || nt != "") {
+			http.Error(w, "SID cannot be combined with CALLBACK or NT", http.StatusBadRequest)
+			return
+		}
+		timeout := parseTimeout(req.Header.Get("TIMEOUT"))
+
+		var sub *subscriber
+		if sid != "" {
+			if sub = r.subs.renew(sid, svc, timeout); sub == nil {
+				http.Error(w, "Unknown subscription", http.StatusPreconditionFailed)
+				return
+			}
+		} else {
+			callbacks := parseCallbacks(callback)
+			if nt != "upnp:event" || len(callbacks) == 0 {
+				http.Error(w, "Invalid CALLBACK or NT", http.StatusPreconditionFailed)
+				return
+			}
+			sub = r.subs.add(svc, callbacks, timeout)
+		}
+
+		w.Header().Set("SID", sub.sid)
+		w.Header().Set("TIMEOUT", "Second-"+strconv.Itoa(timeout))
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+
+		// The initial event carries the full state
+		if sid == "" {
+			go r.subs.send(r, sub)
+		}
+
+	case "UNSUBSCRIBE":
+		if sid == "" || !r.subs.remove(sid) {
+			http.Error(w, "Unknown subscription", http.StatusPreconditionFailed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseTimeout parses a "Second-N" TIMEOUT header, bounded to
+// maxSubscriptionTimeout.
+func parseTimeout(header string) int {
+	secs, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(header), "Second-"))
+	if err != nil || secs <= 0 {
+		return defaultSubscriptionTimeout
+	}
+	return min(secs, maxSubscriptionTimeout)
+}
+
+// parseCallbacks parses a CALLBACK header of the form "<url1><url2>".
+func parseCallbacks(header string) []string {
+	var urls []string
+	for _, part := range strings.Split(header, "<") {
+		u, _, ok := strings.Cut(part, ">")
+		if ok && strings.HasPrefix(u, "http://") {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// newSID returns a random subscription ID.
+func newSID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (s *subscriptions) add(svc *service, callbacks []string, timeout int) *subscriber {
+	sub := &subscriber{
+		sid:       newSID(),
+		svc:       svc,
+		callbacks: callbacks,
+		expires:   time.Now().Add(time.Duration(timeout) * time.Second),
+	}
+
+	s.mu.Lock()
+	s.subs[sub.sid] = sub
+	s.mu.Unlock()
+	return sub
+}
+
+func (s *subscriptions) renew(sid string, svc *service, timeout int) *subscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[sid]
+	if !ok || sub.svc != svc {
+		return nil
+	}
+	sub.expires = time.Now().Add(time.Duration(timeout) * time.Second)
+	return sub
+}
+
+func (s *subscriptions) remove(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.subs[sid]
+	delete(s.subs, sid)
+	return ok
+}
+
+// notify sends the current state of svc to its subscribers, dropping
+// expired subscriptions.
+func (s *subscriptions) notify(r *Renderer, svc *service) {
+	now := time.Now()
+
+	s.mu.Lock()
+	var targets []*subscriber
+	for sid, sub := range s.subs {
+		if sub.svc != svc {
+			continue
+		}
+		if now.After(sub.expires) {
+			delete(s.subs, sid)
+			continue
+		}
+		targets = append(targets, sub)
+	}
+	s.mu.Unlock()
+
+	for _, sub := range targets {
+		go s.send(r, sub)
+	}
+}
+
+// send delivers one NOTIFY to sub unless the state is unchanged since the
+// last one. The body is built while holding sub.mu so that concurrent
+// notifications are delivered in order with the latest state last.
+func (s *subscriptions) send(r *Renderer, sub *subscriber) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	body := r.propertySet(sub.svc)
+	if body == sub.last {
+		return
+	}
+
+	for _, callback := range sub.callbacks {
+		req, err := http.NewRequest("NOTIFY", callback, strings.NewReader(body))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+		req.Header.Set("NT", "upnp:event")
+		req.Header.Set("NTS", "upnp:propchange")
+		req.Header.Set("SID", sub.sid)
+		req.Header.Set("SEQ", strconv.FormatUint(uint64(sub.seq), 10))
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+
+		sub.last = body
+		// SEQ wraps to 1; 0 is reserved for the initial event
+		sub.seq++
+		if sub.seq == 0 {
+			sub.seq = 1
+		}
+		return
+	}
+
+	log.Printf("UPnP renderer: failed to deliver event to %s", sub.sid)
+}
+
+// propertySet builds the GENA propertyset with the current state of svc.
+func (r *Renderer) propertySet(svc *service) string {
+	var props []arg
+	switch svc {
+	case &avTransportService:
+		props = []arg{{"LastChange", r.avTransportLastChange()}}
+	case &renderingControlService:
+		props = []arg{{"LastChange", r.renderingControlLastChange()}}
+	case &connectionManagerService:
+		props = []arg{
+			{"SourceProtocolInfo", ""},
+			{"SinkProtocolInfo", sinkProtocolInfo},
+			{"CurrentConnectionIDs", "0"},
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	buf.WriteString(`<e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0">`)
+	for _, p := range props {
+		fmt.Fprintf(&buf, "<e:property><%s>", p.Name)
+		_ = xml.EscapeText(&buf, []byte(p.Value))
+		fmt.Fprintf(&buf, "</%s></e:property>", p.Name)
+	}
+	buf.WriteString(`</e:propertyset>`)
+	return buf.String()
+}
+
+// lastChange builds a LastChange event document for instance 0. Each entry
+// is a variable name and its attributes.
+func lastChange(namespace string, vars [][]string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<Event xmlns="%s"><InstanceID val="0">`, namespace)
+	for _, v := range vars {
+		buf.WriteString("<" + v[0])
+		for i := 1; i+1 < len(v); i += 2 {
+			fmt.Fprintf(&buf, ` %s="`, v[i])
+			_ = xml.EscapeText(&buf, []byte(v[i+1]))
+			buf.WriteString(`"`)
+		}
+		buf.WriteString("/>")
+	}
+	buf.WriteString(`</InstanceID></Event>`)
+	return buf.String()
+}
+
+func (r *Renderer) avTransportLastChange() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &r.state
+	uri, metadata, duration := r.currentTrack()
+	tracks, medium := "0", "NONE"
+	if s.uri != "" {
+		tracks, medium = "1", "NETWORK"
+	}
+
+	return lastChange("urn:schemas-upnp-org:metadata-1-0/AVT/", [][]string{
+		{"TransportState", "val", r.transportState()},
+		{"TransportStatus", "val", "OK"},
+		{"TransportPlaySpeed", "val", "1"},
+		{"CurrentPlayMode", "val", "NORMAL"},
+		{"PlaybackStorageMedium", "val", medium},
+		{"NumberOfTracks", "val", tracks},
+		{"CurrentTrack", "val", tracks},
+		{"CurrentTrackDuration", "val", formatDuration(duration)},
+		{"CurrentMediaDuration", "val", formatDuration(duration)},
+		{"CurrentTrackURI", "val", uri},
+		{"CurrentTrackMetaData", "val", metadata},
+		{"AVTransportURI", "val", s.uri},
+		{"AVTransportURIMetaData", "val", s.uriMetadata},
+		{"NextAVTransportURI", "val", s.nextURI},
+		{"NextAVTransportURIMetaData", "val", s.nextURIMetadata},
+		{"CurrentTransportActions", "val", r.transportActions()},
+	})
+}
+
+func (r *Renderer) renderingControlLastChange() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return lastChange("urn:schemas-upnp-org:metadata-1-0/RCS/", [][]string{
+		{"Volume", "channel", "Master", "val", strconv.Itoa(r.state.volume)},
+		{"Mute", "channel", "Master", "val", boolString(r.state.muted)},
+		{"PresetNameList", "val", "FactoryDefaults"},
+	})
+}
@@ -0,0 +1,361 @@
+// Package renderer exposes kefw2ui as a UPnP/DLNA MediaRenderer so casting
+// apps (BubbleUPnP, foobar2000, Windows "Cast to Device", ...) can play to the
+// active KEF speaker. It implements the AVTransport, RenderingControl and
+// ConnectionManager services, eventing (GENA) and SSDP advertisement, and
+// translates control actions into calls on the active speaker.
+package renderer
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // only used to derive a stable device UUID
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// BasePath is where the renderer's HTTP endpoints are mounted.
+const BasePath = "/upnp/renderer/"
+
+// Options configures a Renderer.
+type Options struct {
+	Manager *speaker.Manager
+
+	// Port is the HTTP port kefw2ui listens on, used in SSDP LOCATION URLs.
+	Port int
+
+	// PublicURL overrides the detected base URL in SSDP LOCATION URLs.
+	PublicURL string
+
+	// Name is the friendly name shown in casting apps. Defaults to the
+	// active speaker's name.
+	Name string
+}
+
+// Renderer is a UPnP MediaRenderer backed by the active speaker.
+type Renderer struct {
+	opts Options
+	udn  string
+
+	mu    sync.Mutex
+	state state
+
+	subs *subscriptions
+
+	ssdpMu   sync.Mutex
+	ssdpConn *net.UDPConn
+	ssdpStop chan struct{}
+}
+
+// state is the renderer's view of the transport, kept up to date from
+// control actions and the speaker's event stream.
+type state struct {
+	transport string // STOPPED, PLAYING, PAUSED_PLAYBACK, TRANSITIONING
+
+	uri         string   // AVTransportURI set by the control point
+	uriMetadata string   // raw DIDL-Lite for uri
+	meta        Metadata // parsed metadata for uri
+	loaded      bool     // the speaker has been told to play uri
+
+	nextURI         string
+	nextURIMetadata string
+	nextMeta        Metadata
+	nextQueued      bool // next is queued on the speaker
+
+	// What the speaker reports it is playing
+	track      Metadata
+	positionMS int64
+
+	volume     int
+	muted      bool
+	haveVolume bool
+	haveMute   bool
+}
+
+// New creates a renderer. Call HandleEvent for every speaker event, mount the
+// renderer at BasePath and call Start to advertise it.
+func New(opts Options) *Renderer {
+	return &Renderer{
+		opts:  opts,
+		udn:   "uuid:" + deviceUUID(),
+		state: state{transport: "STOPPED"},
+		subs:  newSubscriptions(),
+	}
+}
+
+// deviceUUID derives a UUID from the hostname so the renderer keeps its
+// identity across restarts and control points remember it.
+func deviceUUID() string {
+	host, _ := os.Hostname()
+	sum := sha1.Sum([]byte("kefw2ui-renderer:" + host)) //nolint:gosec // not security sensitive
+	sum[6] = (sum[6] & 0x0f) | 0x50                     // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80                     // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// friendlyName returns the name shown in casting apps.
+func (r *Renderer) friendlyName() string {
+	if r.opts.Name != "" {
+		return r.opts.Name
+	}
+	if spk := r.opts.Manager.GetActiveSpeaker(); spk != nil && spk.Name != "" {
+		return spk.Name + " (kefw2ui)"
+	}
+	return "kefw2ui"
+}
+
+// ServeHTTP serves the device description, service descriptions, control
+// and event subscription endpoints below BasePath.
+func (r *Renderer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, BasePath)
+	if path == "description.xml" {
+		r.handleDescription(w, req)
+		return
+	}
+
+	name, endpoint, ok := strings.Cut(path, "/")
+	svc := serviceByName(name)
+	if !ok || svc == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch endpoint {
+	case "scpd.xml":
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeXML(w, svc.scpd)
+	case "control":
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.handleControl(w, req, svc)
+	case "event":
+		r.handleEventSub(w, req, svc)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// handleDescription serves the root device description.
+func (r *Renderer) handleDescription(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	model := "KEF W2"
+	if spk := r.opts.Manager.GetActiveSpeaker(); spk != nil && spk.Model != "" {
+		model = spk.Model
+	}
+
+	desc := deviceDescription{
+		SpecVersion: specVersion{Major: 1},
+		Device: device{
+			DeviceType:       deviceType,
+			FriendlyName:     r.friendlyName(),
+			Manufacturer:     "kefw2ui",
+			ManufacturerURL:  "https://github.com/hilli/kefw2ui",
+			ModelDescription: "UPnP MediaRenderer for KEF W2 speakers",
+			ModelName:        "kefw2ui",
+			ModelNumber:      model,
+			UDN:              r.udn,
+		},
+	}
+	for _, svc := range services {
+		desc.Device.Services = append(desc.Device.Services, deviceService{
+			ServiceType: svc.typ,
+			ServiceID:   svc.serviceID(),
+			SCPDURL:     BasePath + svc.name + "/scpd.xml",
+			ControlURL:  BasePath + svc.name + "/control",
+			EventSubURL: BasePath + svc.name + "/event",
+		})
+	}
+
+	writeXML(w, desc)
+}
+
+// writeXML writes v as an XML document.
+func writeXML(w http.ResponseWriter, v any) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to encode XML", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+// HandleEvent updates the renderer state from a speaker event and notifies
+// subscribed control points of changes.
+func (r *Renderer) HandleEvent(event speaker.Event) {
+	var changed []*service
+
+	r.mu.Lock()
+	switch e := event.(type) {
+	case speaker.VolumeChanged:
+		r.state.volume = e.Volume
+		r.state.haveVolume = true
+		changed = append(changed, &renderingControlService)
+
+	case speaker.MuteChanged:
+		r.state.muted = e.Muted
+		r.state.haveMute = true
+		changed = append(changed, &renderingControlService)
+
+	case speaker.PlayerChanged:
+		r.state.track = Metadata{
+			Title:    e.Title,
+			Artist:   e.Artist,
+			Album:    e.Album,
+			Icon:     e.Icon,
+			Duration: time.Duration(e.Duration) * time.Millisecond,
+		}
+		r.trackChanged()
+		r.state.transport = transportFromPlayer(e.State)
+		if e.Position != nil {
+			r.state.positionMS = max(*e.Position, 0)
+		}
+		changed = append(changed, &avTransportService)
+
+	case speaker.PositionChanged:
+		r.state.positionMS = max(e.Position, 0)
+
+	case speaker.SourceChanged:
+		if e.Source != kefw2.SourceWiFi {
+			r.state.loaded = false
+			r.state.nextQueued = false
+			r.state.transport = "STOPPED"
+			changed = append(changed, &avTransportService)
+		}
+
+	case speaker.PowerChanged:
+		if e.Status == kefw2.SpeakerStatusStandby {
+			r.state.loaded = false
+			r.state.nextQueued = false
+			r.state.transport = "STOPPED"
+			changed = append(changed, &avTransportService)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, svc := range changed {
+		r.subs.notify(r, svc)
+	}
+}
+
+// trackChanged reconciles the control point's URIs with the track the
+// speaker reports. When the queued next URI starts playing it becomes the
+// current URI; when something else entirely starts playing (another app took
+// over), the current URI is no longer loaded. Must be called with r.mu held.
+func (r *Renderer) trackChanged() {
+	s := &r.state
+	if !s.loaded || s.track.Title == "" || s.track.Title == playTitle(s.uri, s.meta) {
+		return
+	}
+
+	if s.nextQueued && s.track.Title == playTitle(s.nextURI, s.nextMeta) {
+		s.uri, s.uriMetadata, s.meta = s.nextURI, s.nextURIMetadata, s.nextMeta
+		s.nextURI, s.nextURIMetadata, s.nextMeta = "", "", Metadata{}
+		s.nextQueued = false
+		return
+	}
+
+	s.loaded = false
+	s.nextQueued = false
+}
+
+// transportFromPlayer maps a speaker player state to a UPnP transport state.
+func transportFromPlayer(playerState string) string {
+	switch playerState {
+	case kefw2.PlayerStatePlaying:
+		return "PLAYING"
+	case kefw2.PlayerStatePaused:
+		return "PAUSED_PLAYBACK"
+	default:
+		return "STOPPED"
+	}
+}
+
+// transportState returns the TransportState reported to control points.
+// Must be called with r.mu held.
+func (r *Renderer) transportState() string {
+	if r.state.uri == "" && r.state.transport == "STOPPED" {
+		return "NO_MEDIA_PRESENT"
+	}
+	return r.state.transport
+}
+
+// currentTrack returns the metadata of what is playing: the control point's
+// own DIDL-Lite while its URI is loaded, otherwise what the speaker reports.
+// Must be called with r.mu held.
+func (r *Renderer) currentTrack() (uri, metadata string, duration time.Duration) {
+	s := &r.state
+	if s.loaded {
+		duration = s.meta.Duration
+		if s.track.Duration > 0 {
+			duration = s.track.Duration
+		}
+		metadata = s.uriMetadata
+		if metadata == "" {
+			metadata = buildDIDL(s.uri, s.meta)
+		}
+		return s.uri, metadata, duration
+	}
+	if s.track.Title == "" {
+		return s.uri, s.uriMetadata, s.meta.Duration
+	}
+	return "", buildDIDL("", s.track), s.track.Duration
+}
+
+// transportActions returns the CurrentTransportActions value. Must be called
+// with r.mu held.
+func (r *Renderer) transportActions() string {
+	switch r.transportState() {
+	case "PLAYING":
+		return "Pause,Stop,Seek,Next,Previous"
+	case "PAUSED_PLAYBACK":
+		return "Play,Stop,Seek,Next,Previous"
+	case "NO_MEDIA_PRESENT":
+		return ""
+	default:
+		return "Play"
+	}
+}
+
+// Start begins SSDP advertisement. Failing to join the multicast group is
+// returned as an error; the HTTP endpoints keep working without it.
+func (r *Renderer) Start() error {
+	return r.startSSDP()
+}
+
+// Close announces that the renderer is leaving the network and stops SSDP.
+func (r *Renderer) Close() {
+	r.stopSSDP()
+}
+
+// speakerOrFault returns the active speaker or a UPnP fault.
+func (r *Renderer) speakerOrFault() (*kefw2.KEFSpeaker, *upnpError) {
+	spk := r.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		return nil, newError(errActionFailed, "No active speaker")
+	}
+	return spk, nil
+}
+
+// withTimeout bounds speaker calls made on behalf of a control point.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 15*time.Second)
+}
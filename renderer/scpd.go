@@ -0,0 +1,272 @@
+package renderer
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// UPnP type identifiers.
+const (
+	deviceType = "urn:schemas-upnp-org:device:MediaRenderer:1"
+
+	avTransportType       = "urn:schemas-upnp-org:service:AVTransport:1"
+	renderingControlType  = "urn:schemas-upnp-org:service:RenderingControl:1"
+	connectionManagerType = "urn:schemas-upnp-org:service:ConnectionManager:1"
+)
+
+// sinkProtocols lists the formats the KEF speakers can play from a URL.
+var sinkProtocols = []string{
+	"http-get:*:audio/mpeg:*",
+	"http-get:*:audio/mp3:*",
+	"http-get:*:audio/flac:*",
+	"http-get:*:audio/x-flac:*",
+	"http-get:*:audio/wav:*",
+	"http-get:*:audio/x-wav:*",
+	"http-get:*:audio/wave:*",
+	"http-get:*:audio/L16:*",
+	"http-get:*:audio/L24:*",
+	"http-get:*:audio/aac:*",
+	"http-get:*:audio/x-aac:*",
+	"http-get:*:audio/mp4:*",
+	"http-get:*:audio/x-m4a:*",
+	"http-get:*:audio/ogg:*",
+	"http-get:*:audio/x-ogg:*",
+	"http-get:*:audio/aiff:*",
+	"http-get:*:audio/x-aiff:*",
+	"http-get:*:audio/x-ms-wma:*",
+	"http-get:*:application/vnd.apple.mpegurl:*",
+	"http-get:*:audio/x-mpegurl:*",
+}
+
+// sinkProtocolInfo is the SinkProtocolInfo state variable.
+var sinkProtocolInfo = strings.Join(sinkProtocols, ",")
+
+// service describes one UPnP service of the renderer.
+type service struct {
+	name string // short name used in URLs, e.g. "AVTransport"
+	typ  string
+	scpd scpd
+}
+
+// serviceID returns the UPnP service ID.
+func (s *service) serviceID() string {
+	return "urn:upnp-org:serviceId:" + s.name
+}
+
+// scpd is a UPnP service description document.
+type scpd struct {
+	XMLName        xml.Name        `xml:"urn:schemas-upnp-org:service-1-0 scpd"`
+	SpecVersion    specVersion     `xml:"specVersion"`
+	Actions        []scpdAction    `xml:"actionList>action"`
+	StateVariables []stateVariable `xml:"serviceStateTable>stateVariable"`
+}
+
+type specVersion struct {
+	Major int `xml:"major"`
+	Minor int `xml:"minor"`
+}
+
+type scpdAction struct {
+	Name      string         `xml:"name"`
+	Arguments []scpdArgument `xml:"argumentList>argument,omitempty"`
+}
+
+type scpdArgument struct {
+	Name     string `xml:"name"`
+	Dir      string `xml:"direction"`
+	Variable string `xml:"relatedStateVariable"`
+}
+
+type stateVariable struct {
+	SendEvents    string      `xml:"sendEvents,attr"`
+	Name          string      `xml:"name"`
+	DataType      string      `xml:"dataType"`
+	AllowedValues []string    `xml:"allowedValueList>allowedValue,omitempty"`
+	Range         *valueRange `xml:"allowedValueRange,omitempty"`
+}
+
+type valueRange struct {
+	Minimum int `xml:"minimum"`
+	Maximum int `xml:"maximum"`
+	Step    int `xml:"step"`
+}
+
+// action builds an SCPD action from "in:Name:Variable" / "out:Name:Variable"
+// argument specs.
+func action(name string, args ...string) scpdAction {
+	a := scpdAction{Name: name}
+	for _, spec := range args {
+		parts := strings.SplitN(spec, ":", 3)
+		a.Arguments = append(a.Arguments, scpdArgument{Name: parts[1], Dir: parts[0], Variable: parts[2]})
+	}
+	return a
+}
+
+// variable builds an SCPD state variable that is not evented.
+func variable(name, dataType string, allowed ...string) stateVariable {
+	return stateVariable{SendEvents: "no", Name: name, DataType: dataType, AllowedValues: allowed}
+}
+
+var avTransportService = service{
+	name: "AVTransport",
+	typ:  avTransportType,
+	scpd: scpd{
+		SpecVersion: specVersion{Major: 1},
+		Actions: []scpdAction{
+			action("SetAVTransportURI", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:CurrentURI:AVTransportURI", "in:CurrentURIMetaData:AVTransportURIMetaData"),
+			action("SetNextAVTransportURI", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:NextURI:NextAVTransportURI", "in:NextURIMetaData:NextAVTransportURIMetaData"),
+			action("GetMediaInfo", "in:InstanceID:A_ARG_TYPE_InstanceID",
+				"out:NrTracks:NumberOfTracks", "out:MediaDuration:CurrentMediaDuration",
+				"out:CurrentURI:AVTransportURI", "out:CurrentURIMetaData:AVTransportURIMetaData",
+				"out:NextURI:NextAVTransportURI", "out:NextURIMetaData:NextAVTransportURIMetaData",
+				"out:PlayMedium:PlaybackStorageMedium", "out:RecordMedium:RecordStorageMedium",
+				"out:WriteStatus:RecordMediumWriteStatus"),
+			action("GetTransportInfo", "in:InstanceID:A_ARG_TYPE_InstanceID",
+				"out:CurrentTransportState:TransportState", "out:CurrentTransportStatus:TransportStatus",
+				"out:CurrentSpeed:TransportPlaySpeed"),
+			action("GetPositionInfo", "in:InstanceID:A_ARG_TYPE_InstanceID",
+				"out:Track:CurrentTrack", "out:TrackDuration:CurrentTrackDuration",
+				"out:TrackMetaData:CurrentTrackMetaData", "out:TrackURI:CurrentTrackURI",
+				"out:RelTime:RelativeTimePosition", "out:AbsTime:AbsoluteTimePosition",
+				"out:RelCount:RelativeCounterPosition", "out:AbsCount:AbsoluteCounterPosition"),
+			action("GetDeviceCapabilities", "in:InstanceID:A_ARG_TYPE_InstanceID",
+				"out:PlayMedia:PossiblePlaybackStorageMedia", "out:RecMedia:PossibleRecordStorageMedia",
+				"out:RecQualityModes:PossibleRecordQualityModes"),
+			action("GetTransportSettings", "in:InstanceID:A_ARG_TYPE_InstanceID",
+				"out:PlayMode:CurrentPlayMode", "out:RecQualityMode:CurrentRecordQualityMode"),
+			action("Stop", "in:InstanceID:A_ARG_TYPE_InstanceID"),
+			action("Play", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:Speed:TransportPlaySpeed"),
+			action("Pause", "in:InstanceID:A_ARG_TYPE_InstanceID"),
+			action("Seek", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:Unit:A_ARG_TYPE_SeekMode", "in:Target:A_ARG_TYPE_SeekTarget"),
+			action("Next", "in:InstanceID:A_ARG_TYPE_InstanceID"),
+			action("Previous", "in:InstanceID:A_ARG_TYPE_InstanceID"),
+			action("GetCurrentTransportActions", "in:InstanceID:A_ARG_TYPE_InstanceID", "out:Actions:CurrentTransportActions"),
+		},
+		StateVariables: []stateVariable{
+			variable("TransportState", "string", "STOPPED", "PLAYING", "PAUSED_PLAYBACK", "TRANSITIONING", "NO_MEDIA_PRESENT"),
+			variable("TransportStatus", "string", "OK", "ERROR_OCCURRED"),
+			variable("PlaybackStorageMedium", "string", "NETWORK", "NONE"),
+			variable("RecordStorageMedium", "string", "NOT_IMPLEMENTED"),
+			variable("PossiblePlaybackStorageMedia", "string"),
+			variable("PossibleRecordStorageMedia", "string"),
+			variable("CurrentPlayMode", "string", "NORMAL"),
+			variable("TransportPlaySpeed", "string", "1"),
+			variable("RecordMediumWriteStatus", "string", "NOT_IMPLEMENTED"),
+			variable("CurrentRecordQualityMode", "string", "NOT_IMPLEMENTED"),
+			variable("PossibleRecordQualityModes", "string"),
+			variable("NumberOfTracks", "ui4"),
+			variable("CurrentTrack", "ui4"),
+			variable("CurrentTrackDuration", "string"),
+			variable("CurrentMediaDuration", "string"),
+			variable("CurrentTrackMetaData", "string"),
+			variable("CurrentTrackURI", "string"),
+			variable("AVTransportURI", "string"),
+			variable("AVTransportURIMetaData", "string"),
+			variable("NextAVTransportURI", "string"),
+			variable("NextAVTransportURIMetaData", "string"),
+			variable("RelativeTimePosition", "string"),
+			variable("AbsoluteTimePosition", "string"),
+			variable("RelativeCounterPosition", "i4"),
+			variable("AbsoluteCounterPosition", "i4"),
+			variable("CurrentTransportActions", "string"),
+			{SendEvents: "yes", Name: "LastChange", DataType: "string"},
+			variable("A_ARG_TYPE_SeekMode", "string", "REL_TIME", "ABS_TIME"),
+			variable("A_ARG_TYPE_SeekTarget", "string"),
+			variable("A_ARG_TYPE_InstanceID", "ui4"),
+		},
+	},
+}
+
+var renderingControlService = service{
+	name: "RenderingControl",
+	typ:  renderingControlType,
+	scpd: scpd{
+		SpecVersion: specVersion{Major: 1},
+		Actions: []scpdAction{
+			action("ListPresets", "in:InstanceID:A_ARG_TYPE_InstanceID", "out:CurrentPresetNameList:PresetNameList"),
+			action("SelectPreset", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:PresetName:A_ARG_TYPE_PresetName"),
+			action("GetMute", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:Channel:A_ARG_TYPE_Channel", "out:CurrentMute:Mute"),
+			action("SetMute", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:Channel:A_ARG_TYPE_Channel", "in:DesiredMute:Mute"),
+			action("GetVolume", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:Channel:A_ARG_TYPE_Channel", "out:CurrentVolume:Volume"),
+			action("SetVolume", "in:InstanceID:A_ARG_TYPE_InstanceID", "in:Channel:A_ARG_TYPE_Channel", "in:DesiredVolume:Volume"),
+		},
+		StateVariables: []stateVariable{
+			variable("PresetNameList", "string"),
+			{SendEvents: "yes", Name: "LastChange", DataType: "string"},
+			variable("Mute", "boolean"),
+			{SendEvents: "no", Name: "Volume", DataType: "ui2", Range: &valueRange{Minimum: 0, Maximum: 100, Step: 1}},
+			variable("A_ARG_TYPE_Channel", "string", "Master"),
+			variable("A_ARG_TYPE_InstanceID", "ui4"),
+			variable("A_ARG_TYPE_PresetName", "string", "FactoryDefaults"),
+		},
+	},
+}
+
+var connectionManagerService = service{
+	name: "ConnectionManager",
+	typ:  connectionManagerType,
+	scpd: scpd{
+		SpecVersion: specVersion{Major: 1},
+		Actions: []scpdAction{
+			action("GetProtocolInfo", "out:Source:SourceProtocolInfo", "out:Sink:SinkProtocolInfo"),
+			action("GetCurrentConnectionIDs", "out:ConnectionIDs:CurrentConnectionIDs"),
+			action("GetCurrentConnectionInfo", "in:ConnectionID:A_ARG_TYPE_ConnectionID",
+				"out:RcsID:A_ARG_TYPE_RcsID", "out:AVTransportID:A_ARG_TYPE_AVTransportID",
+				"out:ProtocolInfo:A_ARG_TYPE_ProtocolInfo", "out:PeerConnectionManager:A_ARG_TYPE_ConnectionManager",
+				"out:PeerConnectionID:A_ARG_TYPE_ConnectionID", "out:Direction:A_ARG_TYPE_Direction",
+				"out:Status:A_ARG_TYPE_ConnectionStatus"),
+		},
+		StateVariables: []stateVariable{
+			{SendEvents: "yes", Name: "SourceProtocolInfo", DataType: "string"},
+			{SendEvents: "yes", Name: "SinkProtocolInfo", DataType: "string"},
+			{SendEvents: "yes", Name: "CurrentConnectionIDs", DataType: "string"},
+			variable("A_ARG_TYPE_ConnectionStatus", "string", "OK", "ContentFormatMismatch", "InsufficientBandwidth", "UnreliableChannel", "Unknown"),
+			variable("A_ARG_TYPE_ConnectionManager", "string"),
+			variable("A_ARG_TYPE_Direction", "string", "Input", "Output"),
+			variable("A_ARG_TYPE_ProtocolInfo", "string"),
+			variable("A_ARG_TYPE_ConnectionID", "i4"),
+			variable("A_ARG_TYPE_AVTransportID", "i4"),
+			variable("A_ARG_TYPE_RcsID", "i4"),
+		},
+	},
+}
+
+// services lists the renderer's services in description order.
+var services = []*service{&avTransportService, &renderingControlService, &connectionManagerService}
+
+// serviceByName returns the service with the given URL name, or nil.
+func serviceByName(name string) *service {
+	for _, svc := range services {
+		if svc.name == name {
+			return svc
+		}
+	}
+	return nil
+}
+
+// deviceDescription is the root device description document.
+type deviceDescription struct {
+	XMLName     xml.Name    `xml:"urn:schemas-upnp-org:device-1-0 root"`
+	SpecVersion specVersion `xml:"specVersion"`
+	Device      device      `xml:"device"`
+}
+
+type device struct {
+	DeviceType       string          `xml:"deviceType"`
+	FriendlyName     string          `xml:"friendlyName"`
+	Manufacturer     string          `xml:"manufacturer"`
+	ManufacturerURL  string          `xml:"manufacturerURL"`
+	ModelDescription string          `xml:"modelDescription"`
+	ModelName        string          `xml:"modelName"`
+	ModelNumber      string          `xml:"modelNumber,omitempty"`
+	UDN              string          `xml:"UDN"`
+	Services         []deviceService `xml:"serviceList>service"`
+}
+
+type deviceService struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
+}
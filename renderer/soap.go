@@ -0,0 +1,228 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSOAPBody bounds the size of a SOAP request body.
+const maxSOAPBody = 1 << 20
+
+// UPnP error codes returned in SOAP faults.
+const (
+	errInvalidAction       = 401
+	errInvalidArgs         = 402
+	errActionFailed        = 501
+	errTransitionNotAvail  = 701
+	errSeekModeUnsupported = 710
+	errIllegalMIMEType     = 714
+	errResourceNotFound    = 716
+	errInvalidInstanceID   = 718
+)
+
+// upnpError is an action failure reported to the control point as a SOAP
+// fault.
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// newError creates a upnpError.
+func newError(code int, format string, args ...any) *upnpError {
+	return &upnpError{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// arg is a named SOAP argument. Responses keep arguments in SCPD order.
+type arg struct {
+	Name  string
+	Value string
+}
+
+// soapEnvelope is used to decode incoming action requests.
+type soapEnvelope struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// parseSOAPAction reads the action name and arguments from a control request.
+// The action is taken from the SOAPACTION header and checked against the
+// body.
+func parseSOAPAction(r *http.Request, serviceType string) (string, map[string]string, error) {
+	header := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+	typ, name, ok := strings.Cut(header, "#")
+	if !ok || typ != serviceType {
+		return "", nil, fmt.Errorf("invalid SOAPACTION %q", header)
+	}
+
+	var env soapEnvelope
+	if err := xml.NewDecoder(io.LimitReader(r.Body, maxSOAPBody)).Decode(&env); err != nil {
+		return "", nil, fmt.Errorf("invalid SOAP body: %w", err)
+	}
+	if env.Body.Action.XMLName.Local != name {
+		return "", nil, fmt.Errorf("SOAPACTION %q does not match body action %q", name, env.Body.Action.XMLName.Local)
+	}
+
+	args := make(map[string]string, len(env.Body.Action.Args))
+	for _, a := range env.Body.Action.Args {
+		args[a.XMLName.Local] = a.Value
+	}
+	return name, args, nil
+}
+
+// writeSOAPResponse writes a successful action response.
+func writeSOAPResponse(w http.ResponseWriter, serviceType, action string, args []arg) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%sResponse xmlns:u="%s">`, action, serviceType)
+	for _, a := range args {
+		fmt.Fprintf(&body, "<%s>", a.Name)
+		_ = xml.EscapeText(&body, []byte(a.Value))
+		fmt.Fprintf(&body, "</%s>", a.Name)
+	}
+	fmt.Fprintf(&body, `</u:%sResponse>`, action)
+	body.WriteString(`</s:Body></s:Envelope>`)
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	_, _ = w.Write(body.Bytes())
+}
+
+// writeSOAPFault writes a UPnP error as a SOAP fault.
+func writeSOAPFault(w http.ResponseWriter, e *upnpError) {
+	var desc bytes.Buffer
+	_ = xml.EscapeText(&desc, []byte(e.Description))
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`,
+		e.Code, desc.String())
+}
+
+// Metadata is the track information a control point sends in DIDL-Lite.
+type Metadata struct {
+	Title    string
+	Artist   string
+	Album    string
+	Icon     string
+	MimeType string
+	Duration time.Duration
+	Live     bool // audioBroadcast items such as internet radio
+}
+
+// didlLite is the subset of DIDL-Lite that renderers care about.
+type didlLite struct {
+	Items []struct {
+		Title       string   `xml:"title"`
+		Creator     string   `xml:"creator"`
+		Artists     []string `xml:"artist"`
+		Album       string   `xml:"album"`
+		AlbumArtURI []string `xml:"albumArtURI"`
+		Class       string   `xml:"class"`
+		Res         []struct {
+			ProtocolInfo string `xml:"protocolInfo,attr"`
+			Duration     string `xml:"duration,attr"`
+			URL          string `xml:",chardata"`
+		} `xml:"res"`
+	} `xml:"item"`
+}
+
+// parseDIDL extracts track metadata for uri from a DIDL-Lite document. Empty
+// or unparsable metadata yields an empty Metadata; many control points send
+// none.
+func parseDIDL(raw, uri string) Metadata {
+	var doc didlLite
+	if strings.TrimSpace(raw) == "" || xml.Unmarshal([]byte(raw), &doc) != nil || len(doc.Items) == 0 {
+		return Metadata{}
+	}
+
+	item := doc.Items[0]
+	md := Metadata{
+		Title:  strings.TrimSpace(item.Title),
+		Artist: strings.TrimSpace(item.Creator),
+		Album:  strings.TrimSpace(item.Album),
+		Live:   strings.HasPrefix(item.Class, "object.item.audioItem.audioBroadcast"),
+	}
+	if len(item.Artists) > 0 && strings.TrimSpace(item.Artists[0]) != "" {
+		md.Artist = strings.TrimSpace(item.Artists[0])
+	}
+	if len(item.AlbumArtURI) > 0 {
+		md.Icon = strings.TrimSpace(item.AlbumArtURI[0])
+	}
+
+	// Prefer the resource matching the URI being played
+	if len(item.Res) > 0 {
+		res := item.Res[0]
+		for _, r := range item.Res {
+			if strings.TrimSpace(r.URL) == uri {
+				res = r
+				break
+			}
+		}
+		if parts := strings.Split(res.ProtocolInfo, ":"); len(parts) == 4 && parts[2] != "*" {
+			md.MimeType = parts[2]
+		}
+		if d, err := parseDuration(res.Duration); err == nil {
+			md.Duration = d
+		}
+	}
+
+	// Strip protocolInfo extras such as ";rate=44100"
+	if md.MimeType != "" {
+		if mt, _, err := mime.ParseMediaType(md.MimeType); err == nil {
+			md.MimeType = mt
+		}
+	}
+	return md
+}
+
+// formatDuration formats d as UPnP's H:MM:SS.
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	secs := int64(d / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
+
+// parseDuration parses UPnP's H+:MM:SS[.F+] format.
+func parseDuration(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	sec, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || sec < 0 || sec >= 60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)), nil
+}
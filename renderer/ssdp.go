@@ -0,0 +1,192 @@
+package renderer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hilli/kefw2ui/announce"
+)
+
+// SSDP parameters.
+const (
+	ssdpAddr          = "239.255.255.250:1900"
+	ssdpMaxAge        = 1800
+	ssdpAliveInterval = 15 * time.Minute
+	ssdpServer        = "Linux/1.0 UPnP/1.0 kefw2ui/1.0"
+)
+
+// startSSDP joins the SSDP multicast group, answers M-SEARCH requests and
+// sends periodic ssdp:alive notifications.
+func (r *Renderer) startSSDP() error {
+	group, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve SSDP address: %w", err)
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("failed to join SSDP multicast group: %w", err)
+	}
+
+	stop := make(chan struct{})
+	r.ssdpMu.Lock()
+	r.ssdpConn = conn
+	r.ssdpStop = stop
+	r.ssdpMu.Unlock()
+
+	go r.serveSSDP(conn)
+	go func() {
+		r.notifyAll(conn, group, "ssdp:alive")
+		ticker := time.NewTicker(ssdpAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.notifyAll(conn, group, "ssdp:alive")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// stopSSDP sends ssdp:byebye and leaves the multicast group.
+func (r *Renderer) stopSSDP() {
+	r.ssdpMu.Lock()
+	conn, stop := r.ssdpConn, r.ssdpStop
+	r.ssdpConn, r.ssdpStop = nil, nil
+	r.ssdpMu.Unlock()
+
+	if conn == nil {
+		return
+	}
+	close(stop)
+	if group, err := net.ResolveUDPAddr("udp4", ssdpAddr); err == nil {
+		r.notifyAll(conn, group, "ssdp:byebye")
+	}
+	_ = conn.Close()
+}
+
+// targets returns the notification types (NT/ST) the renderer answers to,
+// each with its USN.
+func (r *Renderer) targets() [][2]string {
+	t := [][2]string{
+		{"upnp:rootdevice", r.udn + "::upnp:rootdevice"},
+		{r.udn, r.udn},
+		{deviceType, r.udn + "::" + deviceType},
+	}
+	for _, svc := range services {
+		t = append(t, [2]string{svc.typ, r.udn + "::" + svc.typ})
+	}
+	return t
+}
+
+// location returns the description URL as reachable from peer.
+func (r *Renderer) location(peer net.IP) (string, error) {
+	base, err := announce.BaseURL(r.opts.PublicURL, peer.String(), r.opts.Port)
+	if err != nil {
+		return "", err
+	}
+	return base + BasePath + "description.xml", nil
+}
+
+// notifyAll multicasts a NOTIFY message for every target.
+func (r *Renderer) notifyAll(conn *net.UDPConn, group *net.UDPAddr, nts string) {
+	location, err := r.location(group.IP)
+	if err != nil {
+		log.Printf("UPnP renderer: %v", err)
+		return
+	}
+
+	for _, t := range r.targets() {
+		var msg bytes.Buffer
+		msg.WriteString("NOTIFY * HTTP/1.1\r\n")
+		msg.WriteString("HOST: " + ssdpAddr + "\r\n")
+		msg.WriteString("NT: " + t[0] + "\r\n")
+		msg.WriteString("NTS: " + nts + "\r\n")
+		msg.WriteString("USN: " + t[1] + "\r\n")
+		if nts == "ssdp:alive" {
+			msg.WriteString("CACHE-CONTROL: max-age=" + strconv.Itoa(ssdpMaxAge) + "\r\n")
+			msg.WriteString("LOCATION: " + location + "\r\n")
+			msg.WriteString("SERVER: " + ssdpServer + "\r\n")
+		}
+		msg.WriteString("\r\n")
+
+		if _, err := conn.WriteToUDP(msg.Bytes(), group); err != nil {
+			log.Printf("UPnP renderer: failed to send SSDP %s: %v", nts, err)
+			return
+		}
+	}
+}
+
+// serveSSDP answers M-SEARCH requests until the connection is closed.
+func (r *Renderer) serveSSDP(conn *net.UDPConn) {
+	buf := make([]byte, 8192)
+	for {
+		n, peer, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+			continue
+		}
+
+		st := req.Header.Get("ST")
+		var matches [][2]string
+		for _, t := range r.targets() {
+			if st == "ssdp:all" || st == t[0] {
+				matches = append(matches, t)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		// Spread responses over MX seconds (capped) as the spec asks
+		mx, err := strconv.Atoi(req.Header.Get("MX"))
+		if err != nil || mx < 1 {
+			mx = 1
+		}
+		delay := time.Duration(rand.Int64N(int64(min(mx, 3)) * int64(time.Second))) //nolint:gosec // jitter only
+
+		go r.respondSSDP(conn, peer, matches, delay)
+	}
+}
+
+// respondSSDP sends unicast M-SEARCH responses to peer after delay.
+func (r *Renderer) respondSSDP(conn *net.UDPConn, peer *net.UDPAddr, matches [][2]string, delay time.Duration) {
+	time.Sleep(delay)
+
+	location, err := r.location(peer.IP)
+	if err != nil {
+		log.Printf("UPnP renderer: %v", err)
+		return
+	}
+
+	for _, t := range matches {
+		var msg bytes.Buffer
+		msg.WriteString("HTTP/1.1 200 OK\r\n")
+		msg.WriteString("CACHE-CONTROL: max-age=" + strconv.Itoa(ssdpMaxAge) + "\r\n")
+		msg.WriteString("DATE: " + time.Now().UTC().Format(http.TimeFormat) + "\r\n")
+		msg.WriteString("EXT:\r\n")
+		msg.WriteString("LOCATION: " + location + "\r\n")
+		msg.WriteString("SERVER: " + ssdpServer + "\r\n")
+		msg.WriteString("ST: " + t[0] + "\r\n")
+		msg.WriteString("USN: " + t[1] + "\r\n")
+		msg.WriteString("\r\n")
+
+		if _, err := conn.WriteToUDP(msg.Bytes(), peer); err != nil {
+			return
+		}
+	}
+}
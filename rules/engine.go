@@ -0,0 +1,428 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/scenes"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// Action result statuses.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped" // dry run
+)
+
+const (
+	// cooldown keeps a rule from firing again on the events its own actions
+	// cause (e.g. a volume rule that sets the volume)
+	cooldown = 5 * time.Second
+
+	// runTimeout bounds the speaker calls of one rule run
+	runTimeout = 30 * time.Second
+
+	// logSize is the number of runs kept per rule
+	logSize = 50
+)
+
+// Result is the outcome of one action.
+type Result struct {
+	Action string `json:"action"`
+	Value  string `json:"value,omitempty"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Run records one execution (or dry run) of a rule.
+type Run struct {
+	RuleID  string    `json:"ruleId"`
+	Time    time.Time `json:"time"`
+	Event   Event     `json:"event"`
+	DryRun  bool      `json:"dryRun,omitempty"`
+	Results []Result  `json:"results"`
+}
+
+// Failed returns the number of failed actions.
+func (r *Run) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// Options configures the engine.
+type Options struct {
+	Manager *speaker.Manager
+	Scenes  *scenes.Manager
+
+	// OnRun is invoked after a rule ran (not after dry runs), and OnExecute
+	// before each of its actions.
+	OnRun     func(rule *Rule, run Run)
+	OnExecute func(rule *Rule, action Action)
+}
+
+// Engine evaluates the stored rules against speaker events and runs their
+// actions on the active speaker.
+type Engine struct {
+	*Store
+	opts Options
+
+	mu      sync.Mutex
+	runs    map[string][]Run     // by rule ID, newest first
+	lastRun map[string]time.Time // by rule ID, for the cooldown
+
+	// Last reported state, so rules only fire on changes ("becomes")
+	source string
+	power  string
+	track  string
+	state  string
+	volume int
+	muted  *bool
+}
+
+// NewEngine creates an engine over the rules in the config directory.
+func NewEngine(opts Options) (*Engine, error) {
+	store, err := NewStore()
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		Store:   store,
+		opts:    opts,
+		runs:    make(map[string][]Run),
+		lastRun: make(map[string]time.Time),
+		volume:  -1,
+	}, nil
+}
+
+// HandleEvent evaluates the rules against a speaker event. Matching rules run
+// in the background.
+func (e *Engine) HandleEvent(event speaker.Event) {
+	if _, ok := event.(speaker.ActiveSpeakerChanged); ok {
+		e.speakerChanged()
+		return
+	}
+	ev, ok := eventFromSpeaker(event)
+	if !ok {
+		return
+	}
+	for _, ev := range e.changes(ev) {
+		e.evaluate(ev)
+	}
+}
+
+// changes filters out events that repeat the last reported state, and splits
+// player data into track and playback events.
+func (e *Engine) changes(ev Event) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch ev.Type {
+	case EventSource:
+		if ev.Source == e.source {
+			return nil
+		}
+		e.source = ev.Source
+	case EventPower:
+		if ev.Power == e.power {
+			return nil
+		}
+		e.power = ev.Power
+	case EventVolume:
+		if *ev.Volume == e.volume {
+			return nil
+		}
+		e.volume = *ev.Volume
+	case EventMute:
+		if e.muted != nil && *e.muted == *ev.Muted {
+			return nil
+		}
+		e.muted = ev.Muted
+	default:
+		var events []Event
+		if key := ev.Title + "\x00" + ev.Artist + "\x00" + ev.Album; ev.Title != "" && key != e.track {
+			e.track = key
+			track := ev
+			track.Type = EventTrack
+			events = append(events, track)
+		}
+		if ev.State != "" && ev.State != e.state {
+			e.state = ev.State
+			playback := ev
+			playback.Type = EventPlayback
+			events = append(events, playback)
+		}
+		return events
+	}
+	return []Event{ev}
+}
+
+// speakerChanged forgets the last reported state, so the new speaker's
+// initial events are treated as changes.
+func (e *Engine) speakerChanged() {
+	e.mu.Lock()
+	e.source, e.power, e.track, e.state = "", "", "", ""
+	e.volume = -1
+	e.muted = nil
+	e.mu.Unlock()
+}
+
+// evaluate runs every enabled rule the event triggers.
+func (e *Engine) evaluate(ev Event) {
+	rules, err := e.List()
+	if err != nil {
+		log.Printf("Rules: %v", err)
+		return
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		if ok, _ := rule.When.Match(ev); !ok {
+			continue
+		}
+
+		e.mu.Lock()
+		cooling := time.Since(e.lastRun[rule.ID]) < cooldown
+		if !cooling {
+			e.lastRun[rule.ID] = time.Now()
+		}
+		e.mu.Unlock()
+		if cooling {
+			continue
+		}
+
+		log.Printf("Rule %q triggered by %s event", rule.Name, ev.Type)
+		go e.run(rule, ev, false)
+	}
+}
+
+// Test evaluates a rule against a sample event. An event without a type is
+// filled in from the rule's own trigger, and the time defaults to now. When
+// execute is false (a dry run) the actions that would run are reported
+// without touching the speaker.
+func (e *Engine) Test(id string, ev Event, execute bool) (matched bool, reason string, run *Run, err error) {
+	rule, err := e.Get(id)
+	if err != nil {
+		return false, "", nil, err
+	}
+	if ev.Type == "" {
+		ev = sampleEvent(rule.When, ev)
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	if matched, reason = rule.When.Match(ev); !matched {
+		return false, reason, nil, nil
+	}
+	r := e.run(rule, ev, !execute)
+	return true, "", &r, nil
+}
+
+// sampleEvent fills in an event that satisfies the trigger's event and value
+// conditions, keeping any fields already set.
+func sampleEvent(w When, ev Event) Event {
+	ev.Type = w.Event
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&ev.Source, w.Source)
+	fill(&ev.Power, w.Power)
+	fill(&ev.Title, w.Title)
+	fill(&ev.Artist, w.Artist)
+	fill(&ev.Album, w.Album)
+	fill(&ev.State, w.State)
+	if ev.Muted == nil {
+		ev.Muted = w.Muted
+	}
+	if ev.Volume == nil {
+		switch {
+		case w.VolumeAbove != nil:
+			v := *w.VolumeAbove + 1
+			ev.Volume = &v
+		case w.VolumeBelow != nil:
+			v := *w.VolumeBelow - 1
+			ev.Volume = &v
+		}
+	}
+	return ev
+}
+
+// Runs returns the recent runs of a rule, newest first.
+func (e *Engine) Runs(id string) []Run {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.runs[id])
+}
+
+// Forget drops the run log of a deleted rule.
+func (e *Engine) Forget(id string) {
+	e.mu.Lock()
+	delete(e.runs, id)
+	delete(e.lastRun, id)
+	e.mu.Unlock()
+}
+
+// run executes (or, for a dry run, lists) the rule's actions and logs the run.
+func (e *Engine) run(rule *Rule, ev Event, dryRun bool) Run {
+	run := Run{RuleID: rule.ID, Time: time.Now(), Event: ev, DryRun: dryRun}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout+maxWait)
+	defer cancel()
+
+	for _, action := range rule.Then {
+		result := Result{Action: action.Type, Value: action.Value, Status: StatusOK}
+		if dryRun {
+			result.Status = StatusSkipped
+			result.Detail = "dry run"
+		} else if detail, err := e.executeAction(ctx, rule, action); err != nil {
+			result.Status = StatusFailed
+			result.Detail = err.Error()
+		} else {
+			result.Detail = detail
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	if failed := run.Failed(); failed > 0 {
+		log.Printf("Rule %q: %d of %d actions failed", rule.Name, failed, len(run.Results))
+	}
+
+	e.mu.Lock()
+	entries := append([]Run{run}, e.runs[rule.ID]...)
+	if len(entries) > logSize {
+		entries = entries[:logSize]
+	}
+	e.runs[rule.ID] = entries
+	e.mu.Unlock()
+
+	if !dryRun && e.opts.OnRun != nil {
+		e.opts.OnRun(rule, run)
+	}
+	return run
+}
+
+// executeAction notifies OnExecute and runs the action.
+func (e *Engine) executeAction(ctx context.Context, rule *Rule, action Action) (string, error) {
+	if e.opts.OnExecute != nil {
+		e.opts.OnExecute(rule, action)
+	}
+	return e.execute(ctx, action)
+}
+
+// execute runs one action on the active speaker.
+func (e *Engine) execute(ctx context.Context, action Action) (string, error) {
+	if action.Type == ActionWait {
+		secs, _ := strconv.ParseFloat(action.Value, 64)
+		select {
+		case <-time.After(time.Duration(secs * float64(time.Second))):
+			return "", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	spk := e.opts.Manager.GetActiveSpeaker()
+	if spk == nil {
+		return "", fmt.Errorf("no active speaker")
+	}
+
+	switch action.Type {
+	case ActionVolume:
+		volume, _ := strconv.Atoi(action.Value)
+		set, err := e.opts.Manager.SetVolume(ctx, spk, volume, speaker.OriginRule)
+		if err == nil && set < volume {
+			return fmt.Sprintf("limited to %d by quiet hours", set), nil
+		}
+		return "", err
+
+	case ActionMute:
+		return "", spk.Mute(ctx)
+
+	case ActionUnmute:
+		return "", spk.Unmute(ctx)
+
+	case ActionSource:
+		source := kefw2.Source(action.Value)
+		if err := spk.SetSource(ctx, source); err != nil {
+			return "", err
+		}
+		if source == kefw2.SourceStandby {
+			e.opts.Manager.NotifyStandby()
+		} else {
+			e.opts.Manager.NotifyWake()
+		}
+		return "", nil
+
+	case ActionStandby:
+		if err := spk.PowerOff(ctx); err != nil {
+			return "", err
+		}
+		e.opts.Manager.NotifyStandby()
+		return "", nil
+
+	case ActionPlay:
+		_, err := kefw2.NewAirableClient(spk).PlayOrResumeFromQueue(ctx)
+		return "", err
+
+	case ActionPause:
+		pd, err := spk.PlayerData(ctx)
+		if err != nil {
+			return "", err
+		}
+		if pd.State != kefw2.PlayerStatePlaying {
+			return "not playing", nil
+		}
+		return "", spk.PlayPause(ctx)
+
+	case ActionStop:
+		return "", spk.Stop(ctx)
+
+	case ActionNext:
+		return "", spk.NextTrack(ctx)
+
+	case ActionPrevious:
+		return "", spk.PreviousTrack(ctx)
+
+	case ActionClearQueue:
+		return "", kefw2.NewAirableClient(spk).ClearPlaylist()
+
+	case ActionScene:
+		if e.opts.Scenes == nil {
+			return "", fmt.Errorf("scenes not available")
+		}
+		scene, err := e.opts.Scenes.Get(action.Value)
+		if err != nil {
+			return "", err
+		}
+		steps := scenes.Recall(ctx, spk, scene.State, e.opts.Manager.VolumeSetter(spk, speaker.OriginRule))
+		if scene.State.PoweredOn {
+			e.opts.Manager.NotifyWake()
+		} else {
+			e.opts.Manager.NotifyStandby()
+		}
+		if failed := scenes.Failed(steps); failed > 0 {
+			return "", fmt.Errorf("%d of %d scene steps failed", failed, len(steps))
+		}
+		return scene.Name, nil
+	}
+
+	return "", fmt.Errorf("unknown action %q", action.Type)
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestEngine creates an engine with no stored rules, for testing the
+// change filter.
+func newTestEngine() *Engine {
+	return &Engine{
+		Store:   &Store{rules: []Rule{}},
+		runs:    make(map[string][]Run),
+		lastRun: make(map[string]time.Time),
+		volume:  -1,
+	}
+}
+
+// eventTypes returns the types of the events the engine would evaluate for
+// each input event in turn.
+func eventTypes(e *Engine, events []Event) [][]string {
+	var types [][]string
+	for _, ev := range events {
+		var got []string
+		for _, change := range e.changes(ev) {
+			got = append(got, change.Type)
+		}
+		types = append(types, got)
+	}
+	return types
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []Event
+		want   [][]string
+	}{
+		{
+			"repeated source",
+			[]Event{{Type: EventSource, Source: "wifi"}, {Type: EventSource, Source: "wifi"}, {Type: EventSource, Source: "tv"}},
+			[][]string{{EventSource}, nil, {EventSource}},
+		},
+		{
+			"repeated power",
+			[]Event{{Type: EventPower, Power: "on"}, {Type: EventPower, Power: "on"}, {Type: EventPower, Power: "standby"}},
+			[][]string{{EventPower}, nil, {EventPower}},
+		},
+		{
+			"volume",
+			[]Event{{Type: EventVolume, Volume: intPtr(0)}, {Type: EventVolume, Volume: intPtr(0)}, {Type: EventVolume, Volume: intPtr(5)}},
+			[][]string{{EventVolume}, nil, {EventVolume}},
+		},
+		{
+			"mute",
+			[]Event{{Type: EventMute, Muted: boolPtr(false)}, {Type: EventMute, Muted: boolPtr(false)}, {Type: EventMute, Muted: boolPtr(true)}},
+			[][]string{{EventMute}, nil, {EventMute}},
+		},
+		{
+			"player data split into track and playback",
+			[]Event{
+				{Title: "So What", Artist: "Miles Davis", State: "playing"},
+				{Title: "So What", Artist: "Miles Davis", State: "playing"},
+				{Title: "So What", Artist: "Miles Davis", State: "paused"},
+				{Title: "Blue in Green", Artist: "Miles Davis", State: "paused"},
+				{Title: "", State: "stopped"},
+			},
+			[][]string{{EventTrack, EventPlayback}, nil, {EventPlayback}, {EventTrack}, {EventPlayback}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := eventTypes(newTestEngine(), tt.events)
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangesAfterSpeakerChange(t *testing.T) {
+	e := newTestEngine()
+	source := Event{Type: EventSource, Source: "wifi"}
+	volume := Event{Type: EventVolume, Volume: intPtr(20)}
+	e.changes(source)
+	e.changes(volume)
+
+	e.speakerChanged()
+	if got := eventTypes(e, []Event{source, volume}); !slices.EqualFunc(got, [][]string{{EventSource}, {EventVolume}}, slices.Equal) {
+		t.Errorf("changes after speaker change = %v, want the same state reported again", got)
+	}
+}
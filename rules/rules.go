@@ -0,0 +1,427 @@
+// Package rules runs declarative automation rules for kefw2ui.
+//
+// A rule reads "when <event and conditions> then <actions>", for example
+// "when the source becomes tv, set volume 35" or "when the speaker goes to
+// standby between 22:00 and 07:00, clear the queue". Rules are evaluated
+// against the speaker's event stream and stored in rules.json in the config
+// directory.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/ids"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// Trigger event types.
+const (
+	EventSource   = "source"   // the source changed
+	EventPower    = "power"    // the speaker was turned on or went to standby
+	EventTrack    = "track"    // a different track started
+	EventPlayback = "playback" // the player state changed (playing, paused, stopped)
+	EventVolume   = "volume"   // the volume changed
+	EventMute     = "mute"     // the speaker was muted or unmuted
+)
+
+// EventTypes lists the events a rule can trigger on.
+var EventTypes = []string{EventSource, EventPower, EventTrack, EventPlayback, EventVolume, EventMute}
+
+// Action types.
+const (
+	ActionVolume     = "volume" // value: 0-100
+	ActionMute       = "mute"
+	ActionUnmute     = "unmute"
+	ActionSource     = "source" // value: a source name
+	ActionStandby    = "standby"
+	ActionPlay       = "play"
+	ActionPause      = "pause"
+	ActionStop       = "stop"
+	ActionNext       = "next" // skip the current track
+	ActionPrevious   = "previous"
+	ActionClearQueue = "clear_queue"
+	ActionScene      = "scene" // value: a scene ID to recall
+	ActionWait       = "wait"  // value: seconds (max 60)
+)
+
+// ActionTypes lists the supported action types.
+var ActionTypes = []string{
+	ActionVolume, ActionMute, ActionUnmute, ActionSource, ActionStandby,
+	ActionPlay, ActionPause, ActionStop, ActionNext, ActionPrevious,
+	ActionClearQueue, ActionScene, ActionWait,
+}
+
+// maxWait bounds a wait action.
+const maxWait = 60 * time.Second
+
+// When is a rule's trigger: an event type and optional conditions, all of
+// which must hold. Text comparisons ignore case.
+type When struct {
+	Event string `json:"event"`
+
+	Source string `json:"source,omitempty"` // source event: the new source
+	Power  string `json:"power,omitempty"`  // power event: "on" or "standby"
+	Title  string `json:"title,omitempty"`  // track event
+	Artist string `json:"artist,omitempty"` // track event
+	Album  string `json:"album,omitempty"`  // track event
+	State  string `json:"state,omitempty"`  // playback event: playing, paused, stopped
+
+	VolumeAbove *int  `json:"volumeAbove,omitempty"` // volume event
+	VolumeBelow *int  `json:"volumeBelow,omitempty"` // volume event
+	Muted       *bool `json:"muted,omitempty"`       // mute event
+
+	// Between limits the rule to a local time window, "HH:MM-HH:MM". Windows
+	// that end before they start wrap past midnight ("22:00-07:00").
+	Between string `json:"between,omitempty"`
+}
+
+// Action is one step run when a rule fires.
+type Action struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// Rule is a named automation rule.
+type Rule struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	When      When      `json:"when"`
+	Then      []Action  `json:"then"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Validate checks a rule's trigger and actions.
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	if !slices.Contains(EventTypes, r.When.Event) {
+		return fmt.Errorf("unknown event %q (expected one of %s)", r.When.Event, strings.Join(EventTypes, ", "))
+	}
+	if r.When.Power != "" && r.When.Power != "on" && r.When.Power != "standby" {
+		return fmt.Errorf("power must be \"on\" or \"standby\"")
+	}
+	if r.When.Between != "" {
+		if _, err := parseWindow(r.When.Between); err != nil {
+			return err
+		}
+	}
+	if len(r.Then) == 0 {
+		return fmt.Errorf("rule needs at least one action")
+	}
+	for i, a := range r.Then {
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("action %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (a Action) validate() error {
+	switch a.Type {
+	case ActionVolume:
+		if v, err := strconv.Atoi(a.Value); err != nil || v < 0 || v > 100 {
+			return fmt.Errorf("volume must be 0-100")
+		}
+	case ActionSource:
+		if a.Value == "" {
+			return fmt.Errorf("source is required")
+		}
+	case ActionScene:
+		if a.Value == "" {
+			return fmt.Errorf("scene ID is required")
+		}
+	case ActionWait:
+		secs, err := strconv.ParseFloat(a.Value, 64)
+		if err != nil || secs <= 0 || time.Duration(secs*float64(time.Second)) > maxWait {
+			return fmt.Errorf("wait must be between 0 and %d seconds", int(maxWait.Seconds()))
+		}
+	default:
+		if !slices.Contains(ActionTypes, a.Type) {
+			return fmt.Errorf("unknown action %q", a.Type)
+		}
+	}
+	return nil
+}
+
+// Event is what a rule is matched against: the event type and the state it
+// reports.
+type Event struct {
+	Type   string    `json:"type"`
+	Source string    `json:"source,omitempty"`
+	Power  string    `json:"power,omitempty"`
+	Title  string    `json:"title,omitempty"`
+	Artist string    `json:"artist,omitempty"`
+	Album  string    `json:"album,omitempty"`
+	State  string    `json:"state,omitempty"`
+	Volume *int      `json:"volume,omitempty"`
+	Muted  *bool     `json:"muted,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Match reports whether the event triggers the rule, and if not, why.
+func (w When) Match(e Event) (bool, string) {
+	if w.Event != e.Type {
+		return false, fmt.Sprintf("event is %s, rule triggers on %s", e.Type, w.Event)
+	}
+
+	checks := []struct {
+		name, want, got string
+	}{
+		{"source", w.Source, e.Source},
+		{"power", w.Power, e.Power},
+		{"title", w.Title, e.Title},
+		{"artist", w.Artist, e.Artist},
+		{"album", w.Album, e.Album},
+		{"state", w.State, e.State},
+	}
+	for _, c := range checks {
+		if c.want != "" && !strings.EqualFold(c.want, c.got) {
+			return false, fmt.Sprintf("%s is %q, not %q", c.name, c.got, c.want)
+		}
+	}
+
+	if w.VolumeAbove != nil || w.VolumeBelow != nil {
+		if e.Volume == nil {
+			return false, "event has no volume"
+		}
+		if w.VolumeAbove != nil && *e.Volume <= *w.VolumeAbove {
+			return false, fmt.Sprintf("volume %d is not above %d", *e.Volume, *w.VolumeAbove)
+		}
+		if w.VolumeBelow != nil && *e.Volume >= *w.VolumeBelow {
+			return false, fmt.Sprintf("volume %d is not below %d", *e.Volume, *w.VolumeBelow)
+		}
+	}
+	if w.Muted != nil && (e.Muted == nil || *e.Muted != *w.Muted) {
+		return false, "mute state does not match"
+	}
+
+	if w.Between != "" {
+		window, err := parseWindow(w.Between)
+		if err != nil {
+			return false, err.Error()
+		}
+		if !window.Contains(e.Time) {
+			return false, fmt.Sprintf("%s is outside %s", e.Time.Format("15:04"), w.Between)
+		}
+	}
+
+	return true, ""
+}
+
+// parseWindow parses "HH:MM-HH:MM".
+func parseWindow(s string) (config.TimeWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return config.TimeWindow{}, fmt.Errorf("invalid time window %q (expected HH:MM-HH:MM)", s)
+	}
+	return config.ParseTimeWindow(from, to)
+}
+
+// eventFromSpeaker converts a speaker event to a rule event. ok is false for
+// events rules can't trigger on.
+func eventFromSpeaker(event speaker.Event) (e Event, ok bool) {
+	e.Time = time.Now()
+	switch ev := event.(type) {
+	case speaker.SourceChanged:
+		e.Type = EventSource
+		e.Source = string(ev.Source)
+	case speaker.PowerChanged:
+		e.Type = EventPower
+		e.Power = "on"
+		if ev.Status == kefw2.SpeakerStatusStandby {
+			e.Power = "standby"
+		}
+	case speaker.PlayerChanged:
+		// Split by the engine into track and playback events
+		e.Title, e.Artist, e.Album, e.State = ev.Title, ev.Artist, ev.Album, ev.State
+	case speaker.VolumeChanged:
+		e.Type = EventVolume
+		e.Volume = &ev.Volume
+	case speaker.MuteChanged:
+		e.Type = EventMute
+		e.Muted = &ev.Muted
+	default:
+		return e, false
+	}
+	return e, true
+}
+
+// Store handles rule storage. Rules are read from disk once and kept in
+// memory, since the engine evaluates them on every event.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	rules []Rule // nil until loaded
+}
+
+// NewStore creates a rule store in the config directory.
+func NewStore() (*Store, error) {
+	path, err := config.RulesPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rules path: %w", err)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return &Store{path: path}, nil
+}
+
+// List returns all rules in the order they were created.
+func (s *Store) List() ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get retrieves a rule by ID.
+func (s *Store) Get(id string) (*Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].ID == id {
+			return &rules[i], nil
+		}
+	}
+	return nil, fmt.Errorf("rule not found: %s", id)
+}
+
+// Create validates and stores a new rule.
+func (s *Store) Create(rule Rule) (*Rule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	base := ids.FromName(rule.Name, "rule")
+	rule.ID = base
+	for n := 2; slices.ContainsFunc(rules, func(r Rule) bool { return r.ID == rule.ID }); n++ {
+		rule.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	rules = append(rules, rule)
+	if err := s.save(rules); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Update validates and replaces the rule with the same ID.
+func (s *Store) Update(rule Rule) (*Rule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].ID != rule.ID {
+			continue
+		}
+		rule.CreatedAt = rules[i].CreatedAt
+		rule.UpdatedAt = time.Now()
+		rules[i] = rule
+		if err := s.save(rules); err != nil {
+			return nil, err
+		}
+		return &rule, nil
+	}
+	return nil, fmt.Errorf("rule not found: %s", rule.ID)
+}
+
+// Delete removes a rule.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range rules {
+		if rules[i].ID == id {
+			rules = append(rules[:i], rules[i+1:]...)
+			return s.save(rules)
+		}
+	}
+	return fmt.Errorf("rule not found: %s", id)
+}
+
+// load returns a copy of all rules, reading them from disk the first time.
+// Caller must hold s.mu.
+func (s *Store) load() ([]Rule, error) {
+	if s.rules != nil {
+		return slices.Clone(s.rules), nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.rules = []Rule{}
+			return []Rule{}, nil
+		}
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	if rules == nil {
+		rules = []Rule{}
+	}
+	s.rules = rules
+	return slices.Clone(rules), nil
+}
+
+// save writes all rules to disk and keeps them in memory. Caller must hold
+// s.mu.
+func (s *Store) save(rules []Rule) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal rules: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write rules: %w", err)
+	}
+	s.rules = slices.Clone(rules)
+	return nil
+}
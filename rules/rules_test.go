@@ -0,0 +1,191 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
+
+func TestWhenMatch(t *testing.T) {
+	night := time.Date(2026, time.March, 14, 23, 15, 0, 0, time.Local)
+	noon := time.Date(2026, time.March, 14, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name       string
+		when       When
+		event      Event
+		want       bool
+		wantReason string
+	}{
+		{"event type only", When{Event: EventSource}, Event{Type: EventSource, Source: "tv"}, true, ""},
+		{"other event type", When{Event: EventSource}, Event{Type: EventVolume, Volume: intPtr(10)},
+			false, "event is volume, rule triggers on source"},
+		{"source ignores case", When{Event: EventSource, Source: "TV"}, Event{Type: EventSource, Source: "tv"}, true, ""},
+		{"other source", When{Event: EventSource, Source: "tv"}, Event{Type: EventSource, Source: "optical"},
+			false, `source is "optical", not "tv"`},
+		{"power", When{Event: EventPower, Power: "standby"}, Event{Type: EventPower, Power: "standby"}, true, ""},
+		{"track artist", When{Event: EventTrack, Artist: "miles davis"}, Event{Type: EventTrack, Title: "So What", Artist: "Miles Davis"}, true, ""},
+		{"track other album", When{Event: EventTrack, Album: "Kind of Blue"}, Event{Type: EventTrack, Album: "Bitches Brew"},
+			false, `album is "Bitches Brew", not "Kind of Blue"`},
+		{"playback state", When{Event: EventPlayback, State: "playing"}, Event{Type: EventPlayback, State: "playing"}, true, ""},
+		{"volume above", When{Event: EventVolume, VolumeAbove: intPtr(60)}, Event{Type: EventVolume, Volume: intPtr(61)}, true, ""},
+		{"volume at threshold", When{Event: EventVolume, VolumeAbove: intPtr(60)}, Event{Type: EventVolume, Volume: intPtr(60)},
+			false, "volume 60 is not above 60"},
+		{"volume below", When{Event: EventVolume, VolumeBelow: intPtr(10)}, Event{Type: EventVolume, Volume: intPtr(9)}, true, ""},
+		{"volume in range", When{Event: EventVolume, VolumeAbove: intPtr(20), VolumeBelow: intPtr(40)}, Event{Type: EventVolume, Volume: intPtr(30)}, true, ""},
+		{"volume out of range", When{Event: EventVolume, VolumeAbove: intPtr(20), VolumeBelow: intPtr(40)}, Event{Type: EventVolume, Volume: intPtr(40)},
+			false, "volume 40 is not below 40"},
+		{"no volume", When{Event: EventVolume, VolumeAbove: intPtr(20)}, Event{Type: EventVolume}, false, "event has no volume"},
+		{"muted", When{Event: EventMute, Muted: boolPtr(true)}, Event{Type: EventMute, Muted: boolPtr(true)}, true, ""},
+		{"unmuted", When{Event: EventMute, Muted: boolPtr(true)}, Event{Type: EventMute, Muted: boolPtr(false)},
+			false, "mute state does not match"},
+		{"inside overnight window", When{Event: EventPower, Between: "22:00-07:00"}, Event{Type: EventPower, Time: night}, true, ""},
+		{"outside overnight window", When{Event: EventPower, Between: "22:00-07:00"}, Event{Type: EventPower, Time: noon},
+			false, "12:00 is outside 22:00-07:00"},
+		{"invalid window", When{Event: EventPower, Between: "late"}, Event{Type: EventPower, Time: noon},
+			false, `invalid time window "late" (expected HH:MM-HH:MM)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := tt.when.Match(tt.event)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("Match = %v, %q, want %v, %q", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	valid := func(edit func(r *Rule)) Rule {
+		r := Rule{
+			Name: "Evening",
+			When: When{Event: EventSource, Source: "tv"},
+			Then: []Action{{Type: ActionVolume, Value: "30"}},
+		}
+		edit(&r)
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{"valid", valid(func(*Rule) {}), ""},
+		{"no name", valid(func(r *Rule) { r.Name = " " }), "rule name is required"},
+		{"unknown event", valid(func(r *Rule) { r.When.Event = "eq" }), `unknown event "eq"`},
+		{"bad power", valid(func(r *Rule) { r.When.Power = "off" }), `power must be "on" or "standby"`},
+		{"bad window", valid(func(r *Rule) { r.When.Between = "22:00" }), "invalid time window"},
+		{"no actions", valid(func(r *Rule) { r.Then = nil }), "rule needs at least one action"},
+		{"volume out of range", valid(func(r *Rule) { r.Then[0].Value = "101" }), "action 1: volume must be 0-100"},
+		{"source without value", valid(func(r *Rule) { r.Then = []Action{{Type: ActionSource}} }), "action 1: source is required"},
+		{"wait too long", valid(func(r *Rule) { r.Then = append(r.Then, Action{Type: ActionWait, Value: "61"}) }), "action 2: wait must be between 0 and 60 seconds"},
+		{"wait fraction", valid(func(r *Rule) { r.Then = append(r.Then, Action{Type: ActionWait, Value: "0.5"}) }), ""},
+		{"unknown action", valid(func(r *Rule) { r.Then[0].Type = "explode" }), `action 1: unknown action "explode"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEventFromSpeaker(t *testing.T) {
+	tests := []struct {
+		name   string
+		event  speaker.Event
+		want   Event
+		wantOK bool
+	}{
+		{"source", speaker.SourceChanged{Source: kefw2.SourceTV}, Event{Type: EventSource, Source: "tv"}, true},
+		{"power on", speaker.PowerChanged{Status: kefw2.SpeakerStatusOn}, Event{Type: EventPower, Power: "on"}, true},
+		{"standby", speaker.PowerChanged{Status: kefw2.SpeakerStatusStandby}, Event{Type: EventPower, Power: "standby"}, true},
+		{"player", speaker.PlayerChanged{Title: "So What", Artist: "Miles Davis", State: "playing"},
+			Event{Title: "So What", Artist: "Miles Davis", State: "playing"}, true},
+		{"position", speaker.PositionChanged{Position: 1000}, Event{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := eventFromSpeaker(tt.event)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			got.Time = time.Time{}
+			if got.Type != tt.want.Type || got.Source != tt.want.Source || got.Power != tt.want.Power ||
+				got.Title != tt.want.Title || got.Artist != tt.want.Artist || got.State != tt.want.State {
+				t.Errorf("event = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	store, err := NewStore()
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	rule := Rule{
+		Name: "TV: evening volume",
+		When: When{Event: EventSource, Source: "tv"},
+		Then: []Action{{Type: ActionVolume, Value: "30"}},
+	}
+	first, err := store.Create(rule)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	second, err := store.Create(rule)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if first.ID != "tv-evening-volume" || second.ID != "tv-evening-volume-2" {
+		t.Errorf("IDs = %q, %q", first.ID, second.ID)
+	}
+
+	second.Enabled = true
+	if _, err := store.Update(*second); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := store.Delete(first.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// A new store reads what the first one saved
+	reopened, err := NewStore()
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	rules, err := reopened.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(rules) != 1 || rules[0].ID != second.ID || !rules[0].Enabled {
+		t.Errorf("stored rules = %+v", rules)
+	}
+
+	// Changing a listed rule doesn't change the store
+	rules[0].Name = "changed"
+	if got, _ := reopened.Get(second.ID); got == nil || got.Name != rule.Name {
+		t.Errorf("Get after modifying List result = %+v", got)
+	}
+}
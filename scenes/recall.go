@@ -0,0 +1,393 @@
+package scenes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// Step outcome values reported by Recall.
+const (
+	StepOK      = "ok"
+	StepSkipped = "skipped"
+	StepFailed  = "failed"
+)
+
+// Step reports the outcome of one recall step.
+type Step struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Failed returns the number of failed steps.
+func Failed(steps []Step) int {
+	n := 0
+	for _, st := range steps {
+		if st.Status == StepFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// Capture snapshots the current speaker state. A speaker in standby only
+// records its power state; queue and playback are only captured on WiFi.
+func Capture(ctx context.Context, spk *kefw2.KEFSpeaker) (State, error) {
+	source, err := spk.Source(ctx)
+	if err != nil {
+		return State{}, fmt.Errorf("failed to get source: %w", err)
+	}
+
+	state := State{
+		Source:    string(source),
+		PoweredOn: source != kefw2.SourceStandby,
+	}
+	if !state.PoweredOn {
+		return state, nil
+	}
+
+	if state.Volume, err = spk.GetVolume(ctx); err != nil {
+		return State{}, fmt.Errorf("failed to get volume: %w", err)
+	}
+	if state.Muted, err = spk.IsMuted(ctx); err != nil {
+		return State{}, fmt.Errorf("failed to get mute state: %w", err)
+	}
+	if eq, eqErr := spk.GetEQProfileV2(ctx); eqErr == nil {
+		state.EQ = &eq
+	}
+
+	if source != kefw2.SourceWiFi {
+		return state, nil
+	}
+
+	airable := kefw2.NewAirableClient(spk)
+	state.PlayMode, _ = airable.GetPlayMode()
+	if queue, queueErr := airable.GetPlayQueue(); queueErr == nil {
+		state.Queue = append([]kefw2.ContentItem(nil), queue.Rows...)
+	}
+
+	pd, err := spk.PlayerData(ctx)
+	if err != nil || pd.State == kefw2.PlayerStateStopped || pd.TrackRoles.Title == "" {
+		return state, nil
+	}
+
+	state.Playing = pd.State == kefw2.PlayerStatePlaying
+	state.Current = currentItem(pd, state.Queue)
+	if !state.Current.Live {
+		state.Position, _ = spk.SongProgressMS(ctx)
+	}
+
+	return state, nil
+}
+
+// currentItem builds the Item for the track in pd, locating it in queue by
+// path first and by title as a fallback.
+func currentItem(pd kefw2.PlayerData, queue []kefw2.ContentItem) *Item {
+	item := &Item{
+		Title:      pd.TrackRoles.Title,
+		Artist:     pd.TrackRoles.MediaData.MetaData.Artist,
+		Album:      pd.TrackRoles.MediaData.MetaData.Album,
+		Icon:       pd.TrackRoles.Icon,
+		Path:       pd.TrackRoles.Path,
+		AudioType:  pd.MediaRoles.AudioType,
+		ServiceID:  pd.MediaRoles.MediaData.MetaData.ServiceID,
+		Live:       pd.MediaRoles.MediaData.MetaData.Live,
+		QueueIndex: -1,
+	}
+	if res := pd.MediaRoles.MediaData.Resources; len(res) > 0 {
+		item.URI = res[0].URI
+		item.MimeType = res[0].MimeType
+	}
+
+	for i := range queue {
+		if item.Path != "" && queue[i].Path == item.Path {
+			item.QueueIndex = i
+			return item
+		}
+	}
+	for i := range queue {
+		if queue[i].Title == item.Title {
+			item.QueueIndex = i
+			break
+		}
+	}
+	return item
+}
+
+// Recall applies state to the speaker. Steps run in a safe order: power and
+// source first, then mute and volume (so playback never starts louder than
+// the scene), then EQ, queue, play mode, the current item and its position.
+// Every step is reported; a failed step does not stop later steps unless they
+// depend on it. The volume is set with setVolume, so quiet hours apply.
+func Recall(ctx context.Context, spk *kefw2.KEFSpeaker, state State, setVolume speaker.VolumeSetter) []Step {
+	var steps []Step
+	report := func(step, status, detail string) {
+		steps = append(steps, Step{Step: step, Status: status, Detail: detail})
+	}
+
+	current, err := spk.Source(ctx)
+	if err != nil {
+		report("power", StepFailed, "failed to get source: "+err.Error())
+		return steps
+	}
+
+	// Power
+	if !state.PoweredOn {
+		if current == kefw2.SourceStandby {
+			report("power", StepOK, "already in standby")
+			return steps
+		}
+		if err := spk.PowerOff(ctx); err != nil {
+			report("power", StepFailed, err.Error())
+		} else {
+			report("power", StepOK, "standby")
+		}
+		return steps
+	}
+
+	target := kefw2.Source(state.Source)
+	if target == "" || target == kefw2.SourceStandby {
+		target = kefw2.SourceWiFi
+	}
+
+	if current == kefw2.SourceStandby {
+		if err := wake(ctx, spk, target); err != nil {
+			report("power", StepFailed, err.Error())
+			return steps
+		}
+		report("power", StepOK, "woke from standby")
+		current = target
+	} else {
+		report("power", StepOK, "already on")
+	}
+
+	// Source
+	if current == target {
+		report("source", StepOK, "already "+string(target))
+	} else if err := spk.SetSource(ctx, target); err != nil {
+		report("source", StepFailed, err.Error())
+	} else {
+		report("source", StepOK, string(target))
+	}
+
+	// Mute before volume when muting, volume before unmuting
+	if state.Muted {
+		recallMute(ctx, spk, true, report)
+		recallVolume(ctx, setVolume, state.Volume, report)
+	} else {
+		recallVolume(ctx, setVolume, state.Volume, report)
+		recallMute(ctx, spk, false, report)
+	}
+
+	recallEQ(ctx, spk, state.EQ, report)
+
+	if target != kefw2.SourceWiFi {
+		detail := "source " + string(target) + " has no queue"
+		report("queue", StepSkipped, detail)
+		report("playMode", StepSkipped, detail)
+		report("current", StepSkipped, detail)
+		return steps
+	}
+
+	airable := kefw2.NewAirableClient(spk)
+
+	// Queue
+	queueLoaded := false
+	switch {
+	case len(state.Queue) == 0:
+		report("queue", StepSkipped, "scene has no queue")
+	default:
+		if err := airable.ClearPlaylist(); err != nil {
+			report("queue", StepFailed, "failed to clear queue: "+err.Error())
+			break
+		}
+		if err := airable.AddToQueue(state.Queue, false); err != nil {
+			report("queue", StepFailed, err.Error())
+			break
+		}
+		queueLoaded = true
+		report("queue", StepOK, fmt.Sprintf("%d tracks", len(state.Queue)))
+	}
+
+	// Play mode
+	if state.PlayMode == "" {
+		report("playMode", StepSkipped, "not captured")
+	} else if err := airable.SetPlayMode(state.PlayMode); err != nil {
+		report("playMode", StepFailed, err.Error())
+	} else {
+		report("playMode", StepOK, state.PlayMode)
+	}
+
+	recallCurrent(ctx, spk, airable, state, queueLoaded, report)
+
+	return steps
+}
+
+// wake switches a speaker out of standby and waits for it to come up.
+func wake(ctx context.Context, spk *kefw2.KEFSpeaker, source kefw2.Source) error {
+	if err := spk.SetSource(ctx, source); err != nil {
+		return fmt.Errorf("failed to power on: %w", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+		if s, err := spk.Source(ctx); err == nil && s != kefw2.SourceStandby {
+			// Give the player subsystem a moment to initialize
+			time.Sleep(1 * time.Second)
+			return nil
+		}
+	}
+	return fmt.Errorf("speaker did not wake up within 10s")
+}
+
+func recallMute(ctx context.Context, spk *kefw2.KEFSpeaker, muted bool, report func(step, status, detail string)) {
+	var err error
+	if muted {
+		err = spk.Mute(ctx)
+	} else {
+		err = spk.Unmute(ctx)
+	}
+	if err != nil {
+		report("mute", StepFailed, err.Error())
+		return
+	}
+	report("mute", StepOK, fmt.Sprintf("muted=%t", muted))
+}
+
+func recallVolume(ctx context.Context, setVolume speaker.VolumeSetter, volume int, report func(step, status, detail string)) {
+	set, err := setVolume(ctx, volume)
+	if err != nil {
+		report("volume", StepFailed, err.Error())
+		return
+	}
+	if set < volume {
+		report("volume", StepOK, fmt.Sprintf("%d (limited from %d by quiet hours)", set, volume))
+		return
+	}
+	report("volume", StepOK, fmt.Sprintf("%d", volume))
+}
+
+// recallEQ checks the EQ profile. The speaker API only exposes EQ profiles
+// for reading, so a different profile is reported rather than applied.
+func recallEQ(ctx context.Context, spk *kefw2.KEFSpeaker, eq *kefw2.EQProfileV2, report func(step, status, detail string)) {
+	if eq == nil {
+		report("eq", StepSkipped, "not captured")
+		return
+	}
+
+	current, err := spk.GetEQProfileV2(ctx)
+	if err != nil {
+		report("eq", StepFailed, "failed to get EQ profile: "+err.Error())
+		return
+	}
+	if current == *eq {
+		report("eq", StepOK, "profile "+eq.ProfileName+" already active")
+		return
+	}
+	report("eq", StepSkipped, "EQ profiles cannot be set through the speaker API; select "+eq.ProfileName+" in the KEF Connect app")
+}
+
+// recallCurrent restarts the current item, seeks to its position and pauses
+// again if the scene was captured while paused.
+func recallCurrent(ctx context.Context, spk *kefw2.KEFSpeaker, airable *kefw2.AirableClient, state State, queueLoaded bool, report func(step, status, detail string)) {
+	item := state.Current
+	if item == nil {
+		report("current", StepSkipped, "nothing was playing")
+		return
+	}
+	if !state.Playing && state.Position == 0 {
+		report("current", StepSkipped, "playback was stopped")
+		return
+	}
+
+	var err error
+	switch {
+	case item.QueueIndex >= 0 && item.QueueIndex < len(state.Queue):
+		if !queueLoaded {
+			report("current", StepSkipped, "queue was not restored")
+			return
+		}
+		err = airable.PlayQueueIndex(item.QueueIndex, &state.Queue[item.QueueIndex])
+	case strings.HasPrefix(item.Path, "airable:"):
+		err = airable.PlayRadioByPath(item.Path)
+	case item.URI != "":
+		err = airable.PlayUPnPTracks([]kefw2.ContentItem{streamItem(item)})
+	default:
+		report("current", StepSkipped, "item cannot be replayed")
+		return
+	}
+	if err != nil {
+		report("current", StepFailed, err.Error())
+		return
+	}
+	report("current", StepOK, item.Title)
+
+	if !waitForPlayback(ctx, spk) {
+		report("position", StepFailed, "playback did not start")
+		return
+	}
+
+	if item.Live || state.Position == 0 {
+		report("position", StepSkipped, "live stream or start of track")
+	} else if err := spk.SeekTo(ctx, int64(state.Position)); err != nil {
+		report("position", StepFailed, err.Error())
+	} else {
+		report("position", StepOK, fmt.Sprintf("%dms", state.Position))
+	}
+
+	if !state.Playing {
+		if err := spk.PlayPause(ctx); err != nil {
+			report("pause", StepFailed, err.Error())
+		} else {
+			report("pause", StepOK, "paused")
+		}
+	}
+}
+
+// waitForPlayback polls the player until it reports playing.
+func waitForPlayback(ctx context.Context, spk *kefw2.KEFSpeaker) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if pd, err := spk.PlayerData(ctx); err == nil && pd.State == kefw2.PlayerStatePlaying {
+			return true
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return false
+}
+
+// streamItem rebuilds a playable item for a direct stream or file URL.
+func streamItem(item *Item) kefw2.ContentItem {
+	serviceID := item.ServiceID
+	if serviceID == "" {
+		serviceID = "UPnP"
+	}
+	return kefw2.ContentItem{
+		Title:     item.Title,
+		Type:      "audio",
+		Path:      item.URI,
+		Icon:      item.Icon,
+		AudioType: item.AudioType,
+		MediaData: &kefw2.MediaData{
+			MetaData: kefw2.MediaMetaData{
+				Artist:    item.Artist,
+				Album:     item.Album,
+				ServiceID: serviceID,
+				Live:      item.Live,
+			},
+			Resources: []kefw2.MediaResource{
+				{
+					URI:      item.URI,
+					MimeType: item.MimeType,
+				},
+			},
+		},
+	}
+}
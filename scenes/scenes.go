@@ -0,0 +1,248 @@
+// Package scenes manages named speaker state snapshots for kefw2ui.
+//
+// A scene records everything needed to bring the speaker back to a known
+// state with one call ("Movie night", "Dinner"): power, source, volume, mute,
+// EQ profile, play mode, the queue, and the current item and position.
+package scenes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/ids"
+)
+
+// State is a snapshot of the speaker state.
+type State struct {
+	PoweredOn bool                `json:"poweredOn"`
+	Source    string              `json:"source"`
+	Volume    int                 `json:"volume"`
+	Muted     bool                `json:"muted"`
+	EQ        *kefw2.EQProfileV2  `json:"eq,omitempty"`
+	PlayMode  string              `json:"playMode,omitempty"`
+	Queue     []kefw2.ContentItem `json:"queue,omitempty"`
+	Current   *Item               `json:"current,omitempty"`
+	Position  int                 `json:"position,omitempty"` // milliseconds
+	Playing   bool                `json:"playing"`
+}
+
+// Item is the item that was playing when a scene was captured.
+type Item struct {
+	Title      string `json:"title"`
+	Artist     string `json:"artist,omitempty"`
+	Album      string `json:"album,omitempty"`
+	Icon       string `json:"icon,omitempty"`
+	Path       string `json:"path,omitempty"`
+	AudioType  string `json:"audioType,omitempty"`
+	ServiceID  string `json:"serviceId,omitempty"`
+	URI        string `json:"uri,omitempty"`
+	MimeType   string `json:"mimeType,omitempty"`
+	Live       bool   `json:"live,omitempty"`
+	QueueIndex int    `json:"queueIndex"` // -1 when not playing from the queue
+}
+
+// Scene is a named speaker state.
+type Scene struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	State       State     `json:"state"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Manager handles scene storage and retrieval.
+type Manager struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewManager creates a new scene manager.
+func NewManager() (*Manager, error) {
+	path, err := config.ScenesPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scenes path: %w", err)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return &Manager{path: path}, nil
+}
+
+// List returns all scenes in the order they were created.
+func (m *Manager) List() ([]Scene, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.load()
+}
+
+// Get retrieves a scene by ID.
+func (m *Manager) Get(id string) (*Scene, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scenes, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range scenes {
+		if scenes[i].ID == id {
+			return &scenes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("scene not found: %s", id)
+}
+
+// Save stores state under name. An existing scene with the same name is
+// overwritten, so capturing "Dinner" twice keeps a single scene.
+func (m *Manager) Save(name, description string, state State) (*Scene, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("scene name is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scenes, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range scenes {
+		if !strings.EqualFold(scenes[i].Name, name) {
+			continue
+		}
+		sc := &scenes[i]
+		if description != "" {
+			sc.Description = description
+		}
+		sc.State = state
+		sc.UpdatedAt = now
+		if err := m.save(scenes); err != nil {
+			return nil, err
+		}
+		return sc, nil
+	}
+
+	id := ids.FromName(name, "scene")
+	for _, sc := range scenes {
+		if sc.ID == id {
+			id = fmt.Sprintf("%s-%d", id, now.Unix())
+			break
+		}
+	}
+
+	scene := Scene{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		State:       state,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	scenes = append(scenes, scene)
+	if err := m.save(scenes); err != nil {
+		return nil, err
+	}
+
+	return &scene, nil
+}
+
+// Rename changes a scene's name and description. Empty values leave the
+// current value unchanged.
+func (m *Manager) Rename(id, name, description string) (*Scene, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scenes, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range scenes {
+		if scenes[i].ID != id {
+			continue
+		}
+		sc := &scenes[i]
+		if name = strings.TrimSpace(name); name != "" {
+			sc.Name = name
+		}
+		if description != "" {
+			sc.Description = description
+		}
+		sc.UpdatedAt = time.Now()
+		if err := m.save(scenes); err != nil {
+			return nil, err
+		}
+		return sc, nil
+	}
+
+	return nil, fmt.Errorf("scene not found: %s", id)
+}
+
+// Delete removes a scene.
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scenes, err := m.load()
+	if err != nil {
+		return err
+	}
+
+	for i := range scenes {
+		if scenes[i].ID == id {
+			scenes = append(scenes[:i], scenes[i+1:]...)
+			return m.save(scenes)
+		}
+	}
+
+	return fmt.Errorf("scene not found: %s", id)
+}
+
+// load reads all scenes from disk. Caller must hold m.mu.
+func (m *Manager) load() ([]Scene, error) {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Scene{}, nil
+		}
+		return nil, fmt.Errorf("failed to read scenes: %w", err)
+	}
+
+	var scenes []Scene
+	if err := json.Unmarshal(data, &scenes); err != nil {
+		return nil, fmt.Errorf("failed to parse scenes: %w", err)
+	}
+
+	return scenes, nil
+}
+
+// save writes all scenes to disk. Caller must hold m.mu.
+func (m *Manager) save(scenes []Scene) error {
+	data, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scenes: %w", err)
+	}
+
+	if err := os.WriteFile(m.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write scenes: %w", err)
+	}
+
+	return nil
+}
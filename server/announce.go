@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/announce"
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// announceRequest is the request body for POST /api/announce. Exactly one of
+// Clip (a clip library file name) or URL must be set.
+type announceRequest struct {
+	Clip        string `json:"clip"`
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	MimeType    string `json:"mimeType"`
+	Volume      int    `json:"volume"`
+	MaxDuration int    `json:"maxDuration"` // seconds
+}
+
+// BroadcastAnnouncement sends an "announcement" SSE event with the outcome of
+// an announcement, including the restore step report.
+func (s *Server) BroadcastAnnouncement(result *announce.Result) {
+	s.publish(AnnouncementMade{result})
+}
+
+// BroadcastClipsChanged sends a "clips" SSE event so clients can refresh the
+// clip library.
+func (s *Server) BroadcastClipsChanged() {
+	s.publish(ClipsChanged{})
+}
+
+// MediaBaseURL returns the base URL at which spk can fetch audio served by
+// kefw2ui (announcement clips and local music files).
+func (s *Server) MediaBaseURL(spk *kefw2.KEFSpeaker) (string, error) {
+	return announce.BaseURL(s.opts.PublicURL, spk.IPAddress, s.opts.Port)
+}
+
+// handleAnnounce plays a clip on the active speaker and restores the previous
+// state afterwards. The request returns once the state has been restored.
+func (s *Server) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spk := s.manager.GetActiveSpeaker()
+	if spk == nil {
+		s.jsonError(w, "No active speaker", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req announceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	playReq := announce.Request{
+		URL:         req.URL,
+		Title:       req.Title,
+		MimeType:    req.MimeType,
+		Volume:      req.Volume,
+		MaxDuration: time.Duration(req.MaxDuration) * time.Second,
+	}
+
+	switch {
+	case req.Clip != "" && req.URL != "":
+		s.jsonError(w, "Set either clip or url, not both", http.StatusBadRequest)
+		return
+	case req.Clip != "":
+		if s.clips == nil {
+			s.jsonError(w, "Clip library not available", http.StatusServiceUnavailable)
+			return
+		}
+		clip, err := s.clips.Get(req.Clip)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		baseURL, err := s.MediaBaseURL(spk)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		playReq.URL = announce.ClipURL(baseURL, clip.Name)
+		playReq.MimeType = clip.MimeType
+		if playReq.Title == "" {
+			playReq.Title = clip.Name
+		}
+	case req.URL == "":
+		s.jsonError(w, "clip or url is required", http.StatusBadRequest)
+		return
+	}
+
+	// Restoring the previous state must finish even if the client goes away
+	ctx := context.WithoutCancel(r.Context())
+
+	result, err := s.announcer.Play(ctx, spk, playReq)
+	if result != nil {
+		s.BroadcastAnnouncement(result)
+	}
+	if err != nil {
+		s.jsonError(w, "Failed to announce: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":       "ok",
+		"announcement": result,
+	})
+}
+
+// handleClips handles listing clips and uploading new ones.
+//   - GET /api/clips
+//   - POST /api/clips - multipart form with a "file" field and optional "name"
+func (s *Server) handleClips(w http.ResponseWriter, r *http.Request) {
+	if s.clips == nil {
+		s.jsonError(w, "Clip library not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.clips.List()
+		if err != nil {
+			s.jsonError(w, "Failed to list clips: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"clips": list,
+		})
+
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, announce.MaxClipSize+1<<20)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			s.jsonError(w, "A clip must be uploaded in the \"file\" form field", http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = file.Close() }()
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			name = header.Filename
+		}
+		if err := announce.ValidateName(name); err != nil {
+			s.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		clip, err := s.clips.Save(name, file)
+		if err != nil {
+			s.jsonError(w, "Failed to save clip: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.BroadcastClipsChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"clip": clip,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleClip serves or deletes a single clip. GET returns the audio itself,
+// which is also how the speaker fetches clips during an announcement.
+//   - GET /api/clips/{name}
+//   - DELETE /api/clips/{name}
+func (s *Server) handleClip(w http.ResponseWriter, r *http.Request) {
+	if s.clips == nil {
+		s.jsonError(w, "Clip library not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/clips/")
+	if err := announce.ValidateName(name); err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		path, err := s.clips.Path(name)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, err := os.Open(path) //nolint:gosec // name is validated to stay inside the clip directory
+		if err != nil {
+			s.jsonError(w, "clip not found: "+name, http.StatusNotFound)
+			return
+		}
+		defer func() { _ = f.Close() }()
+
+		info, err := f.Stat()
+		if err != nil {
+			s.jsonError(w, "Failed to read clip: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", stations.GuessMimeType(name))
+		http.ServeContent(w, r, name, info.ModTime(), f)
+
+	case http.MethodDelete:
+		if err := s.clips.Delete(name); err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s.BroadcastClipsChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/auth"
+	"github.com/hilli/kefw2ui/renderer"
+)
+
+const (
+	// maxAuditBody is the largest request body recorded as parameters
+	maxAuditBody = 16 << 10
+
+	// maxAuditError is how much of an error response is kept
+	maxAuditError = 1 << 10
+)
+
+// redactedParams are never written to the audit log. p, t and s are
+// Subsonic credentials.
+var redactedParams = []string{"password", "secret", "token", "apiKey", "p", "t", "s"}
+
+// auditResponseWriter captures the status and the start of error responses.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (aw *auditResponseWriter) WriteHeader(code int) {
+	aw.status = code
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *auditResponseWriter) Write(b []byte) (int, error) {
+	if aw.status >= http.StatusBadRequest && aw.body.Len() < maxAuditError {
+		aw.body.Write(b[:min(len(b), maxAuditError-aw.body.Len())])
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher for streamed responses.
+func (aw *auditResponseWriter) Flush() {
+	if flusher, ok := aw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// errorMessage returns the "error" of a JSON error response, or the text.
+func errorMessage(status int, body []byte) string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	if text := strings.TrimSpace(string(body)); text != "" {
+		return text
+	}
+	return http.StatusText(status)
+}
+
+// auditMiddleware records state-changing requests in the audit log, and
+// makes the caller available to MCP tools, which are recorded one call at
+// a time.
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := requestCaller(r)
+		r = r.WithContext(audit.WithCaller(r.Context(), caller))
+		if s.audit == nil || !auditable(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.audit.NoteLocalChange()
+		entry := audit.Entry{
+			Source: audit.SourceAPI,
+			Action: r.Method + " " + r.URL.Path,
+			Params: requestParams(r),
+			Caller: caller,
+		}
+
+		aw := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r)
+
+		entry.Status = aw.status
+		if aw.status >= http.StatusBadRequest {
+			entry.Error = errorMessage(aw.status, aw.body.Bytes())
+		}
+		s.audit.Record(entry)
+	})
+}
+
+// auditable reports whether a request changes state.
+func auditable(r *http.Request) bool {
+	p := r.URL.Path
+	switch {
+	// Subsonic apps control the speaker with GET requests
+	case strings.HasPrefix(p, "/rest/"):
+		if !strings.HasPrefix(p, "/rest/jukeboxControl") || r.ParseForm() != nil {
+			return false
+		}
+		action := r.Form.Get("action")
+		return action != "" && action != "get" && action != "status"
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return false
+
+	// Casting apps poll with Get* SOAP actions
+	case strings.HasPrefix(p, renderer.BasePath):
+		return r.Method == http.MethodPost && !strings.HasPrefix(soapAction(r), "Get")
+
+	// Tool calls are recorded by the MCP server
+	case p == "/api/mcp":
+		return false
+	}
+	return strings.HasPrefix(p, "/api/")
+}
+
+// soapAction returns the action name of a UPnP control request.
+func soapAction(r *http.Request) string {
+	header := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	_, action, _ := strings.Cut(header, "#")
+	return action
+}
+
+// requestParams returns the query and body parameters of a request, without
+// credentials. Bodies are only read when small JSON or form data.
+func requestParams(r *http.Request) map[string]any {
+	params := map[string]any{}
+	addValues := func(values url.Values) {
+		for key, v := range values {
+			if len(v) == 1 {
+				params[key] = v[0]
+			} else {
+				params[key] = v
+			}
+		}
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/rest/") {
+		addValues(r.Form) // parsed by auditable
+	} else {
+		addValues(r.URL.Query())
+	}
+	if action := soapAction(r); action != "" {
+		params["soapAction"] = action
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	isJSON := strings.HasPrefix(contentType, "application/json")
+	isForm := strings.HasPrefix(contentType, "application/x-www-form-urlencoded")
+	if r.Body != nil && r.ContentLength <= maxAuditBody && (isJSON || isForm) && !strings.HasPrefix(r.URL.Path, "/rest/") {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err == nil && len(body) <= maxAuditBody {
+			if isJSON {
+				var fields map[string]any
+				if json.Unmarshal(body, &fields) == nil {
+					for key, v := range fields {
+						params[key] = v
+					}
+				} else if len(bytes.TrimSpace(body)) > 0 {
+					params["body"] = string(body)
+				}
+			} else if values, err := url.ParseQuery(string(body)); err == nil {
+				addValues(values)
+			}
+		}
+	}
+
+	for key := range params {
+		if slices.Contains(redactedParams, key) {
+			params[key] = "[redacted]"
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// requestCaller describes who made a request.
+func requestCaller(r *http.Request) audit.Caller {
+	c := audit.Caller{IP: r.RemoteAddr}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		c.IP = host
+	}
+	if id := auth.FromContext(r.Context()); id != nil {
+		c.Name, c.Method, c.Role, c.Node = id.Name, id.Method, string(id.Role), id.Node
+	}
+	return c
+}
+
+// auditSystem records a change kefw2ui made on its own.
+func (s *Server) auditSystem(action string, params map[string]any, err error) {
+	if s.audit == nil {
+		return
+	}
+	entry := audit.Entry{Source: audit.SourceSystem, Action: action, Params: params}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.audit.Record(entry)
+}
+
+// parseAuditTime parses an RFC 3339 time, or a duration meaning that long
+// ago ("24h").
+func parseAuditTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleAudit queries the audit log, newest first.
+//   - GET /api/audit?since=24h&action=volume&caller=alice&source=mcp&speaker=&result=error&limit=100
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.audit == nil {
+		s.jsonError(w, "Audit log not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Source:  q.Get("source"),
+		Action:  q.Get("action"),
+		Caller:  q.Get("caller"),
+		Speaker: q.Get("speaker"),
+		Result:  q.Get("result"),
+	}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = parseAuditTime(v); err != nil {
+			s.jsonError(w, "Invalid since: use RFC 3339 or a duration like 24h", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = parseAuditTime(v); err != nil {
+			s.jsonError(w, "Invalid until: use RFC 3339 or a duration like 1h", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 {
+			s.jsonError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		s.jsonError(w, "Failed to read audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
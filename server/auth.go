@@ -0,0 +1,583 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hilli/kefw2ui/auth"
+	"github.com/hilli/kefw2ui/renderer"
+)
+
+// sessionCookie holds the login session ID.
+const sessionCookie = "kefw2ui_session"
+
+// adminPrefixes are the API paths whose changes need the admin role. Reads
+// need the viewer role, like the rest of the API.
+var adminPrefixes = []string{
+	"/api/settings", "/api/speakers", "/api/speaker", "/api/upnp/",
+	"/api/rules", "/api/music/rescan",
+}
+
+// requiredRole returns the role needed for a request. Public requests need
+// no authentication at all.
+func requiredRole(r *http.Request) (role auth.Role, public bool) {
+	p := r.URL.Path
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	switch {
+	case p == "/api/health", p == "/login",
+		p == "/api/auth/login", p == "/api/auth/logout", p == "/api/auth/me":
+		return "", true
+
+	// The speaker fetches clips and music files without credentials
+	case read && (strings.HasPrefix(p, "/api/clips/") ||
+		strings.HasPrefix(p, "/api/music/files/") ||
+		strings.HasPrefix(p, "/api/music/art/")):
+		return "", true
+
+	// UPnP control points can't authenticate, but only the renderer's
+	// descriptions are public. Control and event subscriptions need a
+	// controller, so casting without credentials takes
+	// --auth-anonymous-role controller (or a Tailscale role).
+	case read && (p == renderer.BasePath+"description.xml" ||
+		strings.HasPrefix(p, renderer.BasePath) && strings.HasSuffix(p, "/scpd.xml")):
+		return "", true
+	case strings.HasPrefix(p, renderer.BasePath):
+		return auth.RoleController, false
+
+	// Frontend files; pages redirect to /login in authMiddleware
+	case !strings.HasPrefix(p, "/api/") && !strings.HasPrefix(p, "/rest/") && p != "/events" && p != "/ws":
+		return "", true
+
+	// Tokens, webhook secrets and everyone's audit entries are visible to
+	// readers, so these APIs are admin-only
+	case strings.HasPrefix(p, "/api/auth/"), strings.HasPrefix(p, "/api/webhooks"), p == "/api/audit":
+		return auth.RoleAdmin, false
+
+	// MCP tools check the role per call
+	case p == "/api/mcp":
+		return auth.RoleViewer, false
+
+	case strings.HasPrefix(p, "/rest/"):
+		if strings.HasPrefix(p, "/rest/jukeboxControl") {
+			return auth.RoleController, false
+		}
+		return auth.RoleViewer, false
+
+	case read:
+		return auth.RoleViewer, false
+	}
+
+	for _, prefix := range adminPrefixes {
+		if strings.HasPrefix(p, prefix) {
+			return auth.RoleAdmin, false
+		}
+	}
+	return auth.RoleController, false
+}
+
+// authMiddleware identifies the caller and enforces the role the request
+// needs. Requests pass through untouched when authentication is disabled and
+// no outer middleware (the Tailscale listener) identified the caller.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := auth.FromContext(r.Context())
+		if s.auth == nil && id == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Tailnet callers without an ACL role may still sign in
+		if s.auth != nil && (id == nil || id.Role == "") {
+			if cred := s.authenticate(r); cred != nil {
+				id = cred
+			}
+		}
+		if id != nil {
+			r = r.WithContext(auth.WithIdentity(r.Context(), id))
+			if lrw, ok := w.(*loggingResponseWriter); ok {
+				lrw.identity = id
+			}
+		}
+
+		required, public := requiredRole(r)
+		switch {
+		case public:
+			if s.auth != nil && (id == nil || id.Role == "") && isPageRequest(r) {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			next.ServeHTTP(w, r)
+
+		case id == nil:
+			if strings.HasPrefix(r.URL.Path, "/rest/") {
+				s.writeSubsonic(w, &subsonicRequest{r: r, format: r.FormValue("f")}, subsonicAuthFailed(r))
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kefw2ui"`)
+			s.jsonError(w, "Authentication required", http.StatusUnauthorized)
+
+		case !id.Role.Allows(required):
+			if strings.HasPrefix(r.URL.Path, "/rest/") {
+				s.writeSubsonic(w, &subsonicRequest{r: r, format: r.FormValue("f")},
+					subsonicFailed(50, "User is not authorized for the given operation"))
+				return
+			}
+			s.jsonError(w, "Forbidden: requires the "+string(required)+" role", http.StatusForbidden)
+
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authenticate returns the caller's identity from an API token, a session
+// cookie or Subsonic credentials, or the anonymous role when configured.
+func (s *Server) authenticate(r *http.Request) *auth.Identity {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return s.auth.AuthenticateToken(strings.TrimSpace(token))
+	}
+	if token := r.Header.Get("X-API-Key"); token != "" {
+		return s.auth.AuthenticateToken(token)
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if id := s.auth.Session(c.Value); id != nil {
+			return id
+		}
+	}
+	if strings.HasPrefix(r.URL.Path, "/rest/") {
+		if id := s.subsonicIdentity(r); id != nil {
+			return id
+		}
+	}
+	return s.anonymous()
+}
+
+// anonymous returns the identity of callers without credentials, or nil
+// unless --auth-anonymous-role is set.
+func (s *Server) anonymous() *auth.Identity {
+	if s.opts.AuthAnonymousRole == "" {
+		return nil
+	}
+	return &auth.Identity{Name: "anonymous", Role: s.opts.AuthAnonymousRole, Method: auth.MethodAnonymous}
+}
+
+// mpdIdentity checks the password an MPD client sends: an API token, or a
+// local user as "username:password".
+func (s *Server) mpdIdentity(password string) *auth.Identity {
+	if id := s.auth.AuthenticateToken(password); id != nil {
+		return id
+	}
+	username, pass, ok := strings.Cut(password, ":")
+	if !ok {
+		return nil
+	}
+	id, err := s.auth.CheckPassword(username, pass)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// subsonicIdentity checks Subsonic credentials: an OpenSubsonic apiKey
+// (an API token), or a username and password (u and p, optionally
+// "enc:"-hex encoded). Token authentication (t and s) needs the plain
+// password and isn't supported.
+func (s *Server) subsonicIdentity(r *http.Request) *auth.Identity {
+	if err := r.ParseForm(); err != nil {
+		return nil
+	}
+	if key := r.Form.Get("apiKey"); key != "" {
+		return s.auth.AuthenticateToken(key)
+	}
+	username, password := r.Form.Get("u"), r.Form.Get("p")
+	if username == "" || password == "" {
+		return nil
+	}
+	if encoded, ok := strings.CutPrefix(password, "enc:"); ok {
+		decoded, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil
+		}
+		password = string(decoded)
+	}
+	id, err := s.auth.CheckPassword(username, password)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// subsonicAuthFailed returns the error for Subsonic credentials that were
+// missing or rejected. Passwords are stored hashed, so salted token logins
+// can't be checked; clients are told so, rather than that the password is
+// wrong.
+func subsonicAuthFailed(r *http.Request) *subsonicResponse {
+	if r.FormValue("t") != "" && r.FormValue("p") == "" && r.FormValue("apiKey") == "" {
+		return subsonicFailed(42, "Token authentication is not supported; use a password or an API key")
+	}
+	return subsonicFailed(40, "Wrong username or password")
+}
+
+// isPageRequest reports whether a request is a browser navigating to a
+// frontend page (rather than fetching an asset).
+func isPageRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		r.URL.Path != "/login" &&
+		!strings.HasPrefix(r.URL.Path, "/api/") &&
+		!strings.HasPrefix(r.URL.Path, renderer.BasePath) &&
+		path.Ext(r.URL.Path) == "" &&
+		strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// safeRedirect returns target when it is a local path, "/" otherwise.
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+// loginPage is the server-rendered login form shown when authentication is
+// enabled.
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>kefw2ui - Sign in</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #111; color: #eee; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+form { background: #1c1c1c; padding: 2rem; border-radius: 12px; width: 18rem; display: flex; flex-direction: column; gap: 0.75rem; }
+input { padding: 0.6rem; border-radius: 6px; border: 1px solid #333; background: #111; color: #eee; }
+button { padding: 0.6rem; border: 0; border-radius: 6px; background: #3b82f6; color: #fff; cursor: pointer; }
+.error { color: #f87171; font-size: 0.9rem; }
+</style>
+</head>
+<body>
+<form method="post" action="/api/auth/login">
+<h1>kefw2ui</h1>
+{{if .Error}}<div class="error">Invalid username or password</div>{{end}}
+<input type="hidden" name="next" value="{{.Next}}">
+<input name="username" placeholder="Username" autocomplete="username" required autofocus>
+<input name="password" type="password" placeholder="Password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// handleLogin serves the login form.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.auth == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = loginPage.Execute(w, map[string]any{
+		"Next":  safeRedirect(r.URL.Query().Get("next")),
+		"Error": r.URL.Query().Has("error"),
+	})
+}
+
+// loginRequest is the request body for logging in.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// handleAuthLogin checks a username and password and sets the session
+// cookie. It accepts JSON, or the login form, which is redirected back to
+// the page it came from.
+func (s *Server) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.auth == nil {
+		s.jsonError(w, "Authentication is disabled", http.StatusNotFound)
+		return
+	}
+
+	var req loginRequest
+	form := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if form {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		req.Username, req.Password = r.PostForm.Get("username"), r.PostForm.Get("password")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, sessionID, expires, err := s.auth.Login(req.Username, req.Password)
+	if err != nil {
+		if form {
+			next := safeRedirect(r.PostForm.Get("next"))
+			http.Redirect(w, r, "/login?error=1&next="+url.QueryEscape(next), http.StatusSeeOther)
+			return
+		}
+		s.jsonError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sessionID,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if form {
+		http.Redirect(w, r, safeRedirect(r.PostForm.Get("next")), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"identity": id,
+		"expires":  expires,
+	})
+}
+
+// handleAuthLogout ends the session and clears the cookie.
+func (s *Server) handleAuthLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if c, err := r.Cookie(sessionCookie); err == nil && s.auth != nil {
+		s.auth.Logout(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
+}
+
+// handleAuthMe reports whether authentication is enabled and who the caller
+// is (null when not signed in).
+func (s *Server) handleAuthMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"enabled":  s.auth != nil,
+		"identity": auth.FromContext(r.Context()),
+	})
+}
+
+// tokenRequest is the request body for creating an API token.
+type tokenRequest struct {
+	Name string    `json:"name"`
+	Role auth.Role `json:"role"`
+}
+
+// handleAuthTokens handles listing and creating API tokens. The token value
+// is only returned when it is created.
+func (s *Server) handleAuthTokens(w http.ResponseWriter, r *http.Request) {
+	if s.auth == nil {
+		s.jsonError(w, "Authentication is disabled (start with --auth)", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"tokens": s.auth.Tokens(),
+			"roles":  auth.Roles,
+		})
+
+	case http.MethodPost:
+		var req tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		token, value, err := s.auth.CreateToken(req.Name, req.Role)
+		if err != nil {
+			s.jsonError(w, "Failed to create token: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token": token,
+			"value": value,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAuthToken revokes a token: DELETE /api/auth/tokens/{id}.
+func (s *Server) handleAuthToken(w http.ResponseWriter, r *http.Request) {
+	if s.auth == nil {
+		s.jsonError(w, "Authentication is disabled (start with --auth)", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/auth/tokens/")
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.auth.DeleteToken(id); err != nil {
+		s.jsonError(w, "Failed to delete token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
+}
+
+// userRequest is the request body for creating or updating a user. Empty
+// fields are left unchanged on update.
+type userRequest struct {
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Role     auth.Role `json:"role"`
+}
+
+// handleAuthUsers handles listing and creating local users.
+func (s *Server) handleAuthUsers(w http.ResponseWriter, r *http.Request) {
+	if s.auth == nil {
+		s.jsonError(w, "Authentication is disabled (start with --auth)", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"users": s.auth.Users(),
+			"roles": auth.Roles,
+		})
+
+	case http.MethodPost:
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		for _, u := range s.auth.Users() {
+			if u.Username == req.Username {
+				s.jsonError(w, "User already exists: "+req.Username, http.StatusConflict)
+				return
+			}
+		}
+
+		user, err := s.auth.SetUser(req.Username, req.Password, req.Role)
+		if err != nil {
+			s.jsonError(w, "Failed to create user: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"user": user,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAuthUser handles operations on a single user.
+//   - PUT /api/auth/users/{username} - {"password": "...", "role": "..."}
+//   - DELETE /api/auth/users/{username}
+func (s *Server) handleAuthUser(w http.ResponseWriter, r *http.Request) {
+	if s.auth == nil {
+		s.jsonError(w, "Authentication is disabled (start with --auth)", http.StatusServiceUnavailable)
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/api/auth/users/")
+	if username == "" || strings.Contains(username, "/") {
+		s.jsonError(w, "Invalid username", http.StatusBadRequest)
+		return
+	}
+	exists := false
+	for _, u := range s.auth.Users() {
+		exists = exists || u.Username == username
+	}
+	if !exists {
+		s.jsonError(w, "User not found: "+username, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		user, err := s.auth.SetUser(username, req.Password, req.Role)
+		if err != nil {
+			s.jsonError(w, "Failed to update user: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"user": user,
+		})
+
+	case http.MethodDelete:
+		if err := s.auth.DeleteUser(username); err != nil {
+			s.jsonError(w, "Failed to delete user: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
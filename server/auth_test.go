@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/md5" //nolint:gosec // the Subsonic token scheme
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hilli/kefw2ui/auth"
+)
+
+// newAuthServer returns a server with authentication enabled, a viewer
+// "alice" with password "password1", and a controller API token.
+func newAuthServer(t *testing.T) (s *Server, token string) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	store, err := auth.NewStore()
+	if err != nil {
+		t.Fatalf("auth.NewStore: %v", err)
+	}
+	if _, err := store.SetUser("alice", "password1", auth.RoleViewer); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if _, token, err = store.CreateToken("jukebox", auth.RoleController); err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	return &Server{auth: store}, token
+}
+
+// subsonicToken returns the Subsonic token for a password and salt.
+func subsonicToken(password, salt string) string {
+	sum := md5.Sum([]byte(password + salt)) //nolint:gosec // the Subsonic token scheme
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSubsonicIdentity(t *testing.T) {
+	s, token := newAuthServer(t)
+
+	tests := []struct {
+		name     string
+		params   url.Values
+		wantName string
+		wantRole auth.Role
+	}{
+		{"password", url.Values{"u": {"alice"}, "p": {"password1"}}, "alice", auth.RoleViewer},
+		{"hex password", url.Values{"u": {"alice"}, "p": {"enc:" + hex.EncodeToString([]byte("password1"))}}, "alice", auth.RoleViewer},
+		{"wrong password", url.Values{"u": {"alice"}, "p": {"password2"}}, "", ""},
+		{"bad hex", url.Values{"u": {"alice"}, "p": {"enc:zz"}}, "", ""},
+		{"unknown user", url.Values{"u": {"bob"}, "p": {"password1"}}, "", ""},
+		{"no password", url.Values{"u": {"alice"}}, "", ""},
+		{"api key", url.Values{"apiKey": {token}}, "jukebox", auth.RoleController},
+		{"wrong api key", url.Values{"apiKey": {token + "x"}}, "", ""},
+		{"api key wins over password", url.Values{"apiKey": {"nope"}, "u": {"alice"}, "p": {"password1"}}, "", ""},
+		{"salted token", url.Values{"u": {"alice"}, "t": {subsonicToken("password1", "c19b2d")}, "s": {"c19b2d"}}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/rest/ping.view?"+tt.params.Encode(), nil)
+			id := s.subsonicIdentity(r)
+			if tt.wantName == "" {
+				if id != nil {
+					t.Errorf("identity = %+v, want none", id)
+				}
+				return
+			}
+			if id == nil || id.Name != tt.wantName || id.Role != tt.wantRole {
+				t.Errorf("identity = %+v, want %s (%s)", id, tt.wantName, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestSubsonicAuthMiddleware(t *testing.T) {
+	s, token := newAuthServer(t)
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(auth.FromContext(r.Context()).Name))
+	}))
+
+	salt := "c19b2d"
+	tests := []struct {
+		name       string
+		path       string
+		params     url.Values
+		wantCode   int // Subsonic error code, 0 when the request is let through
+		wantCaller string
+	}{
+		{"password", "/rest/ping.view", url.Values{"u": {"alice"}, "p": {"password1"}}, 0, "alice"},
+		{"no credentials", "/rest/ping.view", url.Values{}, 40, ""},
+		{"wrong password", "/rest/ping.view", url.Values{"u": {"alice"}, "p": {"nope"}}, 40, ""},
+		{"salted token", "/rest/ping.view", url.Values{"u": {"alice"}, "t": {subsonicToken("password1", salt)}, "s": {salt}}, 42, ""},
+		{"viewer can't control", "/rest/jukeboxControl.view", url.Values{"u": {"alice"}, "p": {"password1"}, "action": {"status"}}, 50, ""},
+		{"controller token", "/rest/jukeboxControl.view", url.Values{"apiKey": {token}, "action": {"status"}}, 0, "jukebox"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.Set("f", "json")
+			r := httptest.NewRequest(http.MethodGet, tt.path+"?"+tt.params.Encode(), nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if tt.wantCode == 0 {
+				if body := w.Body.String(); body != tt.wantCaller {
+					t.Errorf("handler saw caller %q, want %q", body, tt.wantCaller)
+				}
+				return
+			}
+			var resp struct {
+				Response subsonicResponse `json:"subsonic-response"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response %q: %v", w.Body.String(), err)
+			}
+			if resp.Response.Status != "failed" || resp.Response.Error == nil || resp.Response.Error.Code != tt.wantCode {
+				t.Errorf("response = %s, want error %d", w.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+)
+
+// bookmarkPathPrefix prefixes the browse path of a UPnP folder bookmark.
+const bookmarkPathPrefix = "bookmark:"
+
+// resolveBookmark resolves a "bookmark:{id}" browse path to the API path of
+// the bookmarked container.
+func (s *Server) resolveBookmark(airable *kefw2.AirableClient, path string) (string, error) {
+	if s.opts.Config == nil {
+		return "", fmt.Errorf("config not available")
+	}
+
+	id := strings.TrimPrefix(path, bookmarkPathPrefix)
+	b := s.opts.Config.FindUPnPBookmark(id)
+	if b == nil {
+		return "", fmt.Errorf("bookmark not found: %s", id)
+	}
+
+	return resolveBookmarkContainer(airable, b, s.opts.Config.GetUPnPConfig())
+}
+
+// resolveBookmarkContainer returns the API container path for a bookmark.
+// Bookmarks with an explicit Path are used as-is; otherwise the human-readable
+// Container is resolved on the bookmark's server (or the default server).
+func resolveBookmarkContainer(airable *kefw2.AirableClient, b *config.UPnPBookmark, upnp config.UPnPConfig) (string, error) {
+	if b.Path != "" {
+		return b.Path, nil
+	}
+
+	serverPath := b.ServerPath
+	if serverPath == "" && b.ServerName != "" {
+		server, err := airable.GetMediaServerByName(b.ServerName)
+		if err != nil {
+			return "", fmt.Errorf("media server %q not found: %w", b.ServerName, err)
+		}
+		serverPath = server.Path
+	}
+	if serverPath == "" {
+		serverPath = upnp.DefaultServerPath
+	}
+	if serverPath == "" {
+		return "", fmt.Errorf("bookmark %q has no media server and no default server is set", b.Name)
+	}
+
+	resolved, _, err := kefw2.FindContainerByPath(airable, serverPath, b.Container)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve bookmark %q: %w", b.Name, err)
+	}
+	return resolved, nil
+}
+
+// bookmarkBrowseItems returns the configured bookmarks as browse items.
+func (s *Server) bookmarkBrowseItems() []BrowseItem {
+	if s.opts.Config == nil {
+		return nil
+	}
+
+	bookmarks := s.opts.Config.GetUPnPBookmarks()
+	items := make([]BrowseItem, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		description := b.Container
+		if b.ServerName != "" {
+			description = b.ServerName + " › " + b.Container
+		}
+		items = append(items, BrowseItem{
+			Title:       b.Name,
+			Type:        contentTypeContainer,
+			Path:        bookmarkPathPrefix + b.ID,
+			ID:          b.ID,
+			Description: description,
+			Playable:    true,
+		})
+	}
+	return items
+}
+
+// bookmarkRequest is the request body for creating or updating a bookmark.
+type bookmarkRequest struct {
+	Name       string `json:"name"`
+	ServerName string `json:"serverName"`
+	ServerPath string `json:"serverPath"`
+	Container  string `json:"container"`
+	Path       string `json:"path"`
+}
+
+// handleUPnPBookmarks handles listing and creating UPnP folder bookmarks.
+func (s *Server) handleUPnPBookmarks(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Config == nil {
+		s.jsonError(w, "Config not available", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"bookmarks": s.opts.Config.GetUPnPBookmarks(),
+		})
+
+	case http.MethodPost:
+		var req bookmarkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Fill in the server path from the display name while a speaker is
+		// available, so later browsing skips the server lookup.
+		if req.ServerPath == "" && req.ServerName != "" {
+			if spk := s.manager.GetActiveSpeaker(); spk != nil {
+				if server, err := s.getCachedAirableClient(spk).GetMediaServerByName(req.ServerName); err == nil {
+					req.ServerPath = server.Path
+				}
+			}
+		}
+
+		b, err := s.opts.Config.AddUPnPBookmark(config.UPnPBookmark{
+			Name:       req.Name,
+			ServerName: req.ServerName,
+			ServerPath: req.ServerPath,
+			Container:  req.Container,
+			Path:       req.Path,
+		})
+		if err != nil {
+			s.jsonError(w, "Failed to add bookmark: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"bookmark": b,
+		})
+
+	default:
+		s.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUPnPBookmark handles operations on a single bookmark.
+func (s *Server) handleUPnPBookmark(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Config == nil {
+		s.jsonError(w, "Config not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Extract bookmark ID from path: /api/upnp/bookmarks/{id}
+	id := strings.TrimPrefix(r.URL.Path, "/api/upnp/bookmarks/")
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid bookmark ID", http.StatusBadRequest)
+		return
+	}
+
+	b := s.opts.Config.FindUPnPBookmark(id)
+	if b == nil {
+		s.jsonError(w, "Bookmark not found: "+id, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"bookmark": b,
+		})
+
+	case http.MethodPut:
+		var req bookmarkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name != "" {
+			b.Name = req.Name
+		}
+		b.ServerName = req.ServerName
+		b.ServerPath = req.ServerPath
+		b.Container = req.Container
+		b.Path = req.Path
+		if b.Container == "" && b.Path == "" {
+			s.jsonError(w, "Bookmark container or path is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.opts.Config.UpdateUPnPBookmark(*b); err != nil {
+			s.jsonError(w, "Failed to update bookmark: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"bookmark": b,
+		})
+
+	case http.MethodDelete:
+		if err := s.opts.Config.RemoveUPnPBookmark(id); err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		s.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+
+	"github.com/hilli/kefw2ui/announce"
+	"github.com/hilli/kefw2ui/rules"
+	"github.com/hilli/kefw2ui/scenes"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// sseBuffer is how many events the SSE subscriber may fall behind the bus.
+// It only copies them into the replay buffer, so it rarely needs much.
+const sseBuffer = 1024
+
+// integrationBuffer is how many events an integration (MQTT, webhooks,
+// rules, ...) may fall behind the bus, e.g. while a slow broker or speaker
+// request holds it up.
+const integrationBuffer = 256
+
+// Events published by kefw2ui itself, next to the speaker events in the
+// speaker package. Events without fields are sent to clients without data.
+
+// VolumeClamped reports a volume change limited by quiet hours.
+type VolumeClamped struct {
+	Requested int    `json:"requested"`
+	Volume    int    `json:"volume"`
+	Origin    string `json:"origin"`
+}
+
+// PlaylistsChanged reports that a saved playlist was created, changed or
+// deleted.
+type PlaylistsChanged struct{}
+
+// ReindexProgress reports the progress of a media index rebuild.
+type ReindexProgress struct {
+	Status            string `json:"status"` // "progress", "complete" or "error"
+	ContainersScanned int    `json:"containersScanned,omitempty"`
+	TracksFound       int    `json:"tracksFound,omitempty"`
+	CurrentContainer  string `json:"currentContainer,omitempty"`
+	TrackCount        int    `json:"trackCount,omitempty"`
+	ServerName        string `json:"serverName,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// ScenesChanged reports that a scene was created, changed or deleted.
+type ScenesChanged struct{}
+
+// SceneRecalled reports the steps of a scene recall.
+type SceneRecalled struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Steps  []scenes.Step `json:"steps"`
+	Failed int           `json:"failed"`
+}
+
+// RulesChanged reports that a rule was created, changed or deleted.
+type RulesChanged struct{}
+
+// RuleRun reports the results of a rule that fired.
+type RuleRun struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Run     rules.Run `json:"run"`
+	Failed  int       `json:"failed"`
+	Trigger string    `json:"trigger"`
+}
+
+// AnnouncementMade reports the outcome of an announcement, including the
+// restore step report.
+type AnnouncementMade struct {
+	*announce.Result
+}
+
+// ClipsChanged reports that the clip library changed.
+type ClipsChanged struct{}
+
+func (VolumeClamped) EventType() string    { return "volumeClamped" }
+func (PlaylistsChanged) EventType() string { return "playlists" }
+func (ReindexProgress) EventType() string  { return "reindex" }
+func (ScenesChanged) EventType() string    { return "scenes" }
+func (SceneRecalled) EventType() string    { return "sceneRecalled" }
+func (RulesChanged) EventType() string     { return "rules" }
+func (RuleRun) EventType() string          { return "ruleRun" }
+func (AnnouncementMade) EventType() string { return "announcement" }
+func (ClipsChanged) EventType() string     { return "clips" }
+
+// Events returns the event bus, for subsystems that follow speaker and
+// kefw2ui events.
+func (s *Server) Events() *speaker.Bus {
+	return s.events
+}
+
+// publish publishes an event on the bus.
+func (s *Server) publish(event speaker.Event) {
+	s.events.Publish(event)
+}
+
+// follow subscribes to the bus and calls handle for each event in a
+// goroutine of its own, so a slow subscriber doesn't hold up the others. The
+// subscription is closed on shutdown.
+func (s *Server) follow(name string, buffer int, handle func(speaker.Delivery)) {
+	s.handle(s.events.Subscribe(name, buffer), handle)
+}
+
+// followTicks is like follow for subscribers that follow the playback
+// position and also want the position ticks.
+func (s *Server) followTicks(name string, buffer int, handle func(speaker.Delivery)) {
+	s.handle(s.events.SubscribeTicks(name, buffer), handle)
+}
+
+func (s *Server) handle(sub *speaker.Subscription, handle func(speaker.Delivery)) {
+	s.subs = append(s.subs, sub)
+	go func() {
+		for d := range sub.Events() {
+			handle(d)
+		}
+	}()
+}
+
+// bufferSSE copies an event to the SSE replay buffer, which SSE and
+// WebSocket clients read from. Position ticks only replace the latest tick.
+func (s *Server) bufferSSE(d speaker.Delivery) {
+	payload, err := s.ssePayload(d.Event)
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", d.Event.EventType(), err)
+		return
+	}
+	if speaker.IsTick(d.Event) {
+		s.broadcastTick(payload)
+		return
+	}
+	s.broadcastSSE(payload)
+}
+
+// ssePayload returns the {"type", "data"} message of an event.
+func (s *Server) ssePayload(event speaker.Event) ([]byte, error) {
+	// Clients load artwork through the image proxy
+	if e, ok := event.(speaker.PlayerChanged); ok {
+		e.Icon = s.proxyIconURL(e.Icon)
+		event = e
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	msg := map[string]any{"type": event.EventType()}
+	if !bytes.Equal(data, []byte("{}")) {
+		msg["data"] = json.RawMessage(data)
+	}
+	return json.Marshal(msg)
+}
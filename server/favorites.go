@@ -0,0 +1,383 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/favorites"
+	"github.com/hilli/kefw2ui/music"
+)
+
+// favoriteRequest is the request body for adding a favorite.
+type favoriteRequest struct {
+	Source        string           `json:"source"`
+	Title         string           `json:"title"`
+	Type          string           `json:"type"`
+	Path          string           `json:"path"`
+	Icon          string           `json:"icon"`
+	Artist        string           `json:"artist"`
+	Album         string           `json:"album"`
+	AudioType     string           `json:"audioType"`
+	ContainerPath string           `json:"containerPath"`
+	MediaData     *kefw2.MediaData `json:"mediaData"`
+	Tags          []string         `json:"tags"`
+}
+
+// sourceForPath infers the browse source an item path belongs to.
+// Used when navigating below a favorited folder, where child paths are
+// not favorites themselves.
+func sourceForPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "upnp:"), strings.HasPrefix(path, bookmarkPathPrefix):
+		return browseSourceUPnP
+	case strings.HasPrefix(path, "custom:"):
+		return browseSourceStations
+	case music.IsMusicPath(path):
+		return browseSourceMusic
+	case strings.Contains(path, "/feeds") || strings.Contains(path, "podcast"):
+		return browseSourcePodcasts
+	case strings.HasPrefix(path, "airable:"):
+		return browseSourceRadio
+	default:
+		return ""
+	}
+}
+
+// resolveFavorite returns the favorite stored for path (if any) and the
+// source the item should be played or browsed through.
+func (s *Server) resolveFavorite(path string) (*favorites.Favorite, string) {
+	if s.favorites != nil {
+		if fav, err := s.favorites.FindByPath("", path); err == nil && fav != nil {
+			return fav, fav.Source
+		}
+	}
+	return nil, sourceForPath(path)
+}
+
+// favoriteBrowseItem converts a favorite to a BrowseItem.
+func (s *Server) favoriteBrowseItem(fav *favorites.Favorite) BrowseItem {
+	item := BrowseItem{
+		Title:         fav.Title,
+		Type:          fav.Type,
+		Path:          fav.Path,
+		Icon:          s.proxyIconURL(fav.Icon),
+		Artist:        fav.Artist,
+		Album:         fav.Album,
+		ID:            fav.ID,
+		Description:   strings.Join(fav.Tags, ", "),
+		Playable:      fav.Type == contentTypeAudio || fav.AudioType == "audioBroadcast",
+		AudioType:     fav.AudioType,
+		MediaData:     fav.MediaData,
+		ContainerPath: fav.ContainerPath,
+		Source:        fav.Source,
+	}
+	if fav.MediaData != nil && len(fav.MediaData.Resources) > 0 {
+		item.Duration = fav.MediaData.Resources[0].Duration
+	}
+	// UPnP and music folders can be played as a whole
+	if (fav.Source == browseSourceUPnP || fav.Source == browseSourceMusic) && fav.Type == contentTypeContainer {
+		item.Playable = true
+	}
+	return item
+}
+
+// handleBrowseFavorites lists local favorites as browse items.
+// With ?path= it browses into a favorited folder using the folder's source.
+// Supports ?q= (text filter) and ?tag= (tag filter).
+func (s *Server) handleBrowseFavorites(w http.ResponseWriter, r *http.Request) {
+	if s.favorites == nil {
+		s.jsonError(w, "Favorites not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	if itemPath := query.Get("path"); itemPath != "" {
+		source := query.Get("source")
+		if source == "" || source == browseSourceFavorites {
+			_, source = s.resolveFavorite(itemPath)
+		}
+		switch source {
+		case browseSourceUPnP:
+			s.handleBrowseUPnP(w, r, "")
+		case browseSourceRadio, browseSourceStations:
+			s.handleBrowseRadio(w, r, "")
+		case browseSourcePodcasts:
+			s.handleBrowsePodcasts(w, r, "")
+		case browseSourceMusic:
+			s.handleBrowseMusic(w, r)
+		default:
+			s.jsonError(w, "Unknown source for path", http.StatusBadRequest)
+		}
+		return
+	}
+
+	page, err := parseBrowsePage(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	favs, err := s.favorites.List(query.Get("tag"))
+	if err != nil {
+		s.jsonError(w, "Failed to list favorites: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	search := query.Get("q")
+	all := make([]BrowseItem, 0, len(favs))
+	for i := range favs {
+		if favs[i].Matches(search) {
+			all = append(all, s.favoriteBrowseItem(&favs[i]))
+		}
+	}
+	items := page.slice(all)
+
+	out := map[string]any{
+		"items":      items,
+		"totalCount": len(all),
+		"source":     browseSourceFavorites,
+	}
+	if next := page.nextCursor(len(items), len(all)); next != "" {
+		out["nextCursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handleFavorites handles listing and adding local favorites.
+func (s *Server) handleFavorites(w http.ResponseWriter, r *http.Request) {
+	if s.favorites == nil {
+		s.jsonError(w, "Favorites not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		favs, err := s.favorites.List(r.URL.Query().Get("tag"))
+		if err != nil {
+			s.jsonError(w, "Failed to list favorites: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"favorites": favs,
+		})
+
+	case http.MethodPost:
+		var req favoriteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Path == "" {
+			s.jsonError(w, "Path is required", http.StatusBadRequest)
+			return
+		}
+		if req.Source == "" || req.Source == browseSourceFavorites {
+			req.Source = sourceForPath(req.Path)
+		}
+		switch req.Source {
+		case browseSourceUPnP, browseSourceRadio, browseSourcePodcasts, browseSourceStations, browseSourceMusic:
+		default:
+			s.jsonError(w, "Unknown source type", http.StatusBadRequest)
+			return
+		}
+		if req.Type == "" {
+			req.Type = contentTypeAudio
+		}
+
+		fav, created, err := s.favorites.Add(favorites.Favorite{
+			Source:        req.Source,
+			Title:         req.Title,
+			Type:          req.Type,
+			Path:          req.Path,
+			Icon:          req.Icon,
+			Artist:        req.Artist,
+			Album:         req.Album,
+			AudioType:     req.AudioType,
+			ContainerPath: req.ContainerPath,
+			MediaData:     req.MediaData,
+			Tags:          req.Tags,
+		})
+		if err != nil {
+			s.jsonError(w, "Failed to add favorite: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"favorite": fav,
+			"created":  created,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFavorite handles operations on a single favorite.
+//   - GET /api/favorites/{id}
+//   - PUT /api/favorites/{id} - update title/tags, or move with {"position": n}
+//   - DELETE /api/favorites/{id}
+func (s *Server) handleFavorite(w http.ResponseWriter, r *http.Request) {
+	if s.favorites == nil {
+		s.jsonError(w, "Favorites not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Extract favorite ID from path: /api/favorites/{id}
+	id := strings.TrimPrefix(r.URL.Path, "/api/favorites/")
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid favorite ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		fav, err := s.favorites.Get(id)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"favorite": fav,
+		})
+
+	case http.MethodPut:
+		var req struct {
+			Title    string   `json:"title"`
+			Tags     []string `json:"tags"`
+			Position *int     `json:"position,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		fav, err := s.favorites.Update(id, req.Title, req.Tags)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if req.Position != nil {
+			if _, err := s.favorites.Move(id, *req.Position); err != nil {
+				s.jsonError(w, "Failed to move favorite: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"favorite": fav,
+		})
+
+	case http.MethodDelete:
+		if err := s.favorites.Remove(id); err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFavoritesReorder sets the order of all favorites.
+// Body: {"ids": ["id1", "id2", ...]}.
+func (s *Server) handleFavoritesReorder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.favorites == nil {
+		s.jsonError(w, "Favorites not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	favs, err := s.favorites.Reorder(req.IDs)
+	if err != nil {
+		s.jsonError(w, "Failed to reorder favorites: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"favorites": favs,
+	})
+}
+
+// toggleLocalFavorite adds or removes an item in the local favorites store.
+// Used by POST /api/browse/favorite for sources without Airable favorites.
+func (s *Server) toggleLocalFavorite(w http.ResponseWriter, source, path, title, itemType, icon string, add bool) {
+	if s.favorites == nil {
+		s.jsonError(w, "Favorites not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if source == "" || source == browseSourceFavorites {
+		_, source = s.resolveFavorite(path)
+	}
+
+	if add {
+		if itemType == "" {
+			itemType = contentTypeAudio
+		}
+		if _, _, err := s.favorites.Add(favorites.Favorite{
+			Source: source,
+			Title:  title,
+			Type:   itemType,
+			Path:   path,
+			Icon:   icon,
+		}); err != nil {
+			s.jsonError(w, "Failed to add to favorites: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		fav, err := s.favorites.FindByPath(source, path)
+		if err != nil {
+			s.jsonError(w, "Failed to remove from favorites: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if fav != nil {
+			if err := s.favorites.Remove(fav.ID); err != nil {
+				s.jsonError(w, "Failed to remove from favorites: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	action := "added to"
+	if !add {
+		action = "removed from"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":  "ok",
+		"message": "Successfully " + action + " favorites",
+	})
+}
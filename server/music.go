@@ -0,0 +1,291 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/music"
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// musicBaseURL returns the base URL the active speaker uses to fetch local
+// music files. With --public-url set no speaker is needed.
+func (s *Server) musicBaseURL() (string, error) {
+	if s.opts.PublicURL != "" {
+		return strings.TrimRight(s.opts.PublicURL, "/"), nil
+	}
+	spk := s.manager.GetActiveSpeaker()
+	if spk == nil {
+		return "", fmt.Errorf("no active speaker")
+	}
+	return s.MediaBaseURL(spk)
+}
+
+// musicFileURL returns the URL of a local music file under baseURL.
+func musicFileURL(baseURL, id string) string {
+	return baseURL + "/api/music/files/" + escapeMusicID(id)
+}
+
+// musicArtURL returns the artwork URL of a local music file under baseURL.
+func musicArtURL(baseURL, id string) string {
+	return baseURL + "/api/music/art/" + escapeMusicID(id)
+}
+
+// escapeMusicID escapes each segment of a slash-separated track ID.
+func escapeMusicID(id string) string {
+	parts := strings.Split(id, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// musicContentItem converts a local track to a ContentItem the speaker can
+// play from kefw2ui's file server.
+func musicContentItem(t *music.Track, baseURL string) kefw2.ContentItem {
+	icon := ""
+	if t.HasArtwork {
+		icon = musicArtURL(baseURL, t.ID)
+	}
+	item := stations.StreamItem(musicFileURL(baseURL, t.ID), t.Title, t.Artist, icon, t.MimeType)
+	item.ID = t.ID
+	item.MediaData.MetaData.Album = t.Album
+	item.MediaData.MetaData.Genre = t.Genre
+	return item
+}
+
+// musicTrackBrowseItem converts a local track to a BrowseItem.
+func (s *Server) musicTrackBrowseItem(t *music.Track, baseURL string) BrowseItem {
+	item := musicContentItem(t, baseURL)
+	return BrowseItem{
+		Title:     t.Title,
+		Type:      contentTypeAudio,
+		Path:      t.Path(),
+		Icon:      s.proxyIconURL(item.Icon),
+		Artist:    t.Artist,
+		Album:     t.Album,
+		ID:        t.ID,
+		Playable:  true,
+		MediaData: item.MediaData,
+	}
+}
+
+// musicContentItems resolves a browse path (a folder or a track) to the
+// ContentItems to play or queue.
+func (s *Server) musicContentItems(path string) ([]kefw2.ContentItem, error) {
+	if s.music == nil {
+		return nil, fmt.Errorf("local music not enabled (start with --music-dir)")
+	}
+
+	baseURL, err := s.musicBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []music.Track
+	if id, ok := strings.CutPrefix(path, music.TrackPathPrefix); ok {
+		t, err := s.music.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		tracks = []music.Track{*t}
+	} else {
+		tracks, err = s.music.FolderTracks(strings.TrimPrefix(path, music.FolderPathPrefix))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no tracks found in folder")
+	}
+
+	items := make([]kefw2.ContentItem, len(tracks))
+	for i := range tracks {
+		items[i] = musicContentItem(&tracks[i], baseURL)
+	}
+	return items, nil
+}
+
+// handleBrowseMusic browses the local music directory.
+//   - GET /api/browse/music - top-level folders and tracks
+//   - GET /api/browse/music?path=music:folder/{dir} - a folder
+//   - GET /api/browse/music?q=query - search titles, artists and albums
+func (s *Server) handleBrowseMusic(w http.ResponseWriter, r *http.Request) {
+	if s.music == nil {
+		s.jsonError(w, "Local music not enabled (start with --music-dir)", http.StatusServiceUnavailable)
+		return
+	}
+
+	page, err := parseBrowsePage(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	baseURL, err := s.musicBaseURL()
+	if err != nil {
+		s.jsonError(w, "No active speaker", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	folder := strings.TrimPrefix(query.Get("path"), music.FolderPathPrefix)
+
+	var all []BrowseItem
+	if q := query.Get("q"); q != "" {
+		tracks := s.music.Search(q)
+		all = make([]BrowseItem, 0, len(tracks))
+		for i := range tracks {
+			all = append(all, s.musicTrackBrowseItem(&tracks[i], baseURL))
+		}
+	} else {
+		folders, tracks, err := s.music.Browse(folder)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		all = make([]BrowseItem, 0, len(folders)+len(tracks))
+		for i := range folders {
+			all = append(all, BrowseItem{
+				Title:    folders[i].Name,
+				Type:     contentTypeContainer,
+				Path:     folders[i].Path(),
+				Playable: true,
+			})
+		}
+		for i := range tracks {
+			all = append(all, s.musicTrackBrowseItem(&tracks[i], baseURL))
+		}
+	}
+	items := page.slice(all)
+
+	out := map[string]any{
+		"items":      items,
+		"totalCount": len(all),
+		"source":     browseSourceMusic,
+		"path":       music.FolderPathPrefix + folder,
+	}
+	if next := page.nextCursor(len(items), len(all)); next != "" {
+		out["nextCursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handleMusic reports the state of the local music index.
+func (s *Server) handleMusic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.music == nil {
+		s.jsonError(w, "Local music not enabled (start with --music-dir)", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.music.Stats())
+}
+
+// handleMusicRescan re-indexes the music directory in the background.
+func (s *Server) handleMusicRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.music == nil {
+		s.jsonError(w, "Local music not enabled (start with --music-dir)", http.StatusServiceUnavailable)
+		return
+	}
+	if s.music.Stats().Scanning {
+		s.jsonError(w, "Scan already in progress", http.StatusConflict)
+		return
+	}
+
+	go s.scanMusic()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "scanning"})
+}
+
+// scanMusic indexes the music directory and logs the outcome.
+func (s *Server) scanMusic() {
+	if err := s.music.Scan(); err != nil {
+		log.Printf("Music scan failed: %v", err)
+		return
+	}
+	stats := s.music.Stats()
+	log.Printf("Indexed %d tracks in %d folders from %s", stats.Tracks, stats.Folders, stats.Dir)
+}
+
+// handleMusicFile serves a local music file with Range support. This is the
+// URL the speaker streams from.
+func (s *Server) handleMusicFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.music == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/music/files/")
+	track, err := s.music.Get(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := s.music.FilePath(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(path) //nolint:gosec // only indexed files below the music directory resolve
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", track.MimeType)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// handleMusicArt serves the cover art of a local music file.
+func (s *Server) handleMusicArt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.music == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, mimeType, err := s.music.Artwork(strings.TrimPrefix(r.URL.Path, "/api/music/art/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 24 hours
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/pagination"
+)
+
+// Browse listings accept ?limit=N&cursor=C. Without a limit (or cursor) the
+// whole listing is returned, as the web UI expects. Cursors come from the
+// pagination package.
+const (
+	defaultBrowseLimit = 50
+	maxBrowseLimit     = 500
+)
+
+// browsePage is the window of a browse listing requested by the client.
+type browsePage struct {
+	offset int
+	limit  int // 0 means no pagination
+}
+
+// parseBrowsePage reads the limit and cursor query parameters.
+func parseBrowsePage(r *http.Request) (browsePage, error) {
+	query := r.URL.Query()
+
+	var page browsePage
+	if cursor := query.Get("cursor"); cursor != "" {
+		offset, err := pagination.DecodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.offset = offset
+		page.limit = defaultBrowseLimit
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, fmt.Errorf("invalid limit: %s", limit)
+		}
+		page.limit = min(n, maxBrowseLimit)
+	}
+
+	return page, nil
+}
+
+// paged reports whether the client asked for a single page.
+func (p browsePage) paged() bool {
+	return p.limit > 0
+}
+
+// slice returns the requested window of a fully loaded listing.
+func (p browsePage) slice(items []BrowseItem) []BrowseItem {
+	if !p.paged() {
+		return items
+	}
+	return pagination.Window(items, p.offset, p.limit)
+}
+
+// split divides the window between local items listed ahead of a remote
+// listing (such as bookmarks ahead of a UPnP container). It returns the local
+// items inside the window and the offset and limit to request remotely.
+func (p browsePage) split(local []BrowseItem) (head []BrowseItem, offset, limit int) {
+	head = p.slice(local)
+	offset = max(p.offset-len(local), 0)
+	limit = p.limit - len(head)
+	return head, offset, limit
+}
+
+// nextCursor returns the cursor of the page following one that consumed n
+// items of a listing with total items, or "" when the listing is exhausted.
+func (p browsePage) nextCursor(n, total int) string {
+	if !p.paged() {
+		return ""
+	}
+	return pagination.NextCursor(p.offset, p.limit, n, total)
+}
+
+// categoryFunc fetches the first batch of a radio or podcast category.
+type categoryFunc func(*kefw2.AirableClient) (*kefw2.RowsResponse, error)
+
+// Radio and podcast categories by subpath.
+var (
+	radioCategories = map[string]categoryFunc{
+		"favorites": (*kefw2.AirableClient).GetRadioFavorites,
+		"local":     (*kefw2.AirableClient).GetRadioLocal,
+		"popular":   (*kefw2.AirableClient).GetRadioPopular,
+		"trending":  (*kefw2.AirableClient).GetRadioTrending,
+		"hq":        (*kefw2.AirableClient).GetRadioHQ,
+		"new":       (*kefw2.AirableClient).GetRadioNew,
+	}
+	podcastCategories = map[string]categoryFunc{
+		"favorites": (*kefw2.AirableClient).GetPodcastFavorites,
+		"popular":   (*kefw2.AirableClient).GetPodcastPopular,
+		"trending":  (*kefw2.AirableClient).GetPodcastTrending,
+		"history":   (*kefw2.AirableClient).GetPodcastHistory,
+	}
+)
+
+// category fetches a radio or podcast category: the first batch, as the web
+// UI expects, or only the requested page of the category's container.
+func (p browsePage) category(airable *kefw2.AirableClient, service kefw2.AirableServiceType, name string, first categoryFunc) (*kefw2.RowsResponse, error) {
+	if !p.paged() {
+		return first(airable)
+	}
+	path, err := pagination.CategoryPath(airable, service, name)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.FetchRows(airable, path, p.offset, p.limit)
+}
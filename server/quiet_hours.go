@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// quietHoursCheckInterval is how often the volume is checked against the
+// quiet-hours cap, so the cap applies when a window starts.
+const quietHoursCheckInterval = 30 * time.Second
+
+// volumeCap returns the quiet-hours cap active now on spk.
+func (s *Server) volumeCap(spk *kefw2.KEFSpeaker) (int, bool) {
+	return s.manager.VolumeLimit(spk)
+}
+
+// enforceVolumeCap turns the speaker back down when its volume exceeds the
+// quiet-hours cap: after a change from outside kefw2ui (the remote, the KEF
+// app), or when a quiet window starts.
+func (s *Server) enforceVolumeCap(volume int) {
+	spk := s.manager.GetActiveSpeaker()
+	limit, ok := s.volumeCap(spk)
+	if !ok || volume <= limit {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if s.audit != nil {
+			s.audit.NoteLocalChange()
+		}
+		_, err := s.manager.SetVolume(ctx, spk, volume, speaker.OriginSpeaker)
+		s.auditSystem("quiet hours volume cap", map[string]any{"requested": volume, "volume": limit}, err)
+		if err != nil {
+			log.Printf("Failed to enforce quiet hours volume cap: %v", err)
+		}
+	}()
+}
+
+// runQuietHours checks the active speaker's volume against the quiet-hours
+// cap until shutdown. Speaker events only catch changes; this catches a
+// window starting while the volume is above its cap. The speaker isn't
+// queried: the volume comes from its state, and a speaker in standby is
+// left alone.
+func (s *Server) runQuietHours() {
+	ticker := time.NewTicker(quietHoursCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopTickers:
+			return
+		case <-ticker.C:
+			s.checkVolumeCap()
+		}
+	}
+}
+
+// checkVolumeCap enforces the quiet-hours cap on the active speaker's known
+// volume.
+func (s *Server) checkVolumeCap() {
+	spk := s.manager.GetActiveSpeaker()
+	if spk == nil || s.manager.IsInStandby() {
+		return
+	}
+	state := s.speakerState.Peek(spk.IPAddress)
+	if state.UpdatedAt.IsZero() || state.Source == kefw2.SourceStandby {
+		return
+	}
+	s.enforceVolumeCap(state.Volume)
+}
+
+// BroadcastVolumeClamped sends a "volumeClamped" SSE event when a volume
+// change was limited by quiet hours. The speaker manager calls it for every
+// clamped change.
+func (s *Server) BroadcastVolumeClamped(requested, limit int, origin string) {
+	log.Printf("Quiet hours: volume %d limited to %d (%s)", requested, limit, origin)
+
+	s.publish(VolumeClamped{Requested: requested, Volume: limit, Origin: origin})
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/rules"
+)
+
+// ruleRequest is the request body for creating or updating a rule. Nil
+// fields are left unchanged on update; new rules are enabled by default.
+type ruleRequest struct {
+	Name    *string         `json:"name"`
+	Enabled *bool           `json:"enabled"`
+	When    *rules.When     `json:"when"`
+	Then    *[]rules.Action `json:"then"`
+}
+
+// apply copies the set fields onto rule.
+func (req *ruleRequest) apply(rule *rules.Rule) {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.When != nil {
+		rule.When = *req.When
+	}
+	if req.Then != nil {
+		rule.Then = *req.Then
+	}
+}
+
+// ruleTestRequest is the request body for testing a rule.
+type ruleTestRequest struct {
+	Event   rules.Event `json:"event"`   // defaults to the rule's trigger, now
+	Execute bool        `json:"execute"` // run the actions instead of a dry run
+}
+
+// BroadcastRulesChanged sends a "rules" SSE event so clients can refresh
+// their rule lists. Called after rule changes from both REST and MCP.
+func (s *Server) BroadcastRulesChanged() {
+	s.publish(RulesChanged{})
+}
+
+// BroadcastRuleRun sends a "ruleRun" SSE event with the results of a rule
+// that fired.
+func (s *Server) BroadcastRuleRun(rule *rules.Rule, run rules.Run) {
+	s.publish(RuleRun{
+		ID:      rule.ID,
+		Name:    rule.Name,
+		Run:     run,
+		Failed:  run.Failed(),
+		Trigger: run.Event.Type,
+	})
+}
+
+// handleRuleRun records a rule run in the audit log and broadcasts it.
+func (s *Server) handleRuleRun(rule *rules.Rule, run rules.Run) {
+	if s.audit != nil {
+		entry := audit.Entry{
+			Source: audit.SourceRule,
+			Action: "rule " + rule.Name,
+			Params: map[string]any{
+				"ruleId":  rule.ID,
+				"trigger": run.Event.Type,
+				"results": run.Results,
+			},
+			Caller: audit.Caller{Name: rule.Name},
+		}
+		if failed := run.Failed(); failed > 0 {
+			entry.Error = fmt.Sprintf("%d of %d actions failed", failed, len(run.Results))
+		}
+		s.audit.Record(entry)
+	}
+	s.BroadcastRuleRun(rule, run)
+}
+
+// handleRuleExecute is called before each rule action touches the speaker.
+func (s *Server) handleRuleExecute(_ *rules.Rule, _ rules.Action) {
+	if s.audit != nil {
+		s.audit.NoteLocalChange()
+	}
+}
+
+// handleRules handles listing and creating rules.
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		s.jsonError(w, "Rules not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.rules.List()
+		if err != nil {
+			s.jsonError(w, "Failed to list rules: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"rules":       list,
+			"eventTypes":  rules.EventTypes,
+			"actionTypes": rules.ActionTypes,
+		})
+
+	case http.MethodPost:
+		var req ruleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		rule := rules.Rule{Enabled: true}
+		req.apply(&rule)
+		created, err := s.rules.Create(rule)
+		if err != nil {
+			s.jsonError(w, "Failed to save rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.BroadcastRulesChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"rule": created,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRule handles operations on a single rule.
+//   - GET /api/rules/{id}
+//   - PUT /api/rules/{id} - partial update, e.g. {"enabled": false}
+//   - DELETE /api/rules/{id}
+//   - GET /api/rules/{id}/runs - execution log
+//   - POST /api/rules/{id}/test - dry run, or {"execute": true} to run the actions
+func (s *Server) handleRule(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		s.jsonError(w, "Rules not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Extract rule ID from path: /api/rules/{id}[/runs|/test]
+	path := strings.TrimPrefix(r.URL.Path, "/api/rules/")
+	if id, ok := strings.CutSuffix(path, "/runs"); ok {
+		s.handleRuleRuns(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(path, "/test"); ok {
+		s.handleRuleTest(w, r, id)
+		return
+	}
+	id := path
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := s.rules.Get(id)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"rule": rule,
+		})
+
+	case http.MethodPut:
+		var req ruleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		rule, err := s.rules.Get(id)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		req.apply(rule)
+		updated, err := s.rules.Update(*rule)
+		if err != nil {
+			s.jsonError(w, "Failed to save rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.BroadcastRulesChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"rule": updated,
+		})
+
+	case http.MethodDelete:
+		if err := s.rules.Delete(id); err != nil {
+			s.jsonError(w, "Failed to delete rule: "+err.Error(), http.StatusNotFound)
+			return
+		}
+		s.rules.Forget(id)
+		s.BroadcastRulesChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRuleRuns returns the recent runs of a rule.
+func (s *Server) handleRuleRuns(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := s.rules.Get(id); err != nil {
+		s.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"runs": s.rules.Runs(id),
+	})
+}
+
+// handleRuleTest evaluates a rule against a sample event. The body is
+// optional; without one the rule's own trigger is tested at the current time.
+func (s *Server) handleRuleTest(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ruleTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	matched, reason, run, err := s.rules.Test(id, req.Event, req.Execute)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	result := map[string]any{
+		"matched": matched,
+	}
+	if reason != "" {
+		result["reason"] = reason
+	}
+	if run != nil {
+		result["run"] = run
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
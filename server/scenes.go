@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hilli/kefw2ui/scenes"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// sceneRequest is the request body for capturing or updating a scene.
+type sceneRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Capture     bool   `json:"capture"` // PUT only: replace the stored state with the current one
+}
+
+// BroadcastScenesChanged sends a "scenes" SSE event so clients can refresh
+// their scene lists. Called after scene changes from both REST and MCP.
+func (s *Server) BroadcastScenesChanged() {
+	s.publish(ScenesChanged{})
+}
+
+// BroadcastSceneRecalled sends a "sceneRecalled" SSE event with the step
+// report of a scene recall.
+func (s *Server) BroadcastSceneRecalled(scene *scenes.Scene, steps []scenes.Step) {
+	s.publish(SceneRecalled{
+		ID:     scene.ID,
+		Name:   scene.Name,
+		Steps:  steps,
+		Failed: scenes.Failed(steps),
+	})
+}
+
+// handleScenes handles listing scenes and capturing the current speaker state
+// as a new scene.
+func (s *Server) handleScenes(w http.ResponseWriter, r *http.Request) {
+	if s.scenes == nil {
+		s.jsonError(w, "Scenes not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.scenes.List()
+		if err != nil {
+			s.jsonError(w, "Failed to list scenes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"scenes": list,
+		})
+
+	case http.MethodPost:
+		var req sceneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			s.jsonError(w, "Scene name is required", http.StatusBadRequest)
+			return
+		}
+
+		spk := s.manager.GetActiveSpeaker()
+		if spk == nil {
+			s.jsonError(w, "No active speaker", http.StatusServiceUnavailable)
+			return
+		}
+
+		state, err := scenes.Capture(r.Context(), spk)
+		if err != nil {
+			s.jsonError(w, "Failed to capture scene: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		scene, err := s.scenes.Save(req.Name, req.Description, state)
+		if err != nil {
+			s.jsonError(w, "Failed to save scene: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.BroadcastScenesChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"scene": scene,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScene handles operations on a single scene.
+//   - GET /api/scenes/{id}
+//   - PUT /api/scenes/{id} - rename, or {"capture": true} to re-capture
+//   - DELETE /api/scenes/{id}
+//   - POST /api/scenes/{id}/recall
+func (s *Server) handleScene(w http.ResponseWriter, r *http.Request) {
+	if s.scenes == nil {
+		s.jsonError(w, "Scenes not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Extract scene ID from path: /api/scenes/{id} or /api/scenes/{id}/recall
+	path := strings.TrimPrefix(r.URL.Path, "/api/scenes/")
+	if id, ok := strings.CutSuffix(path, "/recall"); ok {
+		s.handleSceneRecall(w, r, id)
+		return
+	}
+	id := path
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid scene ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scene, err := s.scenes.Get(id)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"scene": scene,
+		})
+
+	case http.MethodPut:
+		var req sceneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		scene, err := s.scenes.Rename(id, req.Name, req.Description)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if req.Capture {
+			spk := s.manager.GetActiveSpeaker()
+			if spk == nil {
+				s.jsonError(w, "No active speaker", http.StatusServiceUnavailable)
+				return
+			}
+			state, err := scenes.Capture(r.Context(), spk)
+			if err != nil {
+				s.jsonError(w, "Failed to capture scene: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if scene, err = s.scenes.Save(scene.Name, "", state); err != nil {
+				s.jsonError(w, "Failed to save scene: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		s.BroadcastScenesChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"scene": scene,
+		})
+
+	case http.MethodDelete:
+		if err := s.scenes.Delete(id); err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s.BroadcastScenesChanged()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSceneRecall applies a scene to the active speaker and reports the
+// outcome of each step.
+func (s *Server) handleSceneRecall(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spk := s.manager.GetActiveSpeaker()
+	if spk == nil {
+		s.jsonError(w, "No active speaker", http.StatusServiceUnavailable)
+		return
+	}
+
+	scene, err := s.scenes.Get(id)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	steps := scenes.Recall(r.Context(), spk, scene.State, s.manager.VolumeSetter(spk, speaker.OriginScene))
+
+	// Keep the speaker manager's standby tracking in step with the scene
+	if scene.State.PoweredOn {
+		s.manager.NotifyWake()
+	} else {
+		s.manager.NotifyStandby()
+	}
+	s.BroadcastSceneRecalled(scene, steps)
+
+	status := "ok"
+	if scenes.Failed(steps) > 0 {
+		status = "partial"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"scene":  scene.Name,
+		"steps":  steps,
+	})
+}
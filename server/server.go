@@ -1,9 +1,11 @@
 package server
 
 import (
+	"bufio"
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -17,10 +19,23 @@ import (
 
 	"github.com/hilli/go-kef-w2/kefw2"
 
+	"github.com/hilli/kefw2ui/announce"
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/auth"
 	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/favorites"
 	mcppkg "github.com/hilli/kefw2ui/mcp"
+	"github.com/hilli/kefw2ui/mpd"
+	"github.com/hilli/kefw2ui/mqtt"
+	"github.com/hilli/kefw2ui/music"
+	"github.com/hilli/kefw2ui/pagination"
 	"github.com/hilli/kefw2ui/playlist"
+	"github.com/hilli/kefw2ui/renderer"
+	"github.com/hilli/kefw2ui/rules"
+	"github.com/hilli/kefw2ui/scenes"
 	"github.com/hilli/kefw2ui/speaker"
+	"github.com/hilli/kefw2ui/stations"
+	"github.com/hilli/kefw2ui/webhooks"
 )
 
 // Options configures the server.
@@ -31,6 +46,38 @@ type Options struct {
 	Config         *config.Config
 	SpeakerManager *speaker.Manager
 
+	// PublicURL is the base URL speakers use to fetch audio served by
+	// kefw2ui (announcement clips). Detected from the route to the speaker
+	// when empty.
+	PublicURL string
+
+	// MusicDir is a local music directory served to the speaker as the
+	// "music" browse source (disabled when empty).
+	MusicDir string
+
+	// UPnPRenderer exposes kefw2ui as a UPnP/DLNA MediaRenderer for casting
+	// apps. UPnPRendererName overrides the advertised name.
+	UPnPRenderer     bool
+	UPnPRendererName string
+
+	// MPDAddr is the TCP address of the MPD protocol server, e.g. ":6600"
+	// (disabled when empty).
+	MPDAddr string
+
+	// MQTT publishes speaker state to an MQTT broker with Home Assistant
+	// discovery (disabled when MQTT.BrokerURL is empty). Manager is set by
+	// the server.
+	MQTT mqtt.Options
+
+	// Auth requires API tokens or a login for the HTTP API (disabled when
+	// false). AuthAdminUser/AuthAdminPassword create or reset an admin user
+	// at startup; AuthAnonymousRole grants a role to requests without
+	// credentials (none when empty).
+	Auth              bool
+	AuthAdminUser     string
+	AuthAdminPassword string
+	AuthAnonymousRole auth.Role
+
 	// Image proxy cache settings
 	ImageCacheTTL   time.Duration // Disk TTL for cached images (0 = never expire)
 	ImageCacheMemMB int           // Max memory for image cache in MB (default 50)
@@ -43,6 +90,20 @@ type Server struct {
 	httpServer *http.Server
 	manager    *speaker.Manager
 	playlists  *playlist.Manager
+	stations   *stations.Manager
+	favorites  *favorites.Manager
+	scenes     *scenes.Manager
+	clips      *announce.Library
+	announcer  *announce.Announcer
+	music      *music.Library
+	renderer   *renderer.Renderer
+	mpd        *mpd.Server
+	mqtt       *mqtt.Bridge
+	webhooks   *webhooks.Dispatcher
+	rules      *rules.Engine
+	sourceMem  *sourceMemory
+	auth       *auth.Store // nil when authentication is disabled
+	audit      *audit.Log
 
 	// Shared cache for Airable content (UPnP, Radio, Podcasts)
 	airableCache *kefw2.RowsCache
@@ -50,9 +111,26 @@ type Server struct {
 	// Shared cache for proxied images (memory + disk)
 	imageCache *ImageCache
 
-	// SSE clients
-	sseClients   map[chan []byte]struct{}
-	sseClientsMu sync.RWMutex
+	// Speaker state kept from events, so reads don't query the speaker,
+	// and the stop channel of the position and quiet hours tickers
+	speakerState *speaker.StateStore
+	stopTickers  chan struct{}
+
+	// Speaker and kefw2ui events, see events.go
+	events *speaker.Bus
+	subs   []*speaker.Subscription // closed on shutdown
+
+	// SSE clients, the replay buffer and the latest position tick, see
+	// sse.go
+	sseMu      sync.Mutex
+	sseClients map[*sseClient]struct{}
+	sseEvents  []sseEvent
+	sseLastID  uint64
+	sseTick    sseTick
+
+	// Subsonic library view of the media index, see subsonic.go
+	subsonicMu  sync.Mutex
+	subsonicLib *subsonicLibrary
 
 	// Reindex state – prevents concurrent reindexing
 	reindexMu  sync.Mutex
@@ -61,17 +139,21 @@ type Server struct {
 
 // Content type constants used across browse/queue handlers.
 const (
-	contentTypeContainer = "container"
-	contentTypeAudio     = "audio"
-	browseSourceUPnP     = "upnp"
-	browseSourceRadio    = "radio"
-	browseSourcePodcasts = "podcasts"
+	contentTypeContainer  = "container"
+	contentTypeAudio      = "audio"
+	browseSourceUPnP      = "upnp"
+	browseSourceRadio     = "radio"
+	browseSourcePodcasts  = "podcasts"
+	browseSourceStations  = "stations"
+	browseSourceFavorites = "favorites"
+	browseSourceMusic     = "music"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status code.
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	identity   *auth.Identity // set by authMiddleware
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
@@ -86,6 +168,11 @@ func (lrw *loggingResponseWriter) Flush() {
 	}
 }
 
+// Hijack implements http.Hijacker for WebSocket support.
+func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(lrw.ResponseWriter).Hijack()
+}
+
 // loggingMiddleware logs all HTTP requests with method, path, status, and duration.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -111,7 +198,11 @@ func loggingMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Log the request
+		// Log the request, with the caller when known
+		if lrw.identity != nil {
+			log.Printf("%s %s %d %v %s", r.Method, path, lrw.statusCode, duration.Round(time.Millisecond), lrw.identity)
+			return
+		}
 		log.Printf("%s %s %d %v", r.Method, path, lrw.statusCode, duration.Round(time.Millisecond))
 	})
 }
@@ -124,6 +215,38 @@ func New(opts Options) *Server {
 		log.Printf("Warning: failed to initialize playlist manager: %v", err)
 	}
 
+	// Initialize custom radio station manager
+	stationMgr, err := stations.NewManager()
+	if err != nil {
+		log.Printf("Warning: failed to initialize station manager: %v", err)
+	}
+
+	// Initialize local favorites manager
+	favoritesMgr, err := favorites.NewManager()
+	if err != nil {
+		log.Printf("Warning: failed to initialize favorites manager: %v", err)
+	}
+
+	// Initialize scene manager
+	sceneMgr, err := scenes.NewManager()
+	if err != nil {
+		log.Printf("Warning: failed to initialize scene manager: %v", err)
+	}
+
+	// Initialize announcement clip library
+	clipLib, err := announce.NewLibrary()
+	if err != nil {
+		log.Printf("Warning: failed to initialize clip library: %v", err)
+	}
+
+	// Initialize local music library (optional)
+	var musicLib *music.Library
+	if opts.MusicDir != "" {
+		if musicLib, err = music.NewLibrary(opts.MusicDir); err != nil {
+			log.Printf("Warning: failed to initialize music library: %v", err)
+		}
+	}
+
 	// Initialize shared Airable cache (disk-persisted for performance)
 	airableCache := kefw2.NewRowsCache(kefw2.DefaultDiskCacheConfig())
 
@@ -140,9 +263,19 @@ func New(opts Options) *Server {
 	s := &Server{
 		opts:         opts,
 		mux:          http.NewServeMux(),
-		sseClients:   make(map[chan []byte]struct{}),
+		sseClients:   make(map[*sseClient]struct{}),
+		sseLastID:    sseFirstID(),
 		manager:      opts.SpeakerManager,
+		speakerState: speaker.NewStateStore(),
+		stopTickers:  make(chan struct{}),
+		events:       speaker.NewBus(),
 		playlists:    playlistMgr,
+		stations:     stationMgr,
+		favorites:    favoritesMgr,
+		scenes:       sceneMgr,
+		clips:        clipLib,
+		announcer:    announce.NewAnnouncer(opts.SpeakerManager),
+		music:        musicLib,
 		airableCache: airableCache,
 		imageCache: NewImageCache(ImageCacheConfig{
 			MaxMemBytes: int64(imgMemMB) << 20,
@@ -151,11 +284,143 @@ func New(opts Options) *Server {
 		}),
 	}
 
+	// SSE and WebSocket clients read events from the replay buffer
+	s.followTicks("SSE", sseBuffer, s.bufferSSE)
+
+	// Authentication (optional). Failing open would expose the API, so
+	// errors are fatal here
+	if opts.Auth {
+		store, err := auth.NewStore()
+		if err != nil {
+			log.Fatalf("Failed to initialize authentication: %v", err)
+		}
+		if opts.AuthAdminPassword != "" {
+			if _, err := store.SetUser(opts.AuthAdminUser, opts.AuthAdminPassword, auth.RoleAdmin); err != nil {
+				log.Fatalf("Failed to create admin user %q: %v", opts.AuthAdminUser, err)
+			}
+		}
+		if len(store.Users()) == 0 && len(store.Tokens()) == 0 {
+			log.Printf("Warning: authentication is enabled but there are no users or tokens; set --auth-admin-password to create an admin")
+		}
+		s.auth = store
+		log.Printf("Authentication enabled")
+	}
+
+	// Audit log of control actions
+	if s.audit, err = audit.New(opts.SpeakerManager); err != nil {
+		log.Printf("Warning: failed to initialize audit log: %v", err)
+	} else {
+		s.follow("audit log", integrationBuffer, func(d speaker.Delivery) {
+			s.audit.HandleEvent(d.Event, d.Time)
+		})
+	}
+
+	// Automation rules
+	ruleEngine, err := rules.NewEngine(rules.Options{
+		Manager:   opts.SpeakerManager,
+		Scenes:    sceneMgr,
+		OnRun:     s.handleRuleRun,
+		OnExecute: s.handleRuleExecute,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to initialize rules engine: %v", err)
+	} else {
+		s.rules = ruleEngine
+		s.follow("rules", integrationBuffer, func(d speaker.Delivery) {
+			s.rules.HandleEvent(d.Event)
+		})
+	}
+
+	// UPnP MediaRenderer (optional)
+	if opts.UPnPRenderer {
+		s.renderer = renderer.New(renderer.Options{
+			Manager:   opts.SpeakerManager,
+			Port:      opts.Port,
+			PublicURL: opts.PublicURL,
+			Name:      opts.UPnPRendererName,
+		})
+		s.followTicks("UPnP renderer", integrationBuffer, func(d speaker.Delivery) {
+			s.renderer.HandleEvent(d.Event)
+		})
+	}
+
+	// MPD protocol server (optional)
+	if opts.MPDAddr != "" {
+		mpdOpts := mpd.Options{
+			Manager:   opts.SpeakerManager,
+			Playlists: playlistMgr,
+			Audit:     s.audit,
+			Addr:      opts.MPDAddr,
+		}
+		// MPD clients authenticate with the password command, checked
+		// against the same tokens and users as the HTTP API
+		if s.auth != nil {
+			mpdOpts.Authenticate = s.mpdIdentity
+			mpdOpts.Anonymous = s.anonymous()
+		}
+		s.mpd = mpd.New(mpdOpts)
+		if err := s.mpd.Start(); err != nil {
+			log.Printf("Warning: MPD server disabled: %v", err)
+			s.mpd = nil
+		} else {
+			s.follow("MPD", integrationBuffer, func(d speaker.Delivery) {
+				s.mpd.HandleEvent(d.Event)
+			})
+			log.Printf("MPD server listening on %s", opts.MPDAddr)
+		}
+	}
+
+	// MQTT bridge (optional)
+	if opts.MQTT.BrokerURL != "" {
+		mqttOpts := opts.MQTT
+		mqttOpts.Manager = opts.SpeakerManager
+		mqttOpts.State = s.speakerState
+		mqttOpts.Audit = s.audit
+		bridge, err := mqtt.New(mqttOpts)
+		if err != nil {
+			log.Printf("Warning: MQTT disabled: %v", err)
+		} else {
+			s.mqtt = bridge
+			s.mqtt.Start()
+			s.followTicks("MQTT", integrationBuffer, func(d speaker.Delivery) {
+				s.mqtt.HandleEvent(d.Event)
+			})
+		}
+	}
+
+	// Outbound webhooks and per-source volume presets (stored in config)
+	if opts.Config != nil {
+		s.webhooks = webhooks.New(opts.Config, opts.SpeakerManager)
+		s.sourceMem = newSourceMemory(opts.Config, opts.SpeakerManager)
+		s.sourceMem.audit = s.audit
+		s.follow("webhooks", integrationBuffer, func(d speaker.Delivery) {
+			s.webhooks.HandleEvent(d.Event)
+		})
+		s.follow("source presets", integrationBuffer, func(d speaker.Delivery) {
+			s.sourceMem.HandleEvent(d.Event)
+		})
+	}
+
 	s.registerRoutes()
 
+	if s.music != nil {
+		go s.scanMusic()
+	}
+
+	go s.runPositionTicker()
+	go s.runQuietHours()
+
+	if s.renderer != nil {
+		if err := s.renderer.Start(); err != nil {
+			log.Printf("Warning: UPnP renderer will not be discoverable: %v", err)
+		} else {
+			log.Printf("UPnP renderer advertised via SSDP")
+		}
+	}
+
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", opts.Bind, opts.Port),
-		Handler:      loggingMiddleware(s.mux),
+		Handler:      loggingMiddleware(s.apiHandler()),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 0, // SSE needs no write timeout
 		IdleTimeout:  60 * time.Second,
@@ -191,12 +456,18 @@ func (s *Server) getCachedAirableClient(spk *kefw2.KEFSpeaker) *kefw2.AirableCli
 	return client
 }
 
-// Handler returns the server's HTTP handler (with logging middleware).
-// This is useful for serving the same handler on additional listeners (e.g. Tailscale).
+// Handler returns the server's HTTP handler (with logging and auth middleware).
+// This is useful for serving the same handler on additional listeners; the
+// Tailscale listener uses TailscaleHandler to identify its callers.
 func (s *Server) Handler() http.Handler {
 	return s.httpServer.Handler
 }
 
+// apiHandler returns the mux behind the auth and audit middleware.
+func (s *Server) apiHandler() http.Handler {
+	return s.authMiddleware(s.auditMiddleware(s.mux))
+}
+
 // ListenAndServe starts the HTTP server.
 func (s *Server) ListenAndServe() error {
 	return s.httpServer.ListenAndServe()
@@ -204,6 +475,22 @@ func (s *Server) ListenAndServe() error {
 
 // Shutdown gracefully shuts down the HTTP server without interrupting active connections.
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.renderer != nil {
+		s.renderer.Close()
+	}
+	if s.mpd != nil {
+		s.mpd.Close()
+	}
+	if s.mqtt != nil {
+		s.mqtt.Close()
+	}
+	if s.sourceMem != nil {
+		s.sourceMem.Close()
+	}
+	close(s.stopTickers)
+	for _, sub := range s.subs {
+		sub.Close()
+	}
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -212,6 +499,16 @@ func (s *Server) registerRoutes() {
 	// API routes
 	s.mux.HandleFunc("/api/health", s.handleHealth)
 
+	// Authentication (--auth)
+	s.mux.HandleFunc("/login", s.handleLogin)
+	s.mux.HandleFunc("/api/auth/login", s.handleAuthLogin)
+	s.mux.HandleFunc("/api/auth/logout", s.handleAuthLogout)
+	s.mux.HandleFunc("/api/auth/me", s.handleAuthMe)
+	s.mux.HandleFunc("/api/auth/tokens", s.handleAuthTokens)
+	s.mux.HandleFunc("/api/auth/tokens/", s.handleAuthToken) // DELETE single token
+	s.mux.HandleFunc("/api/auth/users", s.handleAuthUsers)
+	s.mux.HandleFunc("/api/auth/users/", s.handleAuthUser) // PUT/DELETE single user
+
 	// Speaker management
 	s.mux.HandleFunc("/api/speakers", s.handleSpeakers)
 	s.mux.HandleFunc("/api/speakers/discover", s.handleSpeakersDiscover)
@@ -232,6 +529,7 @@ func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("/api/player/source", s.handlePlayerSource)
 	s.mux.HandleFunc("/api/player/seek", s.handlePlayerSeek)
 	s.mux.HandleFunc("/api/player/power", s.handlePlayerPower)
+	s.mux.HandleFunc("/api/player/url", s.handlePlayerURL)
 
 	// Queue management
 	s.mux.HandleFunc("/api/queue", s.handleQueue)
@@ -247,6 +545,49 @@ func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("/api/playlists/save-queue", s.handleSaveQueueAsPlaylist)
 	s.mux.HandleFunc("/api/playlists/load/", s.handleLoadPlaylist) // Load playlist to queue
 
+	// Custom radio stations
+	s.mux.HandleFunc("/api/stations", s.handleStations)
+	s.mux.HandleFunc("/api/stations/", s.handleStation) // GET/PUT/DELETE single station
+
+	// Local favorites
+	s.mux.HandleFunc("/api/favorites", s.handleFavorites)
+	s.mux.HandleFunc("/api/favorites/", s.handleFavorite) // GET/PUT/DELETE single favorite
+	s.mux.HandleFunc("/api/favorites/reorder", s.handleFavoritesReorder)
+
+	// Scenes
+	s.mux.HandleFunc("/api/scenes", s.handleScenes)
+	s.mux.HandleFunc("/api/scenes/", s.handleScene) // GET/PUT/DELETE single scene, POST .../recall
+
+	// Automation rules
+	s.mux.HandleFunc("/api/rules", s.handleRules)
+	s.mux.HandleFunc("/api/rules/", s.handleRule) // GET/PUT/DELETE single rule, GET .../runs, POST .../test
+
+	// Audit log
+	s.mux.HandleFunc("/api/audit", s.handleAudit)
+
+	// Webhooks
+	s.mux.HandleFunc("/api/webhooks", s.handleWebhooks)
+	s.mux.HandleFunc("/api/webhooks/", s.handleWebhook) // GET/PUT/DELETE single webhook, GET .../deliveries, POST .../test
+
+	// Announcements
+	s.mux.HandleFunc("/api/announce", s.handleAnnounce)
+	s.mux.HandleFunc("/api/clips", s.handleClips)
+	s.mux.HandleFunc("/api/clips/", s.handleClip) // GET audio, DELETE
+
+	// Local music (--music-dir)
+	s.mux.HandleFunc("/api/music", s.handleMusic)
+	s.mux.HandleFunc("/api/music/rescan", s.handleMusicRescan)
+	s.mux.HandleFunc("/api/music/files/", s.handleMusicFile)
+	s.mux.HandleFunc("/api/music/art/", s.handleMusicArt)
+
+	// Subsonic/OpenSubsonic API
+	s.mux.HandleFunc("/rest/", s.handleSubsonic)
+
+	// UPnP MediaRenderer (--upnp-renderer)
+	if s.renderer != nil {
+		s.mux.Handle(renderer.BasePath, s.renderer)
+	}
+
 	// Content browsing
 	s.mux.HandleFunc("/api/browse/", s.handleBrowse)
 
@@ -258,12 +599,37 @@ func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("/api/upnp/servers", s.handleUPnPServers)
 	s.mux.HandleFunc("/api/upnp/containers", s.handleUPnPContainers)
 	s.mux.HandleFunc("/api/upnp/reindex", s.handleUPnPReindex)
+	s.mux.HandleFunc("/api/upnp/bookmarks", s.handleUPnPBookmarks)
+	s.mux.HandleFunc("/api/upnp/bookmarks/", s.handleUPnPBookmark) // GET/PUT/DELETE single bookmark
 
 	// SSE endpoint
 	s.mux.HandleFunc("/events", s.handleSSE)
 
+	// WebSocket endpoint: events and JSON-RPC commands
+	s.mux.HandleFunc("/ws", s.handleWebSocket)
+
 	// MCP server
-	mcpHandler := mcppkg.NewMCPHandler(s.manager, s.playlists, s.airableCache, s.BroadcastPlaylistsChanged)
+	mcpHandler := mcppkg.NewMCPHandler(mcppkg.Options{
+		Config:           s.opts.Config,
+		SpeakerManager:   s.manager,
+		Playlists:        s.playlists,
+		Stations:         s.stations,
+		Favorites:        s.favorites,
+		Scenes:           s.scenes,
+		Rules:            s.rules,
+		Audit:            s.audit,
+		Clips:            s.clips,
+		Announcer:        s.announcer,
+		AirableCache:     s.airableCache,
+		SpeakerState:     s.speakerState,
+		Events:           s.events,
+		MediaBaseURL:     s.MediaBaseURL,
+		OnPlaylistChange: s.BroadcastPlaylistsChanged,
+		OnSceneChange:    s.BroadcastScenesChanged,
+		OnSceneRecall:    s.BroadcastSceneRecalled,
+		OnRuleChange:     s.BroadcastRulesChanged,
+		OnAnnouncement:   s.BroadcastAnnouncement,
+	})
 	s.mux.Handle("/api/mcp", mcpHandler)
 
 	// Static frontend files
@@ -271,35 +637,29 @@ func (s *Server) registerRoutes() {
 }
 
 // HandleSpeakerHealth is called by the speaker manager when speaker connectivity changes.
-// It broadcasts a speakerHealth SSE event to all connected clients.
+// It publishes a speakerHealth event to clients and integrations.
 func (s *Server) HandleSpeakerHealth(connected bool) {
-	payload, err := json.Marshal(map[string]any{
-		"type": "speakerHealth",
-		"data": map[string]any{
-			"connected": connected,
-		},
-	})
-	if err != nil {
-		log.Printf("Error marshaling speakerHealth event: %v", err)
-		return
+	// Events may have been missed while disconnected; query the speaker
+	// again once it is back, unless that would wake it from standby
+	if spk := s.manager.GetActiveSpeaker(); spk != nil {
+		s.speakerState.Invalidate(spk.IPAddress)
+		if connected && !s.manager.IsInStandby() {
+			go func() { _, _ = s.speakerState.Get(context.Background(), spk) }()
+		}
 	}
 
-	s.broadcastSSE(payload)
+	s.publish(speaker.HealthChanged{Connected: connected})
 }
 
 // BroadcastPlaylistsChanged sends a "playlists" SSE event to all connected
 // clients so they can refresh their playlist lists. Called after any playlist
 // CRUD operation (create, update, delete) from both REST and MCP handlers.
 func (s *Server) BroadcastPlaylistsChanged() {
-	payload, err := json.Marshal(map[string]any{
-		"type": "playlists",
-	})
-	if err != nil {
-		log.Printf("Error marshaling playlists event: %v", err)
-		return
-	}
+	s.publish(PlaylistsChanged{})
 
-	s.broadcastSSE(payload)
+	if s.mpd != nil {
+		s.mpd.Notify(mpd.SubsystemStoredPlaylist)
+	}
 }
 
 // HandleSpeakerEvent is called by the speaker manager when events occur.
@@ -308,186 +668,32 @@ func (s *Server) HandleSpeakerEvent(event kefw2.Event) {
 		return
 	}
 
-	var eventData map[string]any
+	// Update the state first, so subscribers of the event read it
+	if spk := s.manager.GetActiveSpeaker(); spk != nil {
+		s.speakerState.HandleEvent(spk.IPAddress, event)
+	}
 
 	switch e := event.(type) {
 	case *kefw2.VolumeEvent:
-		eventData = map[string]any{
-			"type": "volume",
-			"data": map[string]any{
-				"volume": e.Volume,
-			},
-		}
-	case *kefw2.MuteEvent:
-		eventData = map[string]any{
-			"type": "mute",
-			"data": map[string]any{
-				"muted": e.Muted,
-			},
-		}
+		s.enforceVolumeCap(e.Volume)
 	case *kefw2.SourceEvent:
-		eventData = map[string]any{
-			"type": "source",
-			"data": map[string]any{
-				"source": string(e.Source),
-			},
-		}
 		// Track standby state so the event reconnection loop can pause
 		if e.Source == kefw2.SourceStandby {
 			s.manager.NotifyStandby()
 		} else {
 			s.manager.NotifyWake()
 		}
-	case *kefw2.PowerEvent:
-		eventData = map[string]any{
-			"type": "power",
-			"data": map[string]any{
-				"status": string(e.Status),
-			},
-		}
-	case *kefw2.PlayerDataEvent:
-		eventData = map[string]any{
-			"type": "player",
-			"data": map[string]any{
-				"state":    e.State,
-				"title":    e.Title,
-				"artist":   e.Artist,
-				"album":    e.Album,
-				"duration": e.Duration,
-				"icon":     s.proxyIconURL(e.Icon),
-			},
-		}
-	case *kefw2.PlayTimeEvent:
-		eventData = map[string]any{
-			"type": "playTime",
-			"data": map[string]any{
-				"position": e.PositionMS,
-			},
-		}
-	case *kefw2.PlayModeEvent:
-		eventData = map[string]any{
-			"type": "playMode",
-			"data": map[string]any{
-				"mode": e.Mode,
-			},
-		}
-	case *kefw2.PlaylistEvent:
-		eventData = map[string]any{
-			"type": "queue",
-			"data": map[string]any{
-				"changes": e.Changes,
-				"version": e.Version,
-			},
-		}
-	default:
-		// Ignore unknown events
-		return
-	}
-
-	payload, err := json.Marshal(eventData)
-	if err != nil {
-		log.Printf("Error marshaling event: %v", err)
-		return
 	}
 
-	s.broadcastSSE(payload)
+	s.publish(speaker.FromKEF(event))
 }
 
-// broadcastSSE sends data to all connected SSE clients.
-func (s *Server) broadcastSSE(data []byte) {
-	s.sseClientsMu.RLock()
-	defer s.sseClientsMu.RUnlock()
-
-	for clientChan := range s.sseClients {
-		select {
-		case clientChan <- data:
-		default:
-			// Client buffer full, skip
-		}
-	}
-}
-
-// broadcastCurrentState sends the current speaker/player state to all SSE clients.
-// Called when the active speaker changes so all clients get the new state.
+// broadcastCurrentState publishes the current speaker/player state.
+// Called when the active speaker changes so all clients and integrations get
+// the new state.
 func (s *Server) broadcastCurrentState() {
-	spk := s.manager.GetActiveSpeaker()
-	if spk == nil {
-		return
-	}
-
-	ctx := context.Background()
-
-	// Broadcast speaker info
-	if speakerData, err := json.Marshal(map[string]any{
-		"type": "speaker",
-		"data": map[string]any{
-			"ip":    spk.IPAddress,
-			"name":  spk.Name,
-			"model": spk.Model,
-		},
-	}); err == nil {
-		s.broadcastSSE(speakerData)
-	}
-
-	// Broadcast current volume
-	if volume, err := spk.GetVolume(ctx); err == nil {
-		if volumeData, err := json.Marshal(map[string]any{
-			"type": "volume",
-			"data": map[string]any{"volume": volume},
-		}); err == nil {
-			s.broadcastSSE(volumeData)
-		}
-	}
-
-	// Broadcast mute state
-	if muted, err := spk.IsMuted(ctx); err == nil {
-		if muteData, err := json.Marshal(map[string]any{
-			"type": "mute",
-			"data": map[string]any{"muted": muted},
-		}); err == nil {
-			s.broadcastSSE(muteData)
-		}
-	}
-
-	// Broadcast source
-	if source, err := spk.Source(ctx); err == nil {
-		if sourceData, err := json.Marshal(map[string]any{
-			"type": "source",
-			"data": map[string]any{"source": string(source)},
-		}); err == nil {
-			s.broadcastSSE(sourceData)
-		}
-	}
-
-	// Broadcast power state
-	if status, err := spk.SpeakerState(ctx); err == nil {
-		if powerData, err := json.Marshal(map[string]any{
-			"type": "power",
-			"data": map[string]any{"status": string(status)},
-		}); err == nil {
-			s.broadcastSSE(powerData)
-		}
-	}
-
-	// Broadcast player data
-	if playerData, err := spk.PlayerData(ctx); err == nil {
-		position, _ := spk.SongProgressMS(ctx)
-		if playerEventData, err := json.Marshal(map[string]any{
-			"type": "player",
-			"data": map[string]any{
-				"state":     playerData.State,
-				"title":     playerData.TrackRoles.Title,
-				"artist":    playerData.TrackRoles.MediaData.MetaData.Artist,
-				"album":     playerData.TrackRoles.MediaData.MetaData.Album,
-				"icon":      s.proxyIconURL(playerData.TrackRoles.Icon),
-				"duration":  playerData.Status.Duration,
-				"position":  position,
-				"audioType": playerData.MediaRoles.AudioType,
-				"live":      playerData.MediaRoles.MediaData.MetaData.Live,
-			},
-		}); err == nil {
-			s.broadcastSSE(playerEventData)
-		}
+	for _, event := range s.currentStateEvents() {
+		s.publish(event)
 	}
 }
 
@@ -719,13 +925,7 @@ func (s *Server) handleSpeakerGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
-
-	// Get current state
-	source, _ := spk.Source(ctx)
-	volume, _ := spk.GetVolume(ctx)
-	muted, _ := spk.IsMuted(ctx)
-	status, _ := spk.SpeakerState(ctx)
+	state, _ := s.speakerState.Get(r.Context(), spk)
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
@@ -734,11 +934,12 @@ func (s *Server) handleSpeakerGet(w http.ResponseWriter, r *http.Request) {
 			"name":     spk.Name,
 			"model":    spk.Model,
 			"firmware": spk.FirmwareVersion,
-			"source":   string(source),
-			"volume":   volume,
-			"muted":    muted,
-			"status":   string(status),
+			"source":   string(state.Source),
+			"volume":   state.Volume,
+			"muted":    state.Muted,
+			"status":   string(state.Power),
 		},
+		"cache": stateCacheInfo(state),
 	})
 }
 
@@ -879,44 +1080,70 @@ func (s *Server) handleProxyImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check cache (memory then disk)
-	if cached := s.imageCache.Get(targetURL); cached != nil {
-		if cached.ContentType != "" {
-			w.Header().Set("Content-Type", cached.ContentType)
+	entry, hit, err := s.fetchImage(r.Context(), targetURL)
+	if err != nil {
+		var fetchErr *imageFetchError
+		if errors.As(err, &fetchErr) {
+			http.Error(w, fetchErr.message, fetchErr.status)
+			return
 		}
-		w.Header().Set("Cache-Control", "public, max-age=3600")
-		w.Header().Set("X-Cache", "HIT")
-		_, _ = w.Write(cached.Data)
+		http.Error(w, "Failed to fetch image", http.StatusBadGateway)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+
+	_, _ = w.Write(entry.Data)
+}
+
+// imageFetchError is a failed image fetch with the HTTP status to report.
+type imageFetchError struct {
+	status  int
+	message string
+}
+
+func (e *imageFetchError) Error() string {
+	return e.message
+}
+
+// fetchImage returns an image from the image cache (memory then disk),
+// fetching and caching it on a miss. hit reports whether it was cached.
+func (s *Server) fetchImage(ctx context.Context, targetURL string) (entry *imageCacheEntry, hit bool, err error) {
+	if cached := s.imageCache.Get(targetURL); cached != nil {
+		return cached, true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
 	if err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
-		return
+		return nil, false, &imageFetchError{http.StatusInternalServerError, "Failed to create request"}
 	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		http.Error(w, "Failed to fetch image", http.StatusBadGateway)
-		return
+		return nil, false, &imageFetchError{http.StatusBadGateway, "Failed to fetch image"}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		http.Error(w, "Upstream error", resp.StatusCode)
-		return
+		return nil, false, &imageFetchError{resp.StatusCode, "Upstream error"}
 	}
 
 	// Read the body (limited to 10MB)
 	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
 	if err != nil {
-		http.Error(w, "Failed to read image", http.StatusBadGateway)
-		return
+		return nil, false, &imageFetchError{http.StatusBadGateway, "Failed to read image"}
 	}
 
 	contentType := resp.Header.Get("Content-Type")
@@ -924,13 +1151,7 @@ func (s *Server) handleProxyImage(w http.ResponseWriter, r *http.Request) {
 	// Store in cache
 	s.imageCache.Put(targetURL, data, contentType)
 
-	if contentType != "" {
-		w.Header().Set("Content-Type", contentType)
-	}
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-	w.Header().Set("X-Cache", "MISS")
-
-	_, _ = w.Write(data)
+	return &imageCacheEntry{Data: data, ContentType: contentType, FetchedAt: time.Now()}, false, nil
 }
 
 // handlePlayer returns the current player state.
@@ -965,52 +1186,16 @@ func (s *Server) handlePlayer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	state, _ := s.speakerState.Get(r.Context(), spk)
 
-	// Get player data
-	playerData, err := spk.PlayerData(ctx)
-	if err != nil {
-		// If we can't get player data, return basic state
-		volume, _ := spk.GetVolume(ctx)
-		muted, _ := spk.IsMuted(ctx)
-		source, _ := spk.Source(ctx)
-
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"state":    "stopped",
-			"volume":   volume,
-			"muted":    muted,
-			"source":   string(source),
-			"title":    "",
-			"artist":   "",
-			"album":    "",
-			"icon":     "",
-			"duration": 0,
-			"position": 0,
-		})
-		return
-	}
-
-	volume, _ := spk.GetVolume(ctx)
-	muted, _ := spk.IsMuted(ctx)
-	source, _ := spk.Source(ctx)
-	position, _ := spk.SongProgressMS(ctx)
+	resp := s.playerStateData(state.Player)
+	resp["volume"] = state.Volume
+	resp["muted"] = state.Muted
+	resp["source"] = string(state.Source)
+	resp["cache"] = stateCacheInfo(state)
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"state":     playerData.State,
-		"volume":    volume,
-		"muted":     muted,
-		"source":    string(source),
-		"title":     playerData.TrackRoles.Title,
-		"artist":    playerData.TrackRoles.MediaData.MetaData.Artist,
-		"album":     playerData.TrackRoles.MediaData.MetaData.Album,
-		"icon":      s.proxyIconURL(playerData.TrackRoles.Icon),
-		"duration":  playerData.Status.Duration,
-		"position":  position,
-		"audioType": playerData.MediaRoles.AudioType,
-		"live":      playerData.MediaRoles.MediaData.MetaData.Live,
-	})
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
 // handlePlayerPlay intelligently resumes or starts playback from the queue.
@@ -1144,6 +1329,7 @@ func (s *Server) handlePlayerSeek(w http.ResponseWriter, r *http.Request) {
 		s.jsonError(w, "Seek failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.setPosition(spk, int64(req.PositionMS))
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
@@ -1272,13 +1458,16 @@ func (s *Server) handlePlayerVolume(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := spk.SetVolume(r.Context(), req.Volume); err != nil {
+		// Lowered to the quiet-hours cap
+		volume, err := s.manager.SetVolume(r.Context(), spk, req.Volume, speaker.OriginAPI)
+		if err != nil {
 			s.jsonError(w, "Failed to set volume: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		clamped := volume < req.Volume
 
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{"volume": req.Volume})
+		_ = json.NewEncoder(w).Encode(map[string]any{"volume": volume, "clamped": clamped})
 
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -2000,83 +2189,8 @@ func (s *Server) handleLoadPlaylist(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	// Convert playlist tracks to ContentItems, filtering out non-playable items.
-	// For UPnP tracks that have a browsable path but no stream URI, resolve the
-	// full track details from the speaker API (the speaker returns the stream URL).
-	contentItems := make([]kefw2.ContentItem, 0, len(pl.Tracks))
-	skipped := 0
-	for _, track := range pl.Tracks {
-		// Skip containers (albums, folders) — they can't be played as individual tracks
-		if track.Type == contentTypeContainer {
-			skipped++
-			continue
-		}
-
-		// Skip tracks with no playback URI and no browsable path
-		if track.URI == "" && track.Path == "" {
-			skipped++
-			continue
-		}
-
-		// If the track has a browsable path but no stream URI, resolve it
-		// from the speaker API to get the full ContentItem with stream URL.
-		// This handles UPnP tracks that were added to playlists by path only.
-		if track.URI == "" && track.Path != "" {
-			resp, resolveErr := airable.GetRows(track.Path, 0, 1)
-			if resolveErr == nil {
-				var resolved *kefw2.ContentItem
-				switch {
-				case resp.Roles != nil:
-					resolved = resp.Roles
-				case len(resp.Rows) > 0:
-					resolved = &resp.Rows[0]
-				}
-				if resolved != nil {
-					contentItems = append(contentItems, *resolved)
-					continue
-				}
-			}
-			// Resolution failed — fall through to manual construction
-			skipped++
-			continue
-		}
-
-		// Determine service ID, default to UPnP for local media
-		serviceID := track.ServiceID
-		if serviceID == "" {
-			serviceID = "UPnP"
-		}
-
-		// Fix paths: queue-internal paths like "playlists:item/N" are ephemeral
-		// and can't be resolved by the speaker. Use the URI as the path instead,
-		// which works for addexternalitems since the speaker plays from the URI.
-		path := track.Path
-		if strings.HasPrefix(path, "playlists:item/") || path == "" {
-			path = track.URI
-		}
-
-		contentItems = append(contentItems, kefw2.ContentItem{
-			Title: track.Title,
-			ID:    track.ID,
-			Path:  path,
-			Icon:  track.Icon,
-			Type:  track.Type,
-			MediaData: &kefw2.MediaData{
-				MetaData: kefw2.MediaMetaData{
-					Artist:    track.Artist,
-					Album:     track.Album,
-					ServiceID: serviceID,
-				},
-				Resources: []kefw2.MediaResource{
-					{
-						URI:      track.URI,
-						MimeType: track.MimeType,
-						Duration: track.Duration,
-					},
-				},
-			},
-		})
-	}
+	// Convert playlist tracks to ContentItems, filtering out non-playable items
+	contentItems, skipped := playlist.ContentItems(airable, pl.Tracks)
 
 	if len(contentItems) == 0 {
 		s.jsonError(w, "No playable tracks in playlist", http.StatusBadRequest)
@@ -2125,6 +2239,7 @@ type BrowseItem struct {
 	MediaData     *kefw2.MediaData `json:"mediaData,omitempty"`     // Required for queue playback of airable content
 	ContainerPath string           `json:"containerPath,omitempty"` // Parent container path for podcast episodes
 	SearchQuery   string           `json:"searchQuery,omitempty"`   // If set, clicking triggers this search instead of browsing
+	Source        string           `json:"source,omitempty"`        // Originating source for items listed under favorites
 }
 
 // handleBrowse handles content browsing for UPnP, Radio, and Podcasts.
@@ -2136,6 +2251,9 @@ type BrowseItem struct {
 //   - GET /api/browse/radio/search?q=query - Search radio stations
 //   - GET /api/browse/podcasts - Podcast menu
 //   - GET /api/browse/podcasts/search?q=query - Search podcasts
+//   - GET /api/browse/stations - Custom radio stations
+//   - GET /api/browse/favorites - Local favorites (?tag= filters by tag)
+//   - GET /api/browse/music - Local music directory (--music-dir)
 //   - POST /api/browse/play - Play an item
 //   - POST /api/browse/queue - Add an item to the queue
 func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
@@ -2183,6 +2301,12 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 		s.handleBrowsePodcasts(w, r, "")
 	case strings.HasPrefix(path, browseSourcePodcasts+"/"):
 		s.handleBrowsePodcasts(w, r, strings.TrimPrefix(path, browseSourcePodcasts+"/"))
+	case path == browseSourceStations:
+		s.handleBrowseStations(w, r)
+	case path == browseSourceFavorites:
+		s.handleBrowseFavorites(w, r)
+	case path == browseSourceMusic:
+		s.handleBrowseMusic(w, r)
 	default:
 		s.jsonError(w, "Unknown browse path", http.StatusNotFound)
 	}
@@ -2209,6 +2333,27 @@ func (s *Server) handleBrowseSources(w http.ResponseWriter, _ *http.Request) {
 			"description": "Browse and search podcasts",
 			"icon":        "podcast",
 		},
+		{
+			"id":          "favorites",
+			"name":        "Favorites",
+			"description": "Your saved tracks, folders, stations and podcasts",
+			"icon":        "star",
+		},
+		{
+			"id":          "stations",
+			"name":        "My Stations",
+			"description": "Your own internet radio stream URLs",
+			"icon":        "radio",
+		},
+	}
+
+	if s.music != nil {
+		sources = append(sources, map[string]any{
+			"id":          browseSourceMusic,
+			"name":        "Music Folder",
+			"description": "Music files on the kefw2ui host",
+			"icon":        "folder",
+		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -2227,10 +2372,15 @@ func (s *Server) handleBrowseUPnP(w http.ResponseWriter, r *http.Request, subpat
 		return
 	}
 
+	page, err := parseBrowsePage(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	airable := s.getCachedAirableClient(spk)
 
 	var resp *kefw2.RowsResponse
-	var err error
 
 	// Check for search query first
 	searchQuery := r.URL.Query().Get("q")
@@ -2310,10 +2460,12 @@ func (s *Server) handleBrowseUPnP(w http.ResponseWriter, r *http.Request, subpat
 			items = append(items, item)
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
+		totalCount := len(items)
+		items = page.slice(items)
+
+		out := map[string]any{
 			"items":      items,
-			"totalCount": len(items),
+			"totalCount": totalCount,
 			"source":     "upnp",
 			"search":     true,
 			"indexInfo": map[string]any{
@@ -2321,13 +2473,32 @@ func (s *Server) handleBrowseUPnP(w http.ResponseWriter, r *http.Request, subpat
 				"trackCount": len(index.Tracks),
 				"indexedAt":  index.IndexedAt,
 			},
-		})
+		}
+		if next := page.nextCursor(len(items), totalCount); next != "" {
+			out["nextCursor"] = next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
 		return
 	}
 
 	// Check for direct path navigation first (used when clicking into containers)
 	itemPath := r.URL.Query().Get("path")
 
+	// Bookmarks are listed at the top level, ahead of servers or the browse container
+	showBookmarks := itemPath == "" && subpath == ""
+
+	// Bookmarks resolve to the container they point at
+	if strings.HasPrefix(itemPath, bookmarkPathPrefix) {
+		resolvedPath, resolveErr := s.resolveBookmark(airable, itemPath)
+		if resolveErr != nil {
+			s.jsonError(w, "Failed to open bookmark: "+resolveErr.Error(), http.StatusNotFound)
+			return
+		}
+		itemPath = resolvedPath
+	}
+
 	// If no path provided, check for configured browse container
 	if itemPath == "" && subpath == "" {
 		if s.opts.Config != nil {
@@ -2343,23 +2514,42 @@ func (s *Server) handleBrowseUPnP(w http.ResponseWriter, r *http.Request, subpat
 		}
 	}
 
+	// Bookmarks come first, so a page may be split between bookmarks and rows
+	var bookmarks []BrowseItem
+	if showBookmarks {
+		bookmarks = s.bookmarkBrowseItems()
+	}
+	head, rowOffset, rowLimit := page.split(bookmarks)
+
+	// Containers are fetched a page at a time when the client asked for one
+	browseContainer := func(path string) (*kefw2.RowsResponse, error) {
+		if page.paged() {
+			return pagination.FetchRows(airable, path, rowOffset, rowLimit)
+		}
+		return airable.BrowseContainerAll(path)
+	}
+
+	containerPaged := page.paged()
 	switch {
 	case itemPath != "":
 		// Direct path navigation takes priority
-		resp, err = airable.BrowseContainerAll(itemPath)
+		resp, err = browseContainer(itemPath)
 	case subpath == "":
 		// List media servers (fallback if no browse container configured)
 		resp, err = airable.GetMediaServers()
+		containerPaged = false
 	case strings.HasPrefix(subpath, "upnp:"):
 		// Full API path in subpath
-		resp, err = airable.BrowseContainerAll(subpath)
+		resp, err = browseContainer(subpath)
 	default:
 		// Try to match by server name
 		resp, err = airable.GetMediaServers()
+		containerPaged = false
 		if err == nil && len(resp.Rows) > 0 {
 			for _, server := range resp.Rows {
 				if server.Title == subpath && server.Type != "query" {
-					resp, err = airable.BrowseContainerAll(server.Path)
+					resp, err = browseContainer(server.Path)
+					containerPaged = page.paged()
 					break
 				}
 			}
@@ -2372,7 +2562,13 @@ func (s *Server) handleBrowseUPnP(w http.ResponseWriter, r *http.Request, subpat
 	}
 
 	// Convert to API response format
-	items := make([]BrowseItem, 0, len(resp.Rows))
+	items := make([]BrowseItem, 0, len(bookmarks)+len(resp.Rows))
+	totalCount := resp.RowsCount + len(bookmarks)
+	if containerPaged {
+		items = append(items, head...)
+	} else {
+		items = append(items, bookmarks...)
+	}
 	for _, row := range resp.Rows {
 		item := BrowseItem{
 			Title:     row.Title,
@@ -2400,12 +2596,25 @@ func (s *Server) handleBrowseUPnP(w http.ResponseWriter, r *http.Request, subpat
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{
+	// Server listings are small and fetched whole, so page them here
+	consumed := len(head) + len(resp.Rows)
+	if page.paged() && !containerPaged {
+		items = page.slice(items)
+		totalCount = len(bookmarks) + len(resp.Rows)
+		consumed = len(items)
+	}
+
+	out := map[string]any{
 		"items":      items,
-		"totalCount": resp.RowsCount,
+		"totalCount": totalCount,
 		"source":     "upnp",
-	})
+	}
+	if next := page.nextCursor(consumed, totalCount); next != "" {
+		out["nextCursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
 }
 
 // handleBrowseRadio handles internet radio browsing.
@@ -2416,42 +2625,55 @@ func (s *Server) handleBrowseRadio(w http.ResponseWriter, r *http.Request, subpa
 		return
 	}
 
-	airable := s.getCachedAirableClient(spk)
-
-	var resp *kefw2.RowsResponse
-	var err error
-
 	// Check for search query
 	searchQuery := r.URL.Query().Get("q")
 	// Check for direct path navigation (used when clicking into containers)
 	itemPath := r.URL.Query().Get("path")
 
+	// Custom stations are stored locally, not in the Airable catalog
+	if itemPath == stations.ContainerPath || subpath == "custom" {
+		s.handleBrowseStations(w, r)
+		return
+	}
+
+	page, err := parseBrowsePage(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	airable := s.getCachedAirableClient(spk)
+
+	var resp *kefw2.RowsResponse
+
+	// Containers opened by path and categories are fetched a page at a
+	// time when paging; everything else is loaded whole and paged below
+	containerPaged := false
+
 	switch {
 	case searchQuery != "":
 		resp, err = airable.SearchRadio(searchQuery)
 	case itemPath != "":
 		// Direct path navigation takes priority
 		// For favorites, don't cache as it changes frequently
+		client := airable
 		if strings.HasSuffix(itemPath, "/favorites") {
-			uncachedAirable := kefw2.NewAirableClient(spk)
-			resp, err = uncachedAirable.GetRows(itemPath, 0, 100)
-		} else {
+			client = kefw2.NewAirableClient(spk)
+		}
+		switch {
+		case page.paged():
+			resp, err = pagination.FetchRows(client, itemPath, page.offset, page.limit)
+			containerPaged = true
+		case client != airable:
+			resp, err = client.GetRows(itemPath, 0, 100)
+		default:
 			resp, err = airable.BrowseRadioByItemPath(itemPath)
 		}
 	case subpath == "" || subpath == "menu":
 		resp, err = airable.GetRadioMenu()
-	case subpath == "favorites":
-		resp, err = airable.GetRadioFavorites()
-	case subpath == "local":
-		resp, err = airable.GetRadioLocal()
-	case subpath == "popular":
-		resp, err = airable.GetRadioPopular()
-	case subpath == "trending":
-		resp, err = airable.GetRadioTrending()
-	case subpath == "hq":
-		resp, err = airable.GetRadioHQ()
-	case subpath == "new":
-		resp, err = airable.GetRadioNew()
+	case radioCategories[subpath] != nil:
+		resp, err = page.category(airable, kefw2.ServiceRadio, subpath, radioCategories[subpath])
+		containerPaged = page.paged()
 	default:
 		// Try display path navigation
 		resp, err = airable.BrowseRadioByDisplayPath(subpath)
@@ -2480,12 +2702,41 @@ func (s *Server) handleBrowseRadio(w http.ResponseWriter, r *http.Request, subpa
 		items = append(items, item)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{
+	totalCount := resp.RowsCount
+	switch {
+	case searchQuery != "":
+		// Matching custom stations are listed ahead of catalog results
+		custom := s.customStationItems(searchQuery)
+		items = append(custom, items...)
+		totalCount += len(custom)
+	case itemPath == "" && (subpath == "" || subpath == "menu") && s.stations != nil:
+		items = append(items, BrowseItem{
+			Title:       "My Stations",
+			Type:        contentTypeContainer,
+			Path:        stations.ContainerPath,
+			Description: "Your own internet radio stream URLs",
+		})
+		totalCount++
+	}
+
+	consumed := len(items)
+	if page.paged() && !containerPaged {
+		totalCount = len(items)
+		items = page.slice(items)
+		consumed = len(items)
+	}
+
+	out := map[string]any{
 		"items":      items,
-		"totalCount": resp.RowsCount,
+		"totalCount": totalCount,
 		"source":     "radio",
-	})
+	}
+	if next := page.nextCursor(consumed, totalCount); next != "" {
+		out["nextCursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
 }
 
 // handleBrowsePodcasts handles podcast browsing.
@@ -2496,39 +2747,47 @@ func (s *Server) handleBrowsePodcasts(w http.ResponseWriter, r *http.Request, su
 		return
 	}
 
+	page, err := parseBrowsePage(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	airable := s.getCachedAirableClient(spk)
 
 	var resp *kefw2.RowsResponse
-	var err error
 
 	// Check for search query
 	searchQuery := r.URL.Query().Get("q")
 	// Check for direct path navigation (used when clicking into containers)
 	itemPath := r.URL.Query().Get("path")
 
+	// Containers opened by path and categories are fetched a page at a
+	// time when paging; everything else is loaded whole and paged below
+	containerPaged := false
+
 	switch {
 	case searchQuery != "":
 		resp, err = airable.SearchPodcasts(searchQuery)
 	case itemPath != "":
 		// Direct path navigation takes priority
 		// For favorites and history, don't cache as these change frequently
+		client := airable
 		if strings.HasSuffix(itemPath, "/favorites") || strings.HasSuffix(itemPath, "/history") {
 			// Use uncached client for dynamic content
-			uncachedAirable := kefw2.NewAirableClient(spk)
-			resp, err = uncachedAirable.GetRows(itemPath, 0, 100)
+			client = kefw2.NewAirableClient(spk)
+		}
+		if page.paged() {
+			resp, err = pagination.FetchRows(client, itemPath, page.offset, page.limit)
+			containerPaged = true
 		} else {
-			resp, err = airable.GetRows(itemPath, 0, 100)
+			resp, err = client.GetRows(itemPath, 0, 100)
 		}
 	case subpath == "" || subpath == "menu":
 		resp, err = airable.GetPodcastMenu()
-	case subpath == "favorites":
-		resp, err = airable.GetPodcastFavorites()
-	case subpath == "popular":
-		resp, err = airable.GetPodcastPopular()
-	case subpath == "trending":
-		resp, err = airable.GetPodcastTrending()
-	case subpath == "history":
-		resp, err = airable.GetPodcastHistory()
+	case podcastCategories[subpath] != nil:
+		resp, err = page.category(airable, kefw2.ServicePodcast, subpath, podcastCategories[subpath])
+		containerPaged = page.paged()
 	default:
 		// Try display path navigation
 		resp, err = airable.BrowsePodcastByDisplayPath(subpath)
@@ -2575,12 +2834,25 @@ func (s *Server) handleBrowsePodcasts(w http.ResponseWriter, r *http.Request, su
 		items = append(items, item)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{
+	totalCount := resp.RowsCount
+	consumed := len(items)
+	if page.paged() && !containerPaged {
+		totalCount = len(items)
+		items = page.slice(items)
+		consumed = len(items)
+	}
+
+	out := map[string]any{
 		"items":      items,
-		"totalCount": resp.RowsCount,
+		"totalCount": totalCount,
 		"source":     "podcasts",
-	})
+	}
+	if next := page.nextCursor(consumed, totalCount); next != "" {
+		out["nextCursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
 }
 
 // handleBrowsePlay handles playing a browsed item.
@@ -2593,7 +2865,7 @@ func (s *Server) handleBrowsePlay(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		Path          string           `json:"path"`
-		Source        string           `json:"source"` // "upnp", "radio", "podcasts"
+		Source        string           `json:"source"` // "upnp", "radio", "podcasts", "stations", "favorites"
 		Type          string           `json:"type"`   // "audio", "container"
 		AudioType     string           `json:"audioType,omitempty"`
 		Title         string           `json:"title,omitempty"`
@@ -2613,7 +2885,55 @@ func (s *Server) handleBrowsePlay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Favorites are played through the source they were saved from
+	if req.Source == browseSourceFavorites {
+		fav, source := s.resolveFavorite(req.Path)
+		if source == "" {
+			s.jsonError(w, "Unknown source for favorite", http.StatusBadRequest)
+			return
+		}
+		req.Source = source
+		if fav != nil {
+			req.Type = fav.Type
+			if req.Title == "" {
+				req.Title = fav.Title
+			}
+			if req.Icon == "" {
+				req.Icon = fav.Icon
+			}
+			if req.AudioType == "" {
+				req.AudioType = fav.AudioType
+			}
+			if req.MediaData == nil {
+				req.MediaData = fav.MediaData
+			}
+			if req.ContainerPath == "" {
+				req.ContainerPath = fav.ContainerPath
+			}
+		}
+	}
+
+	// Custom stations may be browsed from the radio menu or their own source
+	if stations.IsStationPath(req.Path) {
+		req.Source = browseSourceStations
+	}
+	if music.IsMusicPath(req.Path) {
+		req.Source = browseSourceMusic
+	}
+
 	airable := kefw2.NewAirableClient(spk)
+
+	// Bookmarked folders play like any other UPnP container
+	if strings.HasPrefix(req.Path, bookmarkPathPrefix) {
+		resolvedPath, resolveErr := s.resolveBookmark(airable, req.Path)
+		if resolveErr != nil {
+			s.jsonError(w, "Failed to open bookmark: "+resolveErr.Error(), http.StatusNotFound)
+			return
+		}
+		req.Path = resolvedPath
+		req.Source = browseSourceUPnP
+		req.Type = contentTypeContainer
+	}
 	var err error
 
 	switch req.Source {
@@ -2623,6 +2943,20 @@ func (s *Server) handleBrowsePlay(w http.ResponseWriter, r *http.Request) {
 		} else {
 			err = airable.PlayUPnPByPath(req.Path)
 		}
+	case browseSourceStations:
+		station, getErr := s.getStation(req.Path)
+		if getErr != nil {
+			s.jsonError(w, getErr.Error(), http.StatusNotFound)
+			return
+		}
+		err = airable.PlayUPnPTracks([]kefw2.ContentItem{station.ContentItem()})
+	case browseSourceMusic:
+		items, itemsErr := s.musicContentItems(req.Path)
+		if itemsErr != nil {
+			s.jsonError(w, itemsErr.Error(), http.StatusNotFound)
+			return
+		}
+		err = airable.PlayUPnPTracks(items)
 	case browseSourceRadio:
 		// Get station details and play
 		station, getErr := airable.GetRadioStationDetails(req.Path)
@@ -2676,7 +3010,7 @@ func (s *Server) handleBrowseAddToQueue(w http.ResponseWriter, r *http.Request)
 
 	var req struct {
 		Path      string           `json:"path"`
-		Source    string           `json:"source"` // "upnp", "radio", "podcasts"
+		Source    string           `json:"source"` // "upnp", "radio", "podcasts", "stations", "favorites"
 		Type      string           `json:"type"`   // "audio", "container"
 		Title     string           `json:"title,omitempty"`
 		Icon      string           `json:"icon,omitempty"`
@@ -2696,7 +3030,58 @@ func (s *Server) handleBrowseAddToQueue(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Favorites are queued through the source they were saved from
+	if req.Source == browseSourceFavorites {
+		fav, source := s.resolveFavorite(req.Path)
+		if source == "" {
+			s.jsonError(w, "Unknown source for favorite", http.StatusBadRequest)
+			return
+		}
+		req.Source = source
+		if fav != nil {
+			req.Type = fav.Type
+			if req.Title == "" {
+				req.Title = fav.Title
+			}
+			if req.Icon == "" {
+				req.Icon = fav.Icon
+			}
+			if req.Artist == "" {
+				req.Artist = fav.Artist
+			}
+			if req.Album == "" {
+				req.Album = fav.Album
+			}
+			if req.AudioType == "" {
+				req.AudioType = fav.AudioType
+			}
+			if req.MediaData == nil {
+				req.MediaData = fav.MediaData
+			}
+		}
+	}
+
+	// Custom stations may be browsed from the radio menu or their own source
+	if stations.IsStationPath(req.Path) {
+		req.Source = browseSourceStations
+	}
+	if music.IsMusicPath(req.Path) {
+		req.Source = browseSourceMusic
+	}
+
 	airable := kefw2.NewAirableClient(spk)
+
+	// Bookmarked folders queue like any other UPnP container
+	if strings.HasPrefix(req.Path, bookmarkPathPrefix) {
+		resolvedPath, resolveErr := s.resolveBookmark(airable, req.Path)
+		if resolveErr != nil {
+			s.jsonError(w, "Failed to open bookmark: "+resolveErr.Error(), http.StatusNotFound)
+			return
+		}
+		req.Path = resolvedPath
+		req.Source = browseSourceUPnP
+		req.Type = contentTypeContainer
+	}
 	var err error
 	var tracksAdded int
 
@@ -2766,6 +3151,22 @@ func (s *Server) handleBrowseAddToQueue(w http.ResponseWriter, r *http.Request)
 		}
 		err = airable.AddToQueue([]kefw2.ContentItem{*station}, false)
 		tracksAdded = 1
+	case browseSourceStations:
+		station, getErr := s.getStation(req.Path)
+		if getErr != nil {
+			s.jsonError(w, getErr.Error(), http.StatusNotFound)
+			return
+		}
+		err = airable.AddToQueue([]kefw2.ContentItem{station.ContentItem()}, false)
+		tracksAdded = 1
+	case browseSourceMusic:
+		items, itemsErr := s.musicContentItems(req.Path)
+		if itemsErr != nil {
+			s.jsonError(w, itemsErr.Error(), http.StatusNotFound)
+			return
+		}
+		err = airable.AddToQueue(items, false)
+		tracksAdded = len(items)
 	case browseSourcePodcasts:
 		// For podcast episodes, use mediaData from request if available
 		// Podcast episode paths cannot be fetched directly, so we rely on browser data
@@ -2822,10 +3223,13 @@ func (s *Server) handleBrowseFavorite(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		Path   string `json:"path"`
-		Source string `json:"source"` // "radio", "podcasts"
+		Source string `json:"source"` // "radio", "podcasts" (others are stored locally)
 		ID     string `json:"id"`
 		Title  string `json:"title"`
-		Add    bool   `json:"add"` // true = add to favorites, false = remove
+		Type   string `json:"type,omitempty"`
+		Icon   string `json:"icon,omitempty"`
+		Add    bool   `json:"add"`             // true = add to favorites, false = remove
+		Local  bool   `json:"local,omitempty"` // true = use kefw2ui favorites instead of Airable
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -2838,6 +3242,12 @@ func (s *Server) handleBrowseFavorite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Sources without Airable favorites (and explicit local requests) use the local store
+	if req.Local || (req.Source != browseSourceRadio && req.Source != browseSourcePodcasts) {
+		s.toggleLocalFavorite(w, req.Source, req.Path, req.Title, req.Type, req.Icon, req.Add)
+		return
+	}
+
 	airable := kefw2.NewAirableClient(spk)
 	var err error
 
@@ -2861,9 +3271,6 @@ func (s *Server) handleBrowseFavorite(w http.ResponseWriter, r *http.Request) {
 		} else {
 			err = airable.RemovePodcastFavorite(item)
 		}
-	default:
-		s.jsonError(w, "Favorites only supported for radio and podcasts", http.StatusBadRequest)
-		return
 	}
 
 	if err != nil {
@@ -2918,11 +3325,18 @@ func (s *Server) handleSpeakerSettings(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		// Get speaker settings
-		maxVolume, _ := spk.GetMaxVolume(ctx)
-		volume, _ := spk.GetVolume(ctx)
-		muted, _ := spk.IsMuted(ctx)
-		source, _ := spk.Source(ctx)
-		isPoweredOn, _ := spk.IsPoweredOn(ctx)
+		state, _ := s.speakerState.Get(ctx, spk)
+
+		var sourcePresets map[string]config.SourcePreset
+		var quietHours []config.QuietHours
+		if s.opts.Config != nil {
+			sourcePresets = s.sourcePresets(spk.IPAddress)
+			quietHours = s.opts.Config.GetQuietHours(spk.IPAddress)
+		}
+		var volumeCap *int
+		if limit, ok := s.volumeCap(spk); ok {
+			volumeCap = &limit
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]any{
@@ -2934,18 +3348,24 @@ func (s *Server) handleSpeakerSettings(w http.ResponseWriter, r *http.Request) {
 				"macPrimary": spk.MacAddress,
 			},
 			"settings": map[string]any{
-				"maxVolume": maxVolume,
-				"volume":    volume,
-				"muted":     muted,
-				"source":    string(source),
-				"poweredOn": isPoweredOn,
+				"maxVolume": state.MaxVolume,
+				"volume":    state.Volume,
+				"muted":     state.Muted,
+				"source":    string(state.Source),
+				"poweredOn": state.Power == kefw2.SpeakerStatusOn,
 			},
+			"cache":         stateCacheInfo(state),
+			"sourcePresets": sourcePresets,
+			"quietHours":    quietHours,
+			"volumeCap":     volumeCap, // active quiet-hours cap, null outside quiet hours
 		})
 
 	case http.MethodPut, http.MethodPost:
 		// Update speaker settings
 		var req struct {
-			MaxVolume *int `json:"maxVolume,omitempty"`
+			MaxVolume     *int                           `json:"maxVolume,omitempty"`
+			SourcePresets map[string]sourcePresetRequest `json:"sourcePresets,omitempty"`
+			QuietHours    *[]config.QuietHours           `json:"quietHours,omitempty"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -2963,6 +3383,33 @@ func (s *Server) handleSpeakerSettings(w http.ResponseWriter, r *http.Request) {
 				s.jsonError(w, "Failed to set max volume: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
+			s.speakerState.Update(spk.IPAddress, func(state *speaker.State) {
+				state.MaxVolume = *req.MaxVolume
+			})
+		}
+
+		// Update source presets if provided
+		if len(req.SourcePresets) > 0 {
+			if s.opts.Config == nil {
+				s.jsonError(w, "Config not available", http.StatusServiceUnavailable)
+				return
+			}
+			if err := s.updateSourcePresets(spk.IPAddress, req.SourcePresets); err != nil {
+				s.jsonError(w, "Failed to update source presets: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Replace quiet hours if provided
+		if req.QuietHours != nil {
+			if s.opts.Config == nil {
+				s.jsonError(w, "Config not available", http.StatusServiceUnavailable)
+				return
+			}
+			if err := s.opts.Config.SetQuietHours(spk.IPAddress, *req.QuietHours); err != nil {
+				s.jsonError(w, "Failed to update quiet hours: "+err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -3184,16 +3631,9 @@ func (s *Server) handleUPnPContainers(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// broadcastReindex sends a reindex SSE event to all connected clients.
-func (s *Server) broadcastReindex(data map[string]any) {
-	payload, err := json.Marshal(map[string]any{
-		"type": "reindex",
-		"data": data,
-	})
-	if err != nil {
-		return
-	}
-	s.broadcastSSE(payload)
+// broadcastReindex publishes the progress of a reindex.
+func (s *Server) broadcastReindex(progress ReindexProgress) {
+	s.publish(progress)
 }
 
 // handleUPnPReindex rebuilds the UPnP track search index asynchronously.
@@ -3248,12 +3688,7 @@ func (s *Server) handleUPnPReindex(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Broadcast that reindex has started
-	s.broadcastReindex(map[string]any{
-		"status":            "progress",
-		"containersScanned": 0,
-		"tracksFound":       0,
-		"currentContainer":  "",
-	})
+	s.broadcastReindex(ReindexProgress{Status: "progress"})
 
 	go func() {
 		defer func() {
@@ -3267,209 +3702,96 @@ func (s *Server) handleUPnPReindex(w http.ResponseWriter, r *http.Request) {
 
 		// Progress callback broadcasts SSE events
 		progress := func(containersScanned, tracksFound int, currentContainer string) {
-			s.broadcastReindex(map[string]any{
-				"status":            "progress",
-				"containersScanned": containersScanned,
-				"tracksFound":       tracksFound,
-				"currentContainer":  currentContainer,
+			s.broadcastReindex(ReindexProgress{
+				Status:            "progress",
+				ContainersScanned: containersScanned,
+				TracksFound:       tracksFound,
+				CurrentContainer:  currentContainer,
 			})
 		}
 
 		index, err := kefw2.BuildTrackIndex(client, upnp.DefaultServerPath, upnp.DefaultServer, upnp.IndexContainer, progress)
 		if err != nil {
 			log.Printf("Media index rebuild failed: %v", err)
-			s.broadcastReindex(map[string]any{
-				"status": "error",
-				"error":  err.Error(),
-			})
+			s.broadcastReindex(ReindexProgress{Status: "error", Error: err.Error()})
 			return
 		}
 
 		if err := kefw2.SaveTrackIndex(index); err != nil {
 			log.Printf("Failed to save track index: %v", err)
-			s.broadcastReindex(map[string]any{
-				"status": "error",
-				"error":  "Failed to save index: " + err.Error(),
-			})
+			s.broadcastReindex(ReindexProgress{Status: "error", Error: "Failed to save index: " + err.Error()})
 			return
 		}
 
 		kefw2.ClearTrackIndexCache()
+		s.invalidateSubsonicLibrary()
 		log.Printf("Media index rebuilt: %d tracks from %q", index.TrackCount, upnp.DefaultServer)
+		if s.mpd != nil {
+			s.mpd.Notify(mpd.SubsystemDatabase)
+		}
+		if s.webhooks != nil {
+			s.webhooks.Emit(webhooks.EventReindexCompleted, map[string]any{
+				"trackCount": index.TrackCount,
+				"serverName": index.ServerName,
+			})
+		}
 
-		s.broadcastReindex(map[string]any{
-			"status":     "complete",
-			"trackCount": index.TrackCount,
-			"serverName": index.ServerName,
+		s.broadcastReindex(ReindexProgress{
+			Status:     "complete",
+			TrackCount: index.TrackCount,
+			ServerName: index.ServerName,
 		})
 	}()
 }
 
-// handleSSE handles Server-Sent Events connections.
-func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
-	// Set headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "SSE not supported", http.StatusInternalServerError)
-		return
-	}
-
-	// Create client channel
-	clientChan := make(chan []byte, 10)
-
-	// Register client
-	s.sseClientsMu.Lock()
-	s.sseClients[clientChan] = struct{}{}
-	s.sseClientsMu.Unlock()
-
-	// Cleanup on disconnect
-	defer func() {
-		s.sseClientsMu.Lock()
-		delete(s.sseClients, clientChan)
-		s.sseClientsMu.Unlock()
-		close(clientChan)
-	}()
-
-	// Send initial connection event with current state
-	s.sendInitialState(w, flusher)
-
-	// Heartbeat ticker
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case data := <-clientChan:
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
-		case <-ticker.C:
-			fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
-			flusher.Flush()
-		}
-	}
-}
-
-// sendInitialState sends the current speaker/player state to a newly connected SSE client.
-func (s *Server) sendInitialState(w http.ResponseWriter, flusher http.Flusher) {
-	// Send connected event
-	fmt.Fprintf(w, "event: connected\ndata: {\"status\":\"connected\"}\n\n")
-	flusher.Flush()
-
-	// Send speaker health status
-	speakerHealthData, _ := json.Marshal(map[string]any{
-		"type": "speakerHealth",
-		"data": map[string]any{
-			"connected": s.manager.IsSpeakerConnected(),
-		},
-	})
-	fmt.Fprintf(w, "data: %s\n\n", speakerHealthData)
-	flusher.Flush()
+// currentStateEvents returns the current speaker/player state as events.
+func (s *Server) currentStateEvents() []speaker.Event {
+	health := speaker.HealthChanged{Connected: s.manager.IsSpeakerConnected()}
 
 	spk := s.manager.GetActiveSpeaker()
 	if spk == nil {
-		return
+		return []speaker.Event{health}
 	}
 
-	// Send speaker info (this is static metadata, safe even during standby)
-	speakerData, _ := json.Marshal(map[string]any{
-		"type": "speaker",
-		"data": map[string]any{
-			"ip":    spk.IPAddress,
-			"name":  spk.Name,
-			"model": spk.Model,
-		},
-	})
-	fmt.Fprintf(w, "data: %s\n\n", speakerData)
-	flusher.Flush()
+	// Speaker info is static metadata, safe even during standby. It comes
+	// first: subscribers forget the previous speaker's state on it
+	events := []speaker.Event{
+		speaker.ActiveSpeakerChanged{IP: spk.IPAddress, Name: spk.Name, Model: spk.Model},
+		health,
+	}
 
 	// If the speaker is in standby, send standby state without querying it.
 	// Querying via HTTP would wake it from standby.
 	if s.manager.IsInStandby() {
-		sourceData, _ := json.Marshal(map[string]any{
-			"type": "source",
-			"data": map[string]any{"source": "standby"},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", sourceData)
-		flusher.Flush()
-
-		powerData, _ := json.Marshal(map[string]any{
-			"type": "power",
-			"data": map[string]any{"status": "standby"},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", powerData)
-		flusher.Flush()
-		return
+		return append(events,
+			speaker.SourceChanged{Source: kefw2.SourceStandby},
+			speaker.PowerChanged{Status: kefw2.SpeakerStatusStandby},
+		)
 	}
 
-	ctx := context.Background()
-
-	// Send current volume
-	if volume, err := spk.GetVolume(ctx); err == nil {
-		volumeData, _ := json.Marshal(map[string]any{
-			"type": "volume",
-			"data": map[string]any{"volume": volume},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", volumeData)
-		flusher.Flush()
-	}
-
-	// Send mute state
-	if muted, err := spk.IsMuted(ctx); err == nil {
-		muteData, _ := json.Marshal(map[string]any{
-			"type": "mute",
-			"data": map[string]any{"muted": muted},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", muteData)
-		flusher.Flush()
-	}
-
-	// Send source
-	if source, err := spk.Source(ctx); err == nil {
-		sourceData, _ := json.Marshal(map[string]any{
-			"type": "source",
-			"data": map[string]any{"source": string(source)},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", sourceData)
-		flusher.Flush()
-	}
-
-	// Send power state
-	if status, err := spk.SpeakerState(ctx); err == nil {
-		powerData, _ := json.Marshal(map[string]any{
-			"type": "power",
-			"data": map[string]any{"status": string(status)},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", powerData)
-		flusher.Flush()
+	state, err := s.speakerState.Get(context.Background(), spk)
+	if err != nil && state.SyncedAt.IsZero() {
+		return events
 	}
+	return append(events,
+		speaker.VolumeChanged{Volume: state.Volume},
+		speaker.MuteChanged{Muted: state.Muted},
+		speaker.SourceChanged{Source: state.Source},
+		speaker.PowerChanged{Status: state.Power},
+		state.Player.Changed(time.Now()),
+	)
+}
 
-	// Send player data
-	if playerData, err := spk.PlayerData(ctx); err == nil {
-		position, _ := spk.SongProgressMS(ctx)
-		playerEventData, _ := json.Marshal(map[string]any{
-			"type": "player",
-			"data": map[string]any{
-				"state":     playerData.State,
-				"title":     playerData.TrackRoles.Title,
-				"artist":    playerData.TrackRoles.MediaData.MetaData.Artist,
-				"album":     playerData.TrackRoles.MediaData.MetaData.Album,
-				"icon":      s.proxyIconURL(playerData.TrackRoles.Icon),
-				"duration":  playerData.Status.Duration,
-				"position":  position,
-				"audioType": playerData.MediaRoles.AudioType,
-				"live":      playerData.MediaRoles.MediaData.MetaData.Live,
-			},
-		})
-		fmt.Fprintf(w, "data: %s\n\n", playerEventData)
-		flusher.Flush()
+// initialStateEvents returns the current speaker/player state as event
+// payloads for a newly connected client.
+func (s *Server) initialStateEvents() [][]byte {
+	var payloads [][]byte
+	for _, event := range s.currentStateEvents() {
+		if payload, err := s.ssePayload(event); err == nil {
+			payloads = append(payloads, payload)
+		}
 	}
+	return payloads
 }
 
 // handleFrontend serves the embedded frontend files.
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/audit"
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// presetSources are the sources that keep a volume preset.
+var presetSources = []kefw2.Source{
+	kefw2.SourceWiFi, kefw2.SourceBluetooth, kefw2.SourceTV, kefw2.SourceOptical,
+	kefw2.SourceCoaxial, kefw2.SourceAux, kefw2.SourceUSB,
+}
+
+// sourcePresetSaveDelay batches config writes while the volume is being
+// dragged.
+const sourcePresetSaveDelay = 5 * time.Second
+
+// sourcePresetRequest updates a source preset. Nil fields are left
+// unchanged.
+type sourcePresetRequest struct {
+	Restore     *bool `json:"restore"`
+	RestoreMute *bool `json:"restoreMute"`
+	Volume      *int  `json:"volume"`
+}
+
+// sourceMemory remembers the volume and mute state of each source of the
+// active speaker, and restores them when a source with restore enabled comes
+// on.
+type sourceMemory struct {
+	config  *config.Config
+	manager *speaker.Manager
+	audit   *audit.Log // records restores, nil when unavailable
+
+	mu        sync.Mutex
+	ip        string       // speaker the current source belongs to
+	source    kefw2.Source // current source, "" until known
+	saveTimer *time.Timer
+}
+
+func newSourceMemory(cfg *config.Config, manager *speaker.Manager) *sourceMemory {
+	return &sourceMemory{config: cfg, manager: manager}
+}
+
+// HandleEvent records volume and mute changes against the current source and
+// restores the preset when the source changes. When another speaker becomes
+// active its source is learned from the events that follow.
+func (m *sourceMemory) HandleEvent(event speaker.Event) {
+	spk := m.manager.GetActiveSpeaker()
+	if spk == nil {
+		return
+	}
+
+	switch e := event.(type) {
+	case speaker.ActiveSpeakerChanged:
+		m.mu.Lock()
+		m.ip, m.source = "", ""
+		m.mu.Unlock()
+
+	case speaker.SourceChanged:
+		m.mu.Lock()
+		previous := m.source
+		if m.ip != spk.IPAddress {
+			previous = ""
+		}
+		m.ip, m.source = spk.IPAddress, e.Source
+		m.mu.Unlock()
+
+		// Only restore on an actual switch; the first source seen after
+		// startup is whatever was already playing
+		if previous != "" && previous != e.Source && e.Source != kefw2.SourceStandby {
+			preset := m.config.GetSourcePresets(spk.IPAddress)[string(e.Source)]
+			if preset.Restore && preset.Volume != nil {
+				go m.restore(spk, e.Source, preset)
+			}
+		}
+
+	case speaker.VolumeChanged:
+		m.remember(spk.IPAddress, &e.Volume, nil)
+
+	case speaker.MuteChanged:
+		m.remember(spk.IPAddress, nil, &e.Muted)
+	}
+}
+
+// remember records the state for the current source and schedules a save.
+func (m *sourceMemory) remember(ip string, volume *int, muted *bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ip != ip || m.source == "" || m.source == kefw2.SourceStandby {
+		return
+	}
+	if !m.config.RememberSourceState(ip, string(m.source), volume, muted) {
+		return
+	}
+	if m.saveTimer == nil {
+		m.saveTimer = time.AfterFunc(sourcePresetSaveDelay, m.save)
+	}
+}
+
+func (m *sourceMemory) save() {
+	m.mu.Lock()
+	m.saveTimer = nil
+	m.mu.Unlock()
+
+	if err := m.config.Save(); err != nil {
+		log.Printf("Failed to save source presets: %v", err)
+	}
+}
+
+// restore applies a preset to the speaker.
+func (m *sourceMemory) restore(spk *kefw2.KEFSpeaker, source kefw2.Source, preset config.SourcePreset) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entry := audit.Entry{
+		Source: audit.SourceSystem,
+		Action: "source preset restore",
+		Params: map[string]any{"source": source, "volume": *preset.Volume},
+	}
+	if m.audit != nil {
+		m.audit.NoteLocalChange()
+		defer func() { m.audit.Record(entry) }()
+	}
+
+	if _, err := m.manager.SetVolume(ctx, spk, *preset.Volume, speaker.OriginSourcePreset); err != nil {
+		log.Printf("Failed to restore %s volume: %v", source, err)
+		entry.Error = err.Error()
+		return
+	}
+	if preset.RestoreMute {
+		var err error
+		entry.Params["muted"] = preset.Muted
+		if preset.Muted {
+			err = spk.Mute(ctx)
+		} else {
+			err = spk.Unmute(ctx)
+		}
+		if err != nil {
+			log.Printf("Failed to restore %s mute state: %v", source, err)
+			entry.Error = err.Error()
+		}
+	}
+	log.Printf("Restored %s volume %d on %s", source, *preset.Volume, spk.Name)
+}
+
+// Close writes pending changes.
+func (m *sourceMemory) Close() {
+	m.mu.Lock()
+	pending := m.saveTimer != nil && m.saveTimer.Stop()
+	m.mu.Unlock()
+
+	if pending {
+		m.save()
+	}
+}
+
+// sourcePresets returns the presets of every source of a speaker.
+func (s *Server) sourcePresets(ip string) map[string]config.SourcePreset {
+	stored := s.opts.Config.GetSourcePresets(ip)
+	presets := make(map[string]config.SourcePreset, len(presetSources))
+	for _, source := range presetSources {
+		presets[string(source)] = stored[string(source)]
+	}
+	return presets
+}
+
+// updateSourcePresets validates and applies preset changes for a speaker.
+func (s *Server) updateSourcePresets(ip string, changes map[string]sourcePresetRequest) error {
+	for source, change := range changes {
+		if !slices.Contains(presetSources, kefw2.Source(source)) {
+			return fmt.Errorf("unknown source: %s", source)
+		}
+		if change.Volume != nil && (*change.Volume < 0 || *change.Volume > 100) {
+			return fmt.Errorf("volume must be between 0 and 100")
+		}
+	}
+
+	stored := s.opts.Config.GetSourcePresets(ip)
+	for source, change := range changes {
+		preset := stored[source]
+		if change.Restore != nil {
+			preset.Restore = *change.Restore
+		}
+		if change.RestoreMute != nil {
+			preset.RestoreMute = *change.RestoreMute
+		}
+		if change.Volume != nil {
+			preset.Volume = change.Volume
+		}
+		if err := s.opts.Config.SetSourcePreset(ip, source, preset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
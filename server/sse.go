@@ -0,0 +1,329 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sseReplaySize is the number of events kept for clients that reconnect
+	// with Last-Event-ID
+	sseReplaySize = 512
+
+	// sseHeartbeat is how often idle clients get a ping
+	sseHeartbeat = 30 * time.Second
+)
+
+// SSE topics clients can subscribe to with ?topics=.
+const (
+	topicPlayer        = "player"
+	topicQueue         = "queue"
+	topicPlaylists     = "playlists"
+	topicReindex       = "reindex"
+	topicScenes        = "scenes"
+	topicRules         = "rules"
+	topicAnnouncements = "announcements"
+)
+
+// sseTopics maps event types to their topic. Unlisted types are their own
+// topic.
+var sseTopics = map[string]string{
+	"player":        topicPlayer,
+	"playTime":      topicPlayer,
+	"volume":        topicPlayer,
+	"volumeClamped": topicPlayer,
+	"mute":          topicPlayer,
+	"source":        topicPlayer,
+	"power":         topicPlayer,
+	"playMode":      topicPlayer,
+	"speaker":       topicPlayer,
+	"speakerHealth": topicPlayer,
+	"queue":         topicQueue,
+	"playlists":     topicPlaylists,
+	"reindex":       topicReindex,
+	"scenes":        topicScenes,
+	"sceneRecalled": topicScenes,
+	"rules":         topicRules,
+	"ruleRun":       topicRules,
+	"announcement":  topicAnnouncements,
+	"clips":         topicAnnouncements,
+}
+
+// sseEvent is a broadcast event kept for replay.
+type sseEvent struct {
+	id    uint64
+	topic string
+	data  []byte
+}
+
+// sseTick is the latest position tick. Ticks come every second during
+// playback, so rather than fill the replay buffer, each replaces the last.
+// Clients get a tick only while no event followed it, and reconnecting
+// clients don't get it at all.
+type sseTick struct {
+	seq   uint64 // counts ticks
+	after uint64 // ID of the buffered event before the tick
+	data  []byte
+}
+
+// sseClient is a connected event stream, over SSE or a WebSocket. Clients
+// read events from the replay buffer at their own pace, so a slow client
+// never loses events silently: when it falls further behind than the buffer
+// reaches, it is resynced.
+type sseClient struct {
+	topics map[string]bool // nil for all topics
+	notify chan struct{}   // signalled when new events are buffered
+	cursor uint64          // ID of the last event seen
+	tick   uint64          // seq of the last position tick seen
+}
+
+// wants reports whether the client subscribed to a topic.
+func (c *sseClient) wants(topic string) bool {
+	return c.topics == nil || c.topics[topic]
+}
+
+// sseFirstID returns the ID to count events from. Starting at the clock
+// keeps IDs increasing across restarts, so a client reconnecting with an ID
+// from a previous run is resynced rather than replayed the wrong events.
+func sseFirstID() uint64 {
+	return uint64(time.Now().UnixMicro())
+}
+
+// eventTopic returns the topic of an event payload.
+func eventTopic(data []byte) string {
+	var event struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(data, &event)
+	if topic, ok := sseTopics[event.Type]; ok {
+		return topic
+	}
+	return event.Type
+}
+
+// parseTopics parses a comma-separated ?topics= list. An empty list means
+// all topics.
+func parseTopics(value string) (map[string]bool, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	known := map[string]bool{}
+	for _, topic := range sseTopics {
+		known[topic] = true
+	}
+
+	topics := map[string]bool{}
+	for topic := range strings.SplitSeq(value, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if !known[topic] {
+			names := make([]string, 0, len(known))
+			for name := range known {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return nil, fmt.Errorf("unknown topic %q (expected %s)", topic, strings.Join(names, ", "))
+		}
+		topics[topic] = true
+	}
+	return topics, nil
+}
+
+// broadcastSSE buffers an event and wakes all connected SSE clients.
+func (s *Server) broadcastSSE(data []byte) {
+	event := sseEvent{topic: eventTopic(data), data: data}
+
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+
+	s.sseLastID++
+	event.id = s.sseLastID
+	s.sseEvents = append(s.sseEvents, event)
+	if len(s.sseEvents) > sseReplaySize {
+		s.sseEvents = slices.Delete(s.sseEvents, 0, len(s.sseEvents)-sseReplaySize)
+	}
+
+	for client := range s.sseClients {
+		select {
+		case client.notify <- struct{}{}:
+		default:
+			// Already signalled
+		}
+	}
+}
+
+// broadcastTick keeps a position tick as the latest and wakes all connected
+// SSE clients.
+func (s *Server) broadcastTick(data []byte) {
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+
+	s.sseTick = sseTick{seq: s.sseTick.seq + 1, after: s.sseLastID, data: data}
+
+	for client := range s.sseClients {
+		select {
+		case client.notify <- struct{}{}:
+		default:
+			// Already signalled
+		}
+	}
+}
+
+// addSSEClient registers an event stream starting after the latest event.
+func (s *Server) addSSEClient(topics map[string]bool) *sseClient {
+	client := &sseClient{topics: topics, notify: make(chan struct{}, 1)}
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+	s.sseClients[client] = struct{}{}
+	client.cursor = s.sseLastID
+	client.tick = s.sseTick.seq
+	return client
+}
+
+// removeSSEClient unregisters an event stream.
+func (s *Server) removeSSEClient(client *sseClient) {
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+	delete(s.sseClients, client)
+}
+
+// nextEvents returns the buffered events after the client's cursor that it
+// subscribed to, followed by a new position tick, and moves the cursor to
+// the latest event. Ticks have no ID. ok is false when events after the
+// cursor are no longer buffered, or the cursor is not an ID this server
+// handed out; the client must then be resynced.
+func (s *Server) nextEvents(client *sseClient) (events []sseEvent, ok bool) {
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+
+	id := client.cursor
+	client.cursor = s.sseLastID
+	switch {
+	case id > s.sseLastID:
+		return nil, false
+	case id == s.sseLastID:
+	case len(s.sseEvents) == 0 || id+1 < s.sseEvents[0].id:
+		return nil, false
+	default:
+		for _, event := range s.sseEvents[id+1-s.sseEvents[0].id:] {
+			if client.wants(event.topic) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	if tick := s.sseTick; client.tick != tick.seq {
+		client.tick = tick.seq
+		if tick.after == s.sseLastID && client.wants(topicPlayer) {
+			events = append(events, sseEvent{topic: topicPlayer, data: tick.data})
+		}
+	}
+	return events, true
+}
+
+// lastEventID returns the ID a reconnecting client saw last. Browsers send
+// the Last-Event-ID header when EventSource reconnects by itself; clients
+// that open a new connection can pass ?lastEventId= instead.
+func lastEventID(r *http.Request) (uint64, bool) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	return id, err == nil
+}
+
+// handleSSE handles Server-Sent Events connections.
+//
+// Every event has an ID. A client reconnecting with Last-Event-ID (or
+// ?lastEventId=) gets the events it missed; when they are no longer
+// buffered it gets a "resync" event followed by the current state.
+// ?topics=player,queue limits the stream to the given topics.
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	topics, err := parseTopics(r.URL.Query().Get("topics"))
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Set headers for SSE
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Register client
+	client := s.addSSEClient(topics)
+	defer s.removeSSEClient(client)
+
+	fmt.Fprintf(w, "event: connected\ndata: {\"status\":\"connected\"}\n\n")
+
+	// sendState sends the current state, after a resync event if the
+	// client has missed events
+	sendState := func(resync bool) {
+		if resync {
+			fmt.Fprintf(w, "id: %d\nevent: resync\ndata: {\"lastEventId\":%d}\n\n", client.cursor, client.cursor)
+		}
+		if client.wants(topicPlayer) {
+			for _, data := range s.initialStateEvents() {
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		}
+		flusher.Flush()
+	}
+
+	// sendEvents sends the events the client hasn't seen
+	sendEvents := func() {
+		events, ok := s.nextEvents(client)
+		if !ok {
+			sendState(true)
+			return
+		}
+		for _, event := range events {
+			if event.id == 0 {
+				fmt.Fprintf(w, "data: %s\n\n", event.data)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.id, event.data)
+		}
+		flusher.Flush()
+	}
+
+	if id, ok := lastEventID(r); ok {
+		// Replay what the client missed
+		client.cursor = id
+		sendEvents()
+	} else {
+		sendState(false)
+	}
+
+	// Heartbeat ticker
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.notify:
+			sendEvents()
+		case <-ticker.C:
+			fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
+			flusher.Flush()
+		}
+	}
+}
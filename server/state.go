@@ -0,0 +1,81 @@
+package server
+
+import (
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// playerStateData returns the player fields of /api/player and the "player"
+// event, with the position interpolated to now.
+func (s *Server) playerStateData(p speaker.PlayerState) map[string]any {
+	return map[string]any{
+		"state":     p.State,
+		"title":     p.Title,
+		"artist":    p.Artist,
+		"album":     p.Album,
+		"icon":      s.proxyIconURL(p.Icon),
+		"duration":  p.Duration,
+		"position":  p.CurrentPosition(time.Now()),
+		"audioType": p.AudioType,
+		"live":      p.Live,
+	}
+}
+
+// stateCacheInfo describes how current a state read from the store is.
+func stateCacheInfo(state speaker.State) map[string]any {
+	info := map[string]any{
+		"stale":     state.Stale,
+		"syncedAt":  nil,
+		"updatedAt": nil,
+		"ageMs":     nil,
+	}
+	if !state.SyncedAt.IsZero() {
+		info["syncedAt"] = state.SyncedAt
+		info["ageMs"] = time.Since(state.SyncedAt).Milliseconds()
+	}
+	if !state.UpdatedAt.IsZero() {
+		info["updatedAt"] = state.UpdatedAt
+	}
+	return info
+}
+
+// positionTickInterval is how often clients get the interpolated position
+// while the speaker plays.
+const positionTickInterval = time.Second
+
+// runPositionTicker publishes the interpolated position as "playTime"
+// events while the active speaker plays, so clients and integrations (MQTT,
+// the UPnP renderer) don't need a clock of their own. Ticks are skipped
+// while the speaker reports the position itself.
+func (s *Server) runPositionTicker() {
+	ticker := time.NewTicker(positionTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopTickers:
+			return
+		case now := <-ticker.C:
+			spk := s.manager.GetActiveSpeaker()
+			if spk == nil || s.manager.IsInStandby() {
+				continue
+			}
+			player := s.speakerState.Peek(spk.IPAddress).Player
+			if player.State != kefw2.PlayerStatePlaying || player.Position < 0 ||
+				now.Sub(player.PositionAt) < positionTickInterval {
+				continue
+			}
+			s.publish(speaker.PositionChanged{Position: player.CurrentPosition(now), Interpolated: true})
+		}
+	}
+}
+
+// setPosition moves the position clock after a seek.
+func (s *Server) setPosition(spk *kefw2.KEFSpeaker, positionMS int64) {
+	s.speakerState.Update(spk.IPAddress, func(state *speaker.State) {
+		state.Player.Position, state.Player.PositionAt = positionMS, time.Now()
+	})
+}
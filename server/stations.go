@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/stations"
+)
+
+// stationRequest is the request body for creating or updating a custom station.
+type stationRequest struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Logo     string   `json:"logo"`
+	Tags     []string `json:"tags"`
+	MimeType string   `json:"mimeType"`
+}
+
+// getStation looks up a custom station by its browse path or ID.
+func (s *Server) getStation(path string) (*stations.Station, error) {
+	if s.stations == nil {
+		return nil, fmt.Errorf("station manager not available")
+	}
+	return s.stations.Get(stations.IDFromPath(path))
+}
+
+// stationBrowseItem converts a custom station to a BrowseItem.
+func (s *Server) stationBrowseItem(st *stations.Station) BrowseItem {
+	item := st.ContentItem()
+	return BrowseItem{
+		Title:       st.Name,
+		Type:        contentTypeAudio,
+		Path:        st.Path(),
+		Icon:        s.proxyIconURL(st.Logo),
+		ID:          st.ID,
+		Description: strings.Join(st.Tags, ", "),
+		Playable:    true,
+		AudioType:   item.AudioType,
+		MediaData:   item.MediaData,
+	}
+}
+
+// customStationItems returns browse items for all custom stations matching query.
+// An empty query matches every station.
+func (s *Server) customStationItems(query string) []BrowseItem {
+	if s.stations == nil {
+		return []BrowseItem{}
+	}
+
+	list, err := s.stations.List()
+	if err != nil {
+		return []BrowseItem{}
+	}
+
+	items := make([]BrowseItem, 0, len(list))
+	for i := range list {
+		if list[i].Matches(query) {
+			items = append(items, s.stationBrowseItem(&list[i]))
+		}
+	}
+	return items
+}
+
+// handleBrowseStations lists custom radio stations as browse items.
+// Does not need an active speaker since stations are stored locally.
+func (s *Server) handleBrowseStations(w http.ResponseWriter, r *http.Request) {
+	if s.stations == nil {
+		s.jsonError(w, "Station manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	page, err := parseBrowsePage(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	all := s.customStationItems(r.URL.Query().Get("q"))
+	items := page.slice(all)
+
+	out := map[string]any{
+		"items":      items,
+		"totalCount": len(all),
+		"source":     browseSourceStations,
+	}
+	if next := page.nextCursor(len(items), len(all)); next != "" {
+		out["nextCursor"] = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handleStations handles listing and creating custom radio stations.
+func (s *Server) handleStations(w http.ResponseWriter, r *http.Request) {
+	if s.stations == nil {
+		s.jsonError(w, "Station manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.stations.List()
+		if err != nil {
+			s.jsonError(w, "Failed to list stations: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"stations": list,
+		})
+
+	case http.MethodPost:
+		var req stationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" || req.URL == "" {
+			s.jsonError(w, "Station name and url are required", http.StatusBadRequest)
+			return
+		}
+
+		st, err := s.stations.Create(req.Name, req.URL, req.Logo, req.Tags, req.MimeType)
+		if err != nil {
+			s.jsonError(w, "Failed to create station: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"station": st,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStation handles operations on a single custom radio station.
+func (s *Server) handleStation(w http.ResponseWriter, r *http.Request) {
+	if s.stations == nil {
+		s.jsonError(w, "Station manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Extract station ID from path: /api/stations/{id}
+	id := strings.TrimPrefix(r.URL.Path, "/api/stations/")
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid station ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		st, err := s.stations.Get(id)
+		if err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"station": st,
+		})
+
+	case http.MethodPut:
+		var req stationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := s.stations.Get(id); err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		st, err := s.stations.Update(id, req.Name, req.URL, req.Logo, req.Tags, req.MimeType)
+		if err != nil {
+			s.jsonError(w, "Failed to update station: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"station": st,
+		})
+
+	case http.MethodDelete:
+		if err := s.stations.Delete(id); err != nil {
+			s.jsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePlayerURL plays an arbitrary HTTP(S) audio URL on the active speaker.
+// With "queue": true the item is appended to the queue instead of replacing it.
+func (s *Server) handlePlayerURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spk := s.manager.GetActiveSpeaker()
+	if spk == nil {
+		s.jsonError(w, "No active speaker", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		URL      string `json:"url"`
+		Title    string `json:"title"`
+		Artist   string `json:"artist"`
+		Artwork  string `json:"artwork"`
+		MimeType string `json:"mimeType"`
+		Queue    bool   `json:"queue"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := stations.ValidateURL(req.URL); err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item := stations.StreamItem(req.URL, req.Title, req.Artist, req.Artwork, req.MimeType)
+
+	airable := kefw2.NewAirableClient(spk)
+	var err error
+	if req.Queue {
+		err = airable.AddToQueue([]kefw2.ContentItem{item}, true)
+	} else {
+		err = airable.PlayUPnPTracks([]kefw2.ContentItem{item})
+	}
+	if err != nil {
+		s.jsonError(w, "Failed to play URL: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status": "ok",
+		"title":  item.Title,
+	})
+}
@@ -0,0 +1,983 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/playlist"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// The Subsonic API (http://www.subsonic.org/pages/api.jsp) with the
+// OpenSubsonic extensions lets Subsonic apps browse the UPnP track index and
+// saved playlists, and control the active speaker through jukeboxControl.
+// Streaming is not offered: the speaker plays, the app is the remote.
+
+// subsonicAPIVersion is the Subsonic REST API version implemented.
+const subsonicAPIVersion = "1.16.1"
+
+// Subsonic error codes.
+const (
+	subsonicErrGeneric  = 0
+	subsonicErrMissing  = 10
+	subsonicErrNotFound = 70
+)
+
+// Subsonic ID prefixes. IDs are derived from the track index so they stay
+// stable across rebuilds of the same library.
+const (
+	subsonicArtistPrefix   = "ar-"
+	subsonicAlbumPrefix    = "al-"
+	subsonicTrackPrefix    = "tr-"
+	subsonicPlaylistPrefix = "pl-"
+	subsonicEntryPrefix    = "pe-" // stored playlist entry: pe-{index}-{playlist ID}
+	subsonicQueuePrefix    = "qu-" // speaker queue row without an index match
+)
+
+// subsonicResponse is the "subsonic-response" envelope, serialized as XML or
+// (with f=json) JSON.
+type subsonicResponse struct {
+	XMLName       xml.Name `xml:"subsonic-response" json:"-"`
+	Xmlns         string   `xml:"xmlns,attr" json:"-"`
+	Status        string   `xml:"status,attr" json:"status"`
+	Version       string   `xml:"version,attr" json:"version"`
+	Type          string   `xml:"type,attr" json:"type"`
+	ServerVersion string   `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic  bool     `xml:"openSubsonic,attr" json:"openSubsonic"`
+
+	Error           *subsonicError           `xml:"error,omitempty" json:"error,omitempty"`
+	License         *subsonicLicense         `xml:"license,omitempty" json:"license,omitempty"`
+	MusicFolders    *subsonicMusicFolders    `xml:"musicFolders,omitempty" json:"musicFolders,omitempty"`
+	Extensions      *[]subsonicExtension     `xml:"openSubsonicExtensions,omitempty" json:"openSubsonicExtensions,omitempty"`
+	Artists         *subsonicArtists         `xml:"artists,omitempty" json:"artists,omitempty"`
+	Artist          *subsonicArtist          `xml:"artist,omitempty" json:"artist,omitempty"`
+	Album           *subsonicAlbum           `xml:"album,omitempty" json:"album,omitempty"`
+	SearchResult3   *subsonicSearchResult    `xml:"searchResult3,omitempty" json:"searchResult3,omitempty"`
+	Playlists       *subsonicPlaylists       `xml:"playlists,omitempty" json:"playlists,omitempty"`
+	Playlist        *subsonicPlaylist        `xml:"playlist,omitempty" json:"playlist,omitempty"`
+	JukeboxStatus   *subsonicJukeboxStatus   `xml:"jukeboxStatus,omitempty" json:"jukeboxStatus,omitempty"`
+	JukeboxPlaylist *subsonicJukeboxPlaylist `xml:"jukeboxPlaylist,omitempty" json:"jukeboxPlaylist,omitempty"`
+}
+
+type subsonicError struct {
+	Code    int    `xml:"code,attr" json:"code"`
+	Message string `xml:"message,attr" json:"message"`
+}
+
+type subsonicLicense struct {
+	Valid bool `xml:"valid,attr" json:"valid"`
+}
+
+type subsonicMusicFolders struct {
+	MusicFolder []subsonicMusicFolder `xml:"musicFolder" json:"musicFolder"`
+}
+
+type subsonicMusicFolder struct {
+	ID   int    `xml:"id,attr" json:"id"`
+	Name string `xml:"name,attr" json:"name"`
+}
+
+type subsonicExtension struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Versions []int  `xml:"versions" json:"versions"`
+}
+
+type subsonicArtists struct {
+	IgnoredArticles string          `xml:"ignoredArticles,attr" json:"ignoredArticles"`
+	Index           []subsonicIndex `xml:"index" json:"index"`
+}
+
+type subsonicIndex struct {
+	Name   string           `xml:"name,attr" json:"name"`
+	Artist []subsonicArtist `xml:"artist" json:"artist"`
+}
+
+type subsonicArtist struct {
+	ID         string          `xml:"id,attr" json:"id"`
+	Name       string          `xml:"name,attr" json:"name"`
+	CoverArt   string          `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	AlbumCount int             `xml:"albumCount,attr" json:"albumCount"`
+	Album      []subsonicAlbum `xml:"album,omitempty" json:"album,omitempty"`
+}
+
+type subsonicAlbum struct {
+	ID        string          `xml:"id,attr" json:"id"`
+	Name      string          `xml:"name,attr" json:"name"`
+	Artist    string          `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	ArtistID  string          `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	CoverArt  string          `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	SongCount int             `xml:"songCount,attr" json:"songCount"`
+	Duration  int             `xml:"duration,attr" json:"duration"`
+	Song      []subsonicChild `xml:"song,omitempty" json:"song,omitempty"`
+}
+
+// subsonicChild is a song entry.
+type subsonicChild struct {
+	ID          string `xml:"id,attr" json:"id"`
+	Parent      string `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	IsDir       bool   `xml:"isDir,attr" json:"isDir"`
+	Title       string `xml:"title,attr" json:"title"`
+	Album       string `xml:"album,attr,omitempty" json:"album,omitempty"`
+	Artist      string `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	CoverArt    string `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Duration    int    `xml:"duration,attr,omitempty" json:"duration,omitempty"`
+	ContentType string `xml:"contentType,attr,omitempty" json:"contentType,omitempty"`
+	Suffix      string `xml:"suffix,attr,omitempty" json:"suffix,omitempty"`
+	Type        string `xml:"type,attr" json:"type"`
+	AlbumID     string `xml:"albumId,attr,omitempty" json:"albumId,omitempty"`
+	ArtistID    string `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+}
+
+type subsonicSearchResult struct {
+	Artist []subsonicArtist `xml:"artist" json:"artist"`
+	Album  []subsonicAlbum  `xml:"album" json:"album"`
+	Song   []subsonicChild  `xml:"song" json:"song"`
+}
+
+type subsonicPlaylists struct {
+	Playlist []subsonicPlaylist `xml:"playlist" json:"playlist"`
+}
+
+type subsonicPlaylist struct {
+	ID        string          `xml:"id,attr" json:"id"`
+	Name      string          `xml:"name,attr" json:"name"`
+	Comment   string          `xml:"comment,attr,omitempty" json:"comment,omitempty"`
+	Public    bool            `xml:"public,attr" json:"public"`
+	SongCount int             `xml:"songCount,attr" json:"songCount"`
+	Duration  int             `xml:"duration,attr" json:"duration"`
+	Created   time.Time       `xml:"created,attr" json:"created"`
+	Changed   time.Time       `xml:"changed,attr" json:"changed"`
+	CoverArt  string          `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Entry     []subsonicChild `xml:"entry,omitempty" json:"entry,omitempty"`
+}
+
+type subsonicJukeboxStatus struct {
+	CurrentIndex int     `xml:"currentIndex,attr" json:"currentIndex"`
+	Playing      bool    `xml:"playing,attr" json:"playing"`
+	Gain         float64 `xml:"gain,attr" json:"gain"`
+	Position     int     `xml:"position,attr" json:"position"`
+}
+
+type subsonicJukeboxPlaylist struct {
+	subsonicJukeboxStatus
+	Entry []subsonicChild `xml:"entry" json:"entry"`
+}
+
+// subsonicLibrary groups the flat track index into artists and albums.
+type subsonicLibrary struct {
+	artists     []*subsonicLibArtist
+	artistsByID map[string]*subsonicLibArtist
+	albumsByID  map[string]*subsonicLibAlbum
+	tracksByID  map[string]*kefw2.IndexedTrack
+	trackIDs    map[string]string // URI or path -> track ID
+}
+
+type subsonicLibArtist struct {
+	id, name string
+	albums   []*subsonicLibAlbum
+}
+
+type subsonicLibAlbum struct {
+	id, name string
+	artist   *subsonicLibArtist
+	tracks   []*kefw2.IndexedTrack
+}
+
+// subsonicID returns a short stable ID for the given key parts.
+func subsonicID(prefix string, parts ...string) string {
+	h := fnv.New64a()
+	for _, p := range parts {
+		_, _ = h.Write([]byte(p))
+		_, _ = h.Write([]byte{0})
+	}
+	return prefix + strconv.FormatUint(h.Sum64(), 36)
+}
+
+// subsonicTrackID returns the ID of an index track.
+func subsonicTrackID(t *kefw2.IndexedTrack) string {
+	if t.URI != "" {
+		return subsonicID(subsonicTrackPrefix, t.URI)
+	}
+	return subsonicID(subsonicTrackPrefix, t.Path)
+}
+
+// loadSubsonicLibrary returns the library view of the track index. It is
+// built on first use and again after the media index is rebuilt, not per
+// request. An unbuilt index yields an empty library.
+func (s *Server) loadSubsonicLibrary() *subsonicLibrary {
+	s.subsonicMu.Lock()
+	defer s.subsonicMu.Unlock()
+
+	if s.subsonicLib != nil {
+		return s.subsonicLib
+	}
+	index, err := kefw2.LoadTrackIndexCached()
+	if err != nil {
+		// Try again on the next request
+		return buildSubsonicLibrary(nil)
+	}
+	s.subsonicLib = buildSubsonicLibrary(index)
+	return s.subsonicLib
+}
+
+// invalidateSubsonicLibrary drops the library view after the media index
+// was rebuilt.
+func (s *Server) invalidateSubsonicLibrary() {
+	s.subsonicMu.Lock()
+	s.subsonicLib = nil
+	s.subsonicMu.Unlock()
+}
+
+// buildSubsonicLibrary builds the library view of a track index, which may
+// be nil.
+func buildSubsonicLibrary(index *kefw2.TrackIndex) *subsonicLibrary {
+	lib := &subsonicLibrary{
+		artistsByID: make(map[string]*subsonicLibArtist),
+		albumsByID:  make(map[string]*subsonicLibAlbum),
+		tracksByID:  make(map[string]*kefw2.IndexedTrack),
+		trackIDs:    make(map[string]string),
+	}
+	if index == nil {
+		return lib
+	}
+
+	for i := range index.Tracks {
+		t := &index.Tracks[i]
+		artistName := t.Artist
+		if artistName == "" {
+			artistName = "Unknown Artist"
+		}
+		albumName := t.Album
+		if albumName == "" {
+			albumName = "Unknown Album"
+		}
+
+		artistID := subsonicID(subsonicArtistPrefix, artistName)
+		artist, ok := lib.artistsByID[artistID]
+		if !ok {
+			artist = &subsonicLibArtist{id: artistID, name: artistName}
+			lib.artistsByID[artistID] = artist
+			lib.artists = append(lib.artists, artist)
+		}
+
+		albumID := subsonicID(subsonicAlbumPrefix, artistName, albumName)
+		album, ok := lib.albumsByID[albumID]
+		if !ok {
+			album = &subsonicLibAlbum{id: albumID, name: albumName, artist: artist}
+			lib.albumsByID[albumID] = album
+			artist.albums = append(artist.albums, album)
+		}
+		album.tracks = append(album.tracks, t)
+
+		trackID := subsonicTrackID(t)
+		lib.tracksByID[trackID] = t
+		if t.URI != "" {
+			lib.trackIDs[t.URI] = trackID
+		}
+		if t.Path != "" {
+			lib.trackIDs[t.Path] = trackID
+		}
+	}
+
+	sort.Slice(lib.artists, func(i, j int) bool {
+		return strings.ToLower(lib.artists[i].name) < strings.ToLower(lib.artists[j].name)
+	})
+	for _, artist := range lib.artists {
+		sort.Slice(artist.albums, func(i, j int) bool {
+			return strings.ToLower(artist.albums[i].name) < strings.ToLower(artist.albums[j].name)
+		})
+	}
+	return lib
+}
+
+// albumOf returns the album of a track.
+func (lib *subsonicLibrary) albumOf(t *kefw2.IndexedTrack) *subsonicLibAlbum {
+	artistName, albumName := t.Artist, t.Album
+	if artistName == "" {
+		artistName = "Unknown Artist"
+	}
+	if albumName == "" {
+		albumName = "Unknown Album"
+	}
+	return lib.albumsByID[subsonicID(subsonicAlbumPrefix, artistName, albumName)]
+}
+
+// coverArt returns the cover art ID for an album: the album ID when one of
+// its tracks has artwork.
+func (a *subsonicLibAlbum) coverArt() string {
+	for _, t := range a.tracks {
+		if t.Icon != "" {
+			return a.id
+		}
+	}
+	return ""
+}
+
+func (lib *subsonicLibrary) artistEntry(a *subsonicLibArtist) subsonicArtist {
+	entry := subsonicArtist{ID: a.id, Name: a.name, AlbumCount: len(a.albums)}
+	for _, album := range a.albums {
+		if entry.CoverArt = album.coverArt(); entry.CoverArt != "" {
+			break
+		}
+	}
+	return entry
+}
+
+func (lib *subsonicLibrary) albumEntry(a *subsonicLibAlbum) subsonicAlbum {
+	duration := 0
+	for _, t := range a.tracks {
+		duration += t.Duration
+	}
+	return subsonicAlbum{
+		ID:        a.id,
+		Name:      a.name,
+		Artist:    a.artist.name,
+		ArtistID:  a.artist.id,
+		CoverArt:  a.coverArt(),
+		SongCount: len(a.tracks),
+		Duration:  duration / 1000,
+	}
+}
+
+func (lib *subsonicLibrary) songEntry(t *kefw2.IndexedTrack) subsonicChild {
+	child := subsonicChild{
+		ID:          subsonicTrackID(t),
+		Title:       t.Title,
+		Album:       t.Album,
+		Artist:      t.Artist,
+		Duration:    t.Duration / 1000,
+		ContentType: t.MimeType,
+		Suffix:      subsonicSuffix(t.MimeType, t.URI),
+		Type:        "music",
+	}
+	if t.Icon != "" {
+		child.CoverArt = child.ID
+	}
+	if album := lib.albumOf(t); album != nil {
+		child.Parent = album.id
+		child.AlbumID = album.id
+		child.ArtistID = album.artist.id
+	}
+	return child
+}
+
+// subsonicSuffix guesses a file suffix from a MIME type or URI.
+func subsonicSuffix(mimeType, uri string) string {
+	switch _, sub, _ := strings.Cut(mimeType, "/"); sub {
+	case "":
+	case "mpeg":
+		return "mp3"
+	case "mp4", "x-m4a":
+		return "m4a"
+	default:
+		return strings.TrimPrefix(sub, "x-")
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(strings.SplitN(uri, "?", 2)[0]), "."))
+}
+
+// playlistEntry converts a stored playlist track, reusing the index ID when
+// the track is in the index.
+func (lib *subsonicLibrary) playlistEntry(pl *playlist.Playlist, i int) subsonicChild {
+	t := pl.Tracks[i]
+	for _, key := range []string{t.URI, t.Path} {
+		if id, ok := lib.trackIDs[key]; ok && key != "" {
+			return lib.songEntry(lib.tracksByID[id])
+		}
+	}
+
+	child := subsonicChild{
+		ID:          fmt.Sprintf("%s%d-%s", subsonicEntryPrefix, i, pl.ID),
+		Parent:      subsonicPlaylistPrefix + pl.ID,
+		Title:       t.Title,
+		Album:       t.Album,
+		Artist:      t.Artist,
+		Duration:    t.Duration / 1000,
+		ContentType: t.MimeType,
+		Suffix:      subsonicSuffix(t.MimeType, t.URI),
+		Type:        "music",
+	}
+	if t.Icon != "" {
+		child.CoverArt = child.ID
+	}
+	return child
+}
+
+// queueEntry converts a speaker queue row.
+func (lib *subsonicLibrary) queueEntry(item kefw2.ContentItem, pos int) subsonicChild {
+	child := subsonicChild{
+		ID:    fmt.Sprintf("%s%d", subsonicQueuePrefix, pos),
+		Title: item.Title,
+		Type:  "music",
+	}
+	if item.MediaData != nil {
+		child.Artist = item.MediaData.MetaData.Artist
+		child.Album = item.MediaData.MetaData.Album
+		if len(item.MediaData.Resources) > 0 {
+			res := item.MediaData.Resources[0]
+			if id, ok := lib.trackIDs[res.URI]; ok && res.URI != "" {
+				return lib.songEntry(lib.tracksByID[id])
+			}
+			child.Duration = res.Duration / 1000
+			child.ContentType = res.MimeType
+			child.Suffix = subsonicSuffix(res.MimeType, res.URI)
+		}
+	}
+	return child
+}
+
+// subsonicRequest carries one API call's parameters and response format.
+type subsonicRequest struct {
+	r      *http.Request
+	format string
+}
+
+func (req *subsonicRequest) param(name string) string {
+	return req.r.Form.Get(name)
+}
+
+func (req *subsonicRequest) params(name string) []string {
+	return req.r.Form[name]
+}
+
+// intParam returns an integer parameter or def when missing or invalid.
+func (req *subsonicRequest) intParam(name string, def int) int {
+	if n, err := strconv.Atoi(req.param(name)); err == nil {
+		return n
+	}
+	return def
+}
+
+// handleSubsonic dispatches /rest/{method}[.view] calls.
+func (s *Server) handleSubsonic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	req := &subsonicRequest{r: r, format: r.Form.Get("f")}
+	method := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/rest/"), ".view")
+
+	// Without --auth, credentials (u, p or t+s) are accepted as given;
+	// with it, authMiddleware has already checked them
+	resp := s.subsonicCall(method, req)
+	if method == "getCoverArt" && resp == nil {
+		s.handleSubsonicCoverArt(w, req)
+		return
+	}
+	s.writeSubsonic(w, req, resp)
+}
+
+// subsonicCall runs an API method and returns its response. getCoverArt
+// returns nil: it writes image data instead.
+func (s *Server) subsonicCall(method string, req *subsonicRequest) *subsonicResponse {
+	switch method {
+	case "ping":
+		return subsonicOK()
+	case "getLicense":
+		resp := subsonicOK()
+		resp.License = &subsonicLicense{Valid: true}
+		return resp
+	case "getOpenSubsonicExtensions":
+		resp := subsonicOK()
+		resp.Extensions = &[]subsonicExtension{{Name: "formPost", Versions: []int{1}}}
+		return resp
+	case "getMusicFolders":
+		resp := subsonicOK()
+		resp.MusicFolders = &subsonicMusicFolders{MusicFolder: []subsonicMusicFolder{{ID: 1, Name: "Media index"}}}
+		return resp
+	case "getArtists":
+		return s.subsonicGetArtists()
+	case "getArtist":
+		return s.subsonicGetArtist(req)
+	case "getAlbum":
+		return s.subsonicGetAlbum(req)
+	case "search3":
+		return s.subsonicSearch3(req)
+	case "getCoverArt":
+		return nil
+	case "getPlaylists":
+		return s.subsonicGetPlaylists()
+	case "getPlaylist":
+		return s.subsonicGetPlaylist(req)
+	case "jukeboxControl":
+		return s.subsonicJukebox(req)
+	}
+	return subsonicFailed(subsonicErrNotFound, "Unknown method: "+method)
+}
+
+func subsonicOK() *subsonicResponse {
+	return &subsonicResponse{
+		Xmlns:         "http://subsonic.org/restapi",
+		Status:        "ok",
+		Version:       subsonicAPIVersion,
+		Type:          "kefw2ui",
+		ServerVersion: subsonicAPIVersion,
+		OpenSubsonic:  true,
+	}
+}
+
+func subsonicFailed(code int, message string) *subsonicResponse {
+	resp := subsonicOK()
+	resp.Status = "failed"
+	resp.Error = &subsonicError{Code: code, Message: message}
+	return resp
+}
+
+// writeSubsonic writes a response as XML (default) or JSON (f=json).
+func (s *Server) writeSubsonic(w http.ResponseWriter, req *subsonicRequest, resp *subsonicResponse) {
+	if req.format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"subsonic-response": resp})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding Subsonic response: %v", err)
+	}
+}
+
+// subsonicIndexName returns the index letter an artist is listed under.
+func subsonicIndexName(name string) string {
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			return string(unicode.ToUpper(r))
+		}
+		break
+	}
+	return "#"
+}
+
+func (s *Server) subsonicGetArtists() *subsonicResponse {
+	lib := s.loadSubsonicLibrary()
+
+	artists := &subsonicArtists{Index: []subsonicIndex{}}
+	for _, a := range lib.artists {
+		name := subsonicIndexName(a.name)
+		if n := len(artists.Index); n == 0 || artists.Index[n-1].Name != name {
+			artists.Index = append(artists.Index, subsonicIndex{Name: name})
+		}
+		idx := &artists.Index[len(artists.Index)-1]
+		idx.Artist = append(idx.Artist, lib.artistEntry(a))
+	}
+
+	resp := subsonicOK()
+	resp.Artists = artists
+	return resp
+}
+
+func (s *Server) subsonicGetArtist(req *subsonicRequest) *subsonicResponse {
+	id := req.param("id")
+	if id == "" {
+		return subsonicFailed(subsonicErrMissing, "Required parameter is missing: id")
+	}
+	lib := s.loadSubsonicLibrary()
+	a, ok := lib.artistsByID[id]
+	if !ok {
+		return subsonicFailed(subsonicErrNotFound, "Artist not found")
+	}
+
+	entry := lib.artistEntry(a)
+	entry.Album = make([]subsonicAlbum, 0, len(a.albums))
+	for _, album := range a.albums {
+		entry.Album = append(entry.Album, lib.albumEntry(album))
+	}
+
+	resp := subsonicOK()
+	resp.Artist = &entry
+	return resp
+}
+
+func (s *Server) subsonicGetAlbum(req *subsonicRequest) *subsonicResponse {
+	id := req.param("id")
+	if id == "" {
+		return subsonicFailed(subsonicErrMissing, "Required parameter is missing: id")
+	}
+	lib := s.loadSubsonicLibrary()
+	a, ok := lib.albumsByID[id]
+	if !ok {
+		return subsonicFailed(subsonicErrNotFound, "Album not found")
+	}
+
+	entry := lib.albumEntry(a)
+	entry.Song = make([]subsonicChild, 0, len(a.tracks))
+	for _, t := range a.tracks {
+		entry.Song = append(entry.Song, lib.songEntry(t))
+	}
+
+	resp := subsonicOK()
+	resp.Album = &entry
+	return resp
+}
+
+// subsonicPage returns the [offset, offset+count) window of n items.
+func subsonicPage(n, offset, count int) (int, int) {
+	start := min(max(offset, 0), n)
+	return start, min(start+max(count, 0), n)
+}
+
+func (s *Server) subsonicSearch3(req *subsonicRequest) *subsonicResponse {
+	// An empty query ("" or "\"\"") matches everything; apps use it to
+	// sync the whole library
+	query := strings.ToLower(strings.Trim(strings.TrimSpace(req.param("query")), `"`))
+	match := func(fields ...string) bool {
+		if query == "" {
+			return true
+		}
+		for _, f := range fields {
+			if strings.Contains(strings.ToLower(f), query) {
+				return true
+			}
+		}
+		return false
+	}
+
+	lib := s.loadSubsonicLibrary()
+	var artists []*subsonicLibArtist
+	var albums []*subsonicLibAlbum
+	var tracks []*kefw2.IndexedTrack
+	for _, a := range lib.artists {
+		if match(a.name) {
+			artists = append(artists, a)
+		}
+		for _, album := range a.albums {
+			if match(album.name) {
+				albums = append(albums, album)
+			}
+			for _, t := range album.tracks {
+				if match(t.Title, t.Artist, t.Album) {
+					tracks = append(tracks, t)
+				}
+			}
+		}
+	}
+
+	result := &subsonicSearchResult{Artist: []subsonicArtist{}, Album: []subsonicAlbum{}, Song: []subsonicChild{}}
+	start, end := subsonicPage(len(artists), req.intParam("artistOffset", 0), req.intParam("artistCount", 20))
+	for _, a := range artists[start:end] {
+		result.Artist = append(result.Artist, lib.artistEntry(a))
+	}
+	start, end = subsonicPage(len(albums), req.intParam("albumOffset", 0), req.intParam("albumCount", 20))
+	for _, a := range albums[start:end] {
+		result.Album = append(result.Album, lib.albumEntry(a))
+	}
+	start, end = subsonicPage(len(tracks), req.intParam("songOffset", 0), req.intParam("songCount", 20))
+	for _, t := range tracks[start:end] {
+		result.Song = append(result.Song, lib.songEntry(t))
+	}
+
+	resp := subsonicOK()
+	resp.SearchResult3 = result
+	return resp
+}
+
+// subsonicPlaylistEntry converts a playlist's metadata.
+func subsonicPlaylistEntry(pl *playlist.Playlist) subsonicPlaylist {
+	entry := subsonicPlaylist{
+		ID:        pl.ID,
+		Name:      pl.Name,
+		Comment:   pl.Description,
+		Public:    true,
+		SongCount: len(pl.Tracks),
+		Created:   pl.CreatedAt.UTC(),
+		Changed:   pl.UpdatedAt.UTC(),
+	}
+	for _, t := range pl.Tracks {
+		entry.Duration += t.Duration / 1000
+		if entry.CoverArt == "" && t.Icon != "" {
+			entry.CoverArt = subsonicPlaylistPrefix + pl.ID
+		}
+	}
+	return entry
+}
+
+func (s *Server) subsonicGetPlaylists() *subsonicResponse {
+	if s.playlists == nil {
+		return subsonicFailed(subsonicErrGeneric, "Playlist manager not available")
+	}
+	list, err := s.playlists.List()
+	if err != nil {
+		return subsonicFailed(subsonicErrGeneric, "Failed to list playlists: "+err.Error())
+	}
+
+	// List returns metadata only; load each for counts and durations
+	playlists := &subsonicPlaylists{Playlist: make([]subsonicPlaylist, 0, len(list))}
+	for _, meta := range list {
+		pl, err := s.playlists.Get(meta.ID)
+		if err != nil {
+			continue
+		}
+		playlists.Playlist = append(playlists.Playlist, subsonicPlaylistEntry(pl))
+	}
+
+	resp := subsonicOK()
+	resp.Playlists = playlists
+	return resp
+}
+
+func (s *Server) subsonicGetPlaylist(req *subsonicRequest) *subsonicResponse {
+	id := req.param("id")
+	if id == "" {
+		return subsonicFailed(subsonicErrMissing, "Required parameter is missing: id")
+	}
+	if s.playlists == nil {
+		return subsonicFailed(subsonicErrGeneric, "Playlist manager not available")
+	}
+	pl, err := s.playlists.Get(id)
+	if err != nil {
+		return subsonicFailed(subsonicErrNotFound, "Playlist not found")
+	}
+
+	lib := s.loadSubsonicLibrary()
+	entry := subsonicPlaylistEntry(pl)
+	entry.Entry = make([]subsonicChild, 0, len(pl.Tracks))
+	for i := range pl.Tracks {
+		entry.Entry = append(entry.Entry, lib.playlistEntry(pl, i))
+	}
+
+	resp := subsonicOK()
+	resp.Playlist = &entry
+	return resp
+}
+
+// subsonicPlaylistTrack resolves a "pe-{index}-{playlist ID}" entry ID.
+func (s *Server) subsonicPlaylistTrack(id string) (*playlist.Track, *playlist.Playlist) {
+	if s.playlists == nil {
+		return nil, nil
+	}
+	indexStr, plID, ok := strings.Cut(strings.TrimPrefix(id, subsonicEntryPrefix), "-")
+	if !ok {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return nil, nil
+	}
+	pl, err := s.playlists.Get(plID)
+	if err != nil || i < 0 || i >= len(pl.Tracks) {
+		return nil, nil
+	}
+	return &pl.Tracks[i], pl
+}
+
+// handleSubsonicCoverArt serves artwork for album, track, playlist and
+// playlist entry IDs through the image cache.
+func (s *Server) handleSubsonicCoverArt(w http.ResponseWriter, req *subsonicRequest) {
+	id := req.param("id")
+	if id == "" {
+		s.writeSubsonic(w, req, subsonicFailed(subsonicErrMissing, "Required parameter is missing: id"))
+		return
+	}
+
+	icon := ""
+	lib := s.loadSubsonicLibrary()
+	switch {
+	case strings.HasPrefix(id, subsonicAlbumPrefix):
+		if album, ok := lib.albumsByID[id]; ok {
+			for _, t := range album.tracks {
+				if t.Icon != "" {
+					icon = t.Icon
+					break
+				}
+			}
+		}
+	case strings.HasPrefix(id, subsonicTrackPrefix):
+		if t, ok := lib.tracksByID[id]; ok {
+			icon = t.Icon
+		}
+	case strings.HasPrefix(id, subsonicEntryPrefix):
+		if t, _ := s.subsonicPlaylistTrack(id); t != nil {
+			icon = t.Icon
+		}
+	case strings.HasPrefix(id, subsonicPlaylistPrefix) && s.playlists != nil:
+		if pl, err := s.playlists.Get(strings.TrimPrefix(id, subsonicPlaylistPrefix)); err == nil {
+			for _, t := range pl.Tracks {
+				if t.Icon != "" {
+					icon = t.Icon
+					break
+				}
+			}
+		}
+	}
+	if icon == "" {
+		s.writeSubsonic(w, req, subsonicFailed(subsonicErrNotFound, "Cover art not found"))
+		return
+	}
+
+	entry, _, err := s.fetchImage(req.r.Context(), icon)
+	if err != nil {
+		s.writeSubsonic(w, req, subsonicFailed(subsonicErrGeneric, "Failed to fetch cover art: "+err.Error()))
+		return
+	}
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_, _ = w.Write(entry.Data)
+}
+
+// subsonicContentItems resolves song IDs to queue items: index tracks,
+// stored playlist entries, or whole playlists.
+func (s *Server) subsonicContentItems(airable *kefw2.AirableClient, ids []string) ([]kefw2.ContentItem, error) {
+	lib := s.loadSubsonicLibrary()
+	items := make([]kefw2.ContentItem, 0, len(ids))
+	for _, id := range ids {
+		if t, ok := lib.tracksByID[id]; ok {
+			items = append(items, kefw2.IndexedTrackToContentItem(t))
+			continue
+		}
+		if t, _ := s.subsonicPlaylistTrack(id); t != nil {
+			resolved, _ := playlist.ContentItems(airable, []playlist.Track{*t})
+			items = append(items, resolved...)
+			continue
+		}
+		if album, ok := lib.albumsByID[id]; ok {
+			for _, t := range album.tracks {
+				items = append(items, kefw2.IndexedTrackToContentItem(t))
+			}
+			continue
+		}
+		return nil, fmt.Errorf("song not found: %s", id)
+	}
+	return items, nil
+}
+
+// subsonicJukebox implements jukeboxControl on the active speaker's queue.
+func (s *Server) subsonicJukebox(req *subsonicRequest) *subsonicResponse {
+	spk := s.manager.GetActiveSpeaker()
+	if spk == nil {
+		return subsonicFailed(subsonicErrGeneric, "No active speaker")
+	}
+
+	ctx, cancel := context.WithTimeout(req.r.Context(), 15*time.Second)
+	defer cancel()
+
+	// Queue reads must see the current queue, so only item lookups go
+	// through the rows cache
+	airable := kefw2.NewAirableClient(spk)
+	action := req.param("action")
+
+	var err error
+	switch action {
+	case "get", "status", "":
+	case "start":
+		_, err = airable.PlayOrResumeFromQueue(ctx)
+	case "stop":
+		var pd kefw2.PlayerData
+		if pd, err = spk.PlayerData(ctx); err == nil && pd.State == kefw2.PlayerStatePlaying {
+			err = spk.PlayPause(ctx)
+		}
+	case "skip":
+		err = s.subsonicJukeboxSkip(ctx, spk, airable, req)
+	case "add", "set":
+		var items []kefw2.ContentItem
+		if items, err = s.subsonicContentItems(s.getCachedAirableClient(spk), req.params("id")); err != nil {
+			return subsonicFailed(subsonicErrNotFound, err.Error())
+		}
+		if action == "set" {
+			if err = airable.ClearPlaylist(); err != nil {
+				break
+			}
+		}
+		if len(items) > 0 {
+			err = airable.AddToQueue(items, false)
+		}
+	case "clear":
+		err = airable.ClearPlaylist()
+	case "remove":
+		index := req.intParam("index", -1)
+		if index < 0 {
+			return subsonicFailed(subsonicErrMissing, "Required parameter is missing: index")
+		}
+		err = airable.RemoveFromQueue([]int{index})
+	case "shuffle":
+		// The speaker shuffles at play time rather than reordering the queue
+		err = airable.SetShuffle(true)
+	case "setGain":
+		gain, perr := strconv.ParseFloat(req.param("gain"), 64)
+		if perr != nil || gain < 0 || gain > 1 {
+			return subsonicFailed(subsonicErrMissing, "Required parameter is missing or invalid: gain")
+		}
+		_, err = s.manager.SetVolume(ctx, spk, int(gain*100+0.5), speaker.OriginSubsonic)
+	default:
+		return subsonicFailed(subsonicErrGeneric, "Unknown jukebox action: "+action)
+	}
+	if err != nil {
+		return subsonicFailed(subsonicErrGeneric, fmt.Sprintf("Jukebox %s failed: %v", action, err))
+	}
+
+	status := s.subsonicJukeboxStatus(ctx, spk, airable)
+	resp := subsonicOK()
+	if action != "get" {
+		resp.JukeboxStatus = &status
+		return resp
+	}
+
+	lib := s.loadSubsonicLibrary()
+	jukebox := &subsonicJukeboxPlaylist{subsonicJukeboxStatus: status, Entry: []subsonicChild{}}
+	if queue, err := airable.GetPlayQueue(); err == nil {
+		for i, item := range queue.Rows {
+			jukebox.Entry = append(jukebox.Entry, lib.queueEntry(item, i))
+		}
+	}
+	resp.JukeboxPlaylist = jukebox
+	return resp
+}
+
+// subsonicJukeboxSkip plays the queue entry at index, starting offset
+// seconds in.
+func (s *Server) subsonicJukeboxSkip(ctx context.Context, spk *kefw2.KEFSpeaker, airable *kefw2.AirableClient, req *subsonicRequest) error {
+	index := req.intParam("index", -1)
+	queue, err := airable.GetPlayQueue()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(queue.Rows) {
+		return fmt.Errorf("index out of range")
+	}
+	if err := airable.PlayQueueIndex(index, &queue.Rows[index]); err != nil {
+		return err
+	}
+
+	if offset := req.intParam("offset", 0); offset > 0 {
+		if err := spk.SeekTo(ctx, int64(offset)*1000); err != nil {
+			return err
+		}
+		s.setPosition(spk, int64(offset)*1000)
+	}
+	return nil
+}
+
+// subsonicJukeboxStatus returns the speaker's playback state from the
+// state store; only the queue index is read from the speaker.
+func (s *Server) subsonicJukeboxStatus(ctx context.Context, spk *kefw2.KEFSpeaker, airable *kefw2.AirableClient) subsonicJukeboxStatus {
+	status := subsonicJukeboxStatus{CurrentIndex: -1}
+	if index, err := airable.GetCurrentQueueIndex(); err == nil {
+		status.CurrentIndex = index
+	}
+	state, _ := s.speakerState.Get(ctx, spk)
+	status.Playing = state.Player.State == kefw2.PlayerStatePlaying
+	status.Gain = float64(state.Volume) / 100
+	if ms := state.Player.CurrentPosition(time.Now()); ms > 0 {
+		status.Position = int(ms / 1000)
+	}
+	return status
+}
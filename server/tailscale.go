@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"tailscale.com/client/tailscale/apitype"
+
+	"github.com/hilli/kefw2ui/auth"
+	"github.com/hilli/kefw2ui/config"
+)
+
+// taggedDevicesLogin is the login name Tailscale reports for tagged nodes,
+// which don't belong to a user.
+const taggedDevicesLogin = "tagged-devices"
+
+// WhoIsFunc resolves the tailnet user and node behind a remote address, as
+// tailscale's local client WhoIs method does.
+type WhoIsFunc func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error)
+
+// TailscaleHandler returns the HTTP handler for the Tailscale listener. Each
+// caller is resolved with whois and given a role from the Tailscale ACL in
+// config before the usual auth middleware runs.
+func (s *Server) TailscaleHandler(whois WhoIsFunc) http.Handler {
+	if s.opts.Config != nil {
+		if acl := s.opts.Config.GetTailscaleACL(); acl != nil {
+			roles := []string{acl.DefaultRole}
+			for _, rule := range acl.Rules {
+				roles = append(roles, rule.Role)
+			}
+			for _, role := range roles {
+				if _, err := auth.ParseRole(role); role != "" && err != nil {
+					log.Printf("Warning: Tailscale ACL: %v; matching callers get no access", err)
+				}
+			}
+			log.Printf("Tailscale ACL: %d rule(s), default role %q", len(acl.Rules), acl.DefaultRole)
+		}
+	}
+	return loggingMiddleware(s.tailscaleMiddleware(whois, s.apiHandler()))
+}
+
+// tailscaleMiddleware adds the tailnet caller's identity to the request.
+func (s *Server) tailscaleMiddleware(whois WhoIsFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := &auth.Identity{Name: r.RemoteAddr, Method: auth.MethodTailscale}
+		if who, err := whois(r.Context(), r.RemoteAddr); err != nil {
+			log.Printf("Tailscale WhoIs %s failed: %v", r.RemoteAddr, err)
+		} else {
+			id = s.tailscaleIdentity(who)
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+// tailscaleIdentity maps a WhoIs response to an identity with its ACL role.
+func (s *Server) tailscaleIdentity(who *apitype.WhoIsResponse) *auth.Identity {
+	var user, node string
+	var tags []string
+	if who.UserProfile != nil && who.UserProfile.LoginName != taggedDevicesLogin {
+		user = who.UserProfile.LoginName
+	}
+	if who.Node != nil {
+		name := who.Node.ComputedName
+		if name == "" {
+			name = who.Node.Name
+		}
+		node, _, _ = strings.Cut(name, ".")
+		tags = who.Node.Tags
+	}
+
+	id := &auth.Identity{Name: user, Node: node, Method: auth.MethodTailscale}
+	if id.Name == "" {
+		id.Name = node
+	}
+	id.Role = s.tailscaleRole(user, node, tags)
+	return id
+}
+
+// tailscaleRole returns the ACL role of a tailnet caller, or "" for none.
+// Without an ACL, tailnet callers keep full access unless --auth asks them
+// for credentials like everyone else.
+func (s *Server) tailscaleRole(user, node string, tags []string) auth.Role {
+	var acl *config.TailscaleACL
+	if s.opts.Config != nil {
+		acl = s.opts.Config.GetTailscaleACL()
+	}
+	if acl == nil {
+		if s.auth == nil {
+			return auth.RoleAdmin
+		}
+		return ""
+	}
+
+	role, err := auth.ParseRole(acl.Role(user, node, tags))
+	if err != nil {
+		return ""
+	}
+	return role
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/webhooks"
+)
+
+// webhookRequest is the request body for creating or updating a webhook.
+// Nil fields are left unchanged on update.
+type webhookRequest struct {
+	Name     *string   `json:"name"`
+	URL      *string   `json:"url"`
+	Secret   *string   `json:"secret"`
+	Events   *[]string `json:"events"`
+	Disabled *bool     `json:"disabled"`
+
+	RegenerateSecret bool `json:"regenerateSecret"` // PUT only
+}
+
+// apply copies the set fields onto wh and validates the result.
+func (req *webhookRequest) apply(wh *config.WebhookConfig) error {
+	if req.Name != nil {
+		wh.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		wh.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Secret != nil {
+		wh.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		wh.Events = *req.Events
+	}
+	if req.Disabled != nil {
+		wh.Disabled = *req.Disabled
+	}
+
+	if wh.Name == "" {
+		return errors.New("Webhook name is required")
+	}
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Webhook URL must be an http or https URL")
+	}
+	for _, event := range wh.Events {
+		if !slices.Contains(webhooks.EventTypes, event) {
+			return fmt.Errorf("Unknown event type: %s", event)
+		}
+	}
+	return nil
+}
+
+// handleWebhooks handles listing and creating webhooks.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		s.jsonError(w, "Webhooks not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"webhooks":   s.opts.Config.GetWebhooks(),
+			"eventTypes": webhooks.EventTypes,
+		})
+
+	case http.MethodPost:
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var wh config.WebhookConfig
+		if err := req.apply(&wh); err != nil {
+			s.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		wh, err := s.opts.Config.AddWebhook(wh)
+		if err != nil {
+			s.jsonError(w, "Failed to save webhook: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"webhook": wh,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhook handles operations on a single webhook.
+//   - GET /api/webhooks/{id}
+//   - PUT /api/webhooks/{id} - partial update, {"regenerateSecret": true} for a new secret
+//   - DELETE /api/webhooks/{id}
+//   - GET /api/webhooks/{id}/deliveries
+//   - POST /api/webhooks/{id}/test
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		s.jsonError(w, "Webhooks not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Extract webhook ID from path: /api/webhooks/{id}[/deliveries|/test]
+	path := strings.TrimPrefix(r.URL.Path, "/api/webhooks/")
+	if id, ok := strings.CutSuffix(path, "/deliveries"); ok {
+		s.handleWebhookDeliveries(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(path, "/test"); ok {
+		s.handleWebhookTest(w, r, id)
+		return
+	}
+	id := path
+	if id == "" || strings.Contains(id, "/") {
+		s.jsonError(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	wh := s.opts.Config.FindWebhook(id)
+	if wh == nil {
+		s.jsonError(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"webhook": wh,
+		})
+
+	case http.MethodPut:
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.apply(wh); err != nil {
+			s.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.RegenerateSecret || wh.Secret == "" {
+			secret, err := config.NewWebhookSecret()
+			if err != nil {
+				s.jsonError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			wh.Secret = secret
+		}
+
+		if err := s.opts.Config.UpdateWebhook(*wh); err != nil {
+			s.jsonError(w, "Failed to save webhook: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"webhook": wh,
+		})
+
+	case http.MethodDelete:
+		if err := s.opts.Config.RemoveWebhook(id); err != nil {
+			s.jsonError(w, "Failed to delete webhook: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.webhooks.Forget(id)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhookDeliveries returns the recent delivery log of a webhook.
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.opts.Config.FindWebhook(id) == nil {
+		s.jsonError(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"deliveries": s.webhooks.Deliveries(id),
+	})
+}
+
+// handleWebhookTest sends a test event to a webhook and reports the result.
+// Disabled webhooks are tested too, so they can be checked before enabling.
+func (s *Server) handleWebhookTest(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	delivery, err := s.webhooks.SendTest(id)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"delivery": delivery,
+	})
+}
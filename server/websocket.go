@@ -0,0 +1,381 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/hilli/kefw2ui/auth"
+)
+
+const (
+	// wsPingTimeout is how long a client has to answer a WebSocket ping
+	wsPingTimeout = 10 * time.Second
+
+	// wsMaxMessage is the largest message a client may send
+	wsMaxMessage = 1 << 20
+)
+
+// JSON-RPC error codes. Errors returned by the REST handlers use their HTTP
+// status as the code instead.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// wsRoute is the REST endpoint a WebSocket method calls.
+type wsRoute struct {
+	method string
+	path   string // {id} is replaced with the "id" param
+}
+
+// wsMethods maps WebSocket methods to REST endpoints. The params are sent as
+// the JSON request body, so they are the same as the endpoint's.
+var wsMethods = map[string]wsRoute{
+	"player.get":       {http.MethodGet, "/api/player"},
+	"player.playPause": {http.MethodPost, "/api/player/play"},
+	"player.stop":      {http.MethodPost, "/api/player/stop"},
+	"player.next":      {http.MethodPost, "/api/player/next"},
+	"player.prev":      {http.MethodPost, "/api/player/prev"},
+	"player.volume":    {http.MethodPost, "/api/player/volume"},
+	"player.mute":      {http.MethodPost, "/api/player/mute"},
+	"player.source":    {http.MethodPost, "/api/player/source"},
+	"player.seek":      {http.MethodPost, "/api/player/seek"},
+	"player.power":     {http.MethodPost, "/api/player/power"},
+	"queue.get":        {http.MethodGet, "/api/queue"},
+	"queue.play":       {http.MethodPost, "/api/queue/play"},
+	"queue.remove":     {http.MethodPost, "/api/queue/remove"},
+	"queue.move":       {http.MethodPost, "/api/queue/move"},
+	"queue.clear":      {http.MethodPost, "/api/queue/clear"},
+	"queue.mode":       {http.MethodPost, "/api/queue/mode"},
+	"playlists.load":   {http.MethodPost, "/api/playlists/load/{id}"},
+	"scenes.recall":    {http.MethodPost, "/api/scenes/{id}/recall"},
+	"announce":         {http.MethodPost, "/api/announce"},
+}
+
+// rpcMessage is a JSON-RPC 2.0 request, response or notification.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a failed request.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcRequest is a request from the client.
+type rpcRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// wsHTTPParams are the params of the "http" method, which calls any REST
+// endpoint.
+type wsHTTPParams struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// wsConn is a connected WebSocket client.
+type wsConn struct {
+	s    *Server
+	conn *websocket.Conn
+	r    *http.Request // the upgrade request, for credentials
+}
+
+// send writes a message. Conn.Write is safe to call concurrently.
+func (c *wsConn) send(ctx context.Context, msg rpcMessage) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.conn.Write(ctx, websocket.MessageText, data)
+}
+
+// handleWebSocket handles WebSocket connections. They carry the same events
+// as /events (with the same ?topics= and ?lastEventId=), and JSON-RPC
+// requests that call the REST handlers with the connection's credentials.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	topics, err := parseTopics(r.URL.Query().Get("topics"))
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket accept failed: %v", err)
+		return
+	}
+	defer func() { _ = conn.CloseNow() }()
+	conn.SetReadLimit(wsMaxMessage)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := &wsConn{s: s, conn: conn, r: r}
+	go c.readLoop(ctx, cancel)
+
+	// Register client
+	client := s.addSSEClient(topics)
+	defer s.removeSSEClient(client)
+
+	if c.send(ctx, rpcMessage{Method: "connected"}) != nil {
+		return
+	}
+
+	// sendState sends the current state, after a resync notification if
+	// the client has missed events
+	sendState := func(resync bool) error {
+		if resync {
+			if err := c.send(ctx, rpcMessage{Method: "resync", Params: map[string]any{"lastEventId": client.cursor}}); err != nil {
+				return err
+			}
+		}
+		if client.wants(topicPlayer) {
+			for _, data := range s.initialStateEvents() {
+				if err := c.sendEvent(ctx, 0, data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// sendEvents sends the events the client hasn't seen
+	sendEvents := func() error {
+		events, ok := s.nextEvents(client)
+		if !ok {
+			return sendState(true)
+		}
+		for _, event := range events {
+			if err := c.sendEvent(ctx, event.id, event.data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if id, ok := lastEventID(r); ok {
+		// Replay what the client missed
+		client.cursor = id
+		err = sendEvents()
+	} else {
+		err = sendState(false)
+	}
+	if err != nil {
+		return
+	}
+
+	// Heartbeat ticker
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-client.notify:
+			if sendEvents() != nil {
+				return
+			}
+		case <-ticker.C:
+			// A ping message for clients that watch for silence, and a
+			// protocol ping to notice dead connections
+			if c.send(ctx, rpcMessage{Method: "ping"}) != nil {
+				return
+			}
+			pingCtx, pingCancel := context.WithTimeout(ctx, wsPingTimeout)
+			err := conn.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendEvent sends an event payload ({"type", "data"}) as an "event"
+// notification. Events sent as part of the current state have no ID.
+func (c *wsConn) sendEvent(ctx context.Context, id uint64, data []byte) error {
+	var event struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil
+	}
+	params := map[string]any{"type": event.Type}
+	if id != 0 {
+		params["id"] = id
+	}
+	if event.Data != nil {
+		params["data"] = event.Data
+	}
+	return c.send(ctx, rpcMessage{Method: "event", Params: params})
+}
+
+// readLoop reads requests until the connection closes. Each request runs in
+// its own goroutine, so a slow speaker call doesn't hold up the others;
+// responses are matched to requests by ID.
+func (c *wsConn) readLoop(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	for {
+		_, data, err := c.conn.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == -1 && !errors.Is(err, context.Canceled) {
+				log.Printf("WebSocket read failed: %v", err)
+			}
+			return
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			_ = c.send(ctx, rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, "Parse error: " + err.Error()}})
+			continue
+		}
+		if req.Method == "" {
+			_ = c.send(ctx, rpcMessage{ID: responseID(req.ID), Error: &rpcError{rpcInvalidRequest, "Invalid request: method is required"}})
+			continue
+		}
+		go c.handle(ctx, req)
+	}
+}
+
+// responseID returns the ID for a response, null when the request had none.
+func responseID(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// handle runs a request and sends the response. Requests without an ID are
+// notifications and get no response.
+func (c *wsConn) handle(ctx context.Context, req rpcRequest) {
+	result, rpcErr := c.call(ctx, req)
+	if len(req.ID) == 0 {
+		return
+	}
+	resp := rpcMessage{ID: req.ID, Result: result, Error: rpcErr}
+	if rpcErr == nil && result == nil {
+		resp.Result = map[string]any{}
+	}
+	_ = c.send(ctx, resp)
+}
+
+// call runs a request.
+func (c *wsConn) call(ctx context.Context, req rpcRequest) (any, *rpcError) {
+	if req.Method == "ping" {
+		return "pong", nil
+	}
+
+	var method, path string
+	var body []byte
+	if req.Method == "http" {
+		var params wsHTTPParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "Invalid params: " + err.Error()}
+		}
+		if !strings.HasPrefix(params.Path, "/api/") || params.Path == "/api/mcp" {
+			return nil, &rpcError{rpcInvalidParams, "Invalid params: path must be a REST endpoint under /api/"}
+		}
+		method, path, body = strings.ToUpper(params.Method), params.Path, params.Body
+		if method == "" {
+			method = http.MethodGet
+		}
+	} else {
+		route, ok := wsMethods[req.Method]
+		if !ok {
+			return nil, &rpcError{rpcMethodNotFound, "Method not found: " + req.Method}
+		}
+		method, path, body = route.method, route.path, req.Params
+		if strings.Contains(path, "{id}") {
+			var params struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(req.Params, &params) != nil || params.ID == "" {
+				return nil, &rpcError{rpcInvalidParams, "Invalid params: id is required"}
+			}
+			path = strings.Replace(path, "{id}", params.ID, 1)
+		}
+	}
+
+	status, respBody := c.dispatch(ctx, method, path, body)
+	if status >= http.StatusBadRequest {
+		return nil, &rpcError{status, errorMessage(status, respBody)}
+	}
+	var result any
+	if json.Unmarshal(respBody, &result) != nil {
+		result = strings.TrimSpace(string(respBody))
+	}
+	return result, nil
+}
+
+// dispatch calls a REST endpoint through the same authorization and audit
+// log as HTTP requests, and returns the response status and body.
+func (c *wsConn) dispatch(ctx context.Context, method, path string, body []byte) (int, []byte) {
+	// Tailnet identities come from the connection; everyone else is
+	// authenticated again from the upgrade request's credentials, so
+	// revoked tokens and expired sessions stop working
+	if id := auth.FromContext(ctx); id != nil && id.Method != auth.MethodTailscale {
+		ctx = auth.WithIdentity(ctx, nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusBadRequest, []byte(err.Error())
+	}
+	req.RemoteAddr = c.r.RemoteAddr
+	for _, header := range []string{"Authorization", "X-API-Key", "Cookie", "User-Agent"} {
+		if value := c.r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rw := &wsResponseWriter{header: http.Header{}, status: http.StatusOK}
+	c.s.apiHandler().ServeHTTP(rw, req)
+	return rw.status, rw.body.Bytes()
+}
+
+// wsResponseWriter collects the response of a REST handler.
+type wsResponseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *wsResponseWriter) Header() http.Header { return rw.header }
+
+func (rw *wsResponseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status, rw.wroteHeader = code, true
+	}
+}
+
+func (rw *wsResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.body.Write(b)
+}
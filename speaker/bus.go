@@ -0,0 +1,110 @@
+package speaker
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Bus delivers events to any number of subscribers. Publishing never
+// blocks: each subscriber has its own buffer, and an event that doesn't fit
+// is dropped for that subscriber only.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Delivery is an event as a subscriber receives it. Time is when it was
+// published, which can be a little earlier than when it is handled.
+type Delivery struct {
+	Event Event
+	Time  time.Time
+}
+
+// Subscription receives the events published after it was created.
+type Subscription struct {
+	bus   *Bus
+	name  string
+	ch    chan Delivery
+	ticks bool // receives position ticks, see IsTick
+
+	// Guarded by bus.mu
+	dropped  uint64
+	dropping bool // the last event was dropped, so the next drop isn't logged
+}
+
+// NewBus creates an event bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe adds a subscriber with room for buffer events. The name is used
+// in logs. Position ticks are left out; see SubscribeTicks.
+func (b *Bus) Subscribe(name string, buffer int) *Subscription {
+	return b.subscribe(name, buffer, false)
+}
+
+// SubscribeTicks is like Subscribe for subscribers that follow the playback
+// position, which also get the position ticks.
+func (b *Bus) SubscribeTicks(name string, buffer int) *Subscription {
+	return b.subscribe(name, buffer, true)
+}
+
+func (b *Bus) subscribe(name string, buffer int, ticks bool) *Subscription {
+	sub := &Subscription{bus: b, name: name, ch: make(chan Delivery, buffer), ticks: ticks}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers an event to all subscribers.
+func (b *Bus) Publish(event Event) {
+	if event == nil {
+		return
+	}
+	d := Delivery{Event: event, Time: time.Now()}
+	tick := IsTick(event)
+
+	// Drop counters are updated under the write lock
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if tick && !sub.ticks {
+			continue
+		}
+		select {
+		case sub.ch <- d:
+			sub.dropping = false
+		default:
+			sub.dropped++
+			if !sub.dropping {
+				log.Printf("Event bus: %s is not keeping up, dropping %s events", sub.name, event.EventType())
+			}
+			sub.dropping = true
+		}
+	}
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (s *Subscription) Events() <-chan Delivery {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+	return s.dropped
+}
+
+// Close unsubscribes and closes the events channel.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
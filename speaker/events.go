@@ -0,0 +1,146 @@
+package speaker
+
+import (
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+)
+
+// Event is a typed change published on a Bus. EventType is the name clients
+// know it by, e.g. the "type" of /events messages; the event itself is the
+// data.
+type Event interface {
+	EventType() string
+}
+
+// VolumeChanged reports the speaker volume.
+type VolumeChanged struct {
+	Volume int `json:"volume"`
+}
+
+// MuteChanged reports whether the speaker is muted.
+type MuteChanged struct {
+	Muted bool `json:"muted"`
+}
+
+// SourceChanged reports the input source, "standby" when the speaker is off.
+type SourceChanged struct {
+	Source kefw2.Source `json:"source"`
+}
+
+// PowerChanged reports the speaker status.
+type PowerChanged struct {
+	Status kefw2.SpeakerStatus `json:"status"`
+}
+
+// PlayerChanged reports the track and play state. Icon is the speaker's
+// URL. Position, AudioType and Live are only set when the player was read
+// from the speaker; its events don't carry them.
+type PlayerChanged struct {
+	State     string  `json:"state"`
+	Title     string  `json:"title"`
+	Artist    string  `json:"artist"`
+	Album     string  `json:"album"`
+	Duration  int     `json:"duration"`
+	Icon      string  `json:"icon"`
+	Position  *int64  `json:"position,omitempty"`
+	AudioType *string `json:"audioType,omitempty"`
+	Live      *bool   `json:"live,omitempty"`
+}
+
+// PositionChanged reports the playback position in milliseconds, either
+// from the speaker or counted on by kefw2ui (Interpolated).
+type PositionChanged struct {
+	Position     int64 `json:"position"`
+	Interpolated bool  `json:"interpolated,omitempty"`
+}
+
+// IsTick reports whether an event is a position tick: an interpolated
+// position, published every second during playback. Only subscribers that
+// follow the position get ticks, and they aren't kept for replay.
+func IsTick(event Event) bool {
+	e, ok := event.(PositionChanged)
+	return ok && e.Interpolated
+}
+
+// PlayModeChanged reports the shuffle/repeat mode.
+type PlayModeChanged struct {
+	Mode string `json:"mode"`
+}
+
+// QueueChanged reports changes to the play queue.
+type QueueChanged struct {
+	Changes []kefw2.PlaylistChange `json:"changes"`
+	Version int                    `json:"version"`
+}
+
+// HealthChanged reports whether the active speaker is reachable.
+type HealthChanged struct {
+	Connected bool `json:"connected"`
+}
+
+// ActiveSpeakerChanged reports the active speaker.
+type ActiveSpeakerChanged struct {
+	IP    string `json:"ip"`
+	Name  string `json:"name"`
+	Model string `json:"model"`
+}
+
+func (VolumeChanged) EventType() string        { return "volume" }
+func (MuteChanged) EventType() string          { return "mute" }
+func (SourceChanged) EventType() string        { return "source" }
+func (PowerChanged) EventType() string         { return "power" }
+func (PlayerChanged) EventType() string        { return "player" }
+func (PositionChanged) EventType() string      { return "playTime" }
+func (PlayModeChanged) EventType() string      { return "playMode" }
+func (QueueChanged) EventType() string         { return "queue" }
+func (HealthChanged) EventType() string        { return "speakerHealth" }
+func (ActiveSpeakerChanged) EventType() string { return "speaker" }
+
+// FromKEF converts an event from the speaker's event stream, or returns nil
+// for events kefw2ui doesn't use.
+func FromKEF(event kefw2.Event) Event {
+	switch e := event.(type) {
+	case *kefw2.VolumeEvent:
+		return VolumeChanged{Volume: e.Volume}
+	case *kefw2.MuteEvent:
+		return MuteChanged{Muted: e.Muted}
+	case *kefw2.SourceEvent:
+		return SourceChanged{Source: e.Source}
+	case *kefw2.PowerEvent:
+		return PowerChanged{Status: e.Status}
+	case *kefw2.PlayerDataEvent:
+		return PlayerChanged{
+			State:    e.State,
+			Title:    e.Title,
+			Artist:   e.Artist,
+			Album:    e.Album,
+			Duration: e.Duration,
+			Icon:     e.Icon,
+		}
+	case *kefw2.PlayTimeEvent:
+		return PositionChanged{Position: e.PositionMS}
+	case *kefw2.PlayModeEvent:
+		return PlayModeChanged{Mode: e.Mode}
+	case *kefw2.PlaylistEvent:
+		return QueueChanged{Changes: e.Changes, Version: e.Version}
+	}
+	return nil
+}
+
+// Changed returns the player state as a PlayerChanged event, with the
+// position at now.
+func (p PlayerState) Changed(now time.Time) PlayerChanged {
+	position := p.CurrentPosition(now)
+	return PlayerChanged{
+		State:     p.State,
+		Title:     p.Title,
+		Artist:    p.Artist,
+		Album:     p.Album,
+		Duration:  p.Duration,
+		Icon:      p.Icon,
+		Position:  &position,
+		AudioType: &p.AudioType,
+		Live:      &p.Live,
+	}
+}
@@ -21,6 +21,10 @@ type Manager struct {
 	onEvent  func(event kefw2.Event)
 	onHealth func(connected bool)
 
+	// Volume limit (quiet hours) and clamping callback, see volume.go
+	volumeLimit     func(ip string, t time.Time) (int, bool)
+	onVolumeClamped func(requested, limit int, origin string)
+
 	// Speaker connectivity state
 	speakerConnected bool
 
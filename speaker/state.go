@@ -0,0 +1,272 @@
+package speaker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+)
+
+const (
+	// StateMaxAge is how long state is served without querying the speaker
+	// again. Events keep it current in between; the limit catches changes
+	// that come without an event, such as the max volume set in the KEF app.
+	StateMaxAge = 5 * time.Minute
+
+	// stateQueryTimeout bounds a query shared by several readers, which
+	// can't use any one reader's context
+	stateQueryTimeout = 15 * time.Second
+)
+
+// State is the last known state of a speaker.
+type State struct {
+	Volume    int                 `json:"volume"`
+	Muted     bool                `json:"muted"`
+	Source    kefw2.Source        `json:"source"`
+	Power     kefw2.SpeakerStatus `json:"power"`
+	MaxVolume int                 `json:"maxVolume"`
+	Player    PlayerState         `json:"player"`
+
+	// SyncedAt is when the speaker was last queried, UpdatedAt when the
+	// state last changed from a query or an event
+	SyncedAt  time.Time `json:"syncedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Stale is set when the state may be out of date: the speaker couldn't
+	// be queried, or events were missed while it was unreachable
+	Stale bool `json:"stale"`
+}
+
+// PlayerState is the last known player state of a speaker.
+type PlayerState struct {
+	State     string `json:"state"`
+	Title     string `json:"title"`
+	Artist    string `json:"artist"`
+	Album     string `json:"album"`
+	Icon      string `json:"icon"` // speaker's URL, not proxied
+	Duration  int    `json:"duration"`
+	AudioType string `json:"audioType"`
+	Live      bool   `json:"live"`
+
+	// Position in milliseconds (-1 when stopped) as of PositionAt; see
+	// CurrentPosition
+	Position   int64     `json:"position"`
+	PositionAt time.Time `json:"positionAt"`
+}
+
+// CurrentPosition returns the position at now, counting on from the last
+// known position while playing, up to the end of the track.
+func (p PlayerState) CurrentPosition(now time.Time) int64 {
+	if p.State != kefw2.PlayerStatePlaying || p.Position < 0 || p.PositionAt.IsZero() {
+		return p.Position
+	}
+	position := p.Position + max(now.Sub(p.PositionAt).Milliseconds(), 0)
+	if p.Duration > 0 {
+		position = min(position, int64(p.Duration))
+	}
+	return position
+}
+
+// StateStore keeps the state of each speaker in memory, so reads don't
+// query the speaker every time. It is seeded by querying the speaker and
+// kept current with its events.
+type StateStore struct {
+	mu     sync.Mutex
+	states map[string]*stateEntry // by speaker IP
+}
+
+// stateEntry is the state of one speaker.
+type stateEntry struct {
+	state State
+	valid bool // queried since the last invalidation
+
+	// In-flight query, and the events received while it runs, which are
+	// applied to its result
+	query   *stateQuery
+	pending []kefw2.Event
+}
+
+// stateQuery is a query of the speaker shared by concurrent readers.
+type stateQuery struct {
+	done chan struct{}
+	err  error
+}
+
+// NewStateStore creates an empty state store.
+func NewStateStore() *StateStore {
+	return &StateStore{states: make(map[string]*stateEntry)}
+}
+
+// entry returns the entry of a speaker. Caller must hold st.mu.
+func (st *StateStore) entry(ip string) *stateEntry {
+	e, ok := st.states[ip]
+	if !ok {
+		e = &stateEntry{}
+		st.states[ip] = e
+	}
+	return e
+}
+
+// Get returns the state of spk, querying the speaker when the state is not
+// known, was invalidated or is older than StateMaxAge. Concurrent readers
+// share one query. When the query fails, the last known state is returned,
+// marked stale, along with the error.
+func (st *StateStore) Get(ctx context.Context, spk *kefw2.KEFSpeaker) (State, error) {
+	st.mu.Lock()
+	e := st.entry(spk.IPAddress)
+	if e.valid && time.Since(e.state.SyncedAt) < StateMaxAge {
+		state := e.state
+		st.mu.Unlock()
+		return state, nil
+	}
+	q := e.query
+	if q == nil {
+		q = &stateQuery{done: make(chan struct{})}
+		e.query = q
+		go st.run(spk, e, q)
+	}
+	st.mu.Unlock()
+
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		return st.Peek(spk.IPAddress), ctx.Err()
+	}
+	return st.Peek(spk.IPAddress), q.err
+}
+
+// Peek returns the state of a speaker without querying it.
+func (st *StateStore) Peek(ip string) State {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e := st.entry(ip)
+	state := e.state
+	state.Stale = state.Stale || !e.valid
+	return state
+}
+
+// run queries the speaker and stores the result.
+func (st *StateStore) run(spk *kefw2.KEFSpeaker, e *stateEntry, q *stateQuery) {
+	ctx, cancel := context.WithTimeout(context.Background(), stateQueryTimeout)
+	defer cancel()
+	state, err := queryState(ctx, spk)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err != nil {
+		e.state.Stale = true
+		q.err = err
+	} else {
+		e.state, e.valid = state, true
+		for _, event := range e.pending {
+			e.apply(event)
+		}
+	}
+	e.pending = nil
+	e.query = nil
+	close(q.done)
+}
+
+// queryState reads the state of a speaker. Only the source is required;
+// the speaker doesn't always answer the rest, e.g. on sources without a
+// player.
+func queryState(ctx context.Context, spk *kefw2.KEFSpeaker) (State, error) {
+	var state State
+	var err error
+	if state.Source, err = spk.Source(ctx); err != nil {
+		return state, err
+	}
+	state.Volume, _ = spk.GetVolume(ctx)
+	state.Muted, _ = spk.IsMuted(ctx)
+	state.Power, _ = spk.SpeakerState(ctx)
+	state.MaxVolume, _ = spk.GetMaxVolume(ctx)
+
+	state.Player = PlayerState{State: kefw2.PlayerStateStopped}
+	if data, err := spk.PlayerData(ctx); err == nil {
+		position, _ := spk.SongProgressMS(ctx)
+		state.Player = PlayerState{
+			State:      data.State,
+			Title:      data.TrackRoles.Title,
+			Artist:     data.TrackRoles.MediaData.MetaData.Artist,
+			Album:      data.TrackRoles.MediaData.MetaData.Album,
+			Icon:       data.TrackRoles.Icon,
+			Duration:   data.Status.Duration,
+			AudioType:  data.MediaRoles.AudioType,
+			Live:       data.MediaRoles.MediaData.MetaData.Live,
+			Position:   int64(position),
+			PositionAt: time.Now(),
+		}
+	}
+
+	state.SyncedAt = time.Now()
+	state.UpdatedAt = state.SyncedAt
+	return state, nil
+}
+
+// HandleEvent updates the state of the speaker at ip from one of its events.
+func (st *StateStore) HandleEvent(ip string, event kefw2.Event) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e := st.entry(ip)
+	if e.query != nil {
+		e.pending = append(e.pending, event)
+	}
+	e.apply(event)
+}
+
+// apply updates the state from an event. Caller must hold st.mu.
+func (e *stateEntry) apply(event kefw2.Event) {
+	s := &e.state
+	switch ev := event.(type) {
+	case *kefw2.VolumeEvent:
+		s.Volume = ev.Volume
+	case *kefw2.MuteEvent:
+		s.Muted = ev.Muted
+	case *kefw2.SourceEvent:
+		s.Source = ev.Source
+	case *kefw2.PowerEvent:
+		s.Power = ev.Status
+	case *kefw2.PlayerDataEvent:
+		// The event doesn't carry the audio type or whether the stream is
+		// live, so a new track is queried on the next read
+		now := time.Now()
+		if ev.Title != s.Player.Title || ev.Icon != s.Player.Icon {
+			e.valid = false
+			s.Player.Position, s.Player.PositionAt = 0, now
+		} else if ev.State != s.Player.State {
+			// Stop or restart the clock where it is
+			s.Player.Position, s.Player.PositionAt = s.Player.CurrentPosition(now), now
+		}
+		s.Player.State = ev.State
+		s.Player.Title = ev.Title
+		s.Player.Artist = ev.Artist
+		s.Player.Album = ev.Album
+		s.Player.Duration = ev.Duration
+		s.Player.Icon = ev.Icon
+	case *kefw2.PlayTimeEvent:
+		s.Player.Position = ev.PositionMS
+		s.Player.PositionAt = time.Now()
+	default:
+		return
+	}
+	s.UpdatedAt = time.Now()
+}
+
+// Update changes the state of a speaker after a change that the speaker
+// doesn't report with an event, such as the max volume.
+func (st *StateStore) Update(ip string, fn func(*State)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e := st.entry(ip)
+	fn(&e.state)
+	e.state.UpdatedAt = time.Now()
+}
+
+// Invalidate marks the state of a speaker as out of date, e.g. after its
+// event stream was interrupted, so the next read queries it.
+func (st *StateStore) Invalidate(ip string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entry(ip).valid = false
+}
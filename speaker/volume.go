@@ -0,0 +1,90 @@
+package speaker
+
+import (
+	"context"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+)
+
+// Origins of volume changes, reported when a change was limited.
+const (
+	OriginAPI          = "api"
+	OriginMCP          = "mcp"
+	OriginSpeaker      = "speaker" // remote, app, or any other client
+	OriginSubsonic     = "subsonic"
+	OriginUPnP         = "upnp"
+	OriginMPD          = "mpd"
+	OriginMQTT         = "mqtt"
+	OriginRule         = "rule"
+	OriginScene        = "scene"
+	OriginAnnouncement = "announcement"
+	OriginSourcePreset = "source preset"
+)
+
+// VolumeSetter sets the volume of a speaker within the volume limit and
+// returns the volume set.
+type VolumeSetter func(ctx context.Context, volume int) (int, error)
+
+// SetVolumeLimit sets the function that returns the highest volume allowed
+// on a speaker at a time, e.g. a quiet-hours cap. ok is false when there is
+// no limit.
+func (m *Manager) SetVolumeLimit(limit func(ip string, t time.Time) (limit int, ok bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.volumeLimit = limit
+}
+
+// SetVolumeClampedCallback sets the callback for volume changes lowered to
+// the limit.
+func (m *Manager) SetVolumeClampedCallback(cb func(requested, limit int, origin string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onVolumeClamped = cb
+}
+
+// VolumeLimit returns the highest volume allowed on spk now. ok is false when
+// there is no limit.
+func (m *Manager) VolumeLimit(spk *kefw2.KEFSpeaker) (limit int, ok bool) {
+	m.mu.RLock()
+	fn := m.volumeLimit
+	m.mu.RUnlock()
+
+	if fn == nil || spk == nil {
+		return 0, false
+	}
+	return fn(spk.IPAddress, time.Now())
+}
+
+// SetVolume sets the volume of spk, lowered to the volume limit, and returns
+// the volume set. Every volume change goes through here so the limit holds
+// no matter where it comes from; origin names the caller when the change is
+// reported as clamped.
+func (m *Manager) SetVolume(ctx context.Context, spk *kefw2.KEFSpeaker, volume int, origin string) (int, error) {
+	requested := volume
+	limit, ok := m.VolumeLimit(spk)
+	if ok && volume > limit {
+		volume = limit
+	}
+
+	if err := spk.SetVolume(ctx, volume); err != nil {
+		return volume, err
+	}
+
+	if volume < requested {
+		m.mu.RLock()
+		cb := m.onVolumeClamped
+		m.mu.RUnlock()
+		if cb != nil {
+			cb(requested, volume, origin)
+		}
+	}
+	return volume, nil
+}
+
+// VolumeSetter returns a VolumeSetter for spk that goes through SetVolume.
+func (m *Manager) VolumeSetter(spk *kefw2.KEFSpeaker, origin string) VolumeSetter {
+	return func(ctx context.Context, volume int) (int, error) {
+		return m.SetVolume(ctx, spk, volume, origin)
+	}
+}
@@ -0,0 +1,355 @@
+// Package stations manages user-defined internet radio stations for kefw2ui.
+//
+// Custom stations live alongside the Airable radio catalog in the browse UI
+// and are played by handing the stream URL straight to the speaker.
+package stations
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/ids"
+)
+
+// Path prefixes used to address custom stations in browse requests.
+const (
+	// ContainerPath is the browse path of the "My Stations" folder.
+	ContainerPath = "custom:stations"
+
+	// ItemPathPrefix prefixes the browse path of a single custom station.
+	ItemPathPrefix = "custom:station/"
+)
+
+// Station represents a user-defined internet radio station.
+type Station struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Logo      string    `json:"logo,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	MimeType  string    `json:"mimeType,omitempty"` // Optional; guessed from the URL when empty
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Path returns the browse path for the station.
+func (st *Station) Path() string {
+	return ItemPathPrefix + st.ID
+}
+
+// ContentItem converts the station to a kefw2 ContentItem suitable for
+// PlayUPnPTracks and AddToQueue.
+func (st *Station) ContentItem() kefw2.ContentItem {
+	item := StreamItem(st.URL, st.Name, "", st.Logo, st.MimeType)
+	item.AudioType = "audioBroadcast"
+	item.MediaData.MetaData.Live = true
+	if len(st.Tags) > 0 {
+		item.MediaData.MetaData.Genre = strings.Join(st.Tags, ", ")
+	}
+	return item
+}
+
+// Matches reports whether the station name or one of its tags contains query
+// (case-insensitive).
+func (st *Station) Matches(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(st.Name), q) {
+		return true
+	}
+	for _, tag := range st.Tags {
+		if strings.Contains(strings.ToLower(tag), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStationPath reports whether path addresses a custom station.
+func IsStationPath(path string) bool {
+	return strings.HasPrefix(path, ItemPathPrefix)
+}
+
+// IDFromPath extracts the station ID from a custom station browse path.
+func IDFromPath(path string) string {
+	return strings.TrimPrefix(path, ItemPathPrefix)
+}
+
+// ValidateURL checks that rawURL is an absolute HTTP(S) URL.
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q (must be http or https)", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL is missing a host")
+	}
+	return nil
+}
+
+// StreamItem builds a ContentItem for an arbitrary HTTP(S) audio URL.
+// If mimeType is empty it is guessed from the URL's file extension.
+func StreamItem(streamURL, title, artist, icon, mimeType string) kefw2.ContentItem {
+	if title == "" {
+		title = streamURL
+	}
+	if mimeType == "" {
+		mimeType = GuessMimeType(streamURL)
+	}
+
+	return kefw2.ContentItem{
+		Title: title,
+		Type:  "audio",
+		Path:  streamURL,
+		Icon:  icon,
+		MediaData: &kefw2.MediaData{
+			MetaData: kefw2.MediaMetaData{
+				Artist:    artist,
+				ServiceID: "UPnP",
+			},
+			Resources: []kefw2.MediaResource{
+				{
+					URI:      streamURL,
+					MimeType: mimeType,
+				},
+			},
+		},
+	}
+}
+
+// GuessMimeType returns an audio MIME type based on the URL's file extension,
+// falling back to audio/mpeg which most Icecast/Shoutcast streams use.
+func GuessMimeType(streamURL string) string {
+	p := streamURL
+	if u, err := url.Parse(streamURL); err == nil {
+		p = u.Path
+	}
+
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".aac":
+		return "audio/aac"
+	case ".m4a", ".mp4":
+		return "audio/mp4"
+	case ".flac":
+		return "audio/flac"
+	case ".ogg", ".oga", ".opus":
+		return "audio/ogg"
+	case ".wav":
+		return "audio/wav"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".m3u":
+		return "audio/x-mpegurl"
+	case ".pls":
+		return "audio/x-scpls"
+	default:
+		return "audio/mpeg"
+	}
+}
+
+// Manager handles custom station storage and retrieval.
+type Manager struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewManager creates a new station manager.
+func NewManager() (*Manager, error) {
+	path, err := config.StationsPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stations path: %w", err)
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return &Manager{path: path}, nil
+}
+
+// List returns all custom stations in the order they were added.
+func (m *Manager) List() ([]Station, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.load()
+}
+
+// Get retrieves a station by ID.
+func (m *Manager) Get(id string) (*Station, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stations {
+		if stations[i].ID == id {
+			return &stations[i], nil
+		}
+	}
+	return nil, fmt.Errorf("station not found: %s", id)
+}
+
+// Create adds a new station.
+func (m *Manager) Create(name, streamURL, logo string, tags []string, mimeType string) (*Station, error) {
+	if name == "" {
+		return nil, fmt.Errorf("station name is required")
+	}
+	if err := ValidateURL(streamURL); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	id := ids.FromName(name, "station")
+	for _, st := range stations {
+		if st.ID == id {
+			id = fmt.Sprintf("%s-%d", id, time.Now().Unix())
+			break
+		}
+	}
+
+	now := time.Now()
+	station := Station{
+		ID:        id,
+		Name:      name,
+		URL:       strings.TrimSpace(streamURL),
+		Logo:      logo,
+		Tags:      tags,
+		MimeType:  mimeType,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	stations = append(stations, station)
+	if err := m.save(stations); err != nil {
+		return nil, err
+	}
+
+	return &station, nil
+}
+
+// Update updates an existing station. Empty name, URL, logo and MIME type
+// leave the current value unchanged; a nil tags slice keeps the existing
+// tags.
+func (m *Manager) Update(id, name, streamURL, logo string, tags []string, mimeType string) (*Station, error) {
+	if streamURL != "" {
+		if err := ValidateURL(streamURL); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stations {
+		if stations[i].ID != id {
+			continue
+		}
+
+		st := &stations[i]
+		if name != "" {
+			st.Name = name
+		}
+		if streamURL != "" {
+			st.URL = strings.TrimSpace(streamURL)
+		}
+		if logo != "" {
+			st.Logo = logo
+		}
+		if tags != nil {
+			st.Tags = tags
+		}
+		if mimeType != "" {
+			st.MimeType = mimeType
+		}
+		st.UpdatedAt = time.Now()
+
+		if err := m.save(stations); err != nil {
+			return nil, err
+		}
+		return st, nil
+	}
+
+	return nil, fmt.Errorf("station not found: %s", id)
+}
+
+// Delete removes a station.
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stations, err := m.load()
+	if err != nil {
+		return err
+	}
+
+	for i := range stations {
+		if stations[i].ID == id {
+			stations = append(stations[:i], stations[i+1:]...)
+			return m.save(stations)
+		}
+	}
+
+	return fmt.Errorf("station not found: %s", id)
+}
+
+// load reads all stations from disk. Caller must hold m.mu.
+func (m *Manager) load() ([]Station, error) {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Station{}, nil
+		}
+		return nil, fmt.Errorf("failed to read stations: %w", err)
+	}
+
+	var stations []Station
+	if err := json.Unmarshal(data, &stations); err != nil {
+		return nil, fmt.Errorf("failed to parse stations: %w", err)
+	}
+
+	return stations, nil
+}
+
+// save writes all stations to disk. Caller must hold m.mu.
+func (m *Manager) save(stations []Station) error {
+	data, err := json.MarshalIndent(stations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stations: %w", err)
+	}
+
+	if err := os.WriteFile(m.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write stations: %w", err)
+	}
+
+	return nil
+}
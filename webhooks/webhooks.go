@@ -0,0 +1,341 @@
+// Package webhooks delivers speaker events to configured HTTP endpoints.
+//
+// Each delivery is a JSON POST:
+//
+//	{"id": "...", "type": "track.changed", "timestamp": "...",
+//	 "speaker": {"name", "ip", "model"}, "data": {...}}
+//
+// signed with the webhook's secret. The X-Kefw2ui-Signature header carries
+// "sha256=" followed by the hex HMAC-SHA256 of the X-Kefw2ui-Timestamp value,
+// a ".", and the raw request body. Failed deliveries (network errors, 429 and
+// 5xx responses) are retried with exponential backoff.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hilli/go-kef-w2/kefw2"
+
+	"github.com/hilli/kefw2ui/config"
+	"github.com/hilli/kefw2ui/ids"
+	"github.com/hilli/kefw2ui/speaker"
+)
+
+// Event types.
+const (
+	EventTrackChanged        = "track.changed"
+	EventSourceChanged       = "source.changed"
+	EventPowerChanged        = "power.changed"
+	EventSpeakerDisconnected = "speaker.disconnected"
+	EventSpeakerReconnected  = "speaker.reconnected"
+	EventReindexCompleted    = "reindex.completed"
+	EventTest                = "test"
+)
+
+// EventTypes lists the event types a webhook can subscribe to.
+var EventTypes = []string{
+	EventTrackChanged,
+	EventSourceChanged,
+	EventPowerChanged,
+	EventSpeakerDisconnected,
+	EventSpeakerReconnected,
+	EventReindexCompleted,
+}
+
+const (
+	// maxAttempts bounds delivery attempts; retries wait 1s, 2s, 4s, 8s
+	maxAttempts    = 5
+	initialBackoff = time.Second
+
+	// attemptTimeout bounds a single delivery request
+	attemptTimeout = 10 * time.Second
+
+	// logSize is the number of deliveries kept per webhook
+	logSize = 50
+)
+
+// Delivery records the outcome of one event delivery.
+type Delivery struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	Timestamp  time.Time `json:"timestamp"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMS int64     `json:"durationMs"`
+}
+
+// payload is the JSON body of a delivery.
+type payload struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	Timestamp time.Time    `json:"timestamp"`
+	Speaker   *speakerInfo `json:"speaker,omitempty"`
+	Data      any          `json:"data,omitempty"`
+}
+
+type speakerInfo struct {
+	Name  string `json:"name"`
+	IP    string `json:"ip"`
+	Model string `json:"model"`
+}
+
+// Dispatcher turns speaker events into webhook deliveries.
+type Dispatcher struct {
+	config  *config.Config
+	manager *speaker.Manager
+	client  *http.Client
+
+	mu           sync.Mutex
+	deliveries   map[string][]Delivery // by webhook ID, newest first
+	track        string                // last delivered track, to skip duplicates
+	source       kefw2.Source
+	powered      *bool
+	disconnected bool
+}
+
+// New creates a dispatcher for the webhooks in cfg.
+func New(cfg *config.Config, manager *speaker.Manager) *Dispatcher {
+	return &Dispatcher{
+		config:     cfg,
+		manager:    manager,
+		client:     &http.Client{Timeout: attemptTimeout},
+		deliveries: make(map[string][]Delivery),
+	}
+}
+
+// HandleEvent delivers track, source and power changes, and speaker
+// disconnects and reconnects. The speaker repeats player data for position
+// and state updates, so only actual changes are sent. A change of the active
+// speaker resets change tracking so the new speaker's state is delivered.
+func (d *Dispatcher) HandleEvent(event speaker.Event) {
+	switch e := event.(type) {
+	case speaker.PlayerChanged:
+		key := e.Title + "\x00" + e.Artist + "\x00" + e.Album
+		d.mu.Lock()
+		changed := e.Title != "" && key != d.track
+		d.track = key
+		d.mu.Unlock()
+		if changed {
+			d.Emit(EventTrackChanged, map[string]any{
+				"title":    e.Title,
+				"artist":   e.Artist,
+				"album":    e.Album,
+				"duration": e.Duration,
+				"icon":     e.Icon,
+				"state":    e.State,
+			})
+		}
+
+	case speaker.SourceChanged:
+		d.mu.Lock()
+		changed := e.Source != d.source
+		d.source = e.Source
+		d.mu.Unlock()
+		if changed {
+			d.Emit(EventSourceChanged, map[string]any{"source": string(e.Source)})
+		}
+		d.setPower(e.Source != kefw2.SourceStandby)
+
+	case speaker.PowerChanged:
+		d.setPower(e.Status != kefw2.SpeakerStatusStandby)
+
+	case speaker.HealthChanged:
+		d.setConnected(e.Connected)
+
+	case speaker.ActiveSpeakerChanged:
+		d.mu.Lock()
+		d.track = ""
+		d.source = ""
+		d.powered = nil
+		d.disconnected = false
+		d.mu.Unlock()
+	}
+}
+
+// setPower emits power.changed when the power state differs from the last
+// one seen.
+func (d *Dispatcher) setPower(on bool) {
+	d.mu.Lock()
+	changed := d.powered == nil || *d.powered != on
+	d.powered = &on
+	d.mu.Unlock()
+	if changed {
+		d.Emit(EventPowerChanged, map[string]any{"on": on})
+	}
+}
+
+// setConnected delivers speaker disconnects, and reconnects that follow
+// them.
+func (d *Dispatcher) setConnected(connected bool) {
+	d.mu.Lock()
+	wasDisconnected := d.disconnected
+	d.disconnected = !connected
+	d.mu.Unlock()
+
+	switch {
+	case !connected && !wasDisconnected:
+		d.Emit(EventSpeakerDisconnected, nil)
+	case connected && wasDisconnected:
+		d.Emit(EventSpeakerReconnected, nil)
+	}
+}
+
+// Emit delivers an event to every enabled webhook subscribed to it. Delivery
+// happens in the background.
+func (d *Dispatcher) Emit(eventType string, data any) {
+	p := d.newPayload(eventType, data)
+	for _, wh := range d.config.GetWebhooks() {
+		if wh.Disabled || !subscribed(wh, eventType) {
+			continue
+		}
+		go d.deliver(wh, p, maxAttempts)
+	}
+}
+
+// SendTest delivers a test event to a webhook with a single attempt and
+// returns the result.
+func (d *Dispatcher) SendTest(id string) (Delivery, error) {
+	wh := d.config.FindWebhook(id)
+	if wh == nil {
+		return Delivery{}, fmt.Errorf("webhook not found: %s", id)
+	}
+	p := d.newPayload(EventTest, map[string]any{"message": "Test event from kefw2ui"})
+	return d.deliver(*wh, p, 1), nil
+}
+
+// Deliveries returns the recent deliveries of a webhook, newest first.
+func (d *Dispatcher) Deliveries(id string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.deliveries[id])
+}
+
+// Forget drops the delivery log of a removed webhook.
+func (d *Dispatcher) Forget(id string) {
+	d.mu.Lock()
+	delete(d.deliveries, id)
+	d.mu.Unlock()
+}
+
+func subscribed(wh config.WebhookConfig, eventType string) bool {
+	return len(wh.Events) == 0 || eventType == EventTest || slices.Contains(wh.Events, eventType)
+}
+
+func (d *Dispatcher) newPayload(eventType string, data any) payload {
+	p := payload{
+		ID:        ids.Random(8),
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+	if d.manager != nil {
+		if spk := d.manager.GetActiveSpeaker(); spk != nil {
+			p.Speaker = &speakerInfo{Name: spk.Name, IP: spk.IPAddress, Model: spk.Model}
+		}
+	}
+	return p
+}
+
+// deliver posts the payload, retrying with backoff up to attempts times, and
+// records the outcome.
+func (d *Dispatcher) deliver(wh config.WebhookConfig, p payload, attempts int) Delivery {
+	result := Delivery{ID: p.ID, Event: p.Type, Timestamp: p.Timestamp}
+	start := time.Now()
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		result.Error = err.Error()
+		d.record(wh.ID, result)
+		return result
+	}
+
+	backoff := initialBackoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		result.Attempts = attempt
+		retry := false
+		result.StatusCode, err = d.post(wh, p, body)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+			retry = true
+		case result.StatusCode >= 200 && result.StatusCode < 300:
+			result.Error = ""
+			result.Success = true
+		default:
+			result.Error = http.StatusText(result.StatusCode)
+			retry = result.StatusCode == http.StatusTooManyRequests || result.StatusCode >= 500
+		}
+		if !retry || attempt == attempts {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	result.DurationMS = time.Since(start).Milliseconds()
+	if !result.Success {
+		log.Printf("Webhook %s: %s delivery failed after %d attempt(s): %s", wh.ID, p.Type, result.Attempts, result.Error)
+	}
+	d.record(wh.ID, result)
+	return result
+}
+
+// post makes one signed delivery request and returns the response status.
+func (d *Dispatcher) post(wh config.WebhookConfig, p payload, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), attemptTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(p.Timestamp.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kefw2ui-webhooks")
+	req.Header.Set("X-Kefw2ui-Event", p.Type)
+	req.Header.Set("X-Kefw2ui-Delivery", p.ID)
+	req.Header.Set("X-Kefw2ui-Timestamp", timestamp)
+	req.Header.Set("X-Kefw2ui-Signature", "sha256="+Sign(wh.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp + "." + body keyed by secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) record(id string, delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := append([]Delivery{delivery}, d.deliveries[id]...)
+	if len(entries) > logSize {
+		entries = entries[:logSize]
+	}
+	d.deliveries[id] = entries
+}
@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hilli/kefw2ui/config"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"secret", "1700000000", `{"type":"test"}`, "5164242d2d7c1061af198b4bfea622c8f5aeec1b9276e38d50a14d7f9dd39bee"},
+		{"s3cr3t", "1761000000", `{}`, "168d9d21846964d497807ef72035d7f3c7a529f255ed3f116c343ff090fd72c6"},
+		{"", "0", "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+
+	for _, tt := range tests {
+		if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign(%q, %q, %q) = %s, want %s", tt.secret, tt.timestamp, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestSignChangesWithInput(t *testing.T) {
+	base := Sign("secret", "1700000000", []byte(`{"a":1}`))
+	for name, sig := range map[string]string{
+		"secret":    Sign("Secret", "1700000000", []byte(`{"a":1}`)),
+		"timestamp": Sign("secret", "1700000001", []byte(`{"a":1}`)),
+		"body":      Sign("secret", "1700000000", []byte(`{"a":2}`)),
+		// The separator keeps the timestamp from running into the body
+		"boundary": Sign("secret", "170000000", []byte(`0{"a":1}`)),
+	} {
+		if sig == base {
+			t.Errorf("changing the %s doesn't change the signature", name)
+		}
+	}
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	const secret = "0123456789abcdef"
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header.Clone(), body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{Webhooks: []config.WebhookConfig{{ID: "hook", Name: "Hook", URL: srv.URL, Secret: secret}}}
+	d := New(cfg, nil)
+
+	delivery, err := d.SendTest("hook")
+	if err != nil {
+		t.Fatalf("SendTest: %v", err)
+	}
+	if !delivery.Success || delivery.StatusCode != http.StatusNoContent || delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v", delivery)
+	}
+
+	req := <-requests
+	timestamp := req.header.Get("X-Kefw2ui-Timestamp")
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("X-Kefw2ui-Timestamp = %q", timestamp)
+	}
+	want := "sha256=" + Sign(secret, timestamp, req.body)
+	if got := req.header.Get("X-Kefw2ui-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("X-Kefw2ui-Signature = %q, want %q", got, want)
+	}
+	if got := req.header.Get("X-Kefw2ui-Event"); got != EventTest {
+		t.Errorf("X-Kefw2ui-Event = %q, want %q", got, EventTest)
+	}
+
+	var p payload
+	if err := json.Unmarshal(req.body, &p); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if p.ID != delivery.ID || req.header.Get("X-Kefw2ui-Delivery") != p.ID {
+		t.Errorf("delivery ID %q, header %q, body %q", delivery.ID, req.header.Get("X-Kefw2ui-Delivery"), p.ID)
+	}
+	if got := d.Deliveries("hook"); len(got) != 1 || got[0].ID != delivery.ID {
+		t.Errorf("Deliveries = %+v", got)
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  string
+		want   bool
+	}{
+		{"all events", nil, EventTrackChanged, true},
+		{"listed", []string{EventSourceChanged, EventTrackChanged}, EventTrackChanged, true},
+		{"not listed", []string{EventSourceChanged}, EventTrackChanged, false},
+		{"test always", []string{EventSourceChanged}, EventTest, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := config.WebhookConfig{Events: tt.events}
+			if got := subscribed(wh, tt.event); got != tt.want {
+				t.Errorf("subscribed(%v, %q) = %v, want %v", tt.events, tt.event, got, tt.want)
+			}
+		})
+	}
+}